@@ -209,6 +209,9 @@ type UpdatePolicyRequest struct {
 	Target     string `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`
 	Krb5Cc     string `protobuf:"bytes,4,opt,name=krb5cc,proto3" json:"krb5cc,omitempty"`
 	Purge      bool   `protobuf:"varint,5,opt,name=purge,proto3" json:"purge,omitempty"`
+	DryRun     bool   `protobuf:"varint,6,opt,name=dryRun,proto3" json:"dryRun,omitempty"` // Only report the changes which would be made, without applying them
+	Force      bool   `protobuf:"varint,7,opt,name=force,proto3" json:"force,omitempty"`   // Apply again policies which did not change since last update
+	Login      bool   `protobuf:"varint,8,opt,name=login,proto3" json:"login,omitempty"`   // Update made when the user logs in, which can apply the cached policies first
 }
 
 func (x *UpdatePolicyRequest) Reset() {
@@ -278,6 +281,27 @@ func (x *UpdatePolicyRequest) GetPurge() bool {
 	return false
 }
 
+func (x *UpdatePolicyRequest) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *UpdatePolicyRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+func (x *UpdatePolicyRequest) GetLogin() bool {
+	if x != nil {
+		return x.Login
+	}
+	return false
+}
+
 type DumpPoliciesRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -287,6 +311,7 @@ type DumpPoliciesRequest struct {
 	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
 	Details    bool   `protobuf:"varint,3,opt,name=details,proto3" json:"details,omitempty"` // Show rules in addition to GPO
 	All        bool   `protobuf:"varint,4,opt,name=all,proto3" json:"all,omitempty"`         // Show overridden rules
+	Format     string `protobuf:"bytes,5,opt,name=format,proto3" json:"format,omitempty"`    // Output format: text (default), json or yaml
 }
 
 func (x *DumpPoliciesRequest) Reset() {
@@ -349,6 +374,454 @@ func (x *DumpPoliciesRequest) GetAll() bool {
 	return false
 }
 
+func (x *DumpPoliciesRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type ExplainPolicyRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+	Key        string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"` // Policy type followed by the key, like dconf/path/to/key
+}
+
+func (x *ExplainPolicyRequest) Reset() {
+	*x = ExplainPolicyRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ExplainPolicyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExplainPolicyRequest) ProtoMessage() {}
+
+func (x *ExplainPolicyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExplainPolicyRequest.ProtoReflect.Descriptor instead.
+func (*ExplainPolicyRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExplainPolicyRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ExplainPolicyRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+func (x *ExplainPolicyRequest) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+type PoliciesReportRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+	Format     string `protobuf:"bytes,3,opt,name=format,proto3" json:"format,omitempty"` // Report format: html (default) or json
+}
+
+func (x *PoliciesReportRequest) Reset() {
+	*x = PoliciesReportRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PoliciesReportRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoliciesReportRequest) ProtoMessage() {}
+
+func (x *PoliciesReportRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoliciesReportRequest.ProtoReflect.Descriptor instead.
+func (*PoliciesReportRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *PoliciesReportRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *PoliciesReportRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+func (x *PoliciesReportRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type PoliciesStatusRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+}
+
+func (x *PoliciesStatusRequest) Reset() {
+	*x = PoliciesStatusRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PoliciesStatusRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PoliciesStatusRequest) ProtoMessage() {}
+
+func (x *PoliciesStatusRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PoliciesStatusRequest.ProtoReflect.Descriptor instead.
+func (*PoliciesStatusRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PoliciesStatusRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *PoliciesStatusRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+type CheckPoliciesDriftRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+	All        bool   `protobuf:"varint,3,opt,name=all,proto3" json:"all,omitempty"`   // Check the machine and all the connected users
+	Heal       bool   `protobuf:"varint,4,opt,name=heal,proto3" json:"heal,omitempty"` // Apply again the policies which drifted
+}
+
+func (x *CheckPoliciesDriftRequest) Reset() {
+	*x = CheckPoliciesDriftRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CheckPoliciesDriftRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckPoliciesDriftRequest) ProtoMessage() {}
+
+func (x *CheckPoliciesDriftRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckPoliciesDriftRequest.ProtoReflect.Descriptor instead.
+func (*CheckPoliciesDriftRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *CheckPoliciesDriftRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *CheckPoliciesDriftRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+func (x *CheckPoliciesDriftRequest) GetAll() bool {
+	if x != nil {
+		return x.All
+	}
+	return false
+}
+
+func (x *CheckPoliciesDriftRequest) GetHeal() bool {
+	if x != nil {
+		return x.Heal
+	}
+	return false
+}
+
+type ListPoliciesHistoryRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+}
+
+func (x *ListPoliciesHistoryRequest) Reset() {
+	*x = ListPoliciesHistoryRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPoliciesHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPoliciesHistoryRequest) ProtoMessage() {}
+
+func (x *ListPoliciesHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPoliciesHistoryRequest.ProtoReflect.Descriptor instead.
+func (*ListPoliciesHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ListPoliciesHistoryRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *ListPoliciesHistoryRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+type DiffPoliciesHistoryRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+	From       int64  `protobuf:"varint,3,opt,name=from,proto3" json:"from,omitempty"` // Generation to compare from
+	To         int64  `protobuf:"varint,4,opt,name=to,proto3" json:"to,omitempty"`     // Generation to compare to
+}
+
+func (x *DiffPoliciesHistoryRequest) Reset() {
+	*x = DiffPoliciesHistoryRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DiffPoliciesHistoryRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DiffPoliciesHistoryRequest) ProtoMessage() {}
+
+func (x *DiffPoliciesHistoryRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DiffPoliciesHistoryRequest.ProtoReflect.Descriptor instead.
+func (*DiffPoliciesHistoryRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DiffPoliciesHistoryRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *DiffPoliciesHistoryRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+func (x *DiffPoliciesHistoryRequest) GetFrom() int64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *DiffPoliciesHistoryRequest) GetTo() int64 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+type RollbackPoliciesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Target     string `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	IsComputer bool   `protobuf:"varint,2,opt,name=isComputer,proto3" json:"isComputer,omitempty"`
+	Generation int64  `protobuf:"varint,3,opt,name=generation,proto3" json:"generation,omitempty"` // Generation of the history to apply again
+}
+
+func (x *RollbackPoliciesRequest) Reset() {
+	*x = RollbackPoliciesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_adsys_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RollbackPoliciesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RollbackPoliciesRequest) ProtoMessage() {}
+
+func (x *RollbackPoliciesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_adsys_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RollbackPoliciesRequest.ProtoReflect.Descriptor instead.
+func (*RollbackPoliciesRequest) Descriptor() ([]byte, []int) {
+	return file_adsys_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RollbackPoliciesRequest) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *RollbackPoliciesRequest) GetIsComputer() bool {
+	if x != nil {
+		return x.IsComputer
+	}
+	return false
+}
+
+func (x *RollbackPoliciesRequest) GetGeneration() int64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
 type DumpPolicyDefinitionsRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -361,7 +834,7 @@ type DumpPolicyDefinitionsRequest struct {
 func (x *DumpPolicyDefinitionsRequest) Reset() {
 	*x = DumpPolicyDefinitionsRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_adsys_proto_msgTypes[6]
+		mi := &file_adsys_proto_msgTypes[13]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -374,7 +847,7 @@ func (x *DumpPolicyDefinitionsRequest) String() string {
 func (*DumpPolicyDefinitionsRequest) ProtoMessage() {}
 
 func (x *DumpPolicyDefinitionsRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_adsys_proto_msgTypes[6]
+	mi := &file_adsys_proto_msgTypes[13]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -387,7 +860,7 @@ func (x *DumpPolicyDefinitionsRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DumpPolicyDefinitionsRequest.ProtoReflect.Descriptor instead.
 func (*DumpPolicyDefinitionsRequest) Descriptor() ([]byte, []int) {
-	return file_adsys_proto_rawDescGZIP(), []int{6}
+	return file_adsys_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *DumpPolicyDefinitionsRequest) GetFormat() string {
@@ -416,7 +889,7 @@ type DumpPolicyDefinitionsResponse struct {
 func (x *DumpPolicyDefinitionsResponse) Reset() {
 	*x = DumpPolicyDefinitionsResponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_adsys_proto_msgTypes[7]
+		mi := &file_adsys_proto_msgTypes[14]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -429,7 +902,7 @@ func (x *DumpPolicyDefinitionsResponse) String() string {
 func (*DumpPolicyDefinitionsResponse) ProtoMessage() {}
 
 func (x *DumpPolicyDefinitionsResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_adsys_proto_msgTypes[7]
+	mi := &file_adsys_proto_msgTypes[14]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -442,7 +915,7 @@ func (x *DumpPolicyDefinitionsResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use DumpPolicyDefinitionsResponse.ProtoReflect.Descriptor instead.
 func (*DumpPolicyDefinitionsResponse) Descriptor() ([]byte, []int) {
-	return file_adsys_proto_rawDescGZIP(), []int{7}
+	return file_adsys_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *DumpPolicyDefinitionsResponse) GetAdmx() string {
@@ -470,7 +943,7 @@ type GetDocRequest struct {
 func (x *GetDocRequest) Reset() {
 	*x = GetDocRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_adsys_proto_msgTypes[8]
+		mi := &file_adsys_proto_msgTypes[15]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -483,7 +956,7 @@ func (x *GetDocRequest) String() string {
 func (*GetDocRequest) ProtoMessage() {}
 
 func (x *GetDocRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_adsys_proto_msgTypes[8]
+	mi := &file_adsys_proto_msgTypes[15]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -496,7 +969,7 @@ func (x *GetDocRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetDocRequest.ProtoReflect.Descriptor instead.
 func (*GetDocRequest) Descriptor() ([]byte, []int) {
-	return file_adsys_proto_rawDescGZIP(), []int{8}
+	return file_adsys_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *GetDocRequest) GetChapter() string {
@@ -517,7 +990,7 @@ type ListDocReponse struct {
 func (x *ListDocReponse) Reset() {
 	*x = ListDocReponse{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_adsys_proto_msgTypes[9]
+		mi := &file_adsys_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -530,7 +1003,7 @@ func (x *ListDocReponse) String() string {
 func (*ListDocReponse) ProtoMessage() {}
 
 func (x *ListDocReponse) ProtoReflect() protoreflect.Message {
-	mi := &file_adsys_proto_msgTypes[9]
+	mi := &file_adsys_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -543,7 +1016,7 @@ func (x *ListDocReponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListDocReponse.ProtoReflect.Descriptor instead.
 func (*ListDocReponse) Descriptor() ([]byte, []int) {
-	return file_adsys_proto_rawDescGZIP(), []int{9}
+	return file_adsys_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *ListDocReponse) GetChapters() []string {
@@ -564,7 +1037,7 @@ var file_adsys_proto_rawDesc = []byte{
 	0x74, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
 	0x52, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x22, 0x22, 0x0a, 0x0e, 0x53, 0x74, 0x72, 0x69, 0x6e,
 	0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x10, 0x0a, 0x03, 0x6d, 0x73, 0x67,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x22, 0x8d, 0x01, 0x0a, 0x13,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6d, 0x73, 0x67, 0x22, 0xd1, 0x01, 0x0a, 0x13,
 	0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x65, 0x71, 0x75,
 	0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65,
 	0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75,
@@ -573,46 +1046,126 @@ var file_adsys_proto_rawDesc = []byte{
 	0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x16, 0x0a,
 	0x06, 0x6b, 0x72, 0x62, 0x35, 0x63, 0x63, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x6b,
 	0x72, 0x62, 0x35, 0x63, 0x63, 0x12, 0x14, 0x0a, 0x05, 0x70, 0x75, 0x72, 0x67, 0x65, 0x18, 0x05,
-	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x70, 0x75, 0x72, 0x67, 0x65, 0x22, 0x79, 0x0a, 0x13, 0x44,
-	0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65,
-	0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73,
-	0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a,
-	0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x64, 0x65,
-	0x74, 0x61, 0x69, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x64, 0x65, 0x74,
-	0x61, 0x69, 0x6c, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x6c, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x08, 0x52, 0x03, 0x61, 0x6c, 0x6c, 0x22, 0x52, 0x0a, 0x1c, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f,
-	0x6c, 0x69, 0x63, 0x79, 0x44, 0x65, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x1a,
-	0x0a, 0x08, 0x64, 0x69, 0x73, 0x74, 0x72, 0x6f, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x08, 0x64, 0x69, 0x73, 0x74, 0x72, 0x6f, 0x49, 0x44, 0x22, 0x47, 0x0a, 0x1d, 0x44, 0x75,
-	0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x44, 0x65, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x69,
-	0x6f, 0x6e, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x61,
-	0x64, 0x6d, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x64, 0x6d, 0x78, 0x12,
-	0x12, 0x0a, 0x04, 0x61, 0x64, 0x6d, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61,
-	0x64, 0x6d, 0x6c, 0x22, 0x29, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x44, 0x6f, 0x63, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x68, 0x61, 0x70, 0x74, 0x65, 0x72, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x68, 0x61, 0x70, 0x74, 0x65, 0x72, 0x22, 0x2c,
-	0x0a, 0x0e, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x6f, 0x63, 0x52, 0x65, 0x70, 0x6f, 0x6e, 0x73, 0x65,
-	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x70, 0x74, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03,
-	0x28, 0x09, 0x52, 0x08, 0x63, 0x68, 0x61, 0x70, 0x74, 0x65, 0x72, 0x73, 0x32, 0xc0, 0x04, 0x0a,
-	0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x20, 0x0a, 0x03, 0x43, 0x61, 0x74, 0x12,
-	0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67,
-	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x24, 0x0a, 0x07, 0x56, 0x65,
-	0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0f, 0x2e,
-	0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01,
-	0x12, 0x23, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x06, 0x2e, 0x45, 0x6d, 0x70,
-	0x74, 0x79, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f,
-	0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x1e, 0x0a, 0x04, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x0c, 0x2e,
-	0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x06, 0x2e, 0x45, 0x6d,
-	0x70, 0x74, 0x79, 0x30, 0x01, 0x12, 0x2e, 0x0a, 0x0c, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x50,
-	0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x14, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x50, 0x6f,
-	0x6c, 0x69, 0x63, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x06, 0x2e, 0x45, 0x6d,
-	0x70, 0x74, 0x79, 0x30, 0x01, 0x12, 0x37, 0x0a, 0x0c, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x70, 0x75, 0x72, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x64,
+	0x72, 0x79, 0x52, 0x75, 0x6e, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x64, 0x72, 0x79,
+	0x52, 0x75, 0x6e, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x6f, 0x67,
+	0x69, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x22,
+	0x91, 0x01, 0x0a, 0x13, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12,
+	0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x12,
+	0x18, 0x0a, 0x07, 0x64, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x07, 0x64, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x73, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x6c, 0x6c,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x03, 0x61, 0x6c, 0x6c, 0x12, 0x16, 0x0a, 0x06, 0x66,
+	0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x6f, 0x72,
+	0x6d, 0x61, 0x74, 0x22, 0x60, 0x0a, 0x14, 0x45, 0x78, 0x70, 0x6c, 0x61, 0x69, 0x6e, 0x50, 0x6f,
+	0x6c, 0x69, 0x63, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74,
+	0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72,
+	0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65,
+	0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75,
+	0x74, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x22, 0x67, 0x0a, 0x15, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65,
+	0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16,
+	0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70,
+	0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f,
+	0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x22, 0x4f,
+	0x0a, 0x15, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65,
+	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12,
+	0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x22,
+	0x79, 0x0a, 0x19, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73,
+	0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61,
+	0x72, 0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74,
+	0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70,
+	0x75, 0x74, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x61, 0x6c, 0x6c, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x03, 0x61, 0x6c, 0x6c, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x65, 0x61, 0x6c, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x68, 0x65, 0x61, 0x6c, 0x22, 0x54, 0x0a, 0x1a, 0x4c, 0x69,
+	0x73, 0x74, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72,
+	0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67,
+	0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74,
+	0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72,
+	0x22, 0x78, 0x0a, 0x1a, 0x44, 0x69, 0x66, 0x66, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73,
+	0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16,
+	0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70,
+	0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f,
+	0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x66, 0x72, 0x6f, 0x6d, 0x12, 0x0e, 0x0a, 0x02, 0x74, 0x6f,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x03, 0x52, 0x02, 0x74, 0x6f, 0x22, 0x71, 0x0a, 0x17, 0x52, 0x6f,
+	0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x72, 0x67, 0x65, 0x74, 0x12, 0x1e, 0x0a,
+	0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0a, 0x69, 0x73, 0x43, 0x6f, 0x6d, 0x70, 0x75, 0x74, 0x65, 0x72, 0x12, 0x1e, 0x0a,
+	0x0a, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x0a, 0x67, 0x65, 0x6e, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0x52, 0x0a,
+	0x1c, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x44, 0x65, 0x66, 0x69, 0x6e,
+	0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x16, 0x0a,
+	0x06, 0x66, 0x6f, 0x72, 0x6d, 0x61, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66,
+	0x6f, 0x72, 0x6d, 0x61, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x69, 0x73, 0x74, 0x72, 0x6f, 0x49,
+	0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x64, 0x69, 0x73, 0x74, 0x72, 0x6f, 0x49,
+	0x44, 0x22, 0x47, 0x0a, 0x1d, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x44,
+	0x65, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
+	0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x64, 0x6d, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x61, 0x64, 0x6d, 0x78, 0x12, 0x12, 0x0a, 0x04, 0x61, 0x64, 0x6d, 0x6c, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x64, 0x6d, 0x6c, 0x22, 0x29, 0x0a, 0x0d, 0x47, 0x65,
+	0x74, 0x44, 0x6f, 0x63, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x63,
+	0x68, 0x61, 0x70, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x68,
+	0x61, 0x70, 0x74, 0x65, 0x72, 0x22, 0x2c, 0x0a, 0x0e, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x6f, 0x63,
+	0x52, 0x65, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x70, 0x74,
+	0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x63, 0x68, 0x61, 0x70, 0x74,
+	0x65, 0x72, 0x73, 0x32, 0x89, 0x08, 0x0a, 0x07, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12,
+	0x20, 0x0a, 0x03, 0x43, 0x61, 0x74, 0x12, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0f,
+	0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30,
+	0x01, 0x12, 0x24, 0x0a, 0x07, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x06, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x23, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75,
+	0x73, 0x12, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69,
+	0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x1e, 0x0a, 0x04,
+	0x53, 0x74, 0x6f, 0x70, 0x12, 0x0c, 0x2e, 0x53, 0x74, 0x6f, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x30, 0x01, 0x12, 0x37, 0x0a, 0x0c,
+	0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x14, 0x2e, 0x55,
+	0x70, 0x64, 0x61, 0x74, 0x65, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x37, 0x0a, 0x0c, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c,
 	0x69, 0x63, 0x69, 0x65, 0x73, 0x12, 0x14, 0x2e, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69,
 	0x63, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74,
-	0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x5a,
+	0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x39,
+	0x0a, 0x0d, 0x45, 0x78, 0x70, 0x6c, 0x61, 0x69, 0x6e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12,
+	0x15, 0x2e, 0x45, 0x78, 0x70, 0x6c, 0x61, 0x69, 0x6e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x3b, 0x0a, 0x0e, 0x50, 0x6f, 0x6c,
+	0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x16, 0x2e, 0x50, 0x6f,
+	0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x3b, 0x0a, 0x0e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69,
+	0x65, 0x73, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x16, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63,
+	0x69, 0x65, 0x73, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73,
+	0x65, 0x30, 0x01, 0x12, 0x43, 0x0a, 0x12, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x50, 0x6f, 0x6c, 0x69,
+	0x63, 0x69, 0x65, 0x73, 0x44, 0x72, 0x69, 0x66, 0x74, 0x12, 0x1a, 0x2e, 0x43, 0x68, 0x65, 0x63,
+	0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x44, 0x72, 0x69, 0x66, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x45, 0x0a, 0x13, 0x4c, 0x69, 0x73, 0x74,
+	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12,
+	0x1b, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x48, 0x69,
+	0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53,
+	0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12,
+	0x45, 0x0a, 0x13, 0x44, 0x69, 0x66, 0x66, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x48,
+	0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x1b, 0x2e, 0x44, 0x69, 0x66, 0x66, 0x50, 0x6f, 0x6c,
+	0x69, 0x63, 0x69, 0x65, 0x73, 0x48, 0x69, 0x73, 0x74, 0x6f, 0x72, 0x79, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x0f, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x12, 0x36, 0x0a, 0x10, 0x52, 0x6f, 0x6c, 0x6c, 0x62, 0x61,
+	0x63, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x12, 0x18, 0x2e, 0x52, 0x6f, 0x6c,
+	0x6c, 0x62, 0x61, 0x63, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x06, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x30, 0x01, 0x12, 0x5a,
 	0x0a, 0x17, 0x44, 0x75, 0x6d, 0x70, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x44, 0x65,
 	0x66, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x1d, 0x2e, 0x44, 0x75, 0x6d, 0x70,
 	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x44, 0x65, 0x66, 0x69, 0x6e, 0x69, 0x74, 0x69, 0x6f, 0x6e,
@@ -650,7 +1203,7 @@ func file_adsys_proto_rawDescGZIP() []byte {
 	return file_adsys_proto_rawDescData
 }
 
-var file_adsys_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_adsys_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_adsys_proto_goTypes = []any{
 	(*Empty)(nil),                         // 0: Empty
 	(*ListUsersRequest)(nil),              // 1: ListUsersRequest
@@ -658,10 +1211,17 @@ var file_adsys_proto_goTypes = []any{
 	(*StringResponse)(nil),                // 3: StringResponse
 	(*UpdatePolicyRequest)(nil),           // 4: UpdatePolicyRequest
 	(*DumpPoliciesRequest)(nil),           // 5: DumpPoliciesRequest
-	(*DumpPolicyDefinitionsRequest)(nil),  // 6: DumpPolicyDefinitionsRequest
-	(*DumpPolicyDefinitionsResponse)(nil), // 7: DumpPolicyDefinitionsResponse
-	(*GetDocRequest)(nil),                 // 8: GetDocRequest
-	(*ListDocReponse)(nil),                // 9: ListDocReponse
+	(*ExplainPolicyRequest)(nil),          // 6: ExplainPolicyRequest
+	(*PoliciesReportRequest)(nil),         // 7: PoliciesReportRequest
+	(*PoliciesStatusRequest)(nil),         // 8: PoliciesStatusRequest
+	(*CheckPoliciesDriftRequest)(nil),     // 9: CheckPoliciesDriftRequest
+	(*ListPoliciesHistoryRequest)(nil),    // 10: ListPoliciesHistoryRequest
+	(*DiffPoliciesHistoryRequest)(nil),    // 11: DiffPoliciesHistoryRequest
+	(*RollbackPoliciesRequest)(nil),       // 12: RollbackPoliciesRequest
+	(*DumpPolicyDefinitionsRequest)(nil),  // 13: DumpPolicyDefinitionsRequest
+	(*DumpPolicyDefinitionsResponse)(nil), // 14: DumpPolicyDefinitionsResponse
+	(*GetDocRequest)(nil),                 // 15: GetDocRequest
+	(*ListDocReponse)(nil),                // 16: ListDocReponse
 }
 var file_adsys_proto_depIdxs = []int32{
 	0,  // 0: service.Cat:input_type -> Empty
@@ -670,26 +1230,40 @@ var file_adsys_proto_depIdxs = []int32{
 	2,  // 3: service.Stop:input_type -> StopRequest
 	4,  // 4: service.UpdatePolicy:input_type -> UpdatePolicyRequest
 	5,  // 5: service.DumpPolicies:input_type -> DumpPoliciesRequest
-	6,  // 6: service.DumpPoliciesDefinitions:input_type -> DumpPolicyDefinitionsRequest
-	8,  // 7: service.GetDoc:input_type -> GetDocRequest
-	0,  // 8: service.ListDoc:input_type -> Empty
-	1,  // 9: service.ListUsers:input_type -> ListUsersRequest
-	0,  // 10: service.GPOListScript:input_type -> Empty
-	0,  // 11: service.CertAutoEnrollScript:input_type -> Empty
-	3,  // 12: service.Cat:output_type -> StringResponse
-	3,  // 13: service.Version:output_type -> StringResponse
-	3,  // 14: service.Status:output_type -> StringResponse
-	0,  // 15: service.Stop:output_type -> Empty
-	0,  // 16: service.UpdatePolicy:output_type -> Empty
-	3,  // 17: service.DumpPolicies:output_type -> StringResponse
-	7,  // 18: service.DumpPoliciesDefinitions:output_type -> DumpPolicyDefinitionsResponse
-	3,  // 19: service.GetDoc:output_type -> StringResponse
-	9,  // 20: service.ListDoc:output_type -> ListDocReponse
-	3,  // 21: service.ListUsers:output_type -> StringResponse
-	3,  // 22: service.GPOListScript:output_type -> StringResponse
-	3,  // 23: service.CertAutoEnrollScript:output_type -> StringResponse
-	12, // [12:24] is the sub-list for method output_type
-	0,  // [0:12] is the sub-list for method input_type
+	6,  // 6: service.ExplainPolicy:input_type -> ExplainPolicyRequest
+	7,  // 7: service.PoliciesReport:input_type -> PoliciesReportRequest
+	8,  // 8: service.PoliciesStatus:input_type -> PoliciesStatusRequest
+	9,  // 9: service.CheckPoliciesDrift:input_type -> CheckPoliciesDriftRequest
+	10, // 10: service.ListPoliciesHistory:input_type -> ListPoliciesHistoryRequest
+	11, // 11: service.DiffPoliciesHistory:input_type -> DiffPoliciesHistoryRequest
+	12, // 12: service.RollbackPolicies:input_type -> RollbackPoliciesRequest
+	13, // 13: service.DumpPoliciesDefinitions:input_type -> DumpPolicyDefinitionsRequest
+	15, // 14: service.GetDoc:input_type -> GetDocRequest
+	0,  // 15: service.ListDoc:input_type -> Empty
+	1,  // 16: service.ListUsers:input_type -> ListUsersRequest
+	0,  // 17: service.GPOListScript:input_type -> Empty
+	0,  // 18: service.CertAutoEnrollScript:input_type -> Empty
+	3,  // 19: service.Cat:output_type -> StringResponse
+	3,  // 20: service.Version:output_type -> StringResponse
+	3,  // 21: service.Status:output_type -> StringResponse
+	0,  // 22: service.Stop:output_type -> Empty
+	3,  // 23: service.UpdatePolicy:output_type -> StringResponse
+	3,  // 24: service.DumpPolicies:output_type -> StringResponse
+	3,  // 25: service.ExplainPolicy:output_type -> StringResponse
+	3,  // 26: service.PoliciesReport:output_type -> StringResponse
+	3,  // 27: service.PoliciesStatus:output_type -> StringResponse
+	3,  // 28: service.CheckPoliciesDrift:output_type -> StringResponse
+	3,  // 29: service.ListPoliciesHistory:output_type -> StringResponse
+	3,  // 30: service.DiffPoliciesHistory:output_type -> StringResponse
+	0,  // 31: service.RollbackPolicies:output_type -> Empty
+	14, // 32: service.DumpPoliciesDefinitions:output_type -> DumpPolicyDefinitionsResponse
+	3,  // 33: service.GetDoc:output_type -> StringResponse
+	16, // 34: service.ListDoc:output_type -> ListDocReponse
+	3,  // 35: service.ListUsers:output_type -> StringResponse
+	3,  // 36: service.GPOListScript:output_type -> StringResponse
+	3,  // 37: service.CertAutoEnrollScript:output_type -> StringResponse
+	19, // [19:38] is the sub-list for method output_type
+	0,  // [0:19] is the sub-list for method input_type
 	0,  // [0:0] is the sub-list for extension type_name
 	0,  // [0:0] is the sub-list for extension extendee
 	0,  // [0:0] is the sub-list for field type_name
@@ -774,7 +1348,7 @@ func file_adsys_proto_init() {
 			}
 		}
 		file_adsys_proto_msgTypes[6].Exporter = func(v any, i int) any {
-			switch v := v.(*DumpPolicyDefinitionsRequest); i {
+			switch v := v.(*ExplainPolicyRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -786,7 +1360,7 @@ func file_adsys_proto_init() {
 			}
 		}
 		file_adsys_proto_msgTypes[7].Exporter = func(v any, i int) any {
-			switch v := v.(*DumpPolicyDefinitionsResponse); i {
+			switch v := v.(*PoliciesReportRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -798,7 +1372,7 @@ func file_adsys_proto_init() {
 			}
 		}
 		file_adsys_proto_msgTypes[8].Exporter = func(v any, i int) any {
-			switch v := v.(*GetDocRequest); i {
+			switch v := v.(*PoliciesStatusRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -810,6 +1384,90 @@ func file_adsys_proto_init() {
 			}
 		}
 		file_adsys_proto_msgTypes[9].Exporter = func(v any, i int) any {
+			switch v := v.(*CheckPoliciesDriftRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[10].Exporter = func(v any, i int) any {
+			switch v := v.(*ListPoliciesHistoryRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[11].Exporter = func(v any, i int) any {
+			switch v := v.(*DiffPoliciesHistoryRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[12].Exporter = func(v any, i int) any {
+			switch v := v.(*RollbackPoliciesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[13].Exporter = func(v any, i int) any {
+			switch v := v.(*DumpPolicyDefinitionsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[14].Exporter = func(v any, i int) any {
+			switch v := v.(*DumpPolicyDefinitionsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[15].Exporter = func(v any, i int) any {
+			switch v := v.(*GetDocRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_adsys_proto_msgTypes[16].Exporter = func(v any, i int) any {
 			switch v := v.(*ListDocReponse); i {
 			case 0:
 				return &v.state
@@ -828,7 +1486,7 @@ func file_adsys_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_adsys_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   10,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
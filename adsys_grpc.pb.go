@@ -25,6 +25,13 @@ const (
 	Service_Stop_FullMethodName                    = "/service/Stop"
 	Service_UpdatePolicy_FullMethodName            = "/service/UpdatePolicy"
 	Service_DumpPolicies_FullMethodName            = "/service/DumpPolicies"
+	Service_ExplainPolicy_FullMethodName           = "/service/ExplainPolicy"
+	Service_PoliciesReport_FullMethodName          = "/service/PoliciesReport"
+	Service_PoliciesStatus_FullMethodName          = "/service/PoliciesStatus"
+	Service_CheckPoliciesDrift_FullMethodName      = "/service/CheckPoliciesDrift"
+	Service_ListPoliciesHistory_FullMethodName     = "/service/ListPoliciesHistory"
+	Service_DiffPoliciesHistory_FullMethodName     = "/service/DiffPoliciesHistory"
+	Service_RollbackPolicies_FullMethodName        = "/service/RollbackPolicies"
 	Service_DumpPoliciesDefinitions_FullMethodName = "/service/DumpPoliciesDefinitions"
 	Service_GetDoc_FullMethodName                  = "/service/GetDoc"
 	Service_ListDoc_FullMethodName                 = "/service/ListDoc"
@@ -41,8 +48,15 @@ type ServiceClient interface {
 	Version(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
 	Status(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
 	Stop(ctx context.Context, in *StopRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Empty], error)
-	UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Empty], error)
+	UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
 	DumpPolicies(ctx context.Context, in *DumpPoliciesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	ExplainPolicy(ctx context.Context, in *ExplainPolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	PoliciesReport(ctx context.Context, in *PoliciesReportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	PoliciesStatus(ctx context.Context, in *PoliciesStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	CheckPoliciesDrift(ctx context.Context, in *CheckPoliciesDriftRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	ListPoliciesHistory(ctx context.Context, in *ListPoliciesHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	DiffPoliciesHistory(ctx context.Context, in *DiffPoliciesHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
+	RollbackPolicies(ctx context.Context, in *RollbackPoliciesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Empty], error)
 	DumpPoliciesDefinitions(ctx context.Context, in *DumpPolicyDefinitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DumpPolicyDefinitionsResponse], error)
 	GetDoc(ctx context.Context, in *GetDocRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error)
 	ListDoc(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListDocReponse], error)
@@ -135,13 +149,13 @@ func (c *serviceClient) Stop(ctx context.Context, in *StopRequest, opts ...grpc.
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Service_StopClient = grpc.ServerStreamingClient[Empty]
 
-func (c *serviceClient) UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Empty], error) {
+func (c *serviceClient) UpdatePolicy(ctx context.Context, in *UpdatePolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[4], Service_UpdatePolicy_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &grpc.GenericClientStream[UpdatePolicyRequest, Empty]{ClientStream: stream}
+	x := &grpc.GenericClientStream[UpdatePolicyRequest, StringResponse]{ClientStream: stream}
 	if err := x.ClientStream.SendMsg(in); err != nil {
 		return nil, err
 	}
@@ -152,7 +166,7 @@ func (c *serviceClient) UpdatePolicy(ctx context.Context, in *UpdatePolicyReques
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type Service_UpdatePolicyClient = grpc.ServerStreamingClient[Empty]
+type Service_UpdatePolicyClient = grpc.ServerStreamingClient[StringResponse]
 
 func (c *serviceClient) DumpPolicies(ctx context.Context, in *DumpPoliciesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
@@ -173,9 +187,142 @@ func (c *serviceClient) DumpPolicies(ctx context.Context, in *DumpPoliciesReques
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Service_DumpPoliciesClient = grpc.ServerStreamingClient[StringResponse]
 
+func (c *serviceClient) ExplainPolicy(ctx context.Context, in *ExplainPolicyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[6], Service_ExplainPolicy_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ExplainPolicyRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_ExplainPolicyClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) PoliciesReport(ctx context.Context, in *PoliciesReportRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[7], Service_PoliciesReport_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PoliciesReportRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_PoliciesReportClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) PoliciesStatus(ctx context.Context, in *PoliciesStatusRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[8], Service_PoliciesStatus_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[PoliciesStatusRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_PoliciesStatusClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) CheckPoliciesDrift(ctx context.Context, in *CheckPoliciesDriftRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[9], Service_CheckPoliciesDrift_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CheckPoliciesDriftRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_CheckPoliciesDriftClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) ListPoliciesHistory(ctx context.Context, in *ListPoliciesHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[10], Service_ListPoliciesHistory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListPoliciesHistoryRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_ListPoliciesHistoryClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) DiffPoliciesHistory(ctx context.Context, in *DiffPoliciesHistoryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[11], Service_DiffPoliciesHistory_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[DiffPoliciesHistoryRequest, StringResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_DiffPoliciesHistoryClient = grpc.ServerStreamingClient[StringResponse]
+
+func (c *serviceClient) RollbackPolicies(ctx context.Context, in *RollbackPoliciesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Empty], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[12], Service_RollbackPolicies_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[RollbackPoliciesRequest, Empty]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_RollbackPoliciesClient = grpc.ServerStreamingClient[Empty]
+
 func (c *serviceClient) DumpPoliciesDefinitions(ctx context.Context, in *DumpPolicyDefinitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DumpPolicyDefinitionsResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[6], Service_DumpPoliciesDefinitions_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[13], Service_DumpPoliciesDefinitions_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -194,7 +341,7 @@ type Service_DumpPoliciesDefinitionsClient = grpc.ServerStreamingClient[DumpPoli
 
 func (c *serviceClient) GetDoc(ctx context.Context, in *GetDocRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[7], Service_GetDoc_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[14], Service_GetDoc_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +360,7 @@ type Service_GetDocClient = grpc.ServerStreamingClient[StringResponse]
 
 func (c *serviceClient) ListDoc(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ListDocReponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[8], Service_ListDoc_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[15], Service_ListDoc_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -232,7 +379,7 @@ type Service_ListDocClient = grpc.ServerStreamingClient[ListDocReponse]
 
 func (c *serviceClient) ListUsers(ctx context.Context, in *ListUsersRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[9], Service_ListUsers_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[16], Service_ListUsers_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -251,7 +398,7 @@ type Service_ListUsersClient = grpc.ServerStreamingClient[StringResponse]
 
 func (c *serviceClient) GPOListScript(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[10], Service_GPOListScript_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[17], Service_GPOListScript_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -270,7 +417,7 @@ type Service_GPOListScriptClient = grpc.ServerStreamingClient[StringResponse]
 
 func (c *serviceClient) CertAutoEnrollScript(ctx context.Context, in *Empty, opts ...grpc.CallOption) (grpc.ServerStreamingClient[StringResponse], error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[11], Service_CertAutoEnrollScript_FullMethodName, cOpts...)
+	stream, err := c.cc.NewStream(ctx, &Service_ServiceDesc.Streams[18], Service_CertAutoEnrollScript_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -295,8 +442,15 @@ type ServiceServer interface {
 	Version(*Empty, grpc.ServerStreamingServer[StringResponse]) error
 	Status(*Empty, grpc.ServerStreamingServer[StringResponse]) error
 	Stop(*StopRequest, grpc.ServerStreamingServer[Empty]) error
-	UpdatePolicy(*UpdatePolicyRequest, grpc.ServerStreamingServer[Empty]) error
+	UpdatePolicy(*UpdatePolicyRequest, grpc.ServerStreamingServer[StringResponse]) error
 	DumpPolicies(*DumpPoliciesRequest, grpc.ServerStreamingServer[StringResponse]) error
+	ExplainPolicy(*ExplainPolicyRequest, grpc.ServerStreamingServer[StringResponse]) error
+	PoliciesReport(*PoliciesReportRequest, grpc.ServerStreamingServer[StringResponse]) error
+	PoliciesStatus(*PoliciesStatusRequest, grpc.ServerStreamingServer[StringResponse]) error
+	CheckPoliciesDrift(*CheckPoliciesDriftRequest, grpc.ServerStreamingServer[StringResponse]) error
+	ListPoliciesHistory(*ListPoliciesHistoryRequest, grpc.ServerStreamingServer[StringResponse]) error
+	DiffPoliciesHistory(*DiffPoliciesHistoryRequest, grpc.ServerStreamingServer[StringResponse]) error
+	RollbackPolicies(*RollbackPoliciesRequest, grpc.ServerStreamingServer[Empty]) error
 	DumpPoliciesDefinitions(*DumpPolicyDefinitionsRequest, grpc.ServerStreamingServer[DumpPolicyDefinitionsResponse]) error
 	GetDoc(*GetDocRequest, grpc.ServerStreamingServer[StringResponse]) error
 	ListDoc(*Empty, grpc.ServerStreamingServer[ListDocReponse]) error
@@ -325,12 +479,33 @@ func (UnimplementedServiceServer) Status(*Empty, grpc.ServerStreamingServer[Stri
 func (UnimplementedServiceServer) Stop(*StopRequest, grpc.ServerStreamingServer[Empty]) error {
 	return status.Errorf(codes.Unimplemented, "method Stop not implemented")
 }
-func (UnimplementedServiceServer) UpdatePolicy(*UpdatePolicyRequest, grpc.ServerStreamingServer[Empty]) error {
+func (UnimplementedServiceServer) UpdatePolicy(*UpdatePolicyRequest, grpc.ServerStreamingServer[StringResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method UpdatePolicy not implemented")
 }
 func (UnimplementedServiceServer) DumpPolicies(*DumpPoliciesRequest, grpc.ServerStreamingServer[StringResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method DumpPolicies not implemented")
 }
+func (UnimplementedServiceServer) ExplainPolicy(*ExplainPolicyRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ExplainPolicy not implemented")
+}
+func (UnimplementedServiceServer) PoliciesReport(*PoliciesReportRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PoliciesReport not implemented")
+}
+func (UnimplementedServiceServer) PoliciesStatus(*PoliciesStatusRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method PoliciesStatus not implemented")
+}
+func (UnimplementedServiceServer) CheckPoliciesDrift(*CheckPoliciesDriftRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CheckPoliciesDrift not implemented")
+}
+func (UnimplementedServiceServer) ListPoliciesHistory(*ListPoliciesHistoryRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ListPoliciesHistory not implemented")
+}
+func (UnimplementedServiceServer) DiffPoliciesHistory(*DiffPoliciesHistoryRequest, grpc.ServerStreamingServer[StringResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DiffPoliciesHistory not implemented")
+}
+func (UnimplementedServiceServer) RollbackPolicies(*RollbackPoliciesRequest, grpc.ServerStreamingServer[Empty]) error {
+	return status.Errorf(codes.Unimplemented, "method RollbackPolicies not implemented")
+}
 func (UnimplementedServiceServer) DumpPoliciesDefinitions(*DumpPolicyDefinitionsRequest, grpc.ServerStreamingServer[DumpPolicyDefinitionsResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method DumpPoliciesDefinitions not implemented")
 }
@@ -419,11 +594,11 @@ func _Service_UpdatePolicy_Handler(srv interface{}, stream grpc.ServerStream) er
 	if err := stream.RecvMsg(m); err != nil {
 		return err
 	}
-	return srv.(ServiceServer).UpdatePolicy(m, &grpc.GenericServerStream[UpdatePolicyRequest, Empty]{ServerStream: stream})
+	return srv.(ServiceServer).UpdatePolicy(m, &grpc.GenericServerStream[UpdatePolicyRequest, StringResponse]{ServerStream: stream})
 }
 
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
-type Service_UpdatePolicyServer = grpc.ServerStreamingServer[Empty]
+type Service_UpdatePolicyServer = grpc.ServerStreamingServer[StringResponse]
 
 func _Service_DumpPolicies_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(DumpPoliciesRequest)
@@ -436,6 +611,83 @@ func _Service_DumpPolicies_Handler(srv interface{}, stream grpc.ServerStream) er
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type Service_DumpPoliciesServer = grpc.ServerStreamingServer[StringResponse]
 
+func _Service_ExplainPolicy_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExplainPolicyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).ExplainPolicy(m, &grpc.GenericServerStream[ExplainPolicyRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_ExplainPolicyServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_PoliciesReport_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PoliciesReportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).PoliciesReport(m, &grpc.GenericServerStream[PoliciesReportRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_PoliciesReportServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_PoliciesStatus_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(PoliciesStatusRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).PoliciesStatus(m, &grpc.GenericServerStream[PoliciesStatusRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_PoliciesStatusServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_CheckPoliciesDrift_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(CheckPoliciesDriftRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).CheckPoliciesDrift(m, &grpc.GenericServerStream[CheckPoliciesDriftRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_CheckPoliciesDriftServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_ListPoliciesHistory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListPoliciesHistoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).ListPoliciesHistory(m, &grpc.GenericServerStream[ListPoliciesHistoryRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_ListPoliciesHistoryServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_DiffPoliciesHistory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DiffPoliciesHistoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).DiffPoliciesHistory(m, &grpc.GenericServerStream[DiffPoliciesHistoryRequest, StringResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_DiffPoliciesHistoryServer = grpc.ServerStreamingServer[StringResponse]
+
+func _Service_RollbackPolicies_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(RollbackPoliciesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ServiceServer).RollbackPolicies(m, &grpc.GenericServerStream[RollbackPoliciesRequest, Empty]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Service_RollbackPoliciesServer = grpc.ServerStreamingServer[Empty]
+
 func _Service_DumpPoliciesDefinitions_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(DumpPolicyDefinitionsRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -540,6 +792,41 @@ var Service_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _Service_DumpPolicies_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "ExplainPolicy",
+			Handler:       _Service_ExplainPolicy_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PoliciesReport",
+			Handler:       _Service_PoliciesReport_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "PoliciesStatus",
+			Handler:       _Service_PoliciesStatus_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "CheckPoliciesDrift",
+			Handler:       _Service_CheckPoliciesDrift_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListPoliciesHistory",
+			Handler:       _Service_ListPoliciesHistory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "DiffPoliciesHistory",
+			Handler:       _Service_DiffPoliciesHistory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "RollbackPolicies",
+			Handler:       _Service_RollbackPolicies_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "DumpPoliciesDefinitions",
 			Handler:       _Service_DumpPoliciesDefinitions_Handler,
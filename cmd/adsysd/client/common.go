@@ -32,3 +32,17 @@ func singleMsg(stream recver) (msg string, err error) {
 
 	return msg, nil
 }
+
+// printMsgs prints every message streamed by the service until the end of the stream.
+func printMsgs(stream recver) error {
+	for {
+		r, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		fmt.Print(r.GetMsg())
+	}
+}
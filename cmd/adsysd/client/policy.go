@@ -48,6 +48,7 @@ func (a *App) installPolicy() {
 	policyCmd.AddCommand(mainCmd)
 
 	var details, all, nocolor, isMachine *bool
+	var format *string
 	appliedCmd := &cobra.Command{
 		Use:   "applied [USER_NAME]",
 		Short: gotext.Get("Print last applied GPOs for current or given user/machine"),
@@ -64,13 +65,14 @@ func (a *App) installPolicy() {
 			if len(args) > 0 {
 				target = args[0]
 			}
-			return a.dumpPolicies(target, *details, *all, *nocolor, *isMachine)
+			return a.dumpPolicies(target, *details, *all, *nocolor, *isMachine, *format)
 		},
 	}
 	details = appliedCmd.Flags().BoolP("details", "", false, gotext.Get("show applied rules in addition to GPOs."))
 	all = appliedCmd.Flags().BoolP("all", "a", false, gotext.Get("show overridden rules in each GPOs."))
 	nocolor = appliedCmd.Flags().BoolP("no-color", "", false, gotext.Get("don't display colorized version."))
 	isMachine = appliedCmd.Flags().BoolP("machine", "m", false, gotext.Get("show applied rules to the machine."))
+	format = appliedCmd.Flags().StringP("format", "", "text", gotext.Get("output format: text, json or yaml. json and yaml list all rules with the GPO they come from and the GPOs they overrode."))
 	policyCmd.AddCommand(appliedCmd)
 	cmdhandler.RegisterAlias(appliedCmd, &a.rootCmd)
 
@@ -115,7 +117,7 @@ The command is a no-op if the ticket is not present on disk or the detect_cached
 	}
 	debugCmd.AddCommand(ticketPathCmd)
 
-	var updateMachine, updateAll *bool
+	var updateMachine, updateAll, updateDryRun, updateForce, updateLogin *bool
 	updateCmd := &cobra.Command{
 		Use:   "update [USER_NAME KERBEROS_TICKET_PATH]",
 		Short: gotext.Get("Updates/Create a policy for current user or given user with its kerberos ticket"),
@@ -142,11 +144,14 @@ The command is a no-op if the ticket is not present on disk or the detect_cached
 			if len(args) > 0 {
 				user, krb5cc = args[0], args[1]
 			}
-			return a.update(*updateMachine, *updateAll, user, krb5cc)
+			return a.update(*updateMachine, *updateAll, *updateDryRun, *updateForce, *updateLogin, user, krb5cc)
 		},
 	}
 	updateMachine = updateCmd.Flags().BoolP("machine", "m", false, gotext.Get("machine updates the policy of the computer."))
 	updateAll = updateCmd.Flags().BoolP("all", "a", false, gotext.Get("all updates the policy of the computer and all the logged in users. -m or USER_NAME/TICKET cannot be used with this option."))
+	updateDryRun = updateCmd.Flags().BoolP("dry-run", "", false, gotext.Get("only show the changes which would be made on the system, without applying them."))
+	updateForce = updateCmd.Flags().BoolP("force", "", false, gotext.Get("apply again policies which did not change since last update."))
+	updateLogin = updateCmd.Flags().BoolP("login", "", false, gotext.Get("the update is made when the user logs in: cached policies are applied first if fast login is enabled."))
 	policyCmd.AddCommand(updateCmd)
 	cmdhandler.RegisterAlias(updateCmd, &a.rootCmd)
 
@@ -177,6 +182,173 @@ The command is a no-op if the ticket is not present on disk or the detect_cached
 	purgeCmd.MarkFlagsMutuallyExclusive("machine", "all")
 	policyCmd.AddCommand(purgeCmd)
 
+	var explainMachine *bool
+	explainCmd := &cobra.Command{
+		Use:   "explain KEY [USER_NAME]",
+		Short: gotext.Get("Explain which GPOs define a policy key for current or given user/machine, and which one won"),
+		Long: gotext.Get(`Show every applied GPO defining KEY, in precedence order, with the value it sets and whether it is applied, merged or overridden.
+KEY is the policy type followed by the key, like dconf/org/gnome/desktop/screensaver/lock-delay.`),
+		Args: cobra.RangeArgs(1, 2),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if *explainMachine || len(args) != 1 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			return a.users(true), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var target string
+			if len(args) > 1 {
+				target = args[1]
+			}
+			return a.explainPolicy(args[0], target, *explainMachine)
+		},
+	}
+	explainMachine = explainCmd.Flags().BoolP("machine", "m", false, gotext.Get("explain the policy applied to the machine."))
+	policyCmd.AddCommand(explainCmd)
+
+	var reportMachine *bool
+	var reportFormat *string
+	reportCmd := &cobra.Command{
+		Use:   "report [USER_NAME]",
+		Short: gotext.Get("Print the resultant set of policies of the machine and current or given user"),
+		Long: gotext.Get(`Print a report of the policies applied to the machine and to the current or given user: GPOs, effective rules per policy manager with the GPOs they come from, rules filtered out without Ubuntu Pro subscription, last update time and backend information.
+The report is written on the standard output, in html or json format.`),
+		Args: cmdhandler.ZeroOrNArgs(1),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if *reportMachine || len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			return a.users(true), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var target string
+			if len(args) > 0 {
+				target = args[0]
+			}
+			return a.policiesReport(target, *reportMachine, *reportFormat)
+		},
+	}
+	reportMachine = reportCmd.Flags().BoolP("machine", "m", false, gotext.Get("only report the policies of the machine."))
+	reportFormat = reportCmd.Flags().StringP("format", "", "html", gotext.Get("report format: html or json."))
+	policyCmd.AddCommand(reportCmd)
+
+	var statusMachine *bool
+	statusCmd := &cobra.Command{
+		Use:   "status [USER_NAME]",
+		Short: gotext.Get("Print the status of each policy manager for current or given user/machine"),
+		Long:  gotext.Get(`Print, for each policy manager, when its policies were last applied, when they last succeeded, the number of rules applied and the error of the last failure.`),
+		Args:  cmdhandler.ZeroOrNArgs(1),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if *statusMachine || len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			// Get all users with cached policies
+			return a.users(false), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var target string
+			if len(args) > 0 {
+				target = args[0]
+			}
+			return a.policiesStatus(target, *statusMachine)
+		},
+	}
+	statusMachine = statusCmd.Flags().BoolP("machine", "m", false, gotext.Get("show the policies status of the machine."))
+	policyCmd.AddCommand(statusCmd)
+
+	var driftMachine, driftAll, driftHeal *bool
+	driftCmd := &cobra.Command{
+		Use:   "drift [USER_NAME]",
+		Short: gotext.Get("Check if files managed by policies changed for current or given user/machine"),
+		Long: gotext.Get(`Compare the files managed by the policies, like sudoers, dconf or apparmor files, with what the last applied policies produce, and print the differences.
+With --heal, the policies which drifted are applied again from the cache, without contacting the Active Directory server.`),
+		Args: cmdhandler.ZeroOrNArgs(1),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			// All and machine options don’t take arguments
+			if *driftAll || *driftMachine || len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			// Get all users with cached policies
+			return a.users(false), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var target string
+			if len(args) > 0 {
+				target = args[0]
+			}
+			return a.checkPoliciesDrift(target, *driftMachine, *driftAll, *driftHeal)
+		},
+	}
+	driftMachine = driftCmd.Flags().BoolP("machine", "m", false, gotext.Get("check the policies of the computer."))
+	driftAll = driftCmd.Flags().BoolP("all", "a", false, gotext.Get("check the policies of the computer and all the logged in users. -m or USER_NAME cannot be used with this option."))
+	driftHeal = driftCmd.Flags().BoolP("heal", "", false, gotext.Get("apply again the policies which drifted."))
+	driftCmd.MarkFlagsMutuallyExclusive("machine", "all")
+	policyCmd.AddCommand(driftCmd)
+
+	var historyMachine, historyNoColor *bool
+	var historyDiff *[]int
+	historyCmd := &cobra.Command{
+		Use:   "history [USER_NAME]",
+		Short: gotext.Get("List previously applied policies for current or given user/machine"),
+		Args:  cmdhandler.ZeroOrNArgs(1),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if *historyMachine || len(args) != 0 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			// Get all users with cached policies
+			return a.users(false), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			var target string
+			if len(args) > 0 {
+				target = args[0]
+			}
+			if len(*historyDiff) > 0 {
+				return a.diffPoliciesHistory(target, *historyMachine, *historyNoColor, *historyDiff)
+			}
+			return a.policiesHistory(target, *historyMachine)
+		},
+	}
+	historyMachine = historyCmd.Flags().BoolP("machine", "m", false, gotext.Get("show policies history of the machine."))
+	historyDiff = historyCmd.Flags().IntSliceP("diff", "", nil, gotext.Get("show the changes between the two generations FROM,TO instead of listing them."))
+	historyNoColor = historyCmd.Flags().BoolP("no-color", "", false, gotext.Get("don't display colorized version."))
+	policyCmd.AddCommand(historyCmd)
+
+	var rollbackMachine *bool
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback GENERATION [USER_NAME]",
+		Short: gotext.Get("Apply again a previous generation of policies for current or given user/machine"),
+		Long: gotext.Get(`Apply again a previous generation of policies, as listed by the history command, without contacting the Active Directory server.
+The restored policies become the current generation, until the next update.`),
+		Args: cobra.RangeArgs(1, 2),
+		ValidArgsFunction: func(_ *cobra.Command, args []string, _ string) ([]string, cobra.ShellCompDirective) {
+			if *rollbackMachine || len(args) != 1 {
+				return nil, cobra.ShellCompDirectiveNoFileComp
+			}
+
+			// Get all users with cached policies
+			return a.users(false), cobra.ShellCompDirectiveNoFileComp
+		},
+		RunE: func(_ *cobra.Command, args []string) error {
+			generation, err := strconv.Atoi(args[0])
+			if err != nil {
+				return errors.New(gotext.Get("invalid generation %q: %v", args[0], err))
+			}
+			var target string
+			if len(args) > 1 {
+				target = args[1]
+			}
+			return a.rollbackPolicies(generation, target, *rollbackMachine)
+		},
+	}
+	rollbackMachine = rollbackCmd.Flags().BoolP("machine", "m", false, gotext.Get("machine rolls back the policy of the computer."))
+	policyCmd.AddCommand(rollbackCmd)
+
 	a.rootCmd.AddCommand(policyCmd)
 }
 
@@ -223,7 +395,7 @@ func (a App) getPolicyDefinitions(format, distroID string) (err error) {
 	return nil
 }
 
-func (a *App) dumpPolicies(target string, showDetails, showOverridden, nocolor, isMachine bool) error {
+func (a *App) dumpPolicies(target string, showDetails, showOverridden, nocolor, isMachine bool, format string) error {
 	// incompatible options
 	if showOverridden && !showDetails {
 		showDetails = true
@@ -257,6 +429,7 @@ func (a *App) dumpPolicies(target string, showDetails, showOverridden, nocolor,
 		IsComputer: isMachine,
 		Details:    showDetails,
 		All:        showOverridden,
+		Format:     format,
 	})
 	if err != nil {
 		return err
@@ -267,6 +440,12 @@ func (a *App) dumpPolicies(target string, showDetails, showOverridden, nocolor,
 		return err
 	}
 
+	// Machine readable formats are printed as is.
+	if format != "text" {
+		fmt.Print(policies)
+		return nil
+	}
+
 	if nocolor {
 		color.NoColor = true
 	}
@@ -459,11 +638,14 @@ func (s *stringsBuilderWithError) Println(l string) {
 	_, s.err = s.Builder.WriteString(l)
 }
 
-func (a *App) update(isComputer, updateAll bool, target, krb5cc string) error {
+func (a *App) update(isComputer, updateAll, dryRun, force, login bool, target, krb5cc string) error {
 	// incompatible options
 	if updateAll && (isComputer || target != "" || krb5cc != "") {
 		return errors.New(gotext.Get("machine or user arguments cannot be used with update all"))
 	}
+	if login && (isComputer || updateAll) {
+		return errors.New(gotext.Get("login can only be used with a user update"))
+	}
 	if isComputer && (target != "" || krb5cc != "") {
 		return errors.New(gotext.Get("user arguments cannot be used with machine update"))
 	}
@@ -506,16 +688,17 @@ func (a *App) update(isComputer, updateAll bool, target, krb5cc string) error {
 		IsComputer: isComputer,
 		All:        updateAll,
 		Target:     target,
-		Krb5Cc:     krb5cc})
+		Krb5Cc:     krb5cc,
+		DryRun:     dryRun,
+		Force:      force,
+		Login:      login,
+	})
 	if err != nil {
 		return err
 	}
 
-	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
-		return err
-	}
-
-	return nil
+	// Planned changes are streamed in dry run mode, one message per object.
+	return printMsgs(stream)
 }
 
 func (a *App) purge(isComputer, purgeAll bool, target string) error {
@@ -562,13 +745,245 @@ func (a *App) purge(isComputer, purgeAll bool, target string) error {
 		return err
 	}
 
-	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+	return printMsgs(stream)
+}
+
+func (a *App) explainPolicy(key, target string, isMachine bool) error {
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
 		return err
 	}
 
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.ExplainPolicy(a.ctx, &adsys.ExplainPolicyRequest{
+		Target:     target,
+		IsComputer: isMachine,
+		Key:        key,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printMsgs(stream)
+}
+
+func (a *App) policiesReport(target string, isMachine bool, format string) error {
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
+		return err
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.PoliciesReport(a.ctx, &adsys.PoliciesReportRequest{
+		Target:     target,
+		IsComputer: isMachine,
+		Format:     format,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printMsgs(stream)
+}
+
+func (a *App) policiesStatus(target string, isMachine bool) error {
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
+		return err
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.PoliciesStatus(a.ctx, &adsys.PoliciesStatusRequest{
+		Target:     target,
+		IsComputer: isMachine,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printMsgs(stream)
+}
+
+func (a *App) checkPoliciesDrift(target string, isMachine, all, heal bool) error {
+	if all && target != "" {
+		return errors.New(gotext.Get("user arguments cannot be used with all"))
+	}
+
+	var err error
+	if !all {
+		if target, err = defaultTarget(target, isMachine); err != nil {
+			return err
+		}
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.CheckPoliciesDrift(a.ctx, &adsys.CheckPoliciesDriftRequest{
+		Target:     target,
+		IsComputer: isMachine,
+		All:        all,
+		Heal:       heal,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Drift is streamed with one message per object.
+	return printMsgs(stream)
+}
+
+func (a *App) policiesHistory(target string, isMachine bool) error {
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
+		return err
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.ListPoliciesHistory(a.ctx, &adsys.ListPoliciesHistoryRequest{
+		Target:     target,
+		IsComputer: isMachine,
+	})
+	if err != nil {
+		return err
+	}
+
+	return printMsgs(stream)
+}
+
+func (a *App) diffPoliciesHistory(target string, isMachine, nocolor bool, generations []int) error {
+	if len(generations) != 2 {
+		return errors.New(gotext.Get("diff requires exactly 2 generations, got %d", len(generations)))
+	}
+
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
+		return err
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.DiffPoliciesHistory(a.ctx, &adsys.DiffPoliciesHistoryRequest{
+		Target:     target,
+		IsComputer: isMachine,
+		From:       int64(generations[0]),
+		To:         int64(generations[1]),
+	})
+	if err != nil {
+		return err
+	}
+
+	diff, err := singleMsg(stream)
+	if err != nil {
+		return err
+	}
+
+	if nocolor {
+		color.NoColor = true
+	}
+	fmt.Print(colorizeDiff(diff))
+
 	return nil
 }
 
+func (a *App) rollbackPolicies(generation int, target string, isMachine bool) error {
+	if isMachine && target != "" {
+		return errors.New(gotext.Get("user arguments cannot be used with machine rollback"))
+	}
+
+	target, err := defaultTarget(target, isMachine)
+	if err != nil {
+		return err
+	}
+
+	client, err := adsysservice.NewClient(a.config.Socket, a.getTimeout())
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	stream, err := client.RollbackPolicies(a.ctx, &adsys.RollbackPoliciesRequest{
+		Target:     target,
+		IsComputer: isMachine,
+		Generation: int64(generation),
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err := stream.Recv(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// historyTarget returns target, defaulting to the machine or the current user.
+func defaultTarget(target string, isMachine bool) (string, error) {
+	if target != "" {
+		return target, nil
+	}
+
+	if isMachine {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("failed to retrieve client hostname: %w", err)
+		}
+		// for malconfigured machines where /proc/sys/kernel/hostname returns the fqdn and not only the machine name, strip it
+		target, _, _ = strings.Cut(hostname, ".")
+		return target, nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve current user: %w", err)
+	}
+	return u.Username, nil
+}
+
+// colorizeDiff highlights added, removed and modified entries of a policies diff.
+func colorizeDiff(diff string) string {
+	var out strings.Builder
+	for _, l := range strings.Split(strings.TrimSuffix(diff, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(l, "** + "):
+			l = color.GreenString("%s", l)
+		case strings.HasPrefix(l, "** - "):
+			l = color.RedString("%s", l)
+		case strings.HasPrefix(l, "** ~ "):
+			l = color.YellowString("%s", l)
+		}
+		out.WriteString(l + "\n")
+	}
+	return out.String()
+}
+
 // users returns the list of connected users according to their cached policy information.
 // If active is true, the list of users is retrieved from the cached Kerberos ticket information.
 func (a App) users(active bool) []string {
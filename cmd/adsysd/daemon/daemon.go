@@ -4,12 +4,14 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"runtime"
 	"time"
 
 	"github.com/leonelquinteros/gotext"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/ubuntu/adsys/internal/ad/backends/keytab"
 	"github.com/ubuntu/adsys/internal/ad/backends/sss"
 	"github.com/ubuntu/adsys/internal/ad/backends/winbind"
 	"github.com/ubuntu/adsys/internal/adsysservice"
@@ -52,8 +54,13 @@ type daemonConfig struct {
 	GlobalTrustDir string `mapstructure:"global_trust_dir"`
 
 	AdBackend     string         `mapstructure:"ad_backend"`
+	GpoList       string         `mapstructure:"gpo_list"`
+	LocalGPODir   string         `mapstructure:"local_gpo_dir"`
 	SSSdConfig    sss.Config     `mapstructure:"sssd"`
 	WinbindConfig winbind.Config `mapstructure:"winbind"`
+	KeytabConfig  keytab.Config  `mapstructure:"keytab"`
+
+	FastLogin adsysservice.FastLoginConfig `mapstructure:"fast_login"`
 
 	ServiceTimeout int `mapstructure:"service_timeout"`
 }
@@ -83,7 +90,7 @@ func New() *App {
 				// Config reload
 
 				// No change in config file: skip.
-				if a.config == newConfig {
+				if reflect.DeepEqual(a.config, newConfig) {
 					return nil
 				}
 
@@ -123,8 +130,12 @@ func New() *App {
 				adsysservice.WithSystemUnitDir(a.config.SystemUnitDir),
 				adsysservice.WithGlobalTrustDir(a.config.GlobalTrustDir),
 				adsysservice.WithADBackend(a.config.AdBackend),
+				adsysservice.WithGpoList(a.config.GpoList),
+				adsysservice.WithLocalGPODir(a.config.LocalGPODir),
 				adsysservice.WithSSSConfig(a.config.SSSdConfig),
 				adsysservice.WithWinbindConfig(a.config.WinbindConfig),
+				adsysservice.WithKeytabConfig(a.config.KeytabConfig),
+				adsysservice.WithFastLogin(a.config.FastLogin),
 			)
 			if err != nil {
 				close(a.ready)
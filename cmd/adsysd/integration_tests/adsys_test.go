@@ -245,6 +245,9 @@ service_timeout: 30
 # Backend selection: sssd (default) or winbind
 ad_backend: %[2]s
 
+# GPO list is done by the python script against the mocked samba modules
+gpo_list: script
+
 # SSSd configuration
 sssd:
   config: testdata/sssd-configs/sssd.conf-example.com
@@ -3,7 +3,9 @@ package adsys_test
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"os/user"
@@ -217,6 +219,7 @@ func TestPolicyUpdate(t *testing.T) {
 		winbindMockBehavior string
 		krb5MockBehavior    string
 		purge               bool
+		dryRun              bool
 		missingCertmonger   bool
 		noExportKrb5cc      bool
 		detectCachedTicket  bool
@@ -650,6 +653,28 @@ func TestPolicyUpdate(t *testing.T) {
 			missingCertmonger: true,
 		},
 
+		// Dry-run cases
+		"Machine, dry-run does not apply policies": {
+			args:       []string{"-m"},
+			dryRun:     true,
+			addPaths:   []string{"apparmorfs/profiles"},
+			krb5ccname: "-",
+			krb5ccNamesState: []krb5ccNamesWithState{
+				{
+					src:     "ccache_EXAMPLE.COM",
+					machine: true,
+				},
+			}},
+		"Current user, dry-run does not apply policies": {
+			dryRun:    true,
+			initState: "localhost-uptodate",
+		},
+		"Dry-run for all cached objects does not apply policies": {
+			args:      []string{"--all"},
+			dryRun:    true,
+			initState: "old-data",
+		},
+
 		// Purge cases
 		"Purge current user policies": {
 			purge:     true,
@@ -1166,6 +1191,9 @@ func TestPolicyUpdate(t *testing.T) {
 				action = "purge"
 			}
 			args := []string{"policy", action}
+			if tc.dryRun {
+				args = append(args, "--dry-run")
+			}
 			for _, arg := range tc.args {
 				// Prefix krb5 ticket with our krb5dir
 				if strings.HasSuffix(arg, ".krb5") {
@@ -1173,7 +1201,8 @@ func TestPolicyUpdate(t *testing.T) {
 				}
 				args = append(args, arg)
 			}
-			_, err = runClient(t, conf, args...)
+			before := systemStateContent(t, adsysDir)
+			out, err := runClient(t, conf, args...)
 			if tc.wantErr {
 				require.Error(t, err, "client should exit with an error")
 				// Client version is still printed
@@ -1181,6 +1210,12 @@ func TestPolicyUpdate(t *testing.T) {
 			}
 			require.NoError(t, err, "client should exit with no error")
 
+			if tc.dryRun {
+				require.Contains(t, out, "Planned changes for", "dry-run should print the planned changes")
+				require.Equal(t, before, systemStateContent(t, adsysDir), "dry-run should not modify the system")
+				return
+			}
+
 			goldenPath := testutils.GoldenPath(t)
 			update := testutils.UpdateEnabled()
 			testutils.CompareTreesWithFiltering(t, filepath.Join(adsysDir, "dconf"), filepath.Join(goldenPath, "dconf"), update)
@@ -1204,6 +1239,31 @@ func TestPolicyUpdate(t *testing.T) {
 	}
 }
 
+// systemStateContent returns the content of every file which policies managers can write in adsysDir, keyed by path.
+func systemStateContent(t *testing.T, adsysDir string) map[string]string {
+	t.Helper()
+
+	content := make(map[string]string)
+	for _, d := range []string{"dconf", "sudoers.d", "polkit-1", filepath.Join("apparmor.d", "adsys"), filepath.Join("systemd", "system"), "lib", filepath.Join("run", "users"), filepath.Join("run", "machine")} {
+		err := filepath.WalkDir(filepath.Join(adsysDir, d), func(p string, de fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || de.IsDir() {
+				return err
+			}
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			content[p] = string(data)
+			return nil
+		})
+		require.NoError(t, err, "Setup: could not read system state")
+	}
+	return content
+}
+
 func TestPolicyDebugScriptDump(t *testing.T) {
 	tests := map[string]struct {
 		script  string
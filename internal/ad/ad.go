@@ -5,16 +5,14 @@
 package ad
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	_ "embed" // embed gpolist python binary.
 	"errors"
 	"fmt"
 	"io/fs"
+	"net"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -23,14 +21,16 @@ import (
 	"github.com/leonelquinteros/gotext"
 	"github.com/ubuntu/adsys/internal/ad/backends"
 	adcommon "github.com/ubuntu/adsys/internal/ad/common"
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+	"github.com/ubuntu/adsys/internal/ad/filter"
 	"github.com/ubuntu/adsys/internal/ad/registry"
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies"
 	"github.com/ubuntu/adsys/internal/policies/entry"
-	"github.com/ubuntu/adsys/internal/smbsafe"
 	"github.com/ubuntu/decorate"
 	"golang.org/x/sync/errgroup"
+	"gopkg.in/yaml.v3"
 )
 
 // ObjectClass is the type of object in the directory. It can be a computer or a user.
@@ -48,6 +48,11 @@ const (
 	// policyServerPrefix is the GPO prefix containing keys that configure
 	// policy servers for certificate enrollment.
 	policyServersPrefix string = "Software/Policies/Microsoft/Cryptography/PolicyServers/"
+
+	// loopbackMerge is the loopback processing mode where computer GPOs user settings extend the user ones.
+	loopbackMerge = "merge"
+	// loopbackReplace is the loopback processing mode where computer GPOs user settings replace the user ones.
+	loopbackReplace = "replace"
 )
 
 type gpo downloadable
@@ -57,6 +62,8 @@ type downloadable struct {
 	url      string
 	mu       *sync.RWMutex
 	isAssets bool
+	// domain is the AD domain of the downloadable when it isn't the backend one.
+	domain string
 
 	// This property is used to instrument the tests for concurrent download and parsing of GPOs
 	// Cf internal_test::TestFetchOneGPOWhileParsingItConcurrently()
@@ -78,8 +85,15 @@ type AD struct {
 	fetchMu sync.Mutex
 
 	withoutKerberos bool
-	gpoListCmd      []string
+	gpoLister       gpoLister
 	gpoListTimeout  time.Duration
+	kinitCmd        []string
+	localGPOsDir    string
+
+	dcResolver    dclocator.Resolver
+	probeDC       func(ctx context.Context, dc string) error
+	usedServers   map[string]string
+	usedServersMu sync.Mutex
 }
 
 type options struct {
@@ -90,6 +104,10 @@ type options struct {
 	withoutKerberos bool
 	gpoListCmd      []string
 	gpoListTimeout  time.Duration
+	kinitCmd        []string
+	localGPOsDir    string
+	dcResolver      dclocator.Resolver
+	probeDC         func(ctx context.Context, dc string) error
 }
 
 // Option reprents an optional function to change AD behavior.
@@ -111,7 +129,7 @@ func WithRunDir(runDir string) Option {
 	}
 }
 
-// WithGpoListTimeout specifies a custom timeout for the adsys-gpolist command.
+// WithGpoListTimeout specifies a custom timeout for listing the GPOs of an object.
 func WithGpoListTimeout(timeout time.Duration) Option {
 	return func(o *options) error {
 		o.gpoListTimeout = timeout
@@ -119,6 +137,14 @@ func WithGpoListTimeout(timeout time.Duration) Option {
 	}
 }
 
+// WithGpoListScript lists GPOs with the embedded adsys-gpolist python script instead of querying LDAP directly.
+func WithGpoListScript() Option {
+	return func(o *options) error {
+		o.gpoListCmd = []string{"python3", "-c", AdsysGpoListCode}
+		return nil
+	}
+}
+
 // AdsysGpoListCode is the embedded script which request
 // Samba to get our GPO list for the given object.
 //
@@ -138,9 +164,13 @@ func New(ctx context.Context, configBackend backends.Backend, hostname string, o
 	args := options{
 		runDir:         consts.DefaultRunDir,
 		cacheDir:       consts.DefaultCacheDir,
-		gpoListCmd:     []string{"python3", "-c", AdsysGpoListCode},
 		versionID:      versionID,
 		gpoListTimeout: 30 * time.Second, // this is used in tests and set to consts.DefaultGpoListTimeout in production
+		kinitCmd:       []string{"kinit"},
+		dcResolver:     net.DefaultResolver,
+		probeDC: func(ctx context.Context, dc string) error {
+			return dclocator.Probe(ctx, dc, dcProbeTimeout)
+		},
 	}
 	// applied options
 	for _, o := range opts {
@@ -170,6 +200,11 @@ func New(ctx context.Context, configBackend backends.Backend, hostname string, o
 	}
 	log.Debugf(ctx, "Backend is SSSD. AD domain: %q, server from configuration: %q", domain, serverFQDN)
 
+	var lister gpoLister = ldapGPOLister{staticSite: configBackend.Site()}
+	if args.gpoListCmd != nil {
+		lister = cmdGPOLister{cmd: args.gpoListCmd}
+	}
+
 	return &AD{
 		hostname:         hostname,
 		configBackend:    configBackend,
@@ -179,8 +214,14 @@ func New(ctx context.Context, configBackend backends.Backend, hostname string, o
 		krb5CacheDir:     krb5CacheDir,
 
 		downloadables:  make(map[string]*downloadable),
-		gpoListCmd:     args.gpoListCmd,
+		gpoLister:      lister,
 		gpoListTimeout: args.gpoListTimeout,
+		kinitCmd:       args.kinitCmd,
+		localGPOsDir:   args.localGPOsDir,
+
+		dcResolver:  args.dcResolver,
+		probeDC:     args.probeDC,
+		usedServers: make(map[string]string),
 	}, nil
 }
 
@@ -204,6 +245,11 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 		return pols, errors.New(gotext.Get("requested a type computer of %q which isn't current host %q", objectName, ad.hostname))
 	}
 
+	// Local GPOs are read without Active Directory nor Kerberos
+	if ad.localGPOsDir != "" {
+		return ad.getLocalPolicies(ctx, objectName, objectClass)
+	}
+
 	krb5CCPath := filepath.Join(ad.krb5CacheDir, objectName)
 	krb5CCSymlink := filepath.Join(ad.krb5CacheDir, "tracking", objectName)
 	// Create a ccache symlink on first fetch for future calls (on refresh for instance)
@@ -227,6 +273,7 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 	if err := ad.ensureKrb5CCCopy(krb5CCSymlink, krb5CCPath); err != nil {
 		return pols, err
 	}
+	ad.renewKrb5CC(ctx, krb5CCPath)
 
 	var online bool
 	if online, err = ad.configBackend.IsOnline(); err != nil {
@@ -244,48 +291,64 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 		return cachedPolicies, nil
 	}
 
-	// We need an AD DC to connect to
-	adServerFQDN, err := ad.configBackend.ServerFQDN(ctx)
-	if err != nil {
-		return policies.Policies{}, errors.New(gotext.Get("can't get current Server FQDN: %v", err))
+	// We need an AD DC to connect to: users get their GPOs from a DC of their own domain, which can be a trusted one
+	var adServerFQDN, trustedDomain string
+	if objectClass == UserObject {
+		_, userDomain, _ := strings.Cut(objectName, "@")
+		var trusted bool
+		adServerFQDN, trusted, err = ad.configBackend.DomainServerFQDN(ctx, userDomain)
+		if err != nil {
+			return policies.Policies{}, errors.New(gotext.Get("can't get current Server FQDN of domain %q: %v", userDomain, err))
+		}
+		if trusted {
+			trustedDomain = strings.ToLower(userDomain)
+			log.Debugf(ctx, "%q is a user of the trusted domain %q, using server %q", objectName, trustedDomain, adServerFQDN)
+		}
+	} else {
+		adServerFQDN, err = ad.configBackend.ServerFQDN(ctx)
+		if err != nil {
+			return policies.Policies{}, errors.New(gotext.Get("can't get current Server FQDN: %v", err))
+		}
+	}
+
+	// Fail over to the other domain controllers of the domain if this one can't be used
+	serversDomain := trustedDomain
+	if serversDomain == "" {
+		serversDomain = ad.configBackend.Domain()
 	}
+	servers := ad.serverCandidates(ctx, serversDomain, adServerFQDN)
 
 	// Otherwise, try fetching the GPO list from LDAP
-	args := append([]string{}, ad.gpoListCmd...) // Copy gpoListCmd to prevent data race
-	scriptArgs := []string{"--objectclass", string(objectClass), adServerFQDN, objectName}
-	cmdArgs := append(args, scriptArgs...)
-	cmdCtx, cancel := context.WithTimeout(ctx, time.Second*10)
-	defer cancel()
-	log.Debugf(ctx, "Getting gpo list with arguments: %q", strings.Join(scriptArgs, " "))
-	// #nosec G204 - cmdArgs is under our control (python embedded script or mock for tests)
-	cmd := exec.CommandContext(cmdCtx, cmdArgs[0], cmdArgs[1:]...)
-	cmd.Env = append(os.Environ(), fmt.Sprintf("KRB5CCNAME=%s", krb5CCPath))
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-
-	smbsafe.WaitExec()
-	err = cmd.Run()
-	smbsafe.DoneExec()
+	orderedGPOs, servers, err := ad.listGPOsWithFailover(ctx, servers, krb5CCPath, objectName, objectClass)
 	if err != nil {
-		return pols, errors.New(gotext.Get("failed to retrieve the list of GPO (exited with %d): %v\n%s", cmd.ProcessState.ExitCode(), err, stderr.String()))
+		return pols, err
+	}
+	adServerFQDN = servers[0]
+
+	for i := range orderedGPOs {
+		orderedGPOs[i].domain = trustedDomain
+	}
+
+	// User settings of the computer GPOs replace or extend the user ones with loopback processing
+	var loopbackGPOs map[string]struct{}
+	if objectClass == UserObject {
+		listCtx, cancel := context.WithTimeout(ctx, ad.gpoListTimeout)
+		defer cancel()
+		orderedGPOs, loopbackGPOs, err = ad.withLoopbackGPOs(listCtx, orderedGPOs, krb5CCPath, adServerFQDN, objectName, trustedDomain)
+		if err != nil {
+			return pols, err
+		}
 	}
 
 	downloadables := make(map[string]string)
-	var orderedGPOs []gpo
-	scanner := bufio.NewScanner(&stdout)
-	for scanner.Scan() {
-		t := scanner.Text()
-		res := strings.SplitN(t, "\t", 2)
-		gpoName, gpoURL := res[0], res[1]
-		log.Debugf(ctx, "GPO %q for %q available at %q", gpoName, objectName, gpoURL)
-		downloadables[gpoName] = gpoURL
-		orderedGPOs = append(orderedGPOs, gpo{name: gpoName, url: gpoURL})
+	for _, g := range orderedGPOs {
+		log.Debugf(ctx, "GPO %q for %q available at %q", g.name, objectName, g.url)
+		downloadables[g.name] = g.url
 
 		if _, ok := downloadables["assets"]; ok {
 			continue
 		}
-		u, err := url.Parse(gpoURL)
+		u, err := url.Parse(g.url)
 		if err != nil {
 			return pols, err
 		}
@@ -293,13 +356,28 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 		u.Path = filepath.Join(filepath.Dir(filepath.Dir(u.Path)), consts.DistroID)
 		downloadables["assets"] = u.String()
 	}
-	if err := scanner.Err(); err != nil {
-		return pols, err
-	}
 
 	ad.Lock()
 	defer ad.Unlock()
-	assetsWereRefresh, err := ad.fetch(ctx, krb5CCPath, downloadables)
+	assetsWereRefresh, usedServer, err := ad.fetchWithFailover(ctx, krb5CCPath, trustedDomain, servers, downloadables)
+	if err != nil {
+		return pols, err
+	}
+	ad.setUsedServer(trustedDomain, usedServer)
+
+	return ad.policiesFromSysvol(ctx, orderedGPOs, loopbackGPOs, assetsWereRefresh, objectName, objectClass, trustedDomain)
+}
+
+// policiesFromSysvol returns the policies of objectName from the ordered GPOs and assets fetched in the SYSVOL cache of
+// trustedDomain, or of the backend domain if empty. The GPOs which don't match this machine are filtered out.
+// The AD lock must be held by the caller.
+func (ad *AD) policiesFromSysvol(ctx context.Context, orderedGPOs []gpo, loopbackGPOs map[string]struct{}, assetsWereRefresh bool, objectName string, objectClass ObjectClass, trustedDomain string) (pols policies.Policies, err error) {
+	// Only keep the GPOs whose filter matches this machine
+	facts := filter.NewFacts("/", ad.versionID, ad.hostname)
+	if objectClass == UserObject {
+		facts.User = objectName
+	}
+	orderedGPOs, filters, filteredGPOs, err := ad.filterGPOs(ctx, orderedGPOs, facts)
 	if err != nil {
 		return pols, err
 	}
@@ -309,12 +387,20 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 	var gposRules []policies.GPO
 	errg.Go(func() (err error) {
 		gposRules, err = ad.parseGPOs(ctx, orderedGPOs, objectClass)
+		for i := range gposRules {
+			gposRules[i].Filter = filters[gposRules[i].Name]
+			_, gposRules[i].Loopback = loopbackGPOs[gposRules[i].Name]
+		}
+		if err != nil {
+			return err
+		}
+		gposRules, err = ad.targetRules(ctx, gposRules, trustedDomain, facts)
 		return err
 	})
 
 	// Compress assets
 	var assetsDbPath string
-	assetsSrc := filepath.Join(ad.sysvolCacheDir, "assets")
+	assetsSrc := filepath.Join(ad.sysvolDir(trustedDomain), "assets")
 	errg.Go(func() (err error) {
 		// Only compress assets if we have fetched them, otherwise attach optionally
 		// existing db.
@@ -353,7 +439,216 @@ func (ad *AD) GetPolicies(ctx context.Context, objectName string, objectClass Ob
 		return pols, fmt.Errorf("one or more error while parsing downloaded elements: %w", err)
 	}
 
-	return policies.New(ctx, gposRules, assetsDbPath)
+	pols, err = policies.New(ctx, gposRules, assetsDbPath)
+	if err != nil {
+		return pols, err
+	}
+	pols.FilteredGPOs = filteredGPOs
+	return pols, nil
+}
+
+// GetCachedPolicies returns the policies of objectName saved by its last update, without reaching AD.
+func (ad *AD) GetCachedPolicies(ctx context.Context, objectName string) (pols policies.Policies, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get cached policies for %q", objectName))
+
+	return policies.NewFromCache(ctx, filepath.Join(ad.policiesCacheDir, objectName))
+}
+
+// withLoopbackGPOs returns the GPOs applying to the user objectName with the loopback processing mode enabled on
+// this machine, along with the names of the GPOs linked to the computer.
+// In replace mode, only the user settings of the computer GPOs apply. In merge mode, they take precedence over the
+// user GPOs, which are only listed once if linked to both.
+// Loopback processing is not supported for users of a trusted domain, set in trustedDomain.
+func (ad *AD) withLoopbackGPOs(ctx context.Context, userGPOs []gpo, krb5CCPath, adServerFQDN, objectName, trustedDomain string) (gpos []gpo, loopbackGPOs map[string]struct{}, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply loopback processing"))
+
+	mode := ad.loopbackMode(ctx)
+	if mode == "" {
+		return userGPOs, nil, nil
+	}
+	if mode != loopbackMerge && mode != loopbackReplace {
+		log.Warningf(ctx, "Unknown loopback processing mode %q, ignoring it", mode)
+		return userGPOs, nil, nil
+	}
+	if trustedDomain != "" {
+		log.Warningf(ctx, "Loopback processing is not supported for %q, user of the trusted domain %q, ignoring it", objectName, trustedDomain)
+		return userGPOs, nil, nil
+	}
+	log.Debugf(ctx, "Loopback processing in %s mode for %q", mode, objectName)
+
+	computerGPOs, err := ad.gpoLister.listLoopbackGPOs(ctx, krb5CCPath, adServerFQDN, objectName, ad.hostname)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loopbackGPOs = make(map[string]struct{})
+	for _, g := range computerGPOs {
+		loopbackGPOs[g.name] = struct{}{}
+		gpos = append(gpos, g)
+	}
+	if mode == loopbackReplace {
+		return gpos, loopbackGPOs, nil
+	}
+	for _, g := range userGPOs {
+		if _, ok := loopbackGPOs[g.name]; ok {
+			continue
+		}
+		gpos = append(gpos, g)
+	}
+	return gpos, loopbackGPOs, nil
+}
+
+// sysvolDir returns the cache directory of the SYSVOL of domain, or of the backend domain if empty.
+// Trusted domains have their own directory, as GPOs of different domains, like the default ones, can share the same
+// name and ID.
+func (ad *AD) sysvolDir(domain string) string {
+	if domain == "" {
+		return ad.sysvolCacheDir
+	}
+	return filepath.Join(ad.sysvolCacheDir, "domains", domain)
+}
+
+// downloadableKey returns the key of the downloadable name of domain in the downloadables cache.
+func downloadableKey(domain, name string) string {
+	if domain == "" {
+		return name
+	}
+	return domain + "/" + name
+}
+
+// loopbackMode returns the user Group Policy loopback processing mode set by the policies of this machine, if any.
+func (ad *AD) loopbackMode(ctx context.Context) string {
+	pols, err := policies.NewFromCache(ctx, filepath.Join(ad.policiesCacheDir, ad.hostname))
+	if err != nil {
+		log.Debugf(ctx, "No machine policies to get loopback processing mode from: %v", err)
+		return ""
+	}
+	defer decorate.LogFuncOnErrorContext(ctx, pols.Close)
+
+	for _, e := range pols.GetUniqueRules()["gpo"] {
+		if e.Key == "loopback" && !e.Disabled {
+			return strings.TrimSpace(e.Value)
+		}
+	}
+	return ""
+}
+
+// filterGPOs returns the GPOs whose host filter matches this machine, with the filter of each of them by name, and
+// the GPOs which are filtered out.
+// A filter is stored in the <DistroID>/filter file of the GPO directory. GPOs without one always apply, while GPOs
+// whose filter is invalid or can't be evaluated never apply.
+func (ad *AD) filterGPOs(ctx context.Context, gpos []gpo, facts *filter.Facts) (kept []gpo, filters map[string]string, filteredOut []policies.GPO, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't filter GPOs"))
+
+	filters = make(map[string]string)
+	for _, g := range gpos {
+		content, err := func() ([]byte, error) {
+			d := ad.downloadables[downloadableKey(g.domain, g.name)]
+			d.mu.RLock()
+			defer d.mu.RUnlock()
+			return os.ReadFile(filepath.Join(ad.sysvolDir(g.domain), "Policies", filepath.Base(g.url), consts.DistroID, "filter"))
+		}()
+		if errors.Is(err, fs.ErrNotExist) {
+			kept = append(kept, g)
+			continue
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+
+		f, err := filter.Parse(string(content))
+		var match bool
+		if err == nil {
+			match, err = f.Eval(facts)
+		}
+		if err != nil {
+			log.Warningf(ctx, "GPO %q is not applied: %v", g.name, err)
+			filteredOut = append(filteredOut, policies.GPO{ID: filepath.Base(g.url), Name: g.name, Filter: strings.Join(strings.Fields(string(content)), " ")})
+			continue
+		}
+
+		if !match {
+			log.Debugf(ctx, "GPO %q is filtered out by %q", g.name, f)
+			filteredOut = append(filteredOut, policies.GPO{ID: filepath.Base(g.url), Name: g.name, Filter: f.String()})
+			continue
+		}
+		filters[g.name] = f.String()
+		kept = append(kept, g)
+	}
+
+	return kept, filters, filteredOut, nil
+}
+
+// targetRules only keeps in gpos the rules whose item-level targeting matches this machine and object. The other
+// ones are moved to the targeted out rules of their GPO.
+// Targets are stored in the <DistroID>/targeting file of the GPO directory, mapping the rule type and key, like
+// dconf/org/gnome/desktop/interface/clock-format, to a filter. Rules whose target is invalid or can't be evaluated
+// are never applied. GPOs whose targeting file is invalid are not applied at all, as their targeted rules are unknown.
+// domain is the AD domain of the GPOs when it isn't the backend one.
+func (ad *AD) targetRules(ctx context.Context, gpos []policies.GPO, domain string, facts *filter.Facts) (kept []policies.GPO, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't evaluate item-level targeting"))
+
+	for _, g := range gpos {
+		content, err := func() ([]byte, error) {
+			d := ad.downloadables[downloadableKey(domain, g.Name)]
+			d.mu.RLock()
+			defer d.mu.RUnlock()
+			return os.ReadFile(filepath.Join(ad.sysvolDir(domain), "Policies", g.ID, consts.DistroID, "targeting"))
+		}()
+		if errors.Is(err, fs.ErrNotExist) {
+			kept = append(kept, g)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		var targets map[string]string
+		if err := yaml.Unmarshal(content, &targets); err != nil {
+			log.Warningf(ctx, "GPO %q is not applied: invalid targeting file: %v", g.Name, err)
+			continue
+		}
+
+		for keyType, entries := range g.Rules {
+			var keptEntries []entry.Entry
+			for _, e := range entries {
+				target, ok := targets[keyType+"/"+e.Key]
+				if !ok {
+					keptEntries = append(keptEntries, e)
+					continue
+				}
+
+				f, err := filter.Parse(target)
+				var match bool
+				if err == nil {
+					match, err = f.Eval(facts)
+				}
+				switch {
+				case err != nil:
+					log.Warningf(ctx, "%s/%s from GPO %q is not applied: %v", keyType, e.Key, g.Name, err)
+					e.Target = strings.Join(strings.Fields(target), " ")
+				case !match:
+					log.Debugf(ctx, "%s/%s from GPO %q is targeted out by %q", keyType, e.Key, g.Name, f)
+					e.Target = f.String()
+				default:
+					e.Target = f.String()
+					keptEntries = append(keptEntries, e)
+					continue
+				}
+
+				if g.TargetedOutRules == nil {
+					g.TargetedOutRules = make(map[string][]entry.Entry)
+				}
+				g.TargetedOutRules[keyType] = append(g.TargetedOutRules[keyType], e)
+			}
+			if len(keptEntries) == 0 {
+				delete(g.Rules, keyType)
+				continue
+			}
+			g.Rules[keyType] = keptEntries
+		}
+		kept = append(kept, g)
+	}
+
+	return kept, nil
 }
 
 // ListUsers returns the list of users on the system based on their cached policy information.
@@ -492,9 +787,10 @@ func (ad *AD) parseGPOs(ctx context.Context, gpos []gpo, objectClass ObjectClass
 		}
 		r = append(r, gpoWithRules)
 		if err := func() error {
-			ad.downloadables[name].mu.RLock()
-			defer ad.downloadables[name].mu.RUnlock()
-			_ = ad.downloadables[name].testConcurrent
+			d := ad.downloadables[downloadableKey(g.domain, name)]
+			d.mu.RLock()
+			defer d.mu.RUnlock()
+			_ = d.testConcurrent
 
 			log.Debugf(ctx, "Parsing GPO %q", name)
 
@@ -510,7 +806,7 @@ func (ad *AD) parseGPOs(ctx context.Context, gpos []gpo, objectClass ObjectClass
 			var f *os.File
 			for _, class := range classes {
 				var e error
-				f, e = os.Open(filepath.Join(ad.sysvolCacheDir, "Policies", filepath.Base(url), class, "Registry.pol"))
+				f, e = os.Open(filepath.Join(ad.sysvolDir(g.domain), "Policies", filepath.Base(url), class, "Registry.pol"))
 
 				// We only care about the first error which is caused by opening
 				// the capitalized version of the class, instead of the
@@ -591,6 +887,8 @@ func (ad *AD) parseGPOs(ctx context.Context, gpos []gpo, objectClass ObjectClass
 				// Replace value with the override content
 				iLast := len(gpoWithRules.Rules[keyType]) - 1
 				p := gpoWithRules.Rules[keyType][iLast]
+				p.AllReleasesValue = p.Value
+				p.ReleaseOverride = ad.versionID
 				p.Value = pol.Value
 				gpoWithRules.Rules[keyType][iLast] = p
 			}
@@ -622,7 +920,11 @@ func (ad *AD) GetInfo(ctx context.Context) (msg string) {
 		server = "Unknown"
 	}
 
-	return gotext.Get("%s\n%sDomain: %s\nServer FQDN: %s", config, online, domain, server)
+	msg = gotext.Get("%s\n%sDomain: %s\nServer FQDN: %s", config, online, domain, server)
+	if used := ad.usedServersInfo(); used != "" {
+		msg = msg + "\n" + used
+	}
+	return msg
 }
 
 // NormalizeTargetName transforms the specified target to values adsys knows.
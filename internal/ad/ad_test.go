@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"net"
 	"os"
 	"path/filepath"
 	"sort"
@@ -117,9 +118,12 @@ func TestGetPolicies(t *testing.T) {
 
 		turnKrb5CCCacheRO bool
 		existing          map[string]string
+		loopbackMode      string
+		dcs               []string
 
 		want             policies.Policies
 		wantAssetsEquals string
+		wantUsedServer   string
 		wantErr          bool
 	}{
 		"Standard policy, user object": {
@@ -217,7 +221,7 @@ func TestGetPolicies(t *testing.T) {
 			gpoListArgs: []string{"gpoonly.com", "bob:multiple-releases-one-enabled"},
 			want: policies.Policies{GPOs: []policies.GPO{{ID: "multiple-releases-one-enabled", Name: "multiple-releases-one-enabled-name", Rules: map[string][]entry.Entry{
 				"dconf": {
-					{Key: "A", Value: "21.04Value"},
+					{Key: "A", Value: "21.04Value", ReleaseOverride: "21.04", AllReleasesValue: "AllValue"},
 				}}}},
 			},
 		},
@@ -235,7 +239,7 @@ func TestGetPolicies(t *testing.T) {
 			gpoListArgs: []string{"gpoonly.com", "bob:multiple-releases"},
 			want: policies.Policies{GPOs: []policies.GPO{{ID: "multiple-releases", Name: "multiple-releases-name", Rules: map[string][]entry.Entry{
 				"dconf": {
-					{Key: "A", Value: "21.04Value"},
+					{Key: "A", Value: "21.04Value", ReleaseOverride: "21.04", AllReleasesValue: "AllValue"},
 				}}}},
 			},
 		},
@@ -424,6 +428,195 @@ func TestGetPolicies(t *testing.T) {
 			}},
 		},
 
+		// Host filters
+		"GPO with matching host filter is applied": {
+			gpoListArgs: []string{"gpoonly.com", "bob:host-filter-match::bob:one-value"},
+			want: policies.Policies{GPOs: []policies.GPO{
+				withFilter(standardUserGPO("host-filter-match"), "hostname = *"),
+				{ID: "one-value", Name: "one-value-name", Rules: map[string][]entry.Entry{
+					"dconf": {
+						{Key: "C", Value: "oneValueC"},
+					}}},
+			}},
+		},
+		"GPO with host filter not matching is filtered out": {
+			gpoListArgs: []string{"gpoonly.com", "bob:host-filter-no-match::bob:one-value"},
+			want: policies.Policies{
+				GPOs: []policies.GPO{
+					{ID: "one-value", Name: "one-value-name", Rules: map[string][]entry.Entry{
+						"dconf": {
+							{Key: "C", Value: "oneValueC"},
+						}}},
+				},
+				FilteredGPOs: []policies.GPO{{ID: "host-filter-no-match", Name: "host-filter-no-match-name", Filter: "hostname = not-this-host-*"}},
+			},
+		},
+		"GPO with invalid host filter is filtered out": {
+			objectName:  hostname,
+			objectClass: ad.ComputerObject,
+			gpoListArgs: []string{"gpoonly.com", hostname + ":host-filter-invalid::" + hostname + ":standard"},
+			want: policies.Policies{
+				GPOs:         []policies.GPO{standardComputerGPO("standard")},
+				FilteredGPOs: []policies.GPO{{ID: "host-filter-invalid", Name: "host-filter-invalid-name", Filter: "kernel >= 6.8"}},
+			},
+		},
+
+		// Item-level targeting
+		"Rules whose target does not match are targeted out": {
+			gpoListArgs: []string{"gpoonly.com", "bob:item-targeting"},
+			want: policies.Policies{GPOs: []policies.GPO{
+				{ID: "item-targeting", Name: "item-targeting-name",
+					Rules: map[string][]entry.Entry{
+						"dconf": {
+							{Key: "A", Value: "standardA", Target: "hostname = *"},
+						}},
+					TargetedOutRules: map[string][]entry.Entry{
+						"dconf": {
+							{Key: "B", Value: "standardB", Target: "hostname = not-this-host-*"},
+							{Key: "C", Value: "standardC", Target: "kernel >= 6.8"},
+						}},
+				},
+			}},
+		},
+		"GPO with an invalid targeting file is not applied": {
+			gpoListArgs: []string{"gpoonly.com", "bob:item-targeting-invalid::bob:standard"},
+			want:        policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+
+		// Loopback processing
+		"Loopback merge mode, computer GPOs come first": {
+			loopbackMode: "merge",
+			gpoListArgs:  []string{"gpoonly.com", "bob:standard::" + hostname + ":one-value"},
+			want: policies.Policies{GPOs: []policies.GPO{
+				{ID: "one-value", Name: "one-value-name", Loopback: true, Rules: map[string][]entry.Entry{
+					"dconf": {
+						{Key: "C", Value: "oneValueC"},
+					}}},
+				standardUserGPO("standard"),
+			}},
+		},
+		"Loopback merge mode, GPOs linked to the user and the computer are listed once": {
+			loopbackMode: "merge",
+			gpoListArgs:  []string{"gpoonly.com", "bob:standard::bob:user-only::" + hostname + ":standard"},
+			want: policies.Policies{GPOs: []policies.GPO{
+				withLoopback(standardUserGPO("standard")),
+				{ID: "user-only", Name: "user-only-name", Rules: map[string][]entry.Entry{
+					"dconf": {
+						{Key: "A", Value: "userOnlyA"},
+						{Key: "B", Value: "userOnlyB"},
+					}}},
+			}},
+		},
+		"Loopback replace mode, only computer GPOs apply": {
+			loopbackMode: "replace",
+			gpoListArgs:  []string{"gpoonly.com", "bob:standard::" + hostname + ":one-value"},
+			want: policies.Policies{GPOs: []policies.GPO{
+				{ID: "one-value", Name: "one-value-name", Loopback: true, Rules: map[string][]entry.Entry{
+					"dconf": {
+						{Key: "C", Value: "oneValueC"},
+					}}},
+			}},
+		},
+		"Loopback disabled, only user GPOs apply": {
+			loopbackMode: "disabled",
+			gpoListArgs:  []string{"gpoonly.com", "bob:standard::" + hostname + ":one-value"},
+			want:         policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+		"Unknown loopback mode is ignored": {
+			loopbackMode: "unknown",
+			gpoListArgs:  []string{"gpoonly.com", "bob:standard::" + hostname + ":one-value"},
+			want:         policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+		"Loopback mode does not apply to the computer": {
+			objectName:   hostname,
+			objectClass:  ad.ComputerObject,
+			loopbackMode: "replace",
+			gpoListArgs:  []string{"gpoonly.com", hostname + ":standard"},
+			want:         policies.Policies{GPOs: []policies.GPO{standardComputerGPO("standard")}},
+		},
+
+		// Trusted domains
+		"User of a trusted domain gets the GPOs of their domain": {
+			objectName: "bob@TRUSTED.COM",
+			backend: mock.Backend{
+				Dom:            "gpoonly.com",
+				TrustedDom:     "trusted.com",
+				TrustedServURL: "myserver.trusted.com",
+				Online:         true,
+			},
+			gpoListArgs: []string{"gpoonly.com", "bob:standard"},
+			want:        policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+		"User of a trusted domain gets the assets of their domain": {
+			objectName: "bob@TRUSTED.COM",
+			backend: mock.Backend{
+				Dom:            "gpoonly.com",
+				TrustedDom:     "trusted.com",
+				TrustedServURL: "myserver.trusted.com",
+				Online:         true,
+			},
+			gpoListArgs:      []string{"assetsandgpo.com", "bob:standard"},
+			want:             policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantAssetsEquals: "testdata/AD/SYSVOL/assetsandgpo.com/Ubuntu",
+		},
+		"Loopback processing does not apply to users of a trusted domain": {
+			objectName:   "bob@TRUSTED.COM",
+			loopbackMode: "replace",
+			backend: mock.Backend{
+				Dom:            "gpoonly.com",
+				TrustedDom:     "trusted.com",
+				TrustedServURL: "myserver.trusted.com",
+				Online:         true,
+			},
+			gpoListArgs: []string{"gpoonly.com", "bob:standard::" + hostname + ":one-value"},
+			want:        policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+		"Error on user of a domain without server": {
+			objectName:  "bob@UNKNOWN.COM",
+			gpoListArgs: []string{"gpoonly.com", "bob:standard"},
+			wantErr:     true,
+		},
+
+		// Domain controllers failover
+		"Failover to the next server when listing GPOs fails": {
+			backend:        mock.Backend{Dom: "gpoonly.com", ServURL: "failing.gpoonly.com", Online: true},
+			dcs:            []string{"failing.gpoonly.com", "dc2.gpoonly.com"},
+			gpoListArgs:    []string{"gpoonly.com", "bob:standard"},
+			want:           policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantUsedServer: "dc2.gpoonly.com",
+		},
+		"Failover to the next server when downloading fails": {
+			backend:        mock.Backend{Dom: "gpoonly.com", ServURL: "localhost:1", Online: true},
+			dcs:            []string{fmt.Sprintf("localhost:%d", ad.SmbPort)},
+			gpoListArgs:    []string{"gpoonly.com", "bob:standard"},
+			want:           policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantUsedServer: fmt.Sprintf("localhost:%d", ad.SmbPort),
+		},
+		"Unreachable servers are tried last": {
+			backend:        mock.Backend{Dom: "gpoonly.com", ServURL: "down.gpoonly.com", Online: true},
+			dcs:            []string{"down.gpoonly.com", "down2.gpoonly.com", "dc3.gpoonly.com"},
+			gpoListArgs:    []string{"gpoonly.com", "bob:standard"},
+			want:           policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantUsedServer: "dc3.gpoonly.com",
+		},
+		"Server from the backend is used first": {
+			dcs:            []string{"dc2.gpoonly.com", "myserver.gpoonly.com"},
+			gpoListArgs:    []string{"gpoonly.com", "bob:standard"},
+			want:           policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantUsedServer: "myserver.gpoonly.com",
+		},
+		"Error when no server can list GPOs": {
+			backend:     mock.Backend{Dom: "gpoonly.com", ServURL: "failing.gpoonly.com", Online: true},
+			dcs:         []string{"failing2.gpoonly.com"},
+			gpoListArgs: []string{"gpoonly.com", "bob:standard"},
+			wantErr:     true,
+		},
+		"Error when no server can download": {
+			backend:     mock.Backend{Dom: "gpoonly.com", ServURL: "localhost:1", Online: true},
+			gpoListArgs: []string{"gpoonly.com", "bob:standard"},
+			wantErr:     true,
+		},
+
 		// Policy class directory spelling cases
 		"Policy user directory is uppercase": {
 			gpoListArgs: []string{"gpoonly.com", "bob:uppercase-class"},
@@ -585,6 +778,7 @@ func TestGetPolicies(t *testing.T) {
 			adc, err := ad.New(context.Background(), tc.backend, hostname,
 				ad.WithCacheDir(cachedir), ad.WithRunDir(rundir), ad.WithoutKerberos(),
 				ad.WithGPOListCmd(mockGPOListCmd(t, tc.gpoListArgs...)),
+				ad.WithDCLocator(dnsStandIn{"_ldap._tcp.dc._msdcs." + tc.backend.Dom: tc.dcs}, probeStandIn),
 				ad.WithVersionID(tc.versionID))
 			require.NoError(t, err, "Setup: cannot create ad object")
 
@@ -592,6 +786,18 @@ func TestGetPolicies(t *testing.T) {
 				testutils.MakeReadOnly(t, adc.Krb5CacheDir())
 			}
 
+			if tc.loopbackMode != "" {
+				loopback := entry.Entry{Key: "loopback", Value: tc.loopbackMode}
+				if tc.loopbackMode == "disabled" {
+					loopback = entry.Entry{Key: "loopback", Disabled: true}
+				}
+				machinePolicies := policies.Policies{GPOs: []policies.GPO{
+					{ID: "loopback", Name: "loopback-name", Rules: map[string][]entry.Entry{"gpo": {loopback}}},
+				}}
+				require.NoError(t, machinePolicies.Save(filepath.Join(adc.PoliciesCacheDir(), hostname)),
+					"Setup: can't save machine policies with loopback processing mode")
+			}
+
 			// prepare by copying downloadables if any
 			for n, src := range tc.existing {
 				testutils.Copy(t, src, filepath.Join(adc.SysvolCacheDir(), n))
@@ -606,6 +812,10 @@ func TestGetPolicies(t *testing.T) {
 
 			// Compare GPOs
 			require.Equal(t, tc.want.GPOs, entries.GPOs, "GetPolicies returns expected GPO entries in correct order")
+			require.Equal(t, tc.want.FilteredGPOs, entries.FilteredGPOs, "GetPolicies returns expected filtered out GPOs")
+			if tc.wantUsedServer != "" {
+				require.Contains(t, adc.GetInfo(context.Background()), "Last used server: "+tc.wantUsedServer, "GetInfo should report the server used")
+			}
 
 			// Compare assets
 			uncompressedAssets := t.TempDir()
@@ -747,6 +957,126 @@ func TestGetPoliciesOffline(t *testing.T) {
 	}
 }
 
+func TestGetPoliciesFromLocalGPOs(t *testing.T) {
+	t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname")
+
+	oneValueUserGPO := policies.GPO{ID: "one-value", Name: "one-value-name", Rules: map[string][]entry.Entry{
+		"dconf": {
+			{Key: "C", Value: "oneValueC"},
+		}}}
+
+	tests := map[string]struct {
+		objectName  string
+		objectClass ad.ObjectClass
+		manifest    string
+		noAssets    bool
+		noManifest  bool
+
+		want       policies.Policies
+		wantAssets bool
+		wantErr    bool
+	}{
+		"Computer GPOs": {
+			objectClass: ad.ComputerObject,
+			manifest:    "computer: [{id: standard, name: standard-name}]\nuser: [{id: one-value, name: one-value-name}]",
+			want:        policies.Policies{GPOs: []policies.GPO{standardComputerGPO("standard")}},
+			wantAssets:  true,
+		},
+		"User GPOs": {
+			manifest:   "computer: [{id: one-value, name: one-value-name}]\nuser: [{id: standard, name: standard-name}]",
+			want:       policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+			wantAssets: true,
+		},
+		"GPOs are ordered": {
+			manifest:   "user: [{id: one-value, name: one-value-name}, {id: standard, name: standard-name}]",
+			want:       policies.Policies{GPOs: []policies.GPO{oneValueUserGPO, standardUserGPO("standard")}},
+			wantAssets: true,
+		},
+		"GPOs of a specific object": {
+			manifest:   "user: [{id: standard, name: standard-name}]\nobjects: {bob@example.com: [{id: one-value, name: one-value-name}]}",
+			want:       policies.Policies{GPOs: []policies.GPO{oneValueUserGPO}},
+			wantAssets: true,
+		},
+		"GPO name defaults to its ID": {
+			manifest: "user: [{id: one-value}]",
+			want: policies.Policies{GPOs: []policies.GPO{
+				{ID: "one-value", Name: "one-value", Rules: oneValueUserGPO.Rules}}},
+			wantAssets: true,
+		},
+		"No GPOs": {
+			manifest:   "computer: [{id: standard, name: standard-name}]",
+			wantAssets: true,
+		},
+		"No assets": {
+			manifest: "user: [{id: standard, name: standard-name}]",
+			noAssets: true,
+			want:     policies.Policies{GPOs: []policies.GPO{standardUserGPO("standard")}},
+		},
+
+		// Error cases
+		"Error on missing manifest":      {noManifest: true, wantErr: true},
+		"Error on invalid manifest":      {manifest: "user: [[", wantErr: true},
+		"Error on GPO ID with a path":    {manifest: "user: [{id: ../standard}]", wantErr: true},
+		"Error on GPO without ID":        {manifest: "user: [{name: standard-name}]", wantErr: true},
+		"Error on GPO missing locally":   {manifest: "user: [{id: doesnotexist}]", wantErr: true},
+		"Error on user not in a domain":  {objectName: "bob", manifest: "user: [{id: standard}]", wantErr: true},
+		"Error on computer not the host": {objectName: "otherhost", objectClass: ad.ComputerObject, manifest: "computer: [{id: standard}]", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.objectClass == "" {
+				tc.objectClass = ad.UserObject
+			}
+			if tc.objectName == "" {
+				tc.objectName = "bob@example.com"
+				if tc.objectClass == ad.ComputerObject {
+					tc.objectName = hostname
+				}
+			}
+
+			localDir := filepath.Join(t.TempDir(), "gpos")
+			testutils.Copy(t, "testdata/AD/SYSVOL/assetsandgpo.com", localDir)
+			if tc.noAssets {
+				require.NoError(t, os.RemoveAll(filepath.Join(localDir, "Ubuntu")), "Setup: can't remove local assets")
+			}
+			if !tc.noManifest {
+				require.NoError(t, os.WriteFile(filepath.Join(localDir, "gpos.yaml"), []byte(tc.manifest), 0600),
+					"Setup: can't write local GPOs manifest")
+			}
+
+			// The backend is offline and no GPO list command is available: GPOs are only read locally
+			adc, err := ad.New(context.Background(), mock.Backend{Dom: "example.com", Online: false}, hostname,
+				ad.WithCacheDir(t.TempDir()), ad.WithRunDir(t.TempDir()), ad.WithoutKerberos(),
+				ad.WithGPOListCmd([]string{"false"}), ad.WithLocalGPOs(localDir))
+			require.NoError(t, err, "Setup: cannot create ad object")
+
+			got, err := adc.GetPolicies(context.Background(), tc.objectName, tc.objectClass, "")
+			if tc.wantErr {
+				require.Error(t, err, "GetPolicies should have errored out")
+				return
+			}
+			require.NoError(t, err, "GetPolicies should return no error")
+			defer got.Close()
+
+			require.Equal(t, tc.want.GPOs, got.GPOs, "GetPolicies returns expected GPO entries in correct order")
+
+			uncompressedAssets := filepath.Join(t.TempDir(), "assets")
+			err = got.SaveAssetsTo(context.Background(), ".", uncompressedAssets, -1, -1)
+			if !tc.wantAssets {
+				require.Error(t, err, "Teardown: policies should have no assets to uncompress")
+				return
+			}
+			require.NoError(t, err, "Teardown: SaveAssetsTo should deserialize successfully.")
+			testutils.CompareTreesWithFiltering(t, uncompressedAssets, "testdata/AD/SYSVOL/assetsandgpo.com/Ubuntu", false)
+		})
+	}
+}
+
 func TestGetPoliciesWorkflows(t *testing.T) {
 	t.Parallel() // libsmbclient overrides SIGCHILD, but we have one global lock
 
@@ -1333,6 +1663,18 @@ func TestMockGPOList(_ *testing.T) {
 	// Get Domain
 	domain := args[0]
 
+	// The server is the argument before the object name. Servers on localhost are the SMB server to download from,
+	// while failing servers simulate an unusable domain controller.
+	server := args[len(args)-2]
+	if strings.HasPrefix(server, "failing") {
+		fmt.Fprintf(os.Stderr, "Error during gpo list requested on %s", server)
+		os.Exit(1)
+	}
+	host := fmt.Sprintf("localhost:%d", ad.SmbPort)
+	if strings.HasPrefix(server, "localhost:") {
+		host = server
+	}
+
 	// as in gpolist, we split on the @ if any
 	objectName := args[len(args)-1]
 	objectName = strings.Split(objectName, "@")[0]
@@ -1349,7 +1691,7 @@ func TestMockGPOList(_ *testing.T) {
 	}
 
 	for _, gpo := range gpos {
-		fmt.Fprintf(os.Stdout, "%s-name\tsmb://localhost:%d/SYSVOL/%s/Policies/%s\n", gpo, ad.SmbPort, domain, gpo)
+		fmt.Fprintf(os.Stdout, "%s-name\tsmb://%s/SYSVOL/%s/Policies/%s\n", gpo, host, domain, gpo)
 	}
 }
 
@@ -1376,6 +1718,30 @@ func setKrb5CC(t *testing.T, ccRootName string) string {
 	return krb5CCName
 }
 
+// dnsStandIn answers SRV queries with the domain controllers of its records, keyed by full name.
+type dnsStandIn map[string][]string
+
+func (d dnsStandIn) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	fullName := "_" + service + "._" + proto + "." + name
+	dcs := d[fullName]
+	if len(dcs) == 0 {
+		return "", nil, &net.DNSError{Err: "no such host", Name: fullName, IsNotFound: true}
+	}
+	var records []*net.SRV
+	for _, dc := range dcs {
+		records = append(records, &net.SRV{Target: dc + ".", Port: 389})
+	}
+	return fullName, records, nil
+}
+
+// probeStandIn reports the domain controllers whose name starts with "down" as unreachable.
+func probeStandIn(_ context.Context, dc string) error {
+	if strings.HasPrefix(dc, "down") {
+		return fmt.Errorf("%s is down", dc)
+	}
+	return nil
+}
+
 // assertEqualPolicies compares expected and actual policies by deserializing them.
 func assertEqualPolicies(t *testing.T, expected policies.Policies, got policies.Policies, checkAssets bool) {
 	t.Helper()
@@ -1406,6 +1772,16 @@ func standardUserGPO(id string) policies.GPO {
 		}}}
 }
 
+func withFilter(g policies.GPO, filter string) policies.GPO {
+	g.Filter = filter
+	return g
+}
+
+func withLoopback(g policies.GPO) policies.GPO {
+	g.Loopback = true
+	return g
+}
+
 func standardComputerGPO(id string) policies.GPO {
 	return policies.GPO{ID: id, Name: id + "-name", Rules: map[string][]entry.Entry{
 		"dconf": {
@@ -58,7 +58,11 @@ import (
 	"golang.org/x/text/language"
 )
 
-const dconfPolicyType = "dconf"
+const (
+	dconfPolicyType = "dconf"
+	// gpoPolicyType configures how GPOs are processed by the client itself.
+	gpoPolicyType = "gpo"
+)
 
 // expandedCategories generation
 
@@ -278,8 +282,8 @@ func (g generator) generateExpandedCategories(categories []category, policies []
 		}
 
 		// Mention if any of the policies require Ubuntu Pro
-		// Currently this only applies to non-dconf policies
-		if typePol != dconfPolicyType {
+		// Currently this only applies to non-dconf policies, except the GPO processing ones
+		if typePol != dconfPolicyType && typePol != gpoPolicyType {
 			explainText = fmt.Sprintf("%s\n\n%s", explainText, gotext.Get("An Ubuntu Pro subscription on the client is required to apply this policy."))
 		}
 
@@ -17,18 +17,24 @@ type Backend interface {
 	// If the dynamic lookup worked, but there is still no server URL found (for instance, backend
 	// if offline), the error raised is of type ErrorNoActiveServer.
 	ServerFQDN(context.Context) (string, error)
+	// DomainServerFQDN returns the FQDN of a server of domain, the domain part of a user name.
+	// trusted is false when domain is the backend one, in which case this is ServerFQDN. Otherwise, domain is
+	// a domain trusted by the backend one, in the same or in another forest, and the server is looked up dynamically.
+	DomainServerFQDN(ctx context.Context, domain string) (serverFQDN string, trusted bool, err error)
 	// HostKrb5CCName computes and returns the absolute path of the machine krb5 ticket.
 	HostKrb5CCName() (string, error)
 	// DefaultDomainSuffix returns current default domain suffix.
 	DefaultDomainSuffix() string
 	// IsOnline refresh and returns if we are online.
 	IsOnline() (bool, error)
+	// Site returns the Active Directory site of the machine from the static configuration, if any.
+	Site() string
 	// Config returns a stringified configuration of the backend.
 	Config() string
 }
 
 var (
 	// ErrNoActiveServer is an error receive when there is no active server and no static configuration
-	// This is received in ServerFQDN.
+	// This is received in ServerFQDN and DomainServerFQDN.
 	ErrNoActiveServer = errors.New(gotext.Get("no active server found"))
 )
@@ -0,0 +1,22 @@
+package keytab
+
+import (
+	"context"
+
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+)
+
+// WithKinitCmd specifies a personalized kinit command for the backend to use.
+func WithKinitCmd(cmd []string) Option {
+	return func(o *options) {
+		o.kinitCmd = cmd
+	}
+}
+
+// WithDCLocator specifies the DNS resolver to find the domain controllers from and how to probe them.
+func WithDCLocator(r dclocator.Resolver, probe func(ctx context.Context, dc string) error) Option {
+	return func(o *options) {
+		o.resolver = r
+		o.probe = probe
+	}
+}
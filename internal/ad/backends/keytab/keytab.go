@@ -0,0 +1,279 @@
+// Package keytab is a standalone backend for machines joined with only a keytab, without sssd nor winbind.
+//
+// The domain is read from the configuration or krb5.conf, the machine ticket is obtained from the keytab, the domain
+// controllers are discovered from DNS and the machine is online if one of them can be reached.
+package keytab
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/backends"
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+	"github.com/ubuntu/adsys/internal/consts"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	// ticketRefreshAge is the age after which the machine ticket is obtained again from the keytab, well before the
+	// default 10 hours lifetime of Active Directory tickets.
+	ticketRefreshAge = 4 * time.Hour
+	// probeTimeout is the time given to a domain controller to accept a connection.
+	probeTimeout = 2 * time.Second
+)
+
+// Keytab is the backend object with domain and DC information.
+type Keytab struct {
+	domain           string
+	staticServerFQDN string
+	principal        string
+
+	kinitCmd []string
+	resolver dclocator.Resolver
+	probe    func(ctx context.Context, dc string) error
+
+	config Config
+}
+
+// Config for keytab backend.
+type Config struct {
+	ADDomain  string `mapstructure:"ad_domain"` // use this domain instead of the default realm of krb5.conf
+	ADServer  string `mapstructure:"ad_server"` // use this server instead of discovering it from DNS
+	ADSite    string `mapstructure:"ad_site"`   // bypass site discovery and use this site
+	Keytab    string `mapstructure:"keytab"`
+	Principal string `mapstructure:"principal"`
+	CCache    string `mapstructure:"ccache"`
+	Krb5Conf  string `mapstructure:"krb5_conf"`
+}
+
+// Option represents an optional function to change the keytab backend.
+type Option func(*options)
+
+type options struct {
+	kinitCmd []string
+	resolver dclocator.Resolver
+	probe    func(ctx context.Context, dc string) error
+}
+
+// New returns a keytab backend loaded from Config.
+func New(ctx context.Context, c Config, hostname string, opts ...Option) (k Keytab, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get domain configuration from %+v", c))
+
+	// defaults
+	args := options{
+		kinitCmd: []string{"kinit"},
+		resolver: net.DefaultResolver,
+		probe: func(ctx context.Context, dc string) error {
+			return dclocator.Probe(ctx, dc, probeTimeout)
+		},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	log.Debug(ctx, "Loading keytab configuration for AD backend")
+
+	if c.Keytab == "" {
+		c.Keytab = consts.DefaultKeytab
+	}
+	if c.CCache == "" {
+		c.CCache = consts.DefaultKeytabCCache
+	}
+	if c.Krb5Conf == "" {
+		c.Krb5Conf = consts.DefaultKrb5Conf
+	}
+
+	var realm string
+	if c.ADDomain == "" {
+		realm, err = defaultRealm(c.Krb5Conf)
+		if err != nil {
+			return Keytab{}, err
+		}
+		c.ADDomain = strings.ToLower(realm)
+	}
+	if realm == "" {
+		realm = strings.ToUpper(c.ADDomain)
+	}
+
+	principal := c.Principal
+	if principal == "" {
+		principal = fmt.Sprintf("%s$@%s", strings.ToUpper(hostname), realm)
+	}
+
+	return Keytab{
+		domain:           c.ADDomain,
+		staticServerFQDN: strings.TrimPrefix(c.ADServer, "ldap://"),
+		principal:        principal,
+
+		kinitCmd: args.kinitCmd,
+		resolver: args.resolver,
+		probe:    args.probe,
+
+		config: c,
+	}, nil
+}
+
+// defaultRealm returns the default_realm of the libdefaults section of the krb5.conf file at p.
+func defaultRealm(p string) (realm string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't read default realm from %s", p))
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer decorate.LogFuncOnError(f.Close)
+
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") || strings.HasPrefix(l, ";") {
+			continue
+		}
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			section = strings.TrimSpace(l[1 : len(l)-1])
+			continue
+		}
+		if section != "libdefaults" {
+			continue
+		}
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || strings.TrimSpace(k) != "default_realm" {
+			continue
+		}
+		realm = strings.TrimSpace(v)
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if realm == "" {
+		return "", errors.New(gotext.Get("no default_realm in the libdefaults section"))
+	}
+	return realm, nil
+}
+
+// Domain returns current server domain.
+func (k Keytab) Domain() string {
+	return k.domain
+}
+
+// ServerFQDN returns current server FQDN.
+// It returns first any static configuration. If nothing is found, it returns the first domain controller advertised
+// in DNS which can be reached. If none can be, the error raised is of type ErrorNoActiveServer.
+func (k Keytab) ServerFQDN(ctx context.Context) (serverFQDN string, err error) {
+	defer decorate.OnError(&err, gotext.Get("error while trying to look up AD server address for %q", k.domain))
+
+	if k.staticServerFQDN != "" {
+		return k.staticServerFQDN, nil
+	}
+
+	log.Debugf(ctx, "Triggering autodiscovery of AD server because the keytab configuration does not provide an ad_server for %q", k.domain)
+	return k.reachableServer(ctx, k.domain)
+}
+
+// DomainServerFQDN returns the FQDN of a server of domain.
+// For the backend domain, this is ServerFQDN. Otherwise, this is the first domain controller of the trusted domain
+// advertised in DNS which can be reached.
+func (k Keytab) DomainServerFQDN(ctx context.Context, domain string) (serverFQDN string, trusted bool, err error) {
+	if strings.EqualFold(domain, k.domain) {
+		serverFQDN, err = k.ServerFQDN(ctx)
+		return serverFQDN, false, err
+	}
+
+	defer decorate.OnError(&err, gotext.Get("error while trying to look up AD server address for trusted domain %q", domain))
+
+	serverFQDN, err = k.reachableServer(ctx, strings.ToLower(domain))
+	return serverFQDN, true, err
+}
+
+// reachableServer returns the first domain controller of domain advertised in DNS which can be reached.
+func (k Keytab) reachableServer(ctx context.Context, domain string) (string, error) {
+	site := ""
+	if strings.EqualFold(domain, k.domain) {
+		site = k.config.ADSite
+	}
+	dcs, err := dclocator.Candidates(ctx, k.resolver, domain, site)
+	if err != nil {
+		return "", err
+	}
+	for _, dc := range dcs {
+		if err := k.probe(ctx, dc); err != nil {
+			log.Debug(ctx, err)
+			continue
+		}
+		return dc, nil
+	}
+	return "", backends.ErrNoActiveServer
+}
+
+// HostKrb5CCName returns the absolute path of the machine krb5 ticket.
+// The ticket is obtained from the keytab when missing or older than ticketRefreshAge.
+func (k Keytab) HostKrb5CCName() (string, error) {
+	target := k.config.CCache
+
+	if os.Getenv("ADSYS_SKIP_ROOT_CALLS") != "" {
+		return target, nil
+	}
+
+	if fi, err := os.Stat(target); err == nil && time.Since(fi.ModTime()) < ticketRefreshAge {
+		return target, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return "", err
+	}
+	cmdArgs := append(k.kinitCmd, "-k", "-t", k.config.Keytab, k.principal, "-c", target)
+	smbsafe.WaitExec()
+	defer smbsafe.DoneExec()
+	if cmd, err := exec.Command(cmdArgs[0], cmdArgs[1:]...).CombinedOutput(); err != nil {
+		return "", errors.New(gotext.Get(`could not get krb5 cached ticket for %q from %s: %v:
+%s`, k.principal, k.config.Keytab, err, string(cmd)))
+	}
+
+	return target, nil
+}
+
+// DefaultDomainSuffix returns current default domain suffix.
+func (k Keytab) DefaultDomainSuffix() string {
+	return k.domain
+}
+
+// IsOnline returns if a domain controller of the domain can be reached on its LDAP port.
+func (k Keytab) IsOnline() (bool, error) {
+	ctx := context.Background()
+	if k.staticServerFQDN != "" {
+		return k.probe(ctx, k.staticServerFQDN) == nil, nil
+	}
+
+	_, err := k.reachableServer(ctx, k.domain)
+	if err != nil {
+		log.Debugf(ctx, "No domain controller of %q can be reached: %v", k.domain, err)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Site returns the site set in the configuration, if any.
+func (k Keytab) Site() string {
+	return k.config.ADSite
+}
+
+// Config returns a stringified configuration for keytab backend.
+func (k Keytab) Config() string {
+	return fmt.Sprintf(`Current backend is keytab
+Keytab: %s
+Principal: %s`, k.config.Keytab, k.principal)
+}
@@ -0,0 +1,250 @@
+package keytab_test
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/ad/backends"
+	"github.com/ubuntu/adsys/internal/ad/backends/keytab"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+var records = dnsStandIn{
+	"_ldap._tcp.dc._msdcs.example.com": {
+		{Target: "down.example.com.", Priority: 0},
+		{Target: "dc1.example.com.", Priority: 10},
+	},
+	"_ldap._tcp.Paris._sites.dc._msdcs.example.com": {
+		{Target: "dc-paris.example.com.", Priority: 0},
+	},
+	"_ldap._tcp.dc._msdcs.overridden.com": {
+		{Target: "dc.overridden.com.", Priority: 0},
+	},
+	"_ldap._tcp.dc._msdcs.offline.com": {
+		{Target: "down.offline.com.", Priority: 0},
+	},
+	"_ldap._tcp.dc._msdcs.trusted.com": {
+		{Target: "dc.trusted.com.", Priority: 0},
+	},
+}
+
+func TestKeytab(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		krb5Conf        string
+		staticADDomain  string
+		staticADServer  string
+		staticADSite    string
+		staticPrincipal string
+		hostname        string
+
+		wantKinitErr bool
+		wantErr      bool
+	}{
+		"Lookup is successful":                         {},
+		"Lookup with different hostname is successful": {hostname: "mycustomhostname"},
+
+		// Override cases
+		"Lookup with overridden ad_domain":                  {staticADDomain: "overridden.com"},
+		"Lookup with overridden ad_server":                  {staticADServer: "controller.example.com"},
+		"Lookup with overridden ad_server with LDAP prefix": {staticADServer: "ldap://controller.example.com"},
+		"Lookup with overridden ad_server down":             {staticADServer: "down.example.com"},
+		"Lookup with ad_site":                               {staticADSite: "Paris"},
+		"Lookup with overridden principal":                  {staticPrincipal: "host/ubuntu.example.com@EXAMPLE.COM"},
+		"No need of krb5.conf with ad_domain":               {krb5Conf: "doesnotexist", staticADDomain: "overridden.com"},
+
+		// Error cases
+		"Error when no domain controller is reachable": {staticADDomain: "offline.com"},
+		"Error when no domain controller is in DNS":    {staticADDomain: "nodns.com"},
+		"Error when requesting krb5cc":                 {wantKinitErr: true},
+		"Error when krb5.conf does not exist":          {krb5Conf: "doesnotexist", wantErr: true},
+		"Error when krb5.conf has no default realm":    {krb5Conf: "krb5-no-realm.conf", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			hostname := tc.hostname
+			if hostname == "" {
+				hostname = "ubuntu"
+			}
+			if tc.krb5Conf == "" {
+				tc.krb5Conf = "krb5.conf"
+			}
+
+			config := keytab.Config{
+				ADDomain:  tc.staticADDomain,
+				ADServer:  tc.staticADServer,
+				ADSite:    tc.staticADSite,
+				Principal: tc.staticPrincipal,
+				Keytab:    "/etc/krb5.keytab",
+				CCache:    filepath.Join(t.TempDir(), "krb5cc_host"),
+				Krb5Conf:  filepath.Join("testdata", tc.krb5Conf),
+			}
+
+			kinitCmdOutputFile := filepath.Join(t.TempDir(), "kinit-output")
+			kinitCmd := []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestExecuteKinitCommand", "--", kinitCmdOutputFile}
+			if tc.wantKinitErr {
+				kinitCmd = append(kinitCmd, "-Exit1-")
+			}
+
+			backend, err := keytab.New(context.Background(), config, hostname,
+				keytab.WithKinitCmd(kinitCmd), keytab.WithDCLocator(records, probeStandIn))
+			if tc.wantErr {
+				require.Error(t, err, "New should have errored out")
+				return
+			}
+			require.NoError(t, err, "New should not have errored out")
+
+			got := testutils.FormatBackendCalls(t, backend)
+			// The ticket cache is in a temporary directory
+			got = strings.ReplaceAll(got, config.CCache, "#CCACHE#")
+
+			// Check kinit command
+			if !tc.wantKinitErr {
+				gotKinitArgs, err := os.ReadFile(kinitCmdOutputFile)
+				require.NoError(t, err, "Setup: failed to read kinit command output")
+				got += "\nKinit args: " + strings.ReplaceAll(string(gotKinitArgs), config.CCache, "#CCACHE#")
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "Got expected loaded values in keytab config object")
+		})
+	}
+}
+
+func TestHostKrb5CCNameReusesFreshTicket(t *testing.T) {
+	t.Parallel()
+
+	ccache := filepath.Join(t.TempDir(), "krb5cc_host")
+	require.NoError(t, os.WriteFile(ccache, []byte("fresh ticket"), 0600), "Setup: can't write ticket")
+
+	// kinit is not called: it would fail
+	backend, err := keytab.New(context.Background(), keytab.Config{ADDomain: "example.com", CCache: ccache}, "ubuntu",
+		keytab.WithKinitCmd([]string{"false"}), keytab.WithDCLocator(records, probeStandIn))
+	require.NoError(t, err, "New should not have errored out")
+
+	got, err := backend.HostKrb5CCName()
+	require.NoError(t, err, "HostKrb5CCName should not have errored out")
+	require.Equal(t, ccache, got, "HostKrb5CCName should return the existing ticket")
+}
+
+func TestDomainServerFQDN(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		domain string
+
+		wantServer  string
+		wantTrusted bool
+		wantErr     bool
+	}{
+		"Backend domain":                     {domain: "example.com", wantServer: "dc1.example.com"},
+		"Backend domain is case insensitive": {domain: "EXAMPLE.COM", wantServer: "dc1.example.com"},
+		"Trusted domain":                     {domain: "trusted.com", wantServer: "dc.trusted.com", wantTrusted: true},
+		"Trusted domain is lowercased":       {domain: "TRUSTED.COM", wantServer: "dc.trusted.com", wantTrusted: true},
+
+		"Error on trusted domain without reachable controller": {domain: "offline.com", wantErr: true},
+		"Error on trusted domain not in DNS":                   {domain: "nodns.com", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			backend, err := keytab.New(context.Background(), keytab.Config{ADDomain: "example.com"}, "ubuntu",
+				keytab.WithDCLocator(records, probeStandIn))
+			require.NoError(t, err, "New should not have errored out")
+
+			server, trusted, err := backend.DomainServerFQDN(context.Background(), tc.domain)
+			if tc.wantErr {
+				require.Error(t, err, "DomainServerFQDN should have errored out")
+				return
+			}
+			require.NoError(t, err, "DomainServerFQDN should not have errored out")
+			require.Equal(t, tc.wantServer, server, "DomainServerFQDN should return the expected server")
+			require.Equal(t, tc.wantTrusted, trusted, "DomainServerFQDN should return if the domain is trusted")
+		})
+	}
+}
+
+func TestOfflineServerIsErrNoActiveServer(t *testing.T) {
+	t.Parallel()
+
+	backend, err := keytab.New(context.Background(), keytab.Config{ADDomain: "offline.com"}, "ubuntu",
+		keytab.WithDCLocator(records, probeStandIn))
+	require.NoError(t, err, "New should not have errored out")
+
+	_, err = backend.ServerFQDN(context.Background())
+	require.ErrorIs(t, err, backends.ErrNoActiveServer, "ServerFQDN should return ErrNoActiveServer")
+}
+
+func TestExecuteKinitCommand(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	var goldPath string
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			goldPath = args[1]
+			args = args[2:]
+			break
+		}
+		args = args[1:]
+	}
+
+	if args[0] == "-Exit1-" {
+		fmt.Fprintf(os.Stderr, "EXIT 1 requested in mock")
+		os.Exit(1)
+	}
+
+	err := os.WriteFile(goldPath, []byte(fmt.Sprintf("%q", args)+"\n"), 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setup: failed to write kinit command output: %v", err)
+		os.Exit(1)
+	}
+}
+
+// dnsStandIn answers SRV queries from its records, keyed by full name.
+type dnsStandIn map[string][]*net.SRV
+
+func (d dnsStandIn) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	fullName := "_" + service + "._" + proto + "." + name
+	records, ok := d[fullName]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: fullName, IsNotFound: true}
+	}
+	// Return a copy, as the records are sorted in place
+	return fullName, append([]*net.SRV(nil), records...), nil
+}
+
+// probeStandIn considers domain controllers prefixed with "down" as unreachable.
+func probeStandIn(_ context.Context, dc string) error {
+	if strings.HasPrefix(dc, "down") {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	debug := flag.Bool("verbose", false, "Print debug log level information within the test")
+	flag.Parse()
+	if *debug {
+		logrus.StandardLogger().SetLevel(logrus.DebugLevel)
+	}
+
+	m.Run()
+	testutils.MergeCoverages()
+}
@@ -4,6 +4,8 @@ package mock
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // Backend is a mock backend where we control some returned value.
@@ -11,6 +13,10 @@ type Backend struct {
 	Dom                string
 	ServURL            string
 	HostKrb5CCNamePath string
+	SiteName           string
+	// TrustedDom is a domain trusted by Dom, whose server is TrustedServURL.
+	TrustedDom     string
+	TrustedServURL string
 
 	Online        bool
 	ErrIsOnline   bool
@@ -34,6 +40,18 @@ func (m Backend) ServerFQDN(context.Context) (string, error) {
 	return m.ServURL, nil
 }
 
+// DomainServerFQDN returns the server of domain, which is either Dom or TrustedDom.
+func (m Backend) DomainServerFQDN(ctx context.Context, domain string) (string, bool, error) {
+	if strings.EqualFold(domain, m.Dom) {
+		s, err := m.ServerFQDN(ctx)
+		return s, false, err
+	}
+	if m.TrustedDom == "" || !strings.EqualFold(domain, m.TrustedDom) {
+		return "", true, fmt.Errorf("no server for unknown domain %q", domain)
+	}
+	return m.TrustedServURL, true, nil
+}
+
 // HostKrb5CCName returns the absolute path of the machine krb5 ticket.
 func (m Backend) HostKrb5CCName() (string, error) {
 	if m.ErrKrb5CCName {
@@ -59,3 +77,8 @@ func (m Backend) IsOnline() (bool, error) {
 func (m Backend) Config() string {
 	return "backend static config"
 }
+
+// Site returns the static site of the machine.
+func (m Backend) Site() string {
+	return m.SiteName
+}
@@ -0,0 +1,15 @@
+package sss
+
+import (
+	"context"
+
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+)
+
+// WithDCLocator specifies the DNS resolver to find the domain controllers of trusted domains from and how to probe them.
+func WithDCLocator(r dclocator.Resolver, probe func(ctx context.Context, dc string) error) Option {
+	return func(o *options) {
+		o.resolver = r
+		o.probe = probe
+	}
+}
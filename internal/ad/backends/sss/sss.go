@@ -5,26 +5,38 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/godbus/dbus/v5"
 	"github.com/leonelquinteros/gotext"
 	"github.com/ubuntu/adsys/internal/ad/backends"
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/decorate"
 	"gopkg.in/ini.v1"
 )
 
+// probeTimeout is the time given to a domain controller of a trusted domain to accept a connection.
+const probeTimeout = 2 * time.Second
+
 // SSS is the backend object with domain and DC information.
 type SSS struct {
 	domain              string
+	sssdDomain          string
 	domainDbus          dbus.BusObject
+	bus                 *dbus.Conn
 	serverFQDN          string
 	staticServerFQDN    string
 	hostKrb5CCName      string
 	defaultDomainSuffix string
+	site                string
+
+	resolver dclocator.Resolver
+	probe    func(ctx context.Context, dc string) error
 
 	config Config
 }
@@ -35,10 +47,30 @@ type Config struct {
 	CacheDir string `mapstructure:"cache_dir"`
 }
 
+// Option represents an optional function to change the sss backend.
+type Option func(*options)
+
+type options struct {
+	resolver dclocator.Resolver
+	probe    func(ctx context.Context, dc string) error
+}
+
 // New returns a sss backend loaded from Config.
-func New(ctx context.Context, c Config, bus *dbus.Conn) (s SSS, err error) {
+func New(ctx context.Context, c Config, bus *dbus.Conn, opts ...Option) (s SSS, err error) {
 	defer decorate.OnError(&err, gotext.Get("can't get domain configuration from %+v", c))
 
+	// defaults
+	args := options{
+		resolver: net.DefaultResolver,
+		probe: func(ctx context.Context, dc string) error {
+			return dclocator.Probe(ctx, dc, probeTimeout)
+		},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
 	log.Debug(ctx, "Loading SSS configuration for AD backend")
 
 	if c.Conf == "" {
@@ -82,16 +114,25 @@ func New(ctx context.Context, c Config, bus *dbus.Conn) (s SSS, err error) {
 		staticServerFQDN = strings.TrimPrefix(staticServerFQDN, "ldap://")
 	}
 
+	// Site forced in the configuration
+	site := domainSection.Key("ad_site").String()
+
 	// local machine sssd krb5 cache
 	hostKrb5CCName := filepath.Join(c.CacheDir, "ccache_"+strings.ToUpper(domain))
 
 	return SSS{
 		domain:              domain,
+		sssdDomain:          sssdDomain,
 		domainDbus:          domainDbus,
+		bus:                 bus,
 		serverFQDN:          staticServerFQDN,
 		staticServerFQDN:    staticServerFQDN,
 		hostKrb5CCName:      hostKrb5CCName,
 		defaultDomainSuffix: defaultDomainSuffix,
+		site:                site,
+
+		resolver: args.resolver,
+		probe:    args.probe,
 
 		config: c,
 	}, nil
@@ -125,6 +166,47 @@ func (sss SSS) ServerFQDN(ctx context.Context) (serverFQDN string, err error) {
 	return strings.TrimPrefix(serverFQDN, "ldap://"), nil
 }
 
+// DomainServerFQDN returns the FQDN of a server of domain.
+// domain is the backend one if it matches its AD or its sssd domain name, and this is ServerFQDN. Otherwise,
+// this is the active server of the trusted domain in sssd, ignoring the static configuration. If sssd has none, like
+// when it didn't contact the trusted domain yet, this is the first domain controller advertised in DNS which can be
+// reached.
+func (sss SSS) DomainServerFQDN(ctx context.Context, domain string) (serverFQDN string, trusted bool, err error) {
+	if strings.EqualFold(domain, sss.domain) || strings.EqualFold(domain, sss.sssdDomain) {
+		serverFQDN, err = sss.ServerFQDN(ctx)
+		return serverFQDN, false, err
+	}
+
+	defer decorate.OnError(&err, gotext.Get("error while trying to look up AD server address on SSSD for trusted domain %q", domain))
+
+	// sssd names trusted domains in lower case, and their failover service after them
+	domain = strings.ToLower(domain)
+	log.Debugf(ctx, "Looking up active AD server of trusted domain %q", domain)
+	domainDbus := sss.bus.Object(consts.SSSDDbusRegisteredName,
+		dbus.ObjectPath(filepath.Join(consts.SSSDDbusBaseObjectPath, domainToObjectPath(domain))))
+	err = domainDbus.Call(consts.SSSDDbusInterface+".ActiveServer", 0, "sd_"+domain).Store(&serverFQDN)
+	if err == nil && serverFQDN != "" {
+		return strings.TrimPrefix(serverFQDN, "ldap://"), true, nil
+	}
+	if err == nil {
+		err = backends.ErrNoActiveServer
+	}
+	log.Debugf(ctx, "No active server in SSSD for trusted domain %q, looking up its domain controllers in DNS: %v", domain, err)
+
+	dcs, err := dclocator.Candidates(ctx, sss.resolver, domain, "")
+	if err != nil {
+		return "", true, err
+	}
+	for _, dc := range dcs {
+		if err := sss.probe(ctx, dc); err != nil {
+			log.Debug(ctx, err)
+			continue
+		}
+		return dc, true, nil
+	}
+	return "", true, backends.ErrNoActiveServer
+}
+
 // HostKrb5CCName returns the absolute path of the machine krb5 ticket.
 func (sss SSS) HostKrb5CCName() (string, error) {
 	return sss.hostKrb5CCName, nil
@@ -144,6 +226,11 @@ func (sss SSS) IsOnline() (bool, error) {
 	return online, nil
 }
 
+// Site returns the ad_site of the domain in sssd.conf, if any.
+func (sss SSS) Site() string {
+	return sss.site
+}
+
 // Config returns a stringified configuration for SSSD backend.
 func (sss SSS) Config() string {
 	return fmt.Sprintf(`Current backend is SSSD
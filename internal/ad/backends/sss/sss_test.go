@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
@@ -48,6 +49,7 @@ func TestSSSD(t *testing.T) {
 		"Default domain suffix is read":            {sssdConf: "example.com-with-default-domain-suffix"},
 		"Use domain from section if no ad_domain":  {sssdConf: "example.com-without-ad_domain"},
 		"Ignore upper cases in domain name":        {sssdConf: "EXAMPLE.COM"},
+		"Site is read":                             {sssdConf: "example.com-with-site"},
 
 		// Special cases for config parameters
 		"Regular config, with cache dir": {sssdConf: "example.com", sssdCacheDir: "/some/specific/cachedir"},
@@ -111,6 +113,53 @@ func TestSSSD(t *testing.T) {
 	}
 }
 
+func TestDomainServerFQDN(t *testing.T) {
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	tests := map[string]struct {
+		sssdConf string
+		domain   string
+
+		want        string
+		wantTrusted bool
+		wantErr     bool
+	}{
+		"Backend domain returns its server":                         {sssdConf: "example.com-with-server", domain: "example.com", want: "mystaticserver.example.com"},
+		"Backend domain ignores case":                               {sssdConf: "example.com", domain: "EXAMPLE.COM", want: "dynamic_active_server.example.com"},
+		"Backend domain matches the sssd domain name":               {sssdConf: "domain-no-match-addomain", domain: "my_sss_domain_name", want: "dynamic_active_server.example.com"},
+		"Trusted domain uses its active server, not the static one": {sssdConf: "example.com-with-server", domain: "trusted.example.com", want: "dynamic_active_server.trusted.example.com", wantTrusted: true},
+		"Trusted domain ignores case":                               {sssdConf: "example.com", domain: "Trusted.Example.COM", want: "dynamic_active_server.trusted.example.com", wantTrusted: true},
+
+		"Trusted domain without active server uses a reachable controller from DNS": {sssdConf: "example.com", domain: "noactiveserver.example.com", want: "dc1.noactiveserver.example.com", wantTrusted: true},
+		"Trusted domain unknown to sssd uses a reachable controller from DNS":       {sssdConf: "example.com", domain: "unknown.example.com", want: "dc.unknown.example.com", wantTrusted: true},
+
+		"Error on backend domain without active server":                          {sssdConf: "no-active-server-example.com", domain: "noactiveserver.example.com", wantErr: true},
+		"Error on trusted domain without active server nor reachable controller": {sssdConf: "example.com", domain: "activeservererr.example.com", wantTrusted: true, wantErr: true},
+		"Error on trusted domain unknown to sssd and not in DNS":                 {sssdConf: "example.com", domain: "nodns.example.com", wantTrusted: true, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			config := sss.Config{Conf: filepath.Join("testdata", "TestSSSD", "configs", tc.sssdConf)}
+			sssd, err := sss.New(context.Background(), config, bus, sss.WithDCLocator(records, probeStandIn))
+			require.NoError(t, err, "Setup: New should return no error")
+
+			got, trusted, err := sssd.DomainServerFQDN(context.Background(), tc.domain)
+			require.Equal(t, tc.wantTrusted, trusted, "DomainServerFQDN should report if the domain is trusted")
+			if tc.wantErr {
+				require.Error(t, err, "DomainServerFQDN should have errored out")
+				return
+			}
+			require.NoError(t, err, "DomainServerFQDN should return no error")
+			require.Equal(t, tc.want, got, "DomainServerFQDN should return the expected server")
+		})
+	}
+}
+
 type sssdbus struct {
 	endpoint       string
 	offline        bool
@@ -120,14 +169,19 @@ type sssdbus struct {
 	isOnlineErr     bool
 }
 
-func (s sssdbus) ActiveServer(_ string) (string, *dbus.Error) {
+func (s sssdbus) ActiveServer(service string) (string, *dbus.Error) {
+	domain := strings.ReplaceAll(strings.ReplaceAll(s.endpoint, "_2e", "."), "_2d", "-")
+	// The failover service of the domain, or of a trusted domain as a subdomain.
+	if service != "AD" && service != "sd_"+domain {
+		return "", dbus.NewError("something.sssd.Error", []interface{}{fmt.Sprintf("Unknown service %q", service)})
+	}
 	if s.noActiveServer {
 		return "", nil
 	}
 	if s.activeServerErr {
 		return "", dbus.NewError("something.sssd.Error", []interface{}{"Active Server dbus call Error"})
 	}
-	return "dynamic_active_server." + strings.ReplaceAll(strings.ReplaceAll(s.endpoint, "_2e", "."), "_2d", "-"), nil
+	return "dynamic_active_server." + domain, nil
 }
 
 func (s sssdbus) IsOnline() (bool, *dbus.Error) {
@@ -137,6 +191,37 @@ func (s sssdbus) IsOnline() (bool, *dbus.Error) {
 	return !s.offline, nil
 }
 
+// records are the domain controllers advertised in DNS for trusted domains.
+var records = dnsStandIn{
+	"_ldap._tcp.dc._msdcs.noactiveserver.example.com": {
+		{Target: "down.noactiveserver.example.com.", Port: 389, Priority: 0},
+		{Target: "dc1.noactiveserver.example.com.", Port: 389, Priority: 10},
+	},
+	"_ldap._tcp.dc._msdcs.activeservererr.example.com": {{Target: "down.activeservererr.example.com.", Port: 389}},
+	"_ldap._tcp.dc._msdcs.unknown.example.com":         {{Target: "dc.unknown.example.com.", Port: 389}},
+}
+
+// dnsStandIn answers SRV queries from its records, keyed by full name.
+type dnsStandIn map[string][]*net.SRV
+
+func (d dnsStandIn) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	fullName := "_" + service + "._" + proto + "." + name
+	records, ok := d[fullName]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: fullName, IsNotFound: true}
+	}
+	// Return a copy, as the records are sorted in place
+	return fullName, append([]*net.SRV(nil), records...), nil
+}
+
+// probeStandIn considers domain controllers prefixed with "down" as unreachable.
+func probeStandIn(_ context.Context, dc string) error {
+	if strings.HasPrefix(dc, "down") {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
 func TestMain(m *testing.M) {
 	// TODO: do we want to alway print debug?
 	debug := flag.Bool("verbose", false, "Print debug log level information within the test")
@@ -183,6 +268,9 @@ func TestMain(m *testing.M) {
 		{
 			endpoint: "special_2dcharacters_2eexample_2ecom",
 		},
+		{
+			endpoint: "trusted_2eexample_2ecom",
+		},
 		{
 			endpoint: "offline_2eexample_2ecom",
 			offline:  true,
@@ -82,6 +82,7 @@ type Winbind struct {
 type Config struct {
 	ADServer string `mapstructure:"ad_server"` // bypass winbind and use this server
 	ADDomain string `mapstructure:"ad_domain"` // bypass domain name detection and use this domain
+	ADSite   string `mapstructure:"ad_site"`   // bypass site discovery and use this site
 }
 
 // Option represents an optional function to change the winbind backend.
@@ -176,6 +177,31 @@ func (w Winbind) ServerFQDN(ctx context.Context) (serverFQDN string, err error)
 	return serverFQDN, nil
 }
 
+// DomainServerFQDN returns the FQDN of a server of domain.
+// For the backend domain, this is ServerFQDN. Otherwise, the domain controller of the trusted domain is looked up
+// from winbind, ignoring the static configuration.
+func (w Winbind) DomainServerFQDN(ctx context.Context, domain string) (serverFQDN string, trusted bool, err error) {
+	if strings.EqualFold(domain, w.domain) {
+		serverFQDN, err = w.ServerFQDN(ctx)
+		return serverFQDN, false, err
+	}
+
+	defer decorate.OnError(&err, gotext.Get("error while trying to look up AD server address on winbind for trusted domain %q", domain))
+
+	log.Debugf(ctx, "Looking up domain controller of trusted domain %q", domain)
+	serverFQDN, err = dcName(domain)
+	if err != nil {
+		return "", true, err
+	}
+
+	return strings.TrimPrefix(serverFQDN, `\\`), true, nil
+}
+
+// Site returns the site set in the configuration, if any.
+func (w Winbind) Site() string {
+	return w.config.ADSite
+}
+
 // Config returns a stringified configuration for Winbind backend.
 func (w Winbind) Config() string {
 	return "Current backend is Winbind"
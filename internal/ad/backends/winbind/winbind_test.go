@@ -30,6 +30,7 @@ func TestWinbind(t *testing.T) {
 		wbclientBehavior string
 		staticADDomain   string
 		staticADServer   string
+		staticADSite     string
 		hostname         string
 
 		wantKinitErr bool
@@ -42,6 +43,7 @@ func TestWinbind(t *testing.T) {
 		"Lookup with overridden ad_domain":                  {staticADDomain: "overridden.com"},
 		"Lookup with overridden ad_server":                  {staticADServer: "controller.overridden.com"},
 		"Lookup with overridden ad_server with LDAP prefix": {staticADServer: "ldap://controller.overridden.com"},
+		"Lookup with ad_site":                               {staticADSite: "Paris"},
 
 		// Error cases
 		"Error when looking up domain":     {wbclientBehavior: "domain_not_found", wantErr: true},
@@ -68,6 +70,7 @@ func TestWinbind(t *testing.T) {
 			if tc.staticADServer != "" {
 				config.ADServer = tc.staticADServer
 			}
+			config.ADSite = tc.staticADSite
 
 			kinitCmdOutputFile := filepath.Join(t.TempDir(), "kinit-output")
 			kinitCmd := []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestExecuteKinitCommand", "--", kinitCmdOutputFile}
@@ -0,0 +1,90 @@
+// Package dclocator finds the domain controllers of an Active Directory domain from the DNS SRV records, and checks
+// if they are reachable.
+package dclocator
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/decorate"
+)
+
+// ldapPort is the port probed on domain controllers without an explicit one.
+const ldapPort = "389"
+
+// Resolver looks up DNS SRV records. *net.Resolver implements it.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// Candidates returns the domain controllers of domain advertised in the _ldap._tcp.dc._msdcs SRV records, in the order
+// they should be tried, without duplicates.
+// The domain controllers of site, if set, come first. Each group is ordered by priority, and by weight within a
+// priority as returned by the resolver.
+func Candidates(ctx context.Context, r Resolver, domain, site string) (dcs []string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't find domain controllers of %q in DNS", domain))
+
+	var names []string
+	if site != "" {
+		names = append(names, site+"._sites.dc._msdcs."+domain)
+	}
+	names = append(names, "dc._msdcs."+domain)
+
+	seen := make(map[string]struct{})
+	for i, name := range names {
+		_, records, err := r.LookupSRV(ctx, "ldap", "tcp", name)
+		if err != nil {
+			// Sites without their own domain controllers have no records
+			if i < len(names)-1 {
+				log.Debugf(ctx, "No domain controller for site %q: %v", site, err)
+				continue
+			}
+			if len(dcs) > 0 {
+				log.Warningf(ctx, "Only using domain controllers of site %q: %v", site, err)
+				break
+			}
+			return nil, err
+		}
+
+		sort.SliceStable(records, func(i, j int) bool { return records[i].Priority < records[j].Priority })
+		for _, srv := range records {
+			dc := strings.ToLower(strings.TrimSuffix(srv.Target, "."))
+			// A single dot target means the service is not available in the domain
+			if _, ok := seen[dc]; ok || dc == "" {
+				continue
+			}
+			seen[dc] = struct{}{}
+			dcs = append(dcs, dc)
+		}
+	}
+
+	if len(dcs) == 0 {
+		return nil, errors.New(gotext.Get("no domain controller advertised"))
+	}
+	log.Debugf(ctx, "Domain controllers of %q from DNS: %s", domain, strings.Join(dcs, ", "))
+	return dcs, nil
+}
+
+// Probe checks that the LDAP port of the domain controller dc accepts connections within timeout.
+// dc can be suffixed with the port to probe.
+func Probe(ctx context.Context, dc string, timeout time.Duration) (err error) {
+	defer decorate.OnError(&err, gotext.Get("domain controller %q is unreachable", dc))
+
+	addr := dc
+	if _, _, err := net.SplitHostPort(dc); err != nil {
+		addr = net.JoinHostPort(dc, ldapPort)
+	}
+
+	d := net.Dialer{Timeout: timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
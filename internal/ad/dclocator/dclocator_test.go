@@ -0,0 +1,125 @@
+package dclocator_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+)
+
+func TestCandidates(t *testing.T) {
+	t.Parallel()
+
+	records := map[string][]*net.SRV{
+		"_ldap._tcp.dc._msdcs.example.com": {
+			{Target: "dc3.example.com.", Priority: 10},
+			{Target: "dc1.example.com.", Priority: 0, Weight: 100},
+			{Target: "dc2.example.com.", Priority: 0, Weight: 50},
+		},
+		"_ldap._tcp.Paris._sites.dc._msdcs.example.com": {
+			{Target: "dc2.example.com.", Priority: 0},
+		},
+		"_ldap._tcp.dc._msdcs.duplicates.com": {
+			{Target: "DC1.duplicates.com.", Priority: 0},
+			{Target: "dc1.duplicates.com", Priority: 5},
+		},
+		"_ldap._tcp.dc._msdcs.unavailable.com": {
+			{Target: ".", Priority: 0},
+		},
+		"_ldap._tcp.Lyon._sites.dc._msdcs.sitesonly.com": {
+			{Target: "dc-lyon.sitesonly.com.", Priority: 0},
+		},
+	}
+
+	tests := map[string]struct {
+		domain string
+		site   string
+
+		want    []string
+		wantErr bool
+	}{
+		"Ordered by priority, then by weight from the resolver": {domain: "example.com", want: []string{"dc1.example.com", "dc2.example.com", "dc3.example.com"}},
+		"Domain controllers of the site come first":             {domain: "example.com", site: "Paris", want: []string{"dc2.example.com", "dc1.example.com", "dc3.example.com"}},
+		"Site without domain controllers":                       {domain: "example.com", site: "Lyon", want: []string{"dc1.example.com", "dc2.example.com", "dc3.example.com"}},
+		"Duplicates are removed":                                {domain: "duplicates.com", want: []string{"dc1.duplicates.com"}},
+		"Only the site domain controllers are found":            {domain: "sitesonly.com", site: "Lyon", want: []string{"dc-lyon.sitesonly.com"}},
+
+		"Error on domain without records":         {domain: "unknown.com", wantErr: true},
+		"Error on domain with service disabled":   {domain: "unavailable.com", wantErr: true},
+		"Error on site and domain without record": {domain: "unknown.com", site: "Paris", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := dclocator.Candidates(context.Background(), dnsStandIn(records), tc.domain, tc.site)
+			if tc.wantErr {
+				require.Error(t, err, "Candidates should have failed")
+				return
+			}
+			require.NoError(t, err, "Candidates should not have failed")
+			require.Equal(t, tc.want, got, "Candidates should return the expected domain controllers")
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Setup: can't listen on a local port")
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Setup: can't listen on a local port")
+	closedAddr := closed.Addr().String()
+	require.NoError(t, closed.Close(), "Setup: can't close listener")
+
+	tests := map[string]struct {
+		dc string
+
+		wantErr bool
+	}{
+		"Reachable domain controller": {dc: l.Addr().String()},
+
+		"Error on port not listening":      {dc: closedAddr, wantErr: true},
+		"Error on unresolvable controller": {dc: "doesnotexist.invalid", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			err := dclocator.Probe(context.Background(), tc.dc, time.Second)
+			if tc.wantErr {
+				require.Error(t, err, "Probe should have failed")
+				return
+			}
+			require.NoError(t, err, "Probe should not have failed")
+		})
+	}
+}
+
+// dnsStandIn answers SRV queries from its records, keyed by full name.
+type dnsStandIn map[string][]*net.SRV
+
+func (d dnsStandIn) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	fullName := "_" + service + "._" + proto + "." + name
+	records, ok := d[fullName]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: fullName, IsNotFound: true}
+	}
+	// Return a copy, as the records are sorted in place
+	return fullName, append([]*net.SRV(nil), records...), nil
+}
@@ -57,11 +57,12 @@ fetch downloads a list of gpos from a url for a given kerberosTicket and stores
 In addition, assetsURL is always refreshed if not empty.
 Each gpo entry must be a gpo, with a name, url of the form: smb://<server>/SYSVOL/<AD domain>/<GPO_ID> and mutex.
 If krb5Ticket is empty, no authentication is done on samba.
+domain is the AD domain of the downloadables when it isn't the backend one: they are then cached separately.
 This should not be called concurrently.
 
-It returns if the assets were refreshed or not.
+It returns if the assets were refreshed or not, even on error.
 */
-func (ad *AD) fetch(ctx context.Context, krb5Ticket string, downloadables map[string]string) (assetsWereRefreshed bool, err error) {
+func (ad *AD) fetch(ctx context.Context, krb5Ticket, domain string, downloadables map[string]string) (assetsWereRefreshed bool, err error) {
 	defer decorate.OnError(&err, gotext.Get("can't download all gpos and assets"))
 
 	// protect env variable and map creation
@@ -80,6 +81,14 @@ func (ad *AD) fetch(ctx context.Context, krb5Ticket string, downloadables map[st
 		}
 	}()
 
+	// Trusted domains cache directories are created on first use
+	sysvolDir := ad.sysvolDir(domain)
+	if domain != "" {
+		if err := os.MkdirAll(filepath.Join(sysvolDir, "Policies"), 0700); err != nil {
+			return false, err
+		}
+	}
+
 	client := libsmbclient.New()
 	defer client.Close()
 	// When testing we cannot use kerberos without a real kerberos server
@@ -90,19 +99,23 @@ func (ad *AD) fetch(ctx context.Context, krb5Ticket string, downloadables map[st
 
 	var errg errgroup.Group
 	for name, url := range downloadables {
-		g, ok := ad.downloadables[name]
+		key := downloadableKey(domain, name)
+		g, ok := ad.downloadables[key]
 		if !ok {
-			ad.downloadables[name] = &downloadable{
+			ad.downloadables[key] = &downloadable{
 				name:     name,
 				url:      url,
 				mu:       &sync.RWMutex{},
 				isAssets: false,
+				domain:   domain,
 			}
 			if name == "assets" {
-				ad.downloadables[name].isAssets = true
+				ad.downloadables[key].isAssets = true
 			}
-			g = ad.downloadables[name]
+			g = ad.downloadables[key]
 		}
+		// The server can change between calls
+		g.url = url
 		errg.Go(func() (err error) {
 			defer decorate.OnError(&err, gotext.Get("can't download %q", g.name))
 
@@ -111,9 +124,9 @@ func (ad *AD) fetch(ctx context.Context, krb5Ticket string, downloadables map[st
 
 			log.Debugf(ctx, "Analyzing %q", g.name)
 
-			dest := filepath.Join(ad.sysvolCacheDir, "Policies", filepath.Base(g.url))
+			dest := filepath.Join(sysvolDir, "Policies", filepath.Base(g.url))
 			if g.isAssets {
-				dest = filepath.Join(ad.sysvolCacheDir, "assets")
+				dest = filepath.Join(sysvolDir, "assets")
 			}
 
 			// Look at GPO version and compare with the one on AD to decide if we redownload or not
@@ -156,7 +169,7 @@ func (ad *AD) fetch(ctx context.Context, krb5Ticket string, downloadables map[st
 	}
 
 	if err := errg.Wait(); err != nil {
-		return false, fmt.Errorf("one or more error while fetching GPOs and assets: %w", err)
+		return assetsWereRefreshed, fmt.Errorf("one or more error while fetching GPOs and assets: %w", err)
 	}
 
 	return assetsWereRefreshed, nil
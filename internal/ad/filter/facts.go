@@ -0,0 +1,234 @@
+package filter
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+// chassisTypes are the chassis kinds a filter can match.
+var chassisTypes = []string{"laptop", "desktop", "server", "tablet", "unknown"}
+
+// smbiosChassis maps the SMBIOS chassis types to the chassis kinds.
+var smbiosChassis = map[int]string{
+	3: "desktop", 4: "desktop", 5: "desktop", 6: "desktop", 7: "desktop", 13: "desktop", 15: "desktop", 16: "desktop",
+	24: "desktop", 35: "desktop", 36: "desktop",
+	8: "laptop", 9: "laptop", 10: "laptop", 14: "laptop", 31: "laptop", 32: "laptop",
+	17: "server", 23: "server", 25: "server", 28: "server",
+	11: "tablet", 30: "tablet",
+}
+
+// debianArchs maps the Go architectures to the Debian ones, when they differ.
+var debianArchs = map[string]string{
+	"386":     "i386",
+	"arm":     "armhf",
+	"ppc64le": "ppc64el",
+}
+
+// Facts are the properties of the machine filters are evaluated against.
+type Facts struct {
+	// Release is the VERSION_ID of the Ubuntu release.
+	Release string
+	// Arch is the Debian architecture of the machine.
+	Arch string
+	// Hostname is the machine name.
+	Hostname string
+	// Desktops are the names of the installed desktop environments.
+	Desktops []string
+	// Chassis is the kind of machine, one of chassisTypes.
+	Chassis string
+	// User is the name of the user the policies are evaluated for, if any.
+	User string
+	// Groups are the names of the groups User is a member of. They are looked up the first time a group condition
+	// is evaluated, unless already set.
+	Groups []string
+
+	// dpkgStatus is the path to the dpkg database, only loaded if a package condition is evaluated.
+	dpkgStatus   string
+	loadPackages sync.Once
+	packages     map[string]struct{}
+	packagesErr  error
+
+	loadGroups sync.Once
+	groupsErr  error
+}
+
+// NewFacts returns the facts of the machine whose filesystem is at root.
+// Desktops and chassis are detected from root, the dpkg database is only read when needed.
+func NewFacts(root, release, hostname string) *Facts {
+	arch := runtime.GOARCH
+	if a, ok := debianArchs[arch]; ok {
+		arch = a
+	}
+
+	return &Facts{
+		Release:    release,
+		Arch:       arch,
+		Hostname:   hostname,
+		Desktops:   desktops(root),
+		Chassis:    chassis(root),
+		dpkgStatus: filepath.Join(root, "var/lib/dpkg/status"),
+	}
+}
+
+// desktops returns the desktop environments declared by the installed X and Wayland sessions.
+func desktops(root string) (names []string) {
+	seen := make(map[string]struct{})
+	for _, dir := range []string{"usr/share/xsessions", "usr/share/wayland-sessions"} {
+		sessions, _ := filepath.Glob(filepath.Join(root, dir, "*.desktop"))
+		for _, session := range sessions {
+			d, err := os.ReadFile(session)
+			if err != nil {
+				continue
+			}
+			for _, l := range strings.Split(string(d), "\n") {
+				v, ok := strings.CutPrefix(strings.TrimSpace(l), "DesktopNames=")
+				if !ok {
+					continue
+				}
+				// Names are separated with ; in the specification, but with : like in XDG_CURRENT_DESKTOP by some sessions.
+				for _, n := range strings.FieldsFunc(v, func(r rune) bool { return r == ';' || r == ':' }) {
+					n = strings.TrimSpace(n)
+					if _, ok := seen[strings.ToLower(n)]; n == "" || ok {
+						continue
+					}
+					seen[strings.ToLower(n)] = struct{}{}
+					names = append(names, n)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// chassis returns the kind of machine, as reported by the firmware.
+func chassis(root string) string {
+	d, err := os.ReadFile(filepath.Join(root, "sys/class/dmi/id/chassis_type"))
+	if err != nil {
+		return "unknown"
+	}
+	t, err := strconv.Atoi(strings.TrimSpace(string(d)))
+	if err != nil {
+		return "unknown"
+	}
+	if c, ok := smbiosChassis[t]; ok {
+		return c
+	}
+	return "unknown"
+}
+
+// isInstalled returns true if the package name, optionally suffixed with :<arch>, is installed.
+func (f *Facts) isInstalled(name string) (bool, error) {
+	f.loadPackages.Do(func() {
+		f.packages, f.packagesErr = installedPackages(f.dpkgStatus)
+	})
+	if f.packagesErr != nil {
+		return false, f.packagesErr
+	}
+
+	_, ok := f.packages[name]
+	return ok, nil
+}
+
+// isMember returns true if User is a member of the group name.
+// Group names can be qualified with the domain, depending on the NSS configuration. They match the unqualified name.
+func (f *Facts) isMember(name string) (bool, error) {
+	f.loadGroups.Do(func() {
+		if f.Groups != nil || f.User == "" {
+			return
+		}
+		f.Groups, f.groupsErr = userGroups(f.User)
+	})
+	if f.groupsErr != nil {
+		return false, f.groupsErr
+	}
+
+	for _, g := range f.Groups {
+		short, _, _ := strings.Cut(g, "@")
+		if strings.EqualFold(g, name) || strings.EqualFold(short, name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// userGroups returns the names of the groups of the user name, as resolved by NSS.
+func userGroups(name string) (groups []string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't list groups of %q", name))
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, gid := range gids {
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, g.Name)
+	}
+	return groups, nil
+}
+
+// installedPackages returns the installed packages listed in the dpkg status file, by name and by name:arch.
+func installedPackages(p string) (packages map[string]struct{}, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't list installed packages"))
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer decorate.LogFuncOnError(f.Close)
+
+	packages = make(map[string]struct{})
+	var name, arch string
+	var installed bool
+	record := func() {
+		if name != "" && installed {
+			packages[name] = struct{}{}
+			packages[name+":"+arch] = struct{}{}
+		}
+		name, arch, installed = "", "", false
+	}
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		l := scanner.Text()
+		switch {
+		case l == "":
+			record()
+		case strings.HasPrefix(l, "Package:"):
+			name = strings.TrimSpace(strings.TrimPrefix(l, "Package:"))
+		case strings.HasPrefix(l, "Architecture:"):
+			arch = strings.TrimSpace(strings.TrimPrefix(l, "Architecture:"))
+		case strings.HasPrefix(l, "Status:"):
+			// Status is "<want> <flag> <status>"
+			status := strings.Fields(strings.TrimPrefix(l, "Status:"))
+			installed = len(status) == 3 && status[2] == "installed"
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	record()
+
+	if len(packages) == 0 {
+		return nil, errors.New(gotext.Get("no installed package found in %s", p))
+	}
+
+	return packages, nil
+}
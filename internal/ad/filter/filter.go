@@ -0,0 +1,280 @@
+// Package filter evaluates conditions on the Linux host, restricting the machines a GPO applies to.
+//
+// It is the equivalent of WMI filters for Linux clients. A filter is a boolean expression combining conditions with
+// "and", "or", "not" and parentheses, like:
+//
+//	release >= 22.04 and (chassis = laptop or hostname = "dev-*") and not package = kubuntu-desktop
+//
+// Supported conditions are:
+//   - release: VERSION_ID of the Ubuntu release, compared with =, !=, <, <=, > or >=.
+//   - arch: Debian architecture of the machine, like amd64 or arm64.
+//   - hostname: shell pattern matched case-insensitively against the machine hostname.
+//   - package: name of a package which is installed, optionally suffixed with :<arch>.
+//   - desktop: name of an installed desktop environment, like GNOME or KDE.
+//   - chassis: laptop, desktop, server, tablet or unknown.
+//   - group: name of a group the user is a member of. It never matches when evaluated for the machine.
+//
+// Text from # to the end of the line is a comment.
+package filter
+
+import (
+	"errors"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+// Filter is a parsed filter expression.
+type Filter struct {
+	root node
+}
+
+// Parse returns the filter represented by s.
+func Parse(s string) (f Filter, err error) {
+	defer decorate.OnError(&err, gotext.Get("invalid filter"))
+
+	tokens, err := tokenize(s)
+	if err != nil {
+		return f, err
+	}
+	if len(tokens) == 0 {
+		return f, errors.New(gotext.Get("filter is empty"))
+	}
+
+	p := parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return f, err
+	}
+	if t, ok := p.peek(); ok {
+		return f, errors.New(gotext.Get("unexpected %q", t.value))
+	}
+
+	return Filter{root: root}, nil
+}
+
+// Eval returns true if the filter matches the machine described by facts.
+func (f Filter) Eval(facts *Facts) (bool, error) {
+	return f.root.eval(facts)
+}
+
+// String returns the normalized representation of the filter, on a single line.
+func (f Filter) String() string {
+	if f.root == nil {
+		return ""
+	}
+	return f.root.String()
+}
+
+// node is an element of the filter expression tree.
+type node interface {
+	eval(facts *Facts) (bool, error)
+	String() string
+}
+
+type orNode []node
+
+func (n orNode) eval(facts *Facts) (bool, error) {
+	for _, c := range n {
+		ok, err := c.eval(facts)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+func (n orNode) String() string {
+	var parts []string
+	for _, c := range n {
+		parts = append(parts, c.String())
+	}
+	return strings.Join(parts, " or ")
+}
+
+type andNode []node
+
+func (n andNode) eval(facts *Facts) (bool, error) {
+	for _, c := range n {
+		ok, err := c.eval(facts)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (n andNode) String() string {
+	var parts []string
+	for _, c := range n {
+		s := c.String()
+		if _, ok := c.(orNode); ok {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " and ")
+}
+
+type notNode struct {
+	child node
+}
+
+func (n notNode) eval(facts *Facts) (bool, error) {
+	ok, err := n.child.eval(facts)
+	return !ok, err
+}
+
+func (n notNode) String() string {
+	if _, ok := n.child.(condition); ok {
+		return "not " + n.child.String()
+	}
+	return "not (" + n.child.String() + ")"
+}
+
+// condition compares a fact of the machine with a value.
+type condition struct {
+	attribute string
+	operator  string
+	value     string
+}
+
+// operators lists the comparisons supported by each attribute.
+var operators = map[string][]string{
+	"release":  {"=", "!=", "<", "<=", ">", ">="},
+	"arch":     {"=", "!="},
+	"hostname": {"=", "!="},
+	"package":  {"=", "!="},
+	"desktop":  {"=", "!="},
+	"chassis":  {"=", "!="},
+	"group":    {"=", "!="},
+}
+
+func newCondition(attribute, operator, value string) (c condition, err error) {
+	attribute = strings.ToLower(attribute)
+	ops, ok := operators[attribute]
+	if !ok {
+		return c, errors.New(gotext.Get("unknown attribute %q", attribute))
+	}
+	if !slices.Contains(ops, operator) {
+		return c, errors.New(gotext.Get("operator %q is not supported by %q", operator, attribute))
+	}
+
+	switch attribute {
+	case "release":
+		if _, err := parseVersion(value); err != nil {
+			return c, err
+		}
+	case "hostname":
+		if _, err := path.Match(value, ""); err != nil {
+			return c, errors.New(gotext.Get("invalid hostname pattern %q: %v", value, err))
+		}
+	case "chassis":
+		value = strings.ToLower(value)
+		if !slices.Contains(chassisTypes, value) {
+			return c, errors.New(gotext.Get("unknown chassis %q, expected one of %s", value, strings.Join(chassisTypes, ", ")))
+		}
+	}
+
+	return condition{attribute: attribute, operator: operator, value: value}, nil
+}
+
+func (c condition) eval(facts *Facts) (ok bool, err error) {
+	switch c.attribute {
+	case "release":
+		cmp, err := compareVersions(facts.Release, c.value)
+		if err != nil {
+			return false, err
+		}
+		switch c.operator {
+		case "<":
+			return cmp < 0, nil
+		case "<=":
+			return cmp <= 0, nil
+		case ">":
+			return cmp > 0, nil
+		case ">=":
+			return cmp >= 0, nil
+		}
+		ok = cmp == 0
+	case "arch":
+		ok = strings.EqualFold(facts.Arch, c.value)
+	case "hostname":
+		ok, _ = path.Match(strings.ToLower(c.value), strings.ToLower(facts.Hostname))
+	case "package":
+		if ok, err = facts.isInstalled(c.value); err != nil {
+			return false, err
+		}
+	case "desktop":
+		for _, d := range facts.Desktops {
+			if strings.EqualFold(d, c.value) {
+				ok = true
+				break
+			}
+		}
+	case "chassis":
+		ok = facts.Chassis == c.value
+	case "group":
+		if ok, err = facts.isMember(c.value); err != nil {
+			return false, err
+		}
+	}
+
+	if c.operator == "!=" {
+		return !ok, nil
+	}
+	return ok, nil
+}
+
+func (c condition) String() string {
+	v := c.value
+	if v == "" || strings.ContainsAny(v, " \t\n()=!<>\"#") {
+		v = strconv.Quote(v)
+	}
+	return c.attribute + " " + c.operator + " " + v
+}
+
+// parseVersion returns the numeric components of a version like 22.04.
+func parseVersion(v string) (parts []int, err error) {
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errors.New(gotext.Get("invalid release %q", v))
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is lower, equal or greater than b.
+func compareVersions(a, b string) (int, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return 0, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < len(va) || i < len(vb); i++ {
+		var x, y int
+		if i < len(va) {
+			x = va[i]
+		}
+		if i < len(vb) {
+			y = vb[i]
+		}
+		if x < y {
+			return -1, nil
+		}
+		if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
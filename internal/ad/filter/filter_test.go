@@ -0,0 +1,127 @@
+package filter_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/ad/filter"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		filter string
+
+		want    string
+		wantErr bool
+	}{
+		"Single condition":                    {filter: "release >= 22.04", want: "release >= 22.04"},
+		"Keywords and attributes ignore case": {filter: "Arch = amd64 AND NOT Chassis = Laptop", want: "arch = amd64 and not chassis = laptop"},
+		"Operators without spaces":            {filter: "release<24.04 or hostname!=dev-*", want: "release < 24.04 or hostname != dev-*"},
+		"Parentheses are kept when needed":    {filter: "(arch = amd64 or arch = arm64) and ((desktop = GNOME))", want: "(arch = amd64 or arch = arm64) and desktop = GNOME"},
+		"Not applies to a group":              {filter: "not (package = a and package = b)", want: "not (package = a and package = b)"},
+		"Quoted values":                       {filter: `desktop = "Ubuntu Desktop" or package = "vim"`, want: `desktop = "Ubuntu Desktop" or package = vim`},
+		"Group with spaces":                   {filter: `group = "Lab Users"`, want: `group = "Lab Users"`},
+		"Comments and multiple lines": {filter: `# Developer laptops
+release >= 22.04 # Supported releases
+and chassis = laptop`, want: "release >= 22.04 and chassis = laptop"},
+
+		"Error on empty filter":                   {filter: " # Nothing\n", wantErr: true},
+		"Error on unknown attribute":              {filter: "kernel = 6.8", wantErr: true},
+		"Error on unsupported operator":           {filter: "arch >= amd64", wantErr: true},
+		"Error on invalid release":                {filter: "release = jammy", wantErr: true},
+		"Error on invalid hostname pattern":       {filter: "hostname = [a", wantErr: true},
+		"Error on unknown chassis":                {filter: "chassis = convertible", wantErr: true},
+		"Error on missing value":                  {filter: "arch =", wantErr: true},
+		"Error on missing operator":               {filter: "arch amd64", wantErr: true},
+		"Error on missing closing parenthesis":    {filter: "(arch = amd64", wantErr: true},
+		"Error on unexpected closing parenthesis": {filter: "arch = amd64)", wantErr: true},
+		"Error on dangling keyword":               {filter: "arch = amd64 and", wantErr: true},
+		"Error on unterminated string":            {filter: `desktop = "GNOME`, wantErr: true},
+		"Error on lone exclamation mark":          {filter: "! arch = amd64", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			f, err := filter.Parse(tc.filter)
+			if tc.wantErr {
+				require.Error(t, err, "Parse should have failed")
+				return
+			}
+			require.NoError(t, err, "Parse should not have failed")
+			require.Equal(t, tc.want, f.String(), "Parse should return the expected filter")
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		filter string
+		root   string
+		user   string
+
+		want    bool
+		wantErr bool
+	}{
+		"Release equal":                    {filter: "release = 22.04", want: true},
+		"Release compared numerically":     {filter: "release > 9.10 and release < 22.10", want: true},
+		"Release with different precision": {filter: "release <= 22.04.0 and release >= 22", want: true},
+		"Release lower":                    {filter: "release < 22.04"},
+		"Architecture":                     {filter: "arch = amd64", want: true},
+		"Other architecture":               {filter: "arch != amd64"},
+		"Hostname pattern":                 {filter: "hostname = DEV-*", want: true},
+		"Hostname not matching":            {filter: "hostname = dev-?"},
+		"Installed package":                {filter: "package = adsys", want: true},
+		"Installed package with arch":      {filter: "package = libc6:i386", want: true},
+		"Package of other arch":            {filter: "package = libc6:amd64"},
+		"Removed package":                  {filter: "package = firefox"},
+		"Missing package":                  {filter: "package != doesnotexist", want: true},
+		"X session desktop":                {filter: "desktop = gnome", want: true},
+		"Wayland session desktop":          {filter: "desktop = KDE", want: true},
+		"Missing desktop":                  {filter: "desktop = XFCE"},
+		"Chassis":                          {filter: "chassis = laptop", want: true},
+		"Chassis is unknown without firmware information": {filter: "chassis = unknown", root: "empty", want: true},
+		"No desktop without sessions":                     {filter: "desktop != GNOME", root: "empty", want: true},
+		"Combined conditions":                             {filter: "not (chassis = desktop or arch = arm64) and (package = doesnotexist or release >= 20.04)", want: true},
+		"Conditions are short-circuited":                  {filter: "arch = arm64 and package = adsys", root: "empty"},
+		"Group of the user":                               {filter: "group = Lab-Users", want: true},
+		"Group qualified with the domain":                 {filter: "group = developers", want: true},
+		"Group the user is not a member of":               {filter: "group = admins"},
+		"Group never matches the machine":                 {filter: "group != lab-users", user: "-", want: true},
+
+		"Error on package without dpkg database": {filter: "package = adsys", root: "empty", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := filepath.Join("testdata", "laptop")
+			if tc.root == "empty" {
+				root = t.TempDir()
+			}
+
+			facts := filter.NewFacts(root, "22.04", "dev-01")
+			facts.Arch = "amd64"
+			if tc.user != "-" {
+				facts.User = "bob@example.com"
+				facts.Groups = []string{"lab-users", "developers@example.com"}
+			}
+
+			f, err := filter.Parse(tc.filter)
+			require.NoError(t, err, "Setup: Parse should not have failed")
+
+			got, err := f.Eval(facts)
+			if tc.wantErr {
+				require.Error(t, err, "Eval should have failed")
+				return
+			}
+			require.NoError(t, err, "Eval should not have failed")
+			require.Equal(t, tc.want, got, "Eval should return the expected result")
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package filter
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+}
+
+// tokenize splits s in words, quoted strings, comparison operators and parentheses.
+func tokenize(s string) (tokens []token, err error) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '#':
+			// Comment up to the end of the line
+			end := strings.IndexByte(s[i:], '\n')
+			if end < 0 {
+				return tokens, nil
+			}
+			i += end
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenOpen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenClose, value: ")"})
+			i++
+		case strings.IndexByte("=!<>", c) >= 0:
+			op := string(c)
+			if i+1 < len(s) && s[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, errors.New(gotext.Get("unexpected %q, use \"not\" or \"!=\"", op))
+			}
+			tokens = append(tokens, token{kind: tokenOperator, value: op})
+			i += len(op)
+		case c == '"':
+			end := i + 1
+			for ; end < len(s) && s[end] != '"'; end++ {
+				if s[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(s) {
+				return nil, errors.New(gotext.Get("unterminated string %s", s[i:]))
+			}
+			v, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, errors.New(gotext.Get("invalid string %s: %v", s[i:end+1], err))
+			}
+			tokens = append(tokens, token{kind: tokenString, value: v})
+			i = end + 1
+		default:
+			end := i
+			for end < len(s) && strings.IndexByte(" \t\r\n()=!<>\"#", s[end]) < 0 {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: s[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// parser builds the expression tree from tokens, with "not" binding tighter than "and", itself tighter than "or".
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) next() (token, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, errors.New(gotext.Get("unexpected end of filter"))
+	}
+	p.pos++
+	return t, nil
+}
+
+// isKeyword returns true if the next token is the keyword k, and consumes it.
+func (p *parser) isKeyword(k string) bool {
+	t, ok := p.peek()
+	if !ok || t.kind != tokenWord || !strings.EqualFold(t.value, k) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *parser) parseOr() (node, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := orNode{n}
+	for p.isKeyword("or") {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	nodes := andNode{n}
+	for p.isKeyword("and") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isKeyword("not") {
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: n}, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokenOpen:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t.kind != tokenClose {
+			return nil, errors.New(gotext.Get("missing closing parenthesis"))
+		}
+		return n, nil
+	case tokenWord:
+		return p.parseCondition(t.value)
+	}
+	return nil, errors.New(gotext.Get("unexpected %q", t.value))
+}
+
+func (p *parser) parseCondition(attribute string) (node, error) {
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.kind != tokenOperator {
+		return nil, errors.New(gotext.Get("expected an operator after %q, got %q", attribute, op.value))
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, errors.New(gotext.Get("expected a value after \"%s %s\", got %q", attribute, op.value, value.value))
+	}
+
+	return newCondition(attribute, op.value, value.value)
+}
@@ -0,0 +1,387 @@
+// Package gpolist lists the GPOs applying to an Active Directory user or computer, by querying the directory.
+//
+// It follows the object parent containers up to the domain, then the site of the machine, honouring enforced and
+// disabled links, blocked inheritance, GPO flags and the "Apply Group Policy" right of the object and its groups.
+package gpolist
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/ldap"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/decorate"
+)
+
+// gPLink options.
+const (
+	gpLinkOptDisable = 0x1
+	gpLinkOptEnforce = 0x2
+)
+
+// gpOptionsBlockInheritance is set in gPOptions when a container blocks the inheritance of the GPOs linked above.
+const gpOptionsBlockInheritance = 0x1
+
+// GPO flags.
+const (
+	gpoFlagUserDisable    = 0x1
+	gpoFlagMachineDisable = 0x2
+)
+
+// computerNameMaxLength is the length Active Directory may truncate computer account names to.
+const computerNameMaxLength = 15
+
+// GPO is a Group Policy Object applying to an object.
+type GPO struct {
+	// Name is the display name of the GPO.
+	Name string
+	// URL is the smb URL of the GPO directory on the domain controller.
+	URL string
+}
+
+// Directory is the LDAP directory of the domain.
+type Directory interface {
+	DefaultNamingContext(ctx context.Context) (string, error)
+	ConfigurationNamingContext(ctx context.Context) (string, error)
+	Search(ctx context.Context, req ldap.SearchRequest) ([]ldap.Entry, error)
+}
+
+// List returns the GPOs applying to accountName, from the highest priority to the lowest one.
+// Enforced GPOs come first, the higher in the hierarchy the higher the priority, followed by the others, the closer to
+// the object the higher the priority.
+// GPOs linked to the site named site, if not empty, are above the domain in the hierarchy.
+// GPO URLs point to the domain controller dcFQDN.
+func List(ctx context.Context, dir Directory, dcFQDN, accountName string, isComputer bool, site string) (gpos []GPO, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't list GPOs of %q", accountName))
+
+	baseDN, err := dir.DefaultNamingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := lookupAccount(ctx, dir, baseDN, accountName, isComputer)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := tokenGroupSIDs(ctx, dir, a.dn)
+	if err != nil {
+		return nil, err
+	}
+	a.sids = append(groups, a.sids...)
+	log.Debugf(ctx, "Account %q found at %q with SIDs %s", accountName, a.dn, strings.Join(a.sids, ", "))
+
+	return gposFor(ctx, dir, baseDN, a, isComputer, dcFQDN, site)
+}
+
+// ListLoopback returns the GPOs linked to the containers of the computer computerName which apply to the user
+// accountName, from the highest priority to the lowest one.
+// This is the list of GPOs whose user settings are applied with loopback processing.
+func ListLoopback(ctx context.Context, dir Directory, dcFQDN, accountName, computerName, site string) (gpos []GPO, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't list loopback GPOs of %q on %q", accountName, computerName))
+
+	baseDN, err := dir.DefaultNamingContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := lookupAccount(ctx, dir, baseDN, accountName, false)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := tokenGroupSIDs(ctx, dir, user.dn)
+	if err != nil {
+		return nil, err
+	}
+	user.sids = append(groups, user.sids...)
+
+	computer, err := lookupAccount(ctx, dir, baseDN, computerName, true)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf(ctx, "Listing loopback GPOs of %q from %q", accountName, computer.dn)
+
+	// Walk the containers of the computer, but check the rights of the user.
+	user.dn = computer.dn
+	return gposFor(ctx, dir, baseDN, user, false, dcFQDN, site)
+}
+
+// account is a user or computer found in the directory.
+type account struct {
+	dn string
+	// sids are the SIDs of the account security token, which the GPO rights are checked against.
+	sids []string
+}
+
+// lookupAccount returns the account of objectClass user or computer with accountName.
+// Computer names are also looked up truncated, as some AD limits them to 15 characters.
+func lookupAccount(ctx context.Context, dir Directory, baseDN, accountName string, isComputer bool) (a account, err error) {
+	candidates := []string{accountName}
+	if isComputer && len(accountName) > computerNameMaxLength {
+		candidates = append(candidates, accountName[:computerNameMaxLength])
+	}
+	for _, name := range candidates {
+		if a, err = findAccount(ctx, dir, baseDN, name, isComputer); err == nil {
+			return a, nil
+		}
+		log.Debugf(ctx, "Searching for account %q failed: %v", name, err)
+	}
+	return a, err
+}
+
+// findAccount returns the account of objectClass user or computer with accountName.
+func findAccount(ctx context.Context, dir Directory, baseDN, accountName string, isComputer bool) (a account, err error) {
+	objectClass := "user"
+	if isComputer {
+		objectClass = "computer"
+	}
+
+	entries, err := dir.Search(ctx, ldap.SearchRequest{
+		BaseDN: baseDN,
+		Scope:  ldap.ScopeSubtree,
+		Filter: ldap.And(
+			ldap.Or(ldap.Equal("sAMAccountName", accountName), ldap.Equal("sAMAccountName", accountName+"$")),
+			ldap.Equal("objectClass", objectClass),
+		),
+		Attributes: []string{"objectClass", "objectSid"},
+	})
+	if err != nil {
+		return a, err
+	}
+	if len(entries) == 0 {
+		return a, errors.New(gotext.Get("failed to find account %s", accountName))
+	}
+	e := entries[0]
+
+	// Computers are also users: check that the object is really of the requested kind.
+	if ldap.Equal("objectClass", "computer").Match(e) != isComputer {
+		return a, errors.New(gotext.Get("failed to find %s account %s", objectClass, accountName))
+	}
+
+	sid, err := parseSID(e.Value("objectSid"))
+	if err != nil {
+		return a, err
+	}
+	return account{dn: e.DN, sids: []string{authenticatedUsersSID, sid}}, nil
+}
+
+// tokenGroupSIDs returns the SIDs of all the groups dn is a member of, directly or through nested groups, including
+// its primary group.
+// They are read from the tokenGroups attribute the directory computes, which is only returned on a base search.
+func tokenGroupSIDs(ctx context.Context, dir Directory, dn string) (sids []string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get groups of %q", dn))
+
+	entries, err := dir.Search(ctx, ldap.SearchRequest{
+		BaseDN:     dn,
+		Scope:      ldap.ScopeBase,
+		Filter:     ldap.Present("objectClass"),
+		Attributes: []string{"tokenGroups"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New(gotext.Get("account not found"))
+	}
+
+	for _, v := range entries[0].Values("tokenGroups") {
+		sid, err := parseSID(v)
+		if err != nil {
+			return nil, err
+		}
+		sids = append(sids, sid)
+	}
+	return sids, nil
+}
+
+// gposFor returns the GPOs linked to the parent containers of the account, up to baseDN, and to the site named site
+// if not empty.
+func gposFor(ctx context.Context, dir Directory, baseDN string, a account, isComputer bool, dcFQDN, site string) (gpos []GPO, err error) {
+	var containers []string
+	for dn := parentDN(a.dn); ; dn = parentDN(dn) {
+		if dn == "" {
+			return nil, errors.New(gotext.Get("%q is not in domain %q", a.dn, baseDN))
+		}
+		containers = append(containers, dn)
+		if strings.EqualFold(dn, baseDN) {
+			break
+		}
+	}
+	if site != "" {
+		dn, err := siteDN(ctx, dir, site)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, dn)
+	}
+
+	inherit := true
+	for _, dn := range containers {
+		entries, err := dir.Search(ctx, ldap.SearchRequest{
+			BaseDN:     dn,
+			Scope:      ldap.ScopeBase,
+			Filter:     ldap.Present("objectClass"),
+			Attributes: []string{"gPLink", "gPOptions"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, errors.New(gotext.Get("container %q not found", dn))
+		}
+		container := entries[0]
+
+		links, err := parseGPLink(string(container.Value("gPLink")))
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			if !inherit && l.options&gpLinkOptEnforce == 0 {
+				continue
+			}
+			if l.options&gpLinkOptDisable != 0 {
+				continue
+			}
+
+			g, ok, err := gpoFor(ctx, dir, l.dn, a, isComputer, dcFQDN)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+
+			// Enforced policy (higher wins)
+			if l.options&gpLinkOptEnforce != 0 {
+				gpos = append([]GPO{g}, gpos...)
+				continue
+			}
+			// Others (higher have less weight)
+			gpos = append(gpos, g)
+		}
+
+		// Check if this blocks inheritance
+		if v := container.Value("gPOptions"); v != nil {
+			options, err := strconv.Atoi(string(v))
+			if err != nil {
+				return nil, errors.New(gotext.Get("invalid gPOptions %q on %q: %v", v, dn, err))
+			}
+			if options&gpOptionsBlockInheritance != 0 {
+				inherit = false
+			}
+		}
+	}
+
+	return gpos, nil
+}
+
+// gpoFor returns the GPO at dn if it applies to the account.
+// GPOs which are not readable are skipped, as Active Directory does.
+func gpoFor(ctx context.Context, dir Directory, dn string, a account, isComputer bool, dcFQDN string) (g GPO, ok bool, err error) {
+	entries, err := dir.Search(ctx, ldap.SearchRequest{
+		BaseDN:     dn,
+		Scope:      ldap.ScopeBase,
+		Filter:     ldap.Present("objectClass"),
+		Attributes: []string{"name", "displayName", "flags", "nTSecurityDescriptor", "gPCFileSysPath"},
+		Controls:   []ldap.Control{ldap.SDFlagsControl(secInfoOwner | secInfoGroup | secInfoDACL)},
+	})
+	if err == nil && (len(entries) == 0 || entries[0].Value("nTSecurityDescriptor") == nil) {
+		err = errors.New(gotext.Get("no security descriptor"))
+	}
+	var sd securityDescriptor
+	if err == nil {
+		sd, err = parseSecurityDescriptor(entries[0].Value("nTSecurityDescriptor"))
+	}
+	if err != nil {
+		log.Warningf(ctx, "Failed to fetch GPO object with nTSecurityDescriptor %s: %v", dn, err)
+		return g, false, nil
+	}
+	e := entries[0]
+
+	token := append([]string{everyoneSID}, a.sids...)
+	if !sd.isAllowed(token, rightGPOReadRequired) {
+		return g, false, errors.New(gotext.Get("failed access check on %s", dn))
+	}
+
+	if !sd.canApply(a.sids) {
+		log.Debugf(ctx, "GPO %s does not apply to %s", dn, a.dn)
+		return g, false, nil
+	}
+
+	// Check the flags on the GPO
+	if v := e.Value("flags"); v != nil {
+		flags, err := strconv.Atoi(string(v))
+		if err != nil {
+			return g, false, errors.New(gotext.Get("invalid flags %q on %s: %v", v, dn, err))
+		}
+		if isComputer && flags&gpoFlagMachineDisable != 0 {
+			return g, false, nil
+		}
+		if !isComputer && flags&gpoFlagUserDisable != 0 {
+			return g, false, nil
+		}
+	}
+
+	name, path := e.Value("displayName"), e.Value("gPCFileSysPath")
+	if name == nil || path == nil {
+		return g, false, errors.New(gotext.Get("GPO %s has no displayName or gPCFileSysPath", dn))
+	}
+
+	return GPO{Name: string(name), URL: gpoURL(string(path), dcFQDN)}, true, nil
+}
+
+type gpLink struct {
+	dn      string
+	options int
+}
+
+// parseGPLink parses the GPO links of a gPLink attribute, in the form [LDAP://<dn>;<options>][LDAP://...].
+func parseGPLink(v string) (links []gpLink, err error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+
+	for _, l := range strings.Split(v, "]") {
+		if l == "" {
+			continue
+		}
+		parts := strings.Split(l, ";")
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], "[LDAP://") {
+			return nil, errors.New(gotext.Get("badly formed gPLink %q", l))
+		}
+		options, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.New(gotext.Get("badly formed gPLink %q: %v", l, err))
+		}
+		links = append(links, gpLink{dn: strings.TrimPrefix(parts[0], "[LDAP://"), options: options})
+	}
+	return links, nil
+}
+
+// parentDN returns the DN of the parent of dn, or an empty string if it has none.
+func parentDN(dn string) string {
+	escaped := false
+	for i, c := range dn {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			return strings.TrimSpace(dn[i+1:])
+		}
+	}
+	return ""
+}
+
+// gpoURL converts the UNC path of a GPO, like \\domain.com\SysVol\..., to a smb URL on the domain controller dcFQDN.
+func gpoURL(path, dcFQDN string) string {
+	path = strings.ReplaceAll(path, `\`, "/")
+	parts := strings.Split(strings.TrimLeft(path, "/"), "/")
+	parts[0] = dcFQDN
+
+	return "smb://" + strings.Join(parts, "/")
+}
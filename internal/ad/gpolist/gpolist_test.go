@@ -0,0 +1,580 @@
+package gpolist_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/ad/gpolist"
+	"github.com/ubuntu/adsys/internal/ad/ldap"
+)
+
+const (
+	baseDN     = "DC=example,DC=com"
+	itDN       = "OU=IT," + baseDN
+	devDN      = "OU=Dev," + itDN
+	domainSID  = "S-1-5-21-1111-2222-3333"
+	policiesDN = "CN=Policies,CN=System," + baseDN
+	configDN   = "CN=Configuration," + baseDN
+	sitesDN    = "CN=Sites," + configDN
+
+	authenticatedUsers = "S-1-5-11"
+	group1SID          = domainSID + "-2001"
+	nestedGroupSID     = domainSID + "-2002"
+	domainUsersSID     = domainSID + "-513"
+	applyGroupPolicy   = "edacfd8f-ffb3-11d1-b41d-00a0c968f939"
+
+	readRights = 0x20094
+)
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		accountName string
+		isComputer  bool
+		domainLinks string
+		itLinks     string
+		devLinks    string
+		devOptions  string
+		site        string
+		siteLinks   string
+		noBaseDN    bool
+
+		want    []string
+		wantErr bool
+	}{
+		"GPOs linked on all parents, closest first": {
+			domainLinks: links("domain"), itLinks: links("it"), devLinks: links("dev", "dev2"),
+			want: []string{"dev", "dev2", "it", "domain"},
+		},
+		"Enforced GPOs first, highest first": {
+			domainLinks: enforced("domain"), itLinks: enforced("it") + links("it2"), devLinks: links("dev"),
+			want: []string{"domain", "it", "dev", "it2"},
+		},
+		"Blocked inheritance only keeps enforced GPOs above": {
+			domainLinks: enforced("domain"), itLinks: links("it"), devLinks: links("dev"), devOptions: "1",
+			want: []string{"domain", "dev"},
+		},
+		"Blocking inheritance keeps GPOs linked on the container": {
+			devLinks: links("dev"), devOptions: "1",
+			want: []string{"dev"},
+		},
+		"Disabled links are skipped": {
+			domainLinks: links("domain"), devLinks: fmt.Sprintf("[LDAP://CN={dev},%s;1]", policiesDN) + enforced("dev2"),
+			want: []string{"dev2", "domain"},
+		},
+		"GPOs with user settings disabled don’t apply to users": {
+			devLinks: links("user-disabled", "machine-disabled"),
+			want:     []string{"machine-disabled"},
+		},
+		"GPOs with computer settings disabled don’t apply to computers": {
+			accountName: "computer1", isComputer: true,
+			itLinks: links("user-disabled", "machine-disabled"),
+			want:    []string{"user-disabled"},
+		},
+		"GPOs filtered on a group apply to its members": {
+			devLinks: links("group-filtered", "dev"),
+			want:     []string{"group-filtered", "dev"},
+		},
+		"GPOs filtered on a group don’t apply to others": {
+			accountName: "user2",
+			devLinks:    links("group-filtered", "dev"),
+			want:        []string{"dev"},
+		},
+		"GPOs filtered on a nested group apply to its indirect members": {
+			devLinks: links("nested-group-filtered", "dev"),
+			want:     []string{"nested-group-filtered", "dev"},
+		},
+		"GPOs filtered on a nested group don’t apply to others": {
+			accountName: "user2",
+			devLinks:    links("nested-group-filtered", "dev"),
+			want:        []string{"dev"},
+		},
+		"GPOs only readable by a nested group apply to its indirect members": {
+			devLinks: links("nested-group-read", "dev"),
+			want:     []string{"nested-group-read", "dev"},
+		},
+		"GPOs denying apply to a group don’t apply to its members": {
+			devLinks: links("denied", "dev"),
+			want:     []string{"dev"},
+		},
+		"GPOs denying apply to a group apply to others": {
+			accountName: "user2",
+			devLinks:    links("denied", "dev"),
+			want:        []string{"denied", "dev"},
+		},
+		"GPOs without apply right don’t apply": {
+			devLinks: links("no-apply", "dev"),
+			want:     []string{"dev"},
+		},
+		"GPOs only readable by the primary group apply": {
+			devLinks: links("primary-group-read", "dev"),
+			want:     []string{"primary-group-read", "dev"},
+		},
+		"GPOs which can’t be fetched are skipped": {
+			devLinks: links("doesnotexist", "no-security-descriptor", "dev"),
+			want:     []string{"dev"},
+		},
+		"Computer name is truncated to 15 characters if not found": {
+			accountName: "computer-with-a-long-name", isComputer: true,
+			domainLinks: links("domain"),
+			want:        []string{"domain"},
+		},
+		"GPOs linked on the site have less priority than the domain": {
+			site: "Paris", siteLinks: links("site"), domainLinks: links("domain"), devLinks: links("dev"),
+			want: []string{"dev", "domain", "site"},
+		},
+		"Enforced GPOs linked on the site have the highest priority": {
+			site: "Paris", siteLinks: enforced("site"), domainLinks: enforced("domain"), devLinks: links("dev"),
+			want: []string{"site", "domain", "dev"},
+		},
+		"Blocked inheritance only keeps enforced GPOs of the site": {
+			site: "Paris", siteLinks: links("site"), devLinks: links("dev"), devOptions: "1",
+			want: []string{"dev"},
+		},
+		"GPOs linked on other sites don’t apply": {
+			site: "Lyon", siteLinks: links("site"), domainLinks: links("domain"),
+			want: []string{"domain"},
+		},
+		"Empty gPLink": {
+			domainLinks: " ",
+		},
+		"No GPO": {},
+
+		"Error on missing default naming context":   {noBaseDN: true, wantErr: true},
+		"Error on unknown site":                     {site: "doesnotexist", wantErr: true},
+		"Error on unknown account":                  {accountName: "doesnotexist", wantErr: true},
+		"Error on user requested as a computer":     {accountName: "user1", isComputer: true, wantErr: true},
+		"Error on computer requested as a user":     {accountName: "computer1", wantErr: true},
+		"Error on GPO not readable by the object":   {devLinks: links("not-readable"), wantErr: true},
+		"Error on GPO without name":                 {devLinks: links("no-name"), wantErr: true},
+		"Error on invalid GPO flags":                {devLinks: links("invalid-flags"), wantErr: true},
+		"Error on invalid gPOptions":                {devLinks: links("dev"), devOptions: "not a number", wantErr: true},
+		"Error on badly formed gPLink":              {devLinks: "[LDAP://CN={dev}]", wantErr: true},
+		"Error on badly formed gPLink options":      {devLinks: "[LDAP://CN={dev};enforced]", wantErr: true},
+		"Error on badly formed gPLink without LDAP": {devLinks: "[CN={dev};0]", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.accountName == "" {
+				tc.accountName = "user1"
+			}
+
+			dir := newDirectory(tc.domainLinks, tc.itLinks, tc.devLinks, tc.devOptions, tc.siteLinks)
+			if tc.noBaseDN {
+				dir.baseDN = ""
+			}
+
+			got, err := gpolist.List(context.Background(), dir, "dc.example.com", tc.accountName, tc.isComputer, tc.site)
+			if tc.wantErr {
+				require.Error(t, err, "List should have failed")
+				return
+			}
+			require.NoError(t, err, "List should not have failed")
+
+			var want []gpolist.GPO
+			for _, n := range tc.want {
+				want = append(want, gpolist.GPO{Name: n, URL: fmt.Sprintf("smb://dc.example.com/SysVol/example.com/Policies/{%s}", n)})
+			}
+			require.Equal(t, want, got, "List should return expected GPOs in order")
+		})
+	}
+}
+
+func TestListLoopback(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		accountName  string
+		computerName string
+		domainLinks  string
+		itLinks      string
+		site         string
+		siteLinks    string
+
+		want    []string
+		wantErr bool
+	}{
+		"GPOs linked on the computer parents, closest first": {
+			domainLinks: links("domain"), itLinks: links("it", "it2"),
+			want: []string{"it", "it2", "domain"},
+		},
+		"GPOs with user settings disabled don’t apply": {
+			itLinks: links("user-disabled", "machine-disabled"),
+			want:    []string{"machine-disabled"},
+		},
+		"GPOs filtered on a group apply to the user members": {
+			itLinks: links("group-filtered", "it"),
+			want:    []string{"group-filtered", "it"},
+		},
+		"GPOs filtered on a group don’t apply to other users": {
+			accountName: "user2",
+			itLinks:     links("group-filtered", "it"),
+			want:        []string{"it"},
+		},
+		"GPOs linked on the site of the computer apply": {
+			site: "Paris", siteLinks: links("site"), itLinks: links("it"),
+			want: []string{"it", "site"},
+		},
+		"Computer name is truncated to 15 characters if not found": {
+			computerName: "computer-with-a-long-name",
+			itLinks:      links("it"),
+			want:         []string{"it"},
+		},
+
+		"Error on unknown user":     {accountName: "doesnotexist", wantErr: true},
+		"Error on unknown computer": {computerName: "doesnotexist", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.accountName == "" {
+				tc.accountName = "user1"
+			}
+			if tc.computerName == "" {
+				tc.computerName = "computer1"
+			}
+
+			// GPOs linked on the user container are ignored with loopback processing.
+			dir := newDirectory(tc.domainLinks, tc.itLinks, links("dev"), "", tc.siteLinks)
+
+			got, err := gpolist.ListLoopback(context.Background(), dir, "dc.example.com", tc.accountName, tc.computerName, tc.site)
+			if tc.wantErr {
+				require.Error(t, err, "ListLoopback should have failed")
+				return
+			}
+			require.NoError(t, err, "ListLoopback should not have failed")
+
+			var want []gpolist.GPO
+			for _, n := range tc.want {
+				want = append(want, gpolist.GPO{Name: n, URL: fmt.Sprintf("smb://dc.example.com/SysVol/example.com/Policies/{%s}", n)})
+			}
+			require.Equal(t, want, got, "ListLoopback should return expected GPOs in order")
+		})
+	}
+}
+
+func TestSite(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		addrs      []string
+		noConfigDN bool
+
+		want    string
+		wantErr bool
+	}{
+		"Site of the subnet containing the address":     {addrs: []string{"10.2.3.4"}, want: "Paris"},
+		"Most specific subnet wins":                     {addrs: []string{"10.1.3.4"}, want: "Lyon"},
+		"Most specific subnet wins across addresses":    {addrs: []string{"10.2.3.4", "10.1.3.4"}, want: "Lyon"},
+		"No site if no subnet contains the addresses":   {addrs: []string{"172.16.0.1"}},
+		"No site if the subnet is not linked to a site": {addrs: []string{"192.168.1.5"}},
+		"No site without addresses":                     {},
+
+		"Error on missing configuration naming context": {addrs: []string{"10.2.3.4"}, noConfigDN: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := newDirectory("", "", "", "", "")
+			if tc.noConfigDN {
+				dir.configDN = ""
+			}
+			var addrs []net.IP
+			for _, a := range tc.addrs {
+				addrs = append(addrs, net.ParseIP(a))
+			}
+
+			got, err := gpolist.Site(context.Background(), dir, addrs)
+			if tc.wantErr {
+				require.Error(t, err, "Site should have failed")
+				return
+			}
+			require.NoError(t, err, "Site should not have failed")
+			require.Equal(t, tc.want, got, "Site should return the expected site")
+		})
+	}
+}
+
+// links returns the gPLink value linking the GPOs named names.
+func links(names ...string) string {
+	var l string
+	for _, n := range names {
+		l += fmt.Sprintf("[LDAP://CN={%s},%s;0]", n, policiesDN)
+	}
+	return l
+}
+
+// enforced returns the gPLink value linking the GPO named name, with enforcement.
+func enforced(name string) string {
+	return fmt.Sprintf("[LDAP://cn={%s},%s;2]", name, strings.ToLower(policiesDN))
+}
+
+// directory is an in memory LDAP directory.
+type directory struct {
+	baseDN   string
+	configDN string
+	entries  []ldap.Entry
+}
+
+func (d directory) DefaultNamingContext(_ context.Context) (string, error) {
+	if d.baseDN == "" {
+		return "", errors.New("no defaultNamingContext")
+	}
+	return d.baseDN, nil
+}
+
+func (d directory) ConfigurationNamingContext(_ context.Context) (string, error) {
+	if d.configDN == "" {
+		return "", errors.New("no configurationNamingContext")
+	}
+	return d.configDN, nil
+}
+
+func (d directory) Search(_ context.Context, req ldap.SearchRequest) (entries []ldap.Entry, err error) {
+	found := false
+	for _, e := range d.entries {
+		isBase := strings.EqualFold(e.DN, req.BaseDN)
+		found = found || isBase
+		switch req.Scope {
+		case ldap.ScopeBase:
+			if !isBase {
+				continue
+			}
+		case ldap.ScopeSubtree:
+			if !isBase && !strings.HasSuffix(strings.ToLower(e.DN), ","+strings.ToLower(req.BaseDN)) {
+				continue
+			}
+		default:
+			return nil, fmt.Errorf("unsupported scope %d", req.Scope)
+		}
+		if req.Filter.Match(e) {
+			entries = append(entries, e)
+		}
+	}
+	if !found {
+		return nil, ldap.Error{Code: ldap.ResultNoSuchObject, Message: "no such object"}
+	}
+	return entries, nil
+}
+
+func newDirectory(domainLinks, itLinks, devLinks, devOptions, parisLinks string) directory {
+	d := directory{baseDN: baseDN, configDN: configDN}
+	add := func(dn string, attrs ...string) {
+		e := ldap.Entry{DN: dn, Attributes: make(map[string][][]byte)}
+		for i := 0; i < len(attrs); i += 2 {
+			e.Attributes[attrs[i]] = append(e.Attributes[attrs[i]], []byte(attrs[i+1]))
+		}
+		d.entries = append(d.entries, e)
+	}
+	container := func(dn, objectClass, links, options string) {
+		attrs := []string{"objectClass", objectClass}
+		if links != "" {
+			attrs = append(attrs, "gPLink", links)
+		}
+		if options != "" {
+			attrs = append(attrs, "gPOptions", options)
+		}
+		add(dn, attrs...)
+	}
+	// groups are the SIDs of all groups the account is a member of, as computed by the directory in tokenGroups.
+	account := func(dn, samAccountName string, rid int, isComputer bool, groups ...string) {
+		attrs := []string{"objectClass", "top", "objectClass", "person", "objectClass", "user",
+			"sAMAccountName", samAccountName, "objectSid", string(encodeSID(fmt.Sprintf("%s-%d", domainSID, rid))), "primaryGroupID", "513"}
+		if isComputer {
+			attrs = append(attrs, "objectClass", "computer")
+		}
+		for _, g := range append(groups, domainUsersSID) {
+			attrs = append(attrs, "tokenGroups", string(encodeSID(g)))
+		}
+		add(dn, attrs...)
+	}
+
+	container(baseDN, "domainDNS", domainLinks, "")
+	container(itDN, "organizationalUnit", itLinks, "")
+	container(devDN, "organizationalUnit", devLinks, devOptions)
+	container("CN=System,"+baseDN, "container", "", "")
+	container(policiesDN, "container", "", "")
+	container(configDN, "configuration", "", "")
+	container(sitesDN, "sitesContainer", "", "")
+	container("CN=Paris,"+sitesDN, "site", parisLinks, "")
+	container("CN=Lyon,"+sitesDN, "site", "", "")
+	container("CN=Subnets,"+sitesDN, "subnetContainer", "", "")
+	subnet := func(cidr, site string) {
+		attrs := []string{"objectClass", "subnet", "cn", cidr}
+		if site != "" {
+			attrs = append(attrs, "siteObject", "CN="+site+","+sitesDN)
+		}
+		add(fmt.Sprintf("CN=%s,CN=Subnets,%s", cidr, sitesDN), attrs...)
+	}
+	subnet("10.0.0.0/8", "Paris")
+	subnet("10.1.0.0/16", "Lyon")
+	subnet("192.168.1.0/24", "")
+	subnet("not-a-subnet", "Paris")
+
+	account("CN=user1,"+devDN, "user1", 1001, false, group1SID, nestedGroupSID)
+	account("CN=user2,"+devDN, "user2", 1002, false)
+	account("CN=computer1,"+itDN, "computer1$", 1003, true)
+	account("CN=computer-with-a-long-name,"+itDN, "COMPUTER-WITH-A$", 1004, true)
+	add("CN=group1,"+baseDN, "objectClass", "top", "objectClass", "group", "objectSid", string(encodeSID(group1SID)),
+		"member", "cn=user1,"+strings.ToLower(devDN))
+	add("CN=nested-group,"+baseDN, "objectClass", "top", "objectClass", "group", "objectSid", string(encodeSID(nestedGroupSID)),
+		"member", "CN=group1,"+baseDN)
+
+	standard := []testACE{
+		{aceType: 0x00, mask: readRights, sid: authenticatedUsers},
+		{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: authenticatedUsers},
+	}
+	gpos := map[string]struct {
+		flags  string
+		aces   []testACE
+		noSD   bool
+		noName bool
+	}{
+		"domain":           {aces: standard},
+		"it":               {aces: standard},
+		"it2":              {aces: standard},
+		"dev":              {aces: standard},
+		"dev2":             {aces: standard},
+		"site":             {aces: standard},
+		"user-disabled":    {flags: "1", aces: standard},
+		"machine-disabled": {flags: "2", aces: standard},
+		"group-filtered": {aces: []testACE{
+			{aceType: 0x00, mask: readRights, sid: authenticatedUsers},
+			{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: group1SID},
+		}},
+		"nested-group-filtered": {aces: []testACE{
+			{aceType: 0x00, mask: readRights, sid: authenticatedUsers},
+			{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: nestedGroupSID},
+		}},
+		"nested-group-read": {aces: []testACE{
+			{aceType: 0x00, mask: readRights, sid: nestedGroupSID},
+			{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: authenticatedUsers},
+		}},
+		"denied": {aces: append([]testACE{
+			{aceType: 0x06, mask: 0x100, objectType: applyGroupPolicy, sid: group1SID},
+		}, standard...)},
+		"no-apply": {aces: []testACE{
+			{aceType: 0x00, mask: readRights, sid: authenticatedUsers},
+			// Inherited object type does not make it an apply right
+			{aceType: 0x05, mask: 0x100, inheritedObjectType: applyGroupPolicy, sid: authenticatedUsers},
+		}},
+		"primary-group-read": {aces: []testACE{
+			{aceType: 0x00, mask: 0x80000000, sid: domainUsersSID},
+			{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: authenticatedUsers},
+		}},
+		"not-readable": {aces: []testACE{
+			{aceType: 0x01, mask: readRights, sid: group1SID},
+			{aceType: 0x00, mask: readRights, sid: authenticatedUsers},
+			{aceType: 0x05, mask: 0x100, objectType: applyGroupPolicy, sid: authenticatedUsers},
+		}},
+		"no-security-descriptor": {noSD: true},
+		"no-name":                {aces: standard, noName: true},
+		"invalid-flags":          {flags: "not a number", aces: standard},
+	}
+	for name, g := range gpos {
+		attrs := []string{"objectClass", "groupPolicyContainer", "name", fmt.Sprintf("{%s}", name),
+			"gPCFileSysPath", fmt.Sprintf(`\\example.com\SysVol\example.com\Policies\{%s}`, name)}
+		if !g.noName {
+			attrs = append(attrs, "displayName", name)
+		}
+		if g.flags != "" {
+			attrs = append(attrs, "flags", g.flags)
+		}
+		if !g.noSD {
+			attrs = append(attrs, "nTSecurityDescriptor", string(encodeSecurityDescriptor(g.aces)))
+		}
+		add(fmt.Sprintf("CN={%s},%s", name, policiesDN), attrs...)
+	}
+
+	return d
+}
+
+type testACE struct {
+	aceType             byte
+	mask                uint32
+	objectType          string
+	inheritedObjectType string
+	sid                 string
+}
+
+// encodeSecurityDescriptor returns a self-relative security descriptor with a DACL made of aces.
+func encodeSecurityDescriptor(aces []testACE) []byte {
+	var acl []byte
+	for _, a := range aces {
+		body := binary.LittleEndian.AppendUint32(nil, a.mask)
+		if a.aceType == 0x05 || a.aceType == 0x06 {
+			var flags uint32
+			var guids []byte
+			if a.objectType != "" {
+				flags |= 0x1
+				guids = append(guids, encodeGUID(a.objectType)...)
+			}
+			if a.inheritedObjectType != "" {
+				flags |= 0x2
+				guids = append(guids, encodeGUID(a.inheritedObjectType)...)
+			}
+			body = append(binary.LittleEndian.AppendUint32(body, flags), guids...)
+		}
+		body = append(body, encodeSID(a.sid)...)
+		acl = append(acl, a.aceType, 0)
+		acl = binary.LittleEndian.AppendUint16(acl, uint16(4+len(body)))
+		acl = append(acl, body...)
+	}
+
+	// Header with the DACL right after it, then the owner.
+	sd := []byte{1, 0}
+	sd = binary.LittleEndian.AppendUint16(sd, 0x8004)
+	owner := encodeSID(domainSID + "-512")
+	sd = binary.LittleEndian.AppendUint32(sd, uint32(20+8+len(acl)))
+	sd = binary.LittleEndian.AppendUint32(sd, 0)
+	sd = binary.LittleEndian.AppendUint32(sd, 0)
+	sd = binary.LittleEndian.AppendUint32(sd, 20)
+	sd = append(sd, 4, 0)
+	sd = binary.LittleEndian.AppendUint16(sd, uint16(8+len(acl)))
+	sd = binary.LittleEndian.AppendUint16(sd, uint16(len(aces)))
+	sd = append(sd, 0, 0)
+	sd = append(sd, acl...)
+	return append(sd, owner...)
+}
+
+// encodeSID returns the binary form of the SID s.
+func encodeSID(s string) []byte {
+	parts := strings.Split(s, "-")[2:]
+	authority, _ := strconv.ParseUint(parts[0], 10, 48)
+	b := []byte{1, byte(len(parts) - 1)}
+	b = append(b, byte(authority>>40), byte(authority>>32), byte(authority>>24), byte(authority>>16), byte(authority>>8), byte(authority))
+	for _, p := range parts[1:] {
+		v, _ := strconv.ParseUint(p, 10, 32)
+		b = binary.LittleEndian.AppendUint32(b, uint32(v))
+	}
+	return b
+}
+
+// encodeGUID returns the binary form of the GUID s, in mixed endianness.
+func encodeGUID(s string) []byte {
+	var b []byte
+	parts := strings.Split(s, "-")
+	d1, _ := strconv.ParseUint(parts[0], 16, 32)
+	d2, _ := strconv.ParseUint(parts[1], 16, 16)
+	d3, _ := strconv.ParseUint(parts[2], 16, 16)
+	b = binary.LittleEndian.AppendUint32(b, uint32(d1))
+	b = binary.LittleEndian.AppendUint16(b, uint16(d2))
+	b = binary.LittleEndian.AppendUint16(b, uint16(d3))
+	for _, p := range []string{parts[3][0:2], parts[3][2:4], parts[4][0:2], parts[4][2:4], parts[4][4:6], parts[4][6:8], parts[4][8:10], parts[4][10:12]} {
+		v, _ := strconv.ParseUint(p, 16, 8)
+		b = append(b, byte(v))
+	}
+	return b
+}
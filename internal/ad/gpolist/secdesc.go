@@ -0,0 +1,238 @@
+package gpolist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+// Parts of nTSecurityDescriptor requested with the SD flags control.
+const (
+	secInfoOwner = 0x1
+	secInfoGroup = 0x2
+	secInfoDACL  = 0x4
+)
+
+// Access rights checked on GPOs.
+const (
+	rightADSList         = 0x00000004
+	rightADSReadProp     = 0x00000010
+	rightADSListObject   = 0x00000080
+	rightStdReadControl  = 0x00020000
+	rightGenericAll      = 0x10000000
+	rightGenericRead     = 0x80000000
+	rightAllDirectory    = 0x000f01ff
+	rightReadDirectory   = rightStdReadControl | rightADSList | rightADSReadProp | rightADSListObject
+	rightGPOReadRequired = rightStdReadControl | rightADSList | rightADSReadProp
+)
+
+// ACE types and flags.
+const (
+	aceTypeAllowed       = 0x00
+	aceTypeDenied        = 0x01
+	aceTypeAllowedObject = 0x05
+	aceTypeDeniedObject  = 0x06
+
+	aceFlagInheritOnly = 0x08
+
+	aceObjectTypePresent          = 0x1
+	aceInheritedObjectTypePresent = 0x2
+)
+
+// seDACLPresent is set in the control of a security descriptor having a DACL.
+const seDACLPresent = 0x0004
+
+// applyGroupPolicyGUID is the "Apply Group Policy" extended right.
+const applyGroupPolicyGUID = "edacfd8f-ffb3-11d1-b41d-00a0c968f939"
+
+// Well known SIDs.
+const (
+	everyoneSID           = "S-1-1-0"
+	authenticatedUsersSID = "S-1-5-11"
+)
+
+type ace struct {
+	aceType    byte
+	flags      byte
+	mask       uint32
+	objectType string
+	sid        string
+}
+
+// securityDescriptor is the DACL of a self-relative security descriptor.
+type securityDescriptor struct {
+	daclPresent bool
+	dacl        []ace
+}
+
+// parseSecurityDescriptor decodes the DACL of the self-relative security descriptor b.
+func parseSecurityDescriptor(b []byte) (sd securityDescriptor, err error) {
+	if len(b) < 20 || b[0] != 1 {
+		return sd, errors.New(gotext.Get("invalid security descriptor"))
+	}
+	control := binary.LittleEndian.Uint16(b[2:4])
+	daclOffset := int(binary.LittleEndian.Uint32(b[16:20]))
+	if control&seDACLPresent == 0 || daclOffset == 0 {
+		return sd, nil
+	}
+	sd.daclPresent = true
+
+	if daclOffset+8 > len(b) {
+		return sd, errors.New(gotext.Get("invalid security descriptor DACL offset"))
+	}
+	acl := b[daclOffset:]
+	aceCount := int(binary.LittleEndian.Uint16(acl[4:6]))
+	acl = acl[8:]
+	for i := 0; i < aceCount; i++ {
+		if len(acl) < 4 {
+			return sd, errors.New(gotext.Get("truncated ACE in security descriptor"))
+		}
+		size := int(binary.LittleEndian.Uint16(acl[2:4]))
+		if size < 4 || size > len(acl) {
+			return sd, errors.New(gotext.Get("invalid ACE size in security descriptor"))
+		}
+		a, err := parseACE(acl[:size])
+		if err != nil {
+			return sd, err
+		}
+		sd.dacl = append(sd.dacl, a)
+		acl = acl[size:]
+	}
+
+	return sd, nil
+}
+
+// parseACE decodes the access allowed or denied ACE b. Other ACE types are only kept with their type.
+func parseACE(b []byte) (a ace, err error) {
+	a = ace{aceType: b[0], flags: b[1]}
+
+	body := b[4:]
+	switch a.aceType {
+	case aceTypeAllowed, aceTypeDenied:
+	case aceTypeAllowedObject, aceTypeDeniedObject:
+		if len(body) < 8 {
+			return a, errors.New(gotext.Get("truncated object ACE in security descriptor"))
+		}
+		flags := binary.LittleEndian.Uint32(body[4:8])
+		guids := body[8:]
+		if flags&aceObjectTypePresent != 0 {
+			if len(guids) < 16 {
+				return a, errors.New(gotext.Get("truncated object ACE in security descriptor"))
+			}
+			a.objectType = formatGUID(guids[:16])
+			guids = guids[16:]
+		}
+		if flags&aceInheritedObjectTypePresent != 0 {
+			if len(guids) < 16 {
+				return a, errors.New(gotext.Get("truncated object ACE in security descriptor"))
+			}
+			guids = guids[16:]
+		}
+		// Keep the mask, followed by the SID.
+		body = append(append([]byte{}, body[:4]...), guids...)
+	default:
+		return a, nil
+	}
+
+	if len(body) < 4 {
+		return a, errors.New(gotext.Get("truncated ACE in security descriptor"))
+	}
+	a.mask = binary.LittleEndian.Uint32(body[:4])
+	if a.sid, err = parseSID(body[4:]); err != nil {
+		return a, err
+	}
+
+	return a, nil
+}
+
+// parseSID returns the string representation of the binary SID b.
+func parseSID(b []byte) (string, error) {
+	if len(b) < 8 || b[0] != 1 || len(b) < 8+4*int(b[1]) {
+		return "", errors.New(gotext.Get("invalid SID"))
+	}
+
+	var authority uint64
+	for _, v := range b[2:8] {
+		authority = authority<<8 | uint64(v)
+	}
+	s := fmt.Sprintf("S-1-%d", authority)
+	if authority >= 1<<32 {
+		s = fmt.Sprintf("S-1-0x%012X", authority)
+	}
+	for i := 0; i < int(b[1]); i++ {
+		s += fmt.Sprintf("-%d", binary.LittleEndian.Uint32(b[8+4*i:]))
+	}
+	return s, nil
+}
+
+// formatGUID returns the string representation of the binary GUID b, stored in mixed endianness.
+func formatGUID(b []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(b[0:4]), binary.LittleEndian.Uint16(b[4:6]), binary.LittleEndian.Uint16(b[6:8]),
+		b[8:10], b[10:16])
+}
+
+// canApply returns true if one of sids is allowed the "Apply Group Policy" right, and none is denied it.
+func (sd securityDescriptor) canApply(sids []string) bool {
+	applied := false
+	for _, a := range sd.dacl {
+		if a.objectType != applyGroupPolicyGUID || !slices.Contains(sids, a.sid) {
+			continue
+		}
+		switch a.aceType {
+		case aceTypeAllowedObject:
+			applied = true
+		case aceTypeDeniedObject:
+			// One denial is enough for denying the whole policy.
+			return false
+		}
+	}
+	return applied
+}
+
+// isAllowed returns true if the DACL grants all desired rights to a token with sids.
+// ACEs are evaluated in order: a denied right which is not granted yet denies the access.
+func (sd securityDescriptor) isAllowed(sids []string, desired uint32) bool {
+	if !sd.daclPresent {
+		return true
+	}
+
+	var granted uint32
+	for _, a := range sd.dacl {
+		if a.flags&aceFlagInheritOnly != 0 || !slices.Contains(sids, a.sid) {
+			continue
+		}
+		// Object ACEs with an object type only apply to a property set or an extended right.
+		if a.objectType != "" {
+			continue
+		}
+
+		mask := mapGenericRights(a.mask)
+		switch a.aceType {
+		case aceTypeAllowed, aceTypeAllowedObject:
+			granted |= mask
+		case aceTypeDenied, aceTypeDeniedObject:
+			if mask&desired&^granted != 0 {
+				return false
+			}
+		}
+		if granted&desired == desired {
+			return true
+		}
+	}
+	return false
+}
+
+// mapGenericRights maps the generic rights of mask to the directory service specific ones.
+func mapGenericRights(mask uint32) uint32 {
+	if mask&rightGenericAll != 0 {
+		mask |= rightAllDirectory
+	}
+	if mask&rightGenericRead != 0 {
+		mask |= rightReadDirectory
+	}
+	return mask
+}
@@ -0,0 +1,108 @@
+package gpolist
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/ldap"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/decorate"
+)
+
+// Site returns the name of the site of a machine with addrs, from the subnets defined in the configuration partition.
+// The most specific subnet containing one of the addresses wins. The name is empty if no subnet matches.
+func Site(ctx context.Context, dir Directory, addrs []net.IP) (site string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't find site from subnets"))
+
+	configDN, err := dir.ConfigurationNamingContext(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	entries, err := dir.Search(ctx, ldap.SearchRequest{
+		BaseDN:     "CN=Subnets,CN=Sites," + configDN,
+		Scope:      ldap.ScopeSubtree,
+		Filter:     ldap.Equal("objectClass", "subnet"),
+		Attributes: []string{"cn", "siteObject"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	longestPrefix := -1
+	for _, e := range entries {
+		siteObject := e.Value("siteObject")
+		if siteObject == nil {
+			log.Debugf(ctx, "Subnet %s is not associated to any site", e.DN)
+			continue
+		}
+		_, subnet, err := net.ParseCIDR(string(e.Value("cn")))
+		if err != nil {
+			log.Warningf(ctx, "Ignoring subnet %s: %v", e.DN, err)
+			continue
+		}
+		prefix, _ := subnet.Mask.Size()
+		if prefix <= longestPrefix {
+			continue
+		}
+		for _, ip := range addrs {
+			if !subnet.Contains(ip) {
+				continue
+			}
+			site, longestPrefix = rdnValue(string(siteObject)), prefix
+			break
+		}
+	}
+
+	if site != "" {
+		log.Debugf(ctx, "Machine is in site %q", site)
+	}
+	return site, nil
+}
+
+// siteDN returns the DN of the site named site.
+func siteDN(ctx context.Context, dir Directory, site string) (string, error) {
+	configDN, err := dir.ConfigurationNamingContext(ctx)
+	if err != nil {
+		return "", errors.New(gotext.Get("can't get site %q: %v", site, err))
+	}
+	return "CN=" + escapeRDNValue(site) + ",CN=Sites," + configDN, nil
+}
+
+// rdnValue returns the unescaped value of the first relative distinguished name of dn, like Paris for
+// CN=Paris,CN=Sites,CN=Configuration,DC=example,DC=com.
+func rdnValue(dn string) string {
+	rdn := dn
+	if parent := parentDN(dn); parent != "" {
+		rdn = dn[:strings.LastIndex(dn, parent)]
+		rdn = strings.TrimRight(strings.TrimSpace(rdn), ",")
+	}
+	_, v, _ := strings.Cut(rdn, "=")
+
+	var unescaped strings.Builder
+	escaped := false
+	for _, c := range v {
+		if c == '\\' && !escaped {
+			escaped = true
+			continue
+		}
+		escaped = false
+		unescaped.WriteRune(c)
+	}
+	return strings.TrimSpace(unescaped.String())
+}
+
+// escapeRDNValue escapes the characters of v with a special meaning in a distinguished name.
+func escapeRDNValue(v string) string {
+	var escaped strings.Builder
+	for i, c := range v {
+		if strings.ContainsRune(`,+"\<>;=`, c) || (i == 0 && (c == ' ' || c == '#')) || (i == len(v)-1 && c == ' ') {
+			escaped.WriteRune('\\')
+		}
+		escaped.WriteRune(c)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,154 @@
+package ad
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/gpolist"
+	"github.com/ubuntu/adsys/internal/ad/ldap"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+)
+
+// gpoLister lists the GPOs applying to an object, from the highest priority to the lowest one.
+type gpoLister interface {
+	listGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName string, objectClass ObjectClass) ([]gpo, error)
+	// listLoopbackGPOs lists the GPOs linked to the containers of the computer whose user settings apply to the user
+	// objectName with loopback processing.
+	listLoopbackGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName, computerName string) ([]gpo, error)
+}
+
+// ldapGPOLister queries the LDAP server of the domain controller, authenticated with the object ticket.
+type ldapGPOLister struct {
+	// staticSite is the site of the machine from the backend configuration. It is discovered from the subnets
+	// otherwise.
+	staticSite string
+}
+
+func (l ldapGPOLister) listGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName string, objectClass ObjectClass) (gpos []gpo, err error) {
+	conn, err := ldap.Dial(ctx, adServerFQDN, krb5CCPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	// Users don’t need @, as we already have the specific-domain ticket
+	accountName := objectName
+	if objectClass == UserObject {
+		accountName, _, _ = strings.Cut(objectName, "@")
+	}
+
+	log.Debugf(ctx, "Getting gpo list of %q from %q", accountName, adServerFQDN)
+	list, err := gpolist.List(ctx, conn, adServerFQDN, accountName, objectClass == ComputerObject, l.site(ctx, conn))
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range list {
+		gpos = append(gpos, gpo{name: g.Name, url: g.URL})
+	}
+	return gpos, nil
+}
+
+func (l ldapGPOLister) listLoopbackGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName, computerName string) (gpos []gpo, err error) {
+	conn, err := ldap.Dial(ctx, adServerFQDN, krb5CCPath)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	accountName, _, _ := strings.Cut(objectName, "@")
+
+	log.Debugf(ctx, "Getting loopback gpo list of %q on %q from %q", accountName, computerName, adServerFQDN)
+	list, err := gpolist.ListLoopback(ctx, conn, adServerFQDN, accountName, computerName, l.site(ctx, conn))
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range list {
+		gpos = append(gpos, gpo{name: g.Name, url: g.URL})
+	}
+	return gpos, nil
+}
+
+// site returns the site of the machine, either from the configuration or from the subnets defined in the directory.
+// GPOs linked to the site are not listed if it can't be discovered.
+func (l ldapGPOLister) site(ctx context.Context, dir gpolist.Directory) string {
+	if l.staticSite != "" {
+		return l.staticSite
+	}
+
+	var ips []net.IP
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		log.Warningf(ctx, "Can't list network addresses to discover the site, GPOs linked to it are not applied: %v", err)
+		return ""
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && !n.IP.IsLoopback() {
+			ips = append(ips, n.IP)
+		}
+	}
+
+	site, err := gpolist.Site(ctx, dir, ips)
+	if err != nil {
+		log.Warningf(ctx, "GPOs linked to the site are not applied: %v", err)
+		return ""
+	}
+	if site == "" {
+		log.Debug(ctx, "No site found for this machine")
+	}
+	return site
+}
+
+// cmdGPOLister runs a command with the same arguments and output than the adsys-gpolist script.
+type cmdGPOLister struct {
+	cmd []string
+}
+
+func (l cmdGPOLister) listGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName string, objectClass ObjectClass) (gpos []gpo, err error) {
+	args := append([]string{}, l.cmd...) // Copy cmd to prevent data race
+	scriptArgs := []string{"--objectclass", string(objectClass), adServerFQDN, objectName}
+	cmdArgs := append(args, scriptArgs...)
+	log.Debugf(ctx, "Getting gpo list with arguments: %q", strings.Join(scriptArgs, " "))
+	// #nosec G204 - cmdArgs is under our control (python embedded script or mock for tests)
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("KRB5CCNAME=%s", krb5CCPath))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	smbsafe.WaitExec()
+	err = cmd.Run()
+	smbsafe.DoneExec()
+	if err != nil {
+		return nil, errors.New(gotext.Get("failed to retrieve the list of GPO (exited with %d): %v\n%s", cmd.ProcessState.ExitCode(), err, stderr.String()))
+	}
+
+	scanner := bufio.NewScanner(&stdout)
+	for scanner.Scan() {
+		res := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(res) != 2 {
+			return nil, errors.New(gotext.Get("invalid GPO list line: %q", scanner.Text()))
+		}
+		gpos = append(gpos, gpo{name: res[0], url: res[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return gpos, nil
+}
+
+// listLoopbackGPOs returns the GPOs of the computer, as the command can't list them with the rights of the user.
+// Security filtering and disabled sections are then evaluated for the computer, not for the user.
+func (l cmdGPOLister) listLoopbackGPOs(ctx context.Context, krb5CCPath, adServerFQDN, objectName, computerName string) ([]gpo, error) {
+	log.Debugf(ctx, "Loopback GPOs of %q are the ones of %q, without security filtering on the user", objectName, computerName)
+	return l.listGPOs(ctx, krb5CCPath, adServerFQDN, computerName, ComputerObject)
+}
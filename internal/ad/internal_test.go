@@ -10,6 +10,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -322,7 +323,7 @@ func TestFetch(t *testing.T) {
 
 			var assetsRefreshed bool
 			if tc.concurrentGposDownload == nil {
-				assetsRefreshed, err = adc.fetch(context.Background(), "", downloadables)
+				assetsRefreshed, err = adc.fetch(context.Background(), "", "", downloadables)
 				if tc.wantErr {
 					require.NotNil(t, err, "fetch should return an error but didn't")
 				} else {
@@ -341,7 +342,7 @@ func TestFetch(t *testing.T) {
 				var assetsRefreshed1, assetsRefreshed2 bool
 				go func() {
 					defer wg.Done()
-					assetsRefreshed1, err = adc.fetch(context.Background(), "", downloadables)
+					assetsRefreshed1, err = adc.fetch(context.Background(), "", "", downloadables)
 					if tc.wantErr {
 						require.NotNil(t, err, "fetch should return an error but didn't")
 					} else {
@@ -351,7 +352,7 @@ func TestFetch(t *testing.T) {
 				go func() {
 					defer wg.Done()
 					var err2 error
-					assetsRefreshed2, err2 = adc.fetch(context.Background(), "", concurrentGpos)
+					assetsRefreshed2, err2 = adc.fetch(context.Background(), "", "", concurrentGpos)
 					if tc.wantErr {
 						require.NotNil(t, err2, "fetch should return an error but didn't")
 					} else {
@@ -436,7 +437,7 @@ func TestFetchWithUnreadableFile(t *testing.T) {
 					"Setup: can't copy initial gpo directory")
 			}
 
-			assetsRefreshed, err := adc.fetch(context.Background(), "", downloadables)
+			assetsRefreshed, err := adc.fetch(context.Background(), "", "", downloadables)
 			require.NotNil(t, err, "fetch should return an error but didn't")
 
 			if !tc.withExistingGPO {
@@ -482,7 +483,7 @@ func TestFetchTweakSysvolCacheDir(t *testing.T) {
 				testutils.MakeReadOnly(t, filepath.Join(adc.sysvolCacheDir, "Policies"))
 			}
 
-			assetsRefreshed, err := adc.fetch(context.Background(), "", map[string]string{"gpo1-name": fmt.Sprintf("smb://localhost:%d/SYSVOL/fakegpo.com/Policies/gpo1", SmbPort)})
+			assetsRefreshed, err := adc.fetch(context.Background(), "", "", map[string]string{"gpo1-name": fmt.Sprintf("smb://localhost:%d/SYSVOL/fakegpo.com/Policies/gpo1", SmbPort)})
 
 			require.NotNil(t, err, "fetch should return an error but didn't")
 			assert.NoDirExists(t, filepath.Join(adc.sysvolCacheDir, "Policies", "gpo1"), "gpo1 shouldn't be downloaded")
@@ -528,7 +529,7 @@ func TestFetchOneGPOWhileParsingItConcurrently(t *testing.T) {
 	go func() {
 		defer wg.Done()
 
-		assetsRefreshed, err := adc.fetch(context.Background(), "", gpos)
+		assetsRefreshed, err := adc.fetch(context.Background(), "", "", gpos)
 		require.NoError(t, err, "fetch returned an error but shouldn't")
 		assert.False(t, assetsRefreshed, "we haven't refreshed assets")
 	}()
@@ -558,7 +559,7 @@ func TestParseGPOConcurrent(t *testing.T) {
 		"standard-name": fmt.Sprintf("smb://localhost:%d/SYSVOL/gpoonly.com/Policies/standard", SmbPort),
 	}
 	orderedGPOs := []gpo{{name: "standard-name", url: gpos["standard-name"]}}
-	assetsRefreshed, err := adc.fetch(context.Background(), "", gpos)
+	assetsRefreshed, err := adc.fetch(context.Background(), "", "", gpos)
 	require.NoError(t, err, "Setup: couldn’t do initial GPO fetch as returned an error but shouldn't")
 	assert.False(t, assetsRefreshed, "we haven't refreshed assets")
 
@@ -576,6 +577,85 @@ func TestParseGPOConcurrent(t *testing.T) {
 	wg.Wait()
 }
 
+func TestRenewKrb5CC(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now().Truncate(time.Second)
+
+	tests := map[string]struct {
+		ticket    []byte
+		kinitFail bool
+
+		wantRenewed bool
+	}{
+		"Renew ticket past half of its lifetime": {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-6*time.Hour), now.Add(4*time.Hour), now.Add(24*time.Hour)), wantRenewed: true},
+
+		"Keep ticket before half of its lifetime": {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-time.Hour), now.Add(9*time.Hour), now.Add(24*time.Hour))},
+		"Keep non renewable ticket":               {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-6*time.Hour), now.Add(4*time.Hour), time.Time{})},
+		"Keep ticket past its renewal period":     {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-6*time.Hour), now.Add(4*time.Hour), now.Add(-time.Hour))},
+		"Keep expired ticket":                     {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-10*time.Hour), now.Add(-time.Hour), now.Add(24*time.Hour))},
+		"Keep ticket which can't be read":         {ticket: []byte("KRB5 Ticket data")},
+		"Keep ticket when renewal fails":          {ticket: testutils.Krb5CC("user@EXAMPLE.COM", now.Add(-6*time.Hour), now.Add(4*time.Hour), now.Add(24*time.Hour)), kinitFail: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			kinitCmd := []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockKinit", "--"}
+			if tc.kinitFail {
+				kinitCmd = append(kinitCmd, "-Exit1-")
+			}
+			adc, err := New(context.Background(), mock.Backend{}, "ubuntu",
+				WithCacheDir(t.TempDir()), WithRunDir(t.TempDir()), withKinitCmd(kinitCmd))
+			require.NoError(t, err, "Setup: cannot create ad object")
+
+			krb5CCPath := filepath.Join(adc.krb5CacheDir, "user@example.com")
+			require.NoError(t, os.WriteFile(krb5CCPath, tc.ticket, 0600), "Setup: can't write ticket")
+
+			adc.renewKrb5CC(context.Background(), krb5CCPath)
+
+			got, err := os.ReadFile(krb5CCPath)
+			require.NoError(t, err, "The ticket should still exist")
+			require.NoFileExists(t, krb5CCPath+".renew", "The renewal copy should be removed")
+			if !tc.wantRenewed {
+				require.Equal(t, tc.ticket, got, "The ticket should not have been renewed")
+				return
+			}
+			require.Equal(t, []byte("renewed ticket"), got, "The ticket should have been renewed")
+		})
+	}
+}
+
+func TestMockKinit(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+
+	if args[0] == "-Exit1-" {
+		fmt.Fprintf(os.Stderr, "EXIT 1 requested in mock")
+		os.Exit(1)
+	}
+	if len(args) != 3 || args[0] != "-R" || args[1] != "-c" || !strings.HasPrefix(args[2], "FILE:") {
+		fmt.Fprintf(os.Stderr, "Unexpected kinit arguments: %q", args)
+		os.Exit(1)
+	}
+
+	if err := os.WriteFile(strings.TrimPrefix(args[2], "FILE:"), []byte("renewed ticket"), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Setup: failed to write renewed ticket: %v", err)
+		os.Exit(1)
+	}
+}
+
 const SmbPort = 1445
 
 func TestMain(m *testing.M) {
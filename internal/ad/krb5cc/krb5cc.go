@@ -0,0 +1,238 @@
+// Package krb5cc reads the ticket granting ticket of Kerberos FILE credential caches, in the version 3 and 4 formats
+// written by MIT Kerberos and Heimdal.
+package krb5cc
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	fileFormatV3 = 0x0503
+	fileFormatV4 = 0x0504
+
+	// flagRenewable is the renewable ticket flag, in network bit order.
+	flagRenewable = 0x00800000
+)
+
+// ErrNoTGT is returned when the cache holds no ticket granting ticket for the realm of its principal.
+var ErrNoTGT = errors.New(gotext.Get("no ticket granting ticket in cache"))
+
+// Ticket is the ticket granting ticket of a credential cache.
+type Ticket struct {
+	// Principal is the default principal of the cache, like user@EXAMPLE.COM.
+	Principal string
+
+	AuthTime  time.Time
+	StartTime time.Time
+	EndTime   time.Time
+	// RenewTill is the time after which the ticket can't be renewed. It is zero for non renewable tickets.
+	RenewTill time.Time
+}
+
+// Renewable returns if the ticket can still be renewed at time now.
+func (t Ticket) Renewable(now time.Time) bool {
+	return now.Before(t.EndTime) && now.Before(t.RenewTill)
+}
+
+// Expired returns if the ticket is expired at time now.
+func (t Ticket) Expired(now time.Time) bool {
+	return !now.Before(t.EndTime)
+}
+
+// TGT returns the ticket granting ticket of the realm of the default principal of the FILE credential cache at p.
+func TGT(p string) (tgt Ticket, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't read ticket granting ticket from %s", p))
+
+	f, err := os.Open(strings.TrimPrefix(p, "FILE:"))
+	if err != nil {
+		return Ticket{}, err
+	}
+	defer decorate.LogFuncOnError(f.Close)
+
+	r := reader{r: bufio.NewReader(f)}
+
+	r.version = r.uint16()
+	if r.err == nil && r.version != fileFormatV3 && r.version != fileFormatV4 {
+		return Ticket{}, errors.New(gotext.Get("unsupported credential cache format version %#x", r.version))
+	}
+	if r.version == fileFormatV4 {
+		// Header tags, like the KDC time offset, are not needed
+		r.skip(int(r.uint16()))
+	}
+
+	realm, principal := r.principal()
+	if r.err != nil {
+		return Ticket{}, r.err
+	}
+
+	for {
+		c, err := r.credential()
+		if errors.Is(err, io.EOF) {
+			return Ticket{}, ErrNoTGT
+		}
+		if err != nil {
+			return Ticket{}, err
+		}
+
+		// Configuration entries and service tickets are stored alongside the ticket granting ticket
+		if len(c.server) != 3 || c.server[0] != realm || c.server[1] != "krbtgt" || c.server[2] != realm {
+			continue
+		}
+
+		tgt = Ticket{
+			Principal: principal,
+			AuthTime:  c.times[0],
+			StartTime: c.times[1],
+			EndTime:   c.times[2],
+		}
+		if tgt.StartTime.Equal(time.Unix(0, 0)) {
+			tgt.StartTime = tgt.AuthTime
+		}
+		if c.flags&flagRenewable != 0 {
+			tgt.RenewTill = c.times[3]
+		}
+		return tgt, nil
+	}
+}
+
+// credential is the part of a cached credential used to find the ticket granting ticket.
+type credential struct {
+	// server is the realm followed by the components of the server principal.
+	server []string
+	// times are the auth, start, end and renew till times.
+	times [4]time.Time
+	flags uint32
+}
+
+// reader decodes the big endian fields of a credential cache, keeping the first error.
+type reader struct {
+	r       *bufio.Reader
+	version uint16
+	err     error
+}
+
+func (r *reader) credential() (c credential, err error) {
+	// Detect the end of the credentials list
+	if _, err := r.r.Peek(1); err != nil {
+		return c, err
+	}
+
+	r.principal() // client
+	c.server = r.principalComponents()
+
+	// Key block, with a repeated encryption type in version 3
+	r.uint16()
+	if r.version == fileFormatV3 {
+		r.uint16()
+	}
+	r.data()
+
+	for i := range c.times {
+		c.times[i] = time.Unix(int64(r.uint32()), 0)
+	}
+	r.skip(1) // is_skey
+	c.flags = r.uint32()
+
+	// Addresses and authorization data
+	for range 2 {
+		n := r.uint32()
+		for i := uint32(0); i < n && r.err == nil; i++ {
+			r.uint16()
+			r.data()
+		}
+	}
+
+	r.data() // ticket
+	r.data() // second ticket
+
+	if r.err != nil {
+		return c, errors.New(gotext.Get("truncated credential: %v", r.err))
+	}
+	return c, nil
+}
+
+// principal returns the realm and the printable name of the next principal.
+func (r *reader) principal() (realm, name string) {
+	components := r.principalComponents()
+	if len(components) == 0 {
+		return "", ""
+	}
+	return components[0], strings.Join(components[1:], "/") + "@" + components[0]
+}
+
+// principalComponents returns the realm followed by the name components of the next principal.
+func (r *reader) principalComponents() []string {
+	r.uint32() // name type
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	components := []string{string(r.data())}
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		components = append(components, string(r.data()))
+	}
+	return components
+}
+
+func (r *reader) uint16() uint16 {
+	var v uint16
+	r.read(&v)
+	return v
+}
+
+func (r *reader) uint32() uint32 {
+	var v uint32
+	r.read(&v)
+	return v
+}
+
+// data returns the next length prefixed data.
+func (r *reader) data() []byte {
+	n := r.uint32()
+	if r.err != nil {
+		return nil
+	}
+	b := make([]byte, 0, min(n, 4096))
+	b, r.err = readN(r.r, b, int(n))
+	return b
+}
+
+func (r *reader) skip(n int) {
+	if r.err != nil {
+		return
+	}
+	_, r.err = r.r.Discard(n)
+}
+
+func (r *reader) read(v any) {
+	if r.err != nil {
+		return
+	}
+	r.err = binary.Read(r.r, binary.BigEndian, v)
+}
+
+// readN appends n bytes read from r to b, without trusting n to allocate.
+func readN(r io.Reader, b []byte, n int) ([]byte, error) {
+	buf := make([]byte, 4096)
+	for n > 0 {
+		chunk := buf[:min(n, len(buf))]
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return b, err
+		}
+		b = append(b, chunk...)
+		n -= len(chunk)
+	}
+	return b, nil
+}
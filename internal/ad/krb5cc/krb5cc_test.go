@@ -0,0 +1,192 @@
+package krb5cc_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/ad/krb5cc"
+)
+
+var (
+	authTime  = time.Date(2024, 5, 25, 8, 0, 0, 0, time.UTC)
+	endTime   = authTime.Add(10 * time.Hour)
+	renewTill = authTime.Add(7 * 24 * time.Hour)
+)
+
+func TestTGT(t *testing.T) {
+	t.Parallel()
+
+	tgt := cred{server: []string{"EXAMPLE.COM", "krbtgt", "EXAMPLE.COM"}, start: authTime, flags: 0x00800000}
+	service := cred{server: []string{"EXAMPLE.COM", "ldap", "dc.example.com"}, start: authTime.Add(time.Hour), flags: 0x00800000}
+	conf := cred{server: []string{"X-CACHECONF:", "krb5_ccache_conf_data", "pa_type", "krbtgt/EXAMPLE.COM@EXAMPLE.COM"}}
+	otherRealm := cred{server: []string{"EXAMPLE.COM", "krbtgt", "TRUSTED.COM"}, start: authTime, flags: 0x00800000}
+
+	tests := map[string]struct {
+		content []byte
+		path    string
+
+		want    krb5cc.Ticket
+		wantErr error
+	}{
+		"Renewable ticket granting ticket": {
+			content: ccache(0x0504, conf, service, tgt),
+			want:    krb5cc.Ticket{Principal: "user@EXAMPLE.COM", AuthTime: authTime, StartTime: authTime, EndTime: endTime, RenewTill: renewTill},
+		},
+		"Non renewable ticket granting ticket": {
+			content: ccache(0x0504, cred{server: tgt.server, start: authTime}),
+			want:    krb5cc.Ticket{Principal: "user@EXAMPLE.COM", AuthTime: authTime, StartTime: authTime, EndTime: endTime},
+		},
+		"Start time defaults to auth time": {
+			content: ccache(0x0504, cred{server: tgt.server, flags: tgt.flags}),
+			want:    krb5cc.Ticket{Principal: "user@EXAMPLE.COM", AuthTime: authTime, StartTime: authTime, EndTime: endTime, RenewTill: renewTill},
+		},
+		"Version 3 format": {
+			content: ccache(0x0503, tgt),
+			want:    krb5cc.Ticket{Principal: "user@EXAMPLE.COM", AuthTime: authTime, StartTime: authTime, EndTime: endTime, RenewTill: renewTill},
+		},
+		"Prefixed with FILE": {
+			content: ccache(0x0504, tgt),
+			path:    "FILE:",
+			want:    krb5cc.Ticket{Principal: "user@EXAMPLE.COM", AuthTime: authTime, StartTime: authTime, EndTime: endTime, RenewTill: renewTill},
+		},
+
+		"Error on cache without ticket granting ticket": {content: ccache(0x0504, conf, service), wantErr: krb5cc.ErrNoTGT},
+		"Error on cache with only a cross realm ticket": {content: ccache(0x0504, otherRealm), wantErr: krb5cc.ErrNoTGT},
+		"Error on empty cache":                          {content: []byte{}},
+		"Error on unsupported version":                  {content: ccache(0x0502, tgt)},
+		"Error on invalid content":                      {content: []byte("KRB5 Ticket data")},
+		"Error on truncated credential":                 {content: ccache(0x0504, tgt)[:100]},
+		"Error on cache which does not exist":           {path: "doesnotexist"},
+		"Error on truncated header":                     {content: ccache(0x0504)[:8]},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "krb5cc")
+			if tc.content != nil {
+				require.NoError(t, os.WriteFile(p, tc.content, 0600), "Setup: can't write credential cache")
+			}
+			switch tc.path {
+			case "":
+			case "FILE:":
+				p = tc.path + p
+			default:
+				p = filepath.Join(filepath.Dir(p), tc.path)
+			}
+
+			got, err := krb5cc.TGT(p)
+			if tc.want == (krb5cc.Ticket{}) {
+				require.Error(t, err, "TGT should have failed")
+				if tc.wantErr != nil {
+					require.ErrorIs(t, err, tc.wantErr, "TGT should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "TGT should not have failed")
+			require.True(t, tc.want.AuthTime.Equal(got.AuthTime), "TGT should return the auth time")
+			require.True(t, tc.want.StartTime.Equal(got.StartTime), "TGT should return the start time")
+			require.True(t, tc.want.EndTime.Equal(got.EndTime), "TGT should return the end time")
+			require.True(t, tc.want.RenewTill.Equal(got.RenewTill) || (tc.want.RenewTill.IsZero() && got.RenewTill.IsZero()),
+				"TGT should return the renew till time")
+			require.Equal(t, tc.want.Principal, got.Principal, "TGT should return the principal of the cache")
+		})
+	}
+}
+
+func TestTicketState(t *testing.T) {
+	t.Parallel()
+
+	renewable := krb5cc.Ticket{EndTime: endTime, RenewTill: renewTill}
+	notRenewable := krb5cc.Ticket{EndTime: endTime}
+
+	tests := map[string]struct {
+		ticket krb5cc.Ticket
+		now    time.Time
+
+		wantRenewable bool
+		wantExpired   bool
+	}{
+		"Valid renewable ticket":     {ticket: renewable, now: authTime, wantRenewable: true},
+		"Valid non renewable ticket": {ticket: notRenewable, now: authTime},
+		"Expired renewable ticket":   {ticket: renewable, now: endTime, wantExpired: true},
+		"Renewal period is over":     {ticket: krb5cc.Ticket{EndTime: endTime, RenewTill: authTime}, now: authTime.Add(time.Hour)},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tc.wantRenewable, tc.ticket.Renewable(tc.now), "Renewable should return the expected value")
+			require.Equal(t, tc.wantExpired, tc.ticket.Expired(tc.now), "Expired should return the expected value")
+		})
+	}
+}
+
+// cred is a credential to write in a credential cache for user@EXAMPLE.COM.
+type cred struct {
+	// server is the realm followed by the components of the server principal.
+	server []string
+	start  time.Time
+	flags  uint32
+}
+
+// ccache returns the content of a credential cache of user@EXAMPLE.COM in the given format version with creds.
+func ccache(version uint16, creds ...cred) []byte {
+	var b bytes.Buffer
+	w := func(v any) {
+		if err := binary.Write(&b, binary.BigEndian, v); err != nil {
+			panic(err)
+		}
+	}
+	data := func(d string) {
+		w(uint32(len(d)))
+		b.WriteString(d)
+	}
+	principal := func(components []string) {
+		w(uint32(1))
+		w(uint32(len(components) - 1))
+		for _, c := range components {
+			data(c)
+		}
+	}
+
+	w(version)
+	if version == 0x0504 {
+		// KDC time offset tag
+		w(uint16(12))
+		w(uint16(1))
+		w(uint16(8))
+		w(uint64(0))
+	}
+	principal([]string{"EXAMPLE.COM", "user"})
+
+	for _, c := range creds {
+		principal([]string{"EXAMPLE.COM", "user"})
+		principal(c.server)
+		w(uint16(18))
+		if version == 0x0503 {
+			w(uint16(18))
+		}
+		data("0123456789abcdef0123456789abcdef")
+		var start uint32
+		if !c.start.IsZero() {
+			start = uint32(c.start.Unix())
+		}
+		w([]uint32{uint32(authTime.Unix()), start, uint32(endTime.Unix()), uint32(renewTill.Unix())})
+		w(uint8(0))
+		w(c.flags)
+		// One address, no authorization data
+		w(uint32(1))
+		w(uint16(2))
+		data("\x7f\x00\x00\x01")
+		w(uint32(0))
+		data("ticket")
+		data("")
+	}
+	return b.Bytes()
+}
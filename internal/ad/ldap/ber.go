@@ -0,0 +1,144 @@
+package ldap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+// Universal BER tags used by LDAP messages.
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x30
+	tagSet         = 0x31
+)
+
+// maxElementSize is the biggest BER element we accept to read, to not exhaust memory on a corrupted stream.
+const maxElementSize = 64 * 1024 * 1024
+
+// berElement is a decoded BER element. Only single byte tags are supported, which is all LDAP needs.
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+// berEncode returns the BER element with tag and the concatenation of content.
+func berEncode(tag byte, content ...[]byte) []byte {
+	var l int
+	for _, c := range content {
+		l += len(c)
+	}
+
+	b := append([]byte{tag}, berLength(l)...)
+	for _, c := range content {
+		b = append(b, c...)
+	}
+	return b
+}
+
+// berLength encodes l in short form if possible, long form otherwise.
+func berLength(l int) []byte {
+	if l < 0x80 {
+		return []byte{byte(l)}
+	}
+
+	var b []byte
+	for ; l > 0; l >>= 8 {
+		b = append([]byte{byte(l)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+// berInt encodes v as a two’s complement integer of minimal length.
+func berInt(tag byte, v int64) []byte {
+	b := []byte{byte(v)}
+	for v > 0x7f || v < -0x80 {
+		v >>= 8
+		b = append([]byte{byte(v)}, b...)
+	}
+	return berEncode(tag, b)
+}
+
+// berString encodes s as an octet string with tag.
+func berString(tag byte, s string) []byte {
+	return berEncode(tag, []byte(s))
+}
+
+// berBool encodes v as a boolean.
+func berBool(v bool) []byte {
+	if v {
+		return berEncode(tagBoolean, []byte{0xff})
+	}
+	return berEncode(tagBoolean, []byte{0x00})
+}
+
+// readElement reads the next BER element from r.
+func readElement(r io.Reader) (e berElement, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		return e, err
+	}
+
+	l := uint32(h[1])
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 4 {
+			return e, errors.New(gotext.Get("unsupported BER length encoding"))
+		}
+		lb := make([]byte, n)
+		if _, err := io.ReadFull(r, lb); err != nil {
+			return e, err
+		}
+		l = 0
+		for _, b := range lb {
+			l = l<<8 | uint32(b)
+		}
+	}
+	if l > maxElementSize {
+		return e, errors.New(gotext.Get("BER element of %d bytes is too big", l))
+	}
+
+	// Don’t trust the announced length to allocate: only grow the content as it is read.
+	var content bytes.Buffer
+	if _, err := io.CopyN(&content, r, int64(l)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return e, err
+	}
+
+	return berElement{tag: h[0], content: content.Bytes()}, nil
+}
+
+// children decodes the elements contained in the constructed element e.
+func (e berElement) children() ([]berElement, error) {
+	var elems []berElement
+	r := bytes.NewReader(e.content)
+	for r.Len() > 0 {
+		c, err := readElement(r)
+		if err != nil {
+			return nil, errors.New(gotext.Get("malformed BER element: %v", err))
+		}
+		elems = append(elems, c)
+	}
+	return elems, nil
+}
+
+// int decodes e as a two’s complement integer.
+func (e berElement) int() (int64, error) {
+	if len(e.content) == 0 || len(e.content) > 8 {
+		return 0, errors.New(gotext.Get("invalid BER integer of %d bytes", len(e.content)))
+	}
+
+	// Sign extension from the first byte.
+	v := int64(int8(e.content[0]))
+	for _, b := range e.content[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
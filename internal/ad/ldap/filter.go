@@ -0,0 +1,126 @@
+package ldap
+
+import (
+	"fmt"
+	"strings"
+)
+
+type filterOp int
+
+const (
+	filterAnd filterOp = iota
+	filterOr
+	filterEqual
+	filterPresent
+)
+
+// Filter is a search filter, built with And, Or, Equal and Present.
+type Filter struct {
+	op        filterOp
+	attribute string
+	value     string
+	filters   []Filter
+}
+
+// And matches entries matching all filters.
+func And(filters ...Filter) Filter {
+	return Filter{op: filterAnd, filters: filters}
+}
+
+// Or matches entries matching any of filters.
+func Or(filters ...Filter) Filter {
+	return Filter{op: filterOr, filters: filters}
+}
+
+// Equal matches entries with one value of attribute equal to value.
+func Equal(attribute, value string) Filter {
+	return Filter{op: filterEqual, attribute: attribute, value: value}
+}
+
+// Present matches entries having attribute.
+func Present(attribute string) Filter {
+	return Filter{op: filterPresent, attribute: attribute}
+}
+
+// Match returns true if e matches the filter.
+// Attribute names and values are compared case insensitively, as the directory does for most attributes.
+func (f Filter) Match(e Entry) bool {
+	switch f.op {
+	case filterAnd:
+		for _, sub := range f.filters {
+			if !sub.Match(e) {
+				return false
+			}
+		}
+		return true
+	case filterOr:
+		for _, sub := range f.filters {
+			if sub.Match(e) {
+				return true
+			}
+		}
+		return false
+	case filterEqual:
+		for _, v := range e.Values(f.attribute) {
+			if strings.EqualFold(string(v), f.value) {
+				return true
+			}
+		}
+		return false
+	case filterPresent:
+		return e.Values(f.attribute) != nil
+	}
+	return false
+}
+
+// String returns the RFC 4515 representation of the filter.
+func (f Filter) String() string {
+	switch f.op {
+	case filterAnd, filterOr:
+		op := "&"
+		if f.op == filterOr {
+			op = "|"
+		}
+		var b strings.Builder
+		for _, sub := range f.filters {
+			b.WriteString(sub.String())
+		}
+		return fmt.Sprintf("(%s%s)", op, b.String())
+	case filterEqual:
+		return fmt.Sprintf("(%s=%s)", f.attribute, escapeFilterValue(f.value))
+	case filterPresent:
+		return fmt.Sprintf("(%s=*)", f.attribute)
+	}
+	return ""
+}
+
+// encode returns the BER encoding of the filter.
+func (f Filter) encode() []byte {
+	switch f.op {
+	case filterAnd, filterOr:
+		var subs [][]byte
+		for _, sub := range f.filters {
+			subs = append(subs, sub.encode())
+		}
+		return berEncode(0xa0|byte(f.op), subs...)
+	case filterEqual:
+		return berEncode(0xa3, berString(tagOctetString, f.attribute), berString(tagOctetString, f.value))
+	case filterPresent:
+		return berString(0x87, f.attribute)
+	}
+	return nil
+}
+
+// escapeFilterValue escapes the characters of v with a special meaning in a string filter.
+func escapeFilterValue(v string) string {
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; c {
+		case '*', '(', ')', '\\', 0:
+			fmt.Fprintf(&b, `\%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
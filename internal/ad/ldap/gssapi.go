@@ -0,0 +1,217 @@
+package ldap
+
+/*
+#include <stdlib.h>
+#include <string.h>
+
+#include <gssapi/gssapi.h>
+#include <gssapi/gssapi_ext.h>
+#include <gssapi/gssapi_krb5.h>
+
+typedef struct {
+  gss_cred_id_t cred;
+  gss_name_t target;
+  gss_ctx_id_t ctx;
+} adsys_gss_t;
+
+// adsys_gss_init acquires the initiator credentials from the ccache file and imports the service@host target name.
+OM_uint32 adsys_gss_init(adsys_gss_t *g, const char *ccache, const char *service, OM_uint32 *minor) {
+  OM_uint32 major;
+  gss_key_value_element_desc element = { "ccache", ccache };
+  gss_key_value_set_desc store = { 1, &element };
+  gss_OID_set_desc mechs = { 1, (gss_OID)gss_mech_krb5 };
+  gss_buffer_desc name = { strlen(service), (void *)service };
+
+  g->cred = GSS_C_NO_CREDENTIAL;
+  g->target = GSS_C_NO_NAME;
+  g->ctx = GSS_C_NO_CONTEXT;
+
+  major = gss_acquire_cred_from(minor, GSS_C_NO_NAME, GSS_C_INDEFINITE, &mechs, GSS_C_INITIATE, &store,
+                                &g->cred, NULL, NULL);
+  if (GSS_ERROR(major)) {
+    return major;
+  }
+  return gss_import_name(minor, &name, GSS_C_NT_HOSTBASED_SERVICE, &g->target);
+}
+
+OM_uint32 adsys_gss_step(adsys_gss_t *g, void *in, size_t in_len, gss_buffer_desc *out, OM_uint32 *minor) {
+  gss_buffer_desc input = { in_len, in };
+
+  return gss_init_sec_context(minor, g->cred, &g->ctx, g->target, (gss_OID)gss_mech_krb5,
+                              GSS_C_MUTUAL_FLAG | GSS_C_SEQUENCE_FLAG | GSS_C_INTEG_FLAG | GSS_C_CONF_FLAG, 0,
+                              GSS_C_NO_CHANNEL_BINDINGS, in_len > 0 ? &input : GSS_C_NO_BUFFER, NULL, out, NULL, NULL);
+}
+
+OM_uint32 adsys_gss_wrap(adsys_gss_t *g, int conf, void *in, size_t in_len, gss_buffer_desc *out, OM_uint32 *minor) {
+  gss_buffer_desc input = { in_len, in };
+
+  return gss_wrap(minor, g->ctx, conf, GSS_C_QOP_DEFAULT, &input, NULL, out);
+}
+
+OM_uint32 adsys_gss_unwrap(adsys_gss_t *g, void *in, size_t in_len, gss_buffer_desc *out, OM_uint32 *minor) {
+  gss_buffer_desc input = { in_len, in };
+
+  return gss_unwrap(minor, g->ctx, &input, out, NULL, NULL);
+}
+
+void adsys_gss_free(adsys_gss_t *g) {
+  OM_uint32 minor;
+
+  if (g->ctx != GSS_C_NO_CONTEXT) {
+    gss_delete_sec_context(&minor, &g->ctx, GSS_C_NO_BUFFER);
+  }
+  if (g->target != GSS_C_NO_NAME) {
+    gss_release_name(&minor, &g->target);
+  }
+  if (g->cred != GSS_C_NO_CREDENTIAL) {
+    gss_release_cred(&minor, &g->cred);
+  }
+}
+
+void adsys_gss_release_buffer(gss_buffer_desc *buf) {
+  OM_uint32 minor;
+
+  gss_release_buffer(&minor, buf);
+}
+
+int adsys_gss_is_error(OM_uint32 major) {
+  return GSS_ERROR(major) != 0;
+}
+
+int adsys_gss_continue_needed(OM_uint32 major) {
+  return (major & GSS_S_CONTINUE_NEEDED) != 0;
+}
+
+// adsys_gss_status returns the first message describing the status code of type, to be freed by the caller.
+char *adsys_gss_status(OM_uint32 code, int type) {
+  OM_uint32 minor, msg_ctx = 0;
+  gss_buffer_desc msg = GSS_C_EMPTY_BUFFER;
+  char *r;
+
+  if (GSS_ERROR(gss_display_status(&minor, code, type, GSS_C_NO_OID, &msg_ctx, &msg))) {
+    return NULL;
+  }
+  r = strndup(msg.value, msg.length);
+  gss_release_buffer(&minor, &msg);
+  return r;
+}
+
+int adsys_gss_code_type() {
+  return GSS_C_GSS_CODE;
+}
+
+int adsys_mech_code_type() {
+  return GSS_C_MECH_CODE;
+}
+*/
+// #cgo pkg-config: krb5-gssapi
+import "C"
+
+import (
+	"errors"
+	"strings"
+	"unsafe"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+// gssContext is a Kerberos GSSAPI security context.
+type gssContext struct {
+	g C.adsys_gss_t
+}
+
+// newGSSContext returns a security context for service, using the Kerberos tickets from the ccache at krb5CCPath.
+// The ccache is set per context, so that concurrent connections can use different tickets.
+func newGSSContext(krb5CCPath, service string) (securityContext, error) {
+	cCCache := C.CString(krb5CCPath)
+	defer C.free(unsafe.Pointer(cCCache))
+	cService := C.CString(service)
+	defer C.free(unsafe.Pointer(cService))
+
+	// Allocated in C memory as the GSSAPI handles are kept between calls.
+	s := (*gssContext)(C.calloc(1, C.size_t(unsafe.Sizeof(gssContext{}))))
+	var minor C.OM_uint32
+	if major := C.adsys_gss_init(&s.g, cCCache, cService, &minor); C.adsys_gss_is_error(major) != 0 {
+		s.close()
+		return nil, gssError(gotext.Get("can't acquire Kerberos credentials from %q", krb5CCPath), major, minor)
+	}
+
+	return s, nil
+}
+
+func (s *gssContext) step(in []byte) (out []byte, done bool, err error) {
+	var minor C.OM_uint32
+	var buf C.gss_buffer_desc
+	major := C.adsys_gss_step(&s.g, cBytes(in), C.size_t(len(in)), &buf, &minor)
+	defer C.adsys_gss_release_buffer(&buf)
+	if C.adsys_gss_is_error(major) != 0 {
+		return nil, false, gssError(gotext.Get("can't initialize security context"), major, minor)
+	}
+
+	return C.GoBytes(buf.value, C.int(buf.length)), C.adsys_gss_continue_needed(major) == 0, nil
+}
+
+func (s *gssContext) wrap(msg []byte, conf bool) ([]byte, error) {
+	var minor C.OM_uint32
+	var buf C.gss_buffer_desc
+	cConf := C.int(0)
+	if conf {
+		cConf = 1
+	}
+	major := C.adsys_gss_wrap(&s.g, cConf, cBytes(msg), C.size_t(len(msg)), &buf, &minor)
+	defer C.adsys_gss_release_buffer(&buf)
+	if C.adsys_gss_is_error(major) != 0 {
+		return nil, gssError(gotext.Get("can't wrap message"), major, minor)
+	}
+
+	return C.GoBytes(buf.value, C.int(buf.length)), nil
+}
+
+func (s *gssContext) unwrap(msg []byte) ([]byte, error) {
+	var minor C.OM_uint32
+	var buf C.gss_buffer_desc
+	major := C.adsys_gss_unwrap(&s.g, cBytes(msg), C.size_t(len(msg)), &buf, &minor)
+	defer C.adsys_gss_release_buffer(&buf)
+	if C.adsys_gss_is_error(major) != 0 {
+		return nil, gssError(gotext.Get("can't unwrap message"), major, minor)
+	}
+
+	return C.GoBytes(buf.value, C.int(buf.length)), nil
+}
+
+func (s *gssContext) close() {
+	C.adsys_gss_free(&s.g)
+	C.free(unsafe.Pointer(s))
+}
+
+// cBytes returns a pointer to the content of b, which can be passed to C as b does not contain any Go pointer.
+func cBytes(b []byte) unsafe.Pointer {
+	if len(b) == 0 {
+		return nil
+	}
+	return unsafe.Pointer(&b[0])
+}
+
+// gssError returns an error with msg and the descriptions of the major and minor status codes.
+func gssError(msg string, major, minor C.OM_uint32) error {
+	details := []string{msg}
+	for _, s := range []struct {
+		code C.OM_uint32
+		typ  C.int
+	}{
+		{major, C.adsys_gss_code_type()},
+		{minor, C.adsys_mech_code_type()},
+	} {
+		if s.code == 0 {
+			continue
+		}
+		cMsg := C.adsys_gss_status(s.code, s.typ)
+		if cMsg == nil {
+			continue
+		}
+		details = append(details, C.GoString(cMsg))
+		C.free(unsafe.Pointer(cMsg))
+	}
+
+	return errors.New(strings.Join(details, ": "))
+}
@@ -0,0 +1,401 @@
+// Package ldap is a minimal LDAP client to query Active Directory.
+//
+// It only supports what adsys needs: binding with Kerberos through SASL GSSAPI, with signed and sealed messages,
+// and searching entries.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+// Scope is the part of the tree under the base DN a search applies to.
+type Scope int
+
+const (
+	// ScopeBase only searches the base DN entry.
+	ScopeBase Scope = 0
+	// ScopeOneLevel searches the direct children of the base DN.
+	ScopeOneLevel Scope = 1
+	// ScopeSubtree searches the base DN and all its descendants.
+	ScopeSubtree Scope = 2
+)
+
+// Result codes of LDAP operations.
+const (
+	// ResultSuccess is returned on successful operations.
+	ResultSuccess = 0
+	// ResultNoSuchObject is returned when the base DN does not exist.
+	ResultNoSuchObject = 32
+
+	resultSaslBindInProgress = 14
+)
+
+// Application tags of the LDAP protocol operations.
+const (
+	appBindRequest          = 0x60
+	appBindResponse         = 0x61
+	appUnbindRequest        = 0x42
+	appSearchRequest        = 0x63
+	appSearchResultEntry    = 0x64
+	appSearchResultDone     = 0x65
+	appSearchResultRef      = 0x73
+	appExtendedResponse     = 0x78
+	ctxControls             = 0xa0
+	ctxSaslCredentials      = 0xa3
+	ctxServerSaslCredential = 0x87
+)
+
+// Error is an LDAP operation failure reported by the server.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e Error) Error() string {
+	return gotext.Get("LDAP result code %d: %s", e.Code, e.Message)
+}
+
+// Control is an LDAP control attached to a request.
+type Control struct {
+	OID      string
+	Critical bool
+	Value    []byte
+}
+
+// SDFlagsControl returns the control selecting the parts of nTSecurityDescriptor returned by the server.
+// Without it, the whole descriptor is requested, and the SACL is only readable by administrators.
+func SDFlagsControl(flags int) Control {
+	return Control{
+		OID:      "1.2.840.113556.1.4.801",
+		Critical: true,
+		Value:    berEncode(tagSequence, berInt(tagInteger, int64(flags))),
+	}
+}
+
+func (c Control) encode() []byte {
+	parts := [][]byte{berString(tagOctetString, c.OID)}
+	if c.Critical {
+		parts = append(parts, berBool(true))
+	}
+	if c.Value != nil {
+		parts = append(parts, berEncode(tagOctetString, c.Value))
+	}
+	return berEncode(tagSequence, parts...)
+}
+
+// SearchRequest describes the entries to search for and the attributes to return.
+type SearchRequest struct {
+	BaseDN     string
+	Scope      Scope
+	Filter     Filter
+	Attributes []string
+	Controls   []Control
+}
+
+// Entry is an entry returned by a search.
+type Entry struct {
+	DN         string
+	Attributes map[string][][]byte
+}
+
+// Values returns all values of attribute, whose name is case insensitive. It is nil if the entry does not have it.
+func (e Entry) Values(attribute string) [][]byte {
+	for name, v := range e.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of attribute, whose name is case insensitive. It is nil if the entry does not have it.
+func (e Entry) Value(attribute string) []byte {
+	v := e.Values(attribute)
+	if len(v) == 0 {
+		return nil
+	}
+	return v[0]
+}
+
+// Conn is a connection to an LDAP server. Requests are serialized.
+type Conn struct {
+	mu    sync.Mutex
+	conn  net.Conn
+	r     io.Reader
+	w     io.Writer
+	msgID int64
+
+	sec securityContext
+}
+
+// Dial connects to the LDAP server on host and binds with SASL GSSAPI, using the Kerberos tickets from the ccache
+// at krb5CCPath.
+// All following messages are sealed, or at least signed, depending on what the server supports.
+func Dial(ctx context.Context, host, krb5CCPath string) (c *Conn, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't connect to LDAP server %q", host))
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "389"))
+	if err != nil {
+		return nil, err
+	}
+
+	sec, err := newGSSContext(krb5CCPath, "ldap@"+host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	c = newConn(conn)
+	if err := c.bind(ctx, sec); err != nil {
+		sec.close()
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// newConn returns an unauthenticated connection over conn.
+func newConn(conn net.Conn) *Conn {
+	return &Conn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    conn,
+	}
+}
+
+// Close unbinds and closes the connection.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The server does not answer an unbind request and closes the connection.
+	_, _ = c.send(berEncode(appUnbindRequest), nil)
+	if c.sec != nil {
+		c.sec.close()
+	}
+	return c.conn.Close()
+}
+
+// DefaultNamingContext returns the DN of the domain, as advertised by the root DSE.
+func (c *Conn) DefaultNamingContext(ctx context.Context) (dn string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get default naming context"))
+
+	return c.rootDSEValue(ctx, "defaultNamingContext")
+}
+
+// ConfigurationNamingContext returns the DN of the configuration partition of the forest, as advertised by the
+// root DSE.
+func (c *Conn) ConfigurationNamingContext(ctx context.Context) (dn string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get configuration naming context"))
+
+	return c.rootDSEValue(ctx, "configurationNamingContext")
+}
+
+// rootDSEValue returns the value of attribute on the root DSE.
+func (c *Conn) rootDSEValue(ctx context.Context, attribute string) (string, error) {
+	entries, err := c.Search(ctx, SearchRequest{
+		Scope:      ScopeBase,
+		Filter:     Present("objectClass"),
+		Attributes: []string{attribute},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 || entries[0].Value(attribute) == nil {
+		return "", errors.New(gotext.Get("root DSE has no %s", attribute))
+	}
+
+	return string(entries[0].Value(attribute)), nil
+}
+
+// Search returns the entries matching req.
+// References to other partitions are not followed.
+func (c *Conn) Search(ctx context.Context, req SearchRequest) (entries []Entry, err error) {
+	defer decorate.OnError(&err, gotext.Get("search of %s under %q failed", req.Filter, req.BaseDN))
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := c.watch(ctx)
+	defer stop()
+	defer func() {
+		if err != nil && ctx.Err() != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	var attrs [][]byte
+	for _, a := range req.Attributes {
+		attrs = append(attrs, berString(tagOctetString, a))
+	}
+	id, err := c.send(berEncode(appSearchRequest,
+		berString(tagOctetString, req.BaseDN),
+		berInt(tagEnumerated, int64(req.Scope)),
+		berInt(tagEnumerated, 0), // never dereference aliases
+		berInt(tagInteger, 0),    // no size limit
+		berInt(tagInteger, 0),    // no time limit
+		berBool(false),           // return values
+		req.Filter.encode(),
+		berEncode(tagSequence, attrs...),
+	), req.Controls)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, err := c.receive(id)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case appSearchResultEntry:
+			e, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		case appSearchResultRef:
+			continue
+		case appSearchResultDone:
+			if _, err := parseResult(op); err != nil {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, errors.New(gotext.Get("unexpected LDAP operation 0x%x in search response", op.tag))
+		}
+	}
+}
+
+// watch applies the deadline and cancellation of ctx to the connection, until stop is called.
+func (c *Conn) watch(ctx context.Context) (stop func() bool) {
+	deadline, _ := ctx.Deadline()
+	_ = c.conn.SetDeadline(deadline)
+	return context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+	})
+}
+
+// send writes a message with the protocol operation op and controls. It returns the message id.
+func (c *Conn) send(op []byte, controls []Control) (id int64, err error) {
+	c.msgID++
+	parts := [][]byte{berInt(tagInteger, c.msgID), op}
+	if len(controls) > 0 {
+		var ctrls [][]byte
+		for _, ctrl := range controls {
+			ctrls = append(ctrls, ctrl.encode())
+		}
+		parts = append(parts, berEncode(ctxControls, ctrls...))
+	}
+
+	if _, err := c.w.Write(berEncode(tagSequence, parts...)); err != nil {
+		return 0, err
+	}
+	return c.msgID, nil
+}
+
+// receive returns the protocol operation of the next message for the message id.
+func (c *Conn) receive(id int64) (op berElement, err error) {
+	for {
+		msg, err := readElement(c.r)
+		if err != nil {
+			return op, err
+		}
+		parts, err := msg.children()
+		if err != nil {
+			return op, err
+		}
+		if msg.tag != tagSequence || len(parts) < 2 {
+			return op, errors.New(gotext.Get("malformed LDAP message"))
+		}
+		msgID, err := parts[0].int()
+		if err != nil {
+			return op, err
+		}
+
+		// Unsolicited notification, like a notice of disconnection.
+		if msgID == 0 && parts[1].tag == appExtendedResponse {
+			if _, err := parseResult(parts[1]); err != nil {
+				return op, err
+			}
+			return op, errors.New(gotext.Get("unexpected notification from the server"))
+		}
+		if msgID != id {
+			continue
+		}
+		return parts[1], nil
+	}
+}
+
+// parseResult returns the elements of an LDAPResult operation, or an Error if it is not successful.
+func parseResult(op berElement) ([]berElement, error) {
+	parts, err := op.children()
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) < 3 {
+		return nil, errors.New(gotext.Get("malformed LDAP result"))
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return nil, err
+	}
+	if code != ResultSuccess && code != resultSaslBindInProgress {
+		return nil, Error{Code: int(code), Message: string(parts[2].content)}
+	}
+
+	return parts, nil
+}
+
+// parseEntry decodes a search result entry.
+func parseEntry(op berElement) (e Entry, err error) {
+	parts, err := op.children()
+	if err != nil {
+		return e, err
+	}
+	if len(parts) != 2 {
+		return e, errors.New(gotext.Get("malformed LDAP search result entry"))
+	}
+
+	e = Entry{DN: string(parts[0].content), Attributes: make(map[string][][]byte)}
+	attrs, err := parts[1].children()
+	if err != nil {
+		return e, err
+	}
+	for _, attr := range attrs {
+		typeAndValues, err := attr.children()
+		if err != nil {
+			return e, err
+		}
+		if len(typeAndValues) != 2 {
+			return e, errors.New(gotext.Get("malformed LDAP attribute in entry %q", e.DN))
+		}
+		values, err := typeAndValues[1].children()
+		if err != nil {
+			return e, err
+		}
+		name := string(typeAndValues[0].content)
+		e.Attributes[name] = [][]byte{}
+		for _, v := range values {
+			e.Attributes[name] = append(e.Attributes[name], v.content)
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,356 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	entries := map[string][]Entry{
+		"dc=example,dc=com": {
+			{DN: "cn=user1,dc=example,dc=com", Attributes: map[string][][]byte{"cn": {[]byte("user1")}, "objectClass": {[]byte("top"), []byte("user")}}},
+			{DN: "cn=user2,dc=example,dc=com", Attributes: map[string][][]byte{"cn": {[]byte("user2")}}},
+		},
+		"cn=empty,dc=example,dc=com": {},
+	}
+
+	tests := map[string]struct {
+		baseDN        string
+		withReference bool
+		malformed     bool
+		cancelled     bool
+
+		want    []Entry
+		wantErr error
+	}{
+		"Return matching entries":             {baseDN: "dc=example,dc=com", want: entries["dc=example,dc=com"]},
+		"Return no entries":                   {baseDN: "cn=empty,dc=example,dc=com"},
+		"References to other partitions skip": {baseDN: "dc=example,dc=com", withReference: true, want: entries["dc=example,dc=com"]},
+
+		"Error on unknown base DN":    {baseDN: "dc=doesnotexist", wantErr: Error{Code: ResultNoSuchObject, Message: "no such object"}},
+		"Error on malformed response": {baseDN: "dc=example,dc=com", malformed: true, wantErr: errAny},
+		"Error on cancelled context":  {baseDN: "dc=example,dc=com", cancelled: true, wantErr: context.Canceled},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server := net.Pipe()
+			srv := fakeServer{conn: server, entries: entries, withReference: tc.withReference, malformed: tc.malformed}
+			go srv.serve(t)
+
+			c := newConn(client)
+			defer c.Close()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tc.cancelled {
+				cancel()
+			}
+
+			got, err := c.Search(ctx, SearchRequest{
+				BaseDN:     tc.baseDN,
+				Scope:      ScopeSubtree,
+				Filter:     And(Equal("objectClass", "user"), Present("cn")),
+				Attributes: []string{"cn", "objectClass"},
+				Controls:   []Control{SDFlagsControl(7)},
+			})
+			if tc.wantErr != nil {
+				require.Error(t, err, "Search should have failed")
+				if !errors.Is(tc.wantErr, errAny) {
+					require.ErrorIs(t, err, tc.wantErr, "Search should have returned the expected error")
+				}
+				return
+			}
+			require.NoError(t, err, "Search should not have failed")
+			require.Equal(t, len(tc.want), len(got), "Search should return all entries")
+			for i := range tc.want {
+				require.Equal(t, tc.want[i].DN, got[i].DN, "Entry DN should match")
+				for attr, values := range tc.want[i].Attributes {
+					require.Equal(t, values, got[i].Values(attr), "Entry attribute %q should match", attr)
+				}
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		offeredLayers byte
+		stepErr       bool
+
+		wantLayer byte
+		wantErr   bool
+	}{
+		"Negotiate confidentiality when offered": {offeredLayers: saslLayerNone | saslLayerIntegrity | saslLayerConfidentiality, wantLayer: saslLayerConfidentiality},
+		"Negotiate integrity when offered":       {offeredLayers: saslLayerNone | saslLayerIntegrity, wantLayer: saslLayerIntegrity},
+		"Negotiate no layer if only one offered": {offeredLayers: saslLayerNone, wantLayer: saslLayerNone},
+
+		"Error when no known layer is offered":     {offeredLayers: 0x8, wantErr: true},
+		"Error when security context can't be set": {offeredLayers: saslLayerNone, stepErr: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			client, server := net.Pipe()
+			srv := fakeServer{
+				conn:          server,
+				entries:       map[string][]Entry{"dc=example,dc=com": {{DN: "cn=user1,dc=example,dc=com"}}},
+				offeredLayers: tc.offeredLayers,
+				gotLayer:      make(chan byte, 1),
+			}
+			go srv.serve(t)
+
+			c := newConn(client)
+			defer c.Close()
+
+			err := c.bind(context.Background(), &fakeSecurityContext{stepErr: tc.stepErr})
+			if tc.wantErr {
+				require.Error(t, err, "bind should have failed")
+				return
+			}
+			require.NoError(t, err, "bind should not have failed")
+			require.Equal(t, tc.wantLayer, <-srv.gotLayer, "bind should have negotiated the expected security layer")
+
+			// Messages are now exchanged with the security layer.
+			got, err := c.Search(context.Background(), SearchRequest{BaseDN: "dc=example,dc=com", Filter: Present("objectClass")})
+			require.NoError(t, err, "Search should not have failed after bind")
+			require.Len(t, got, 1, "Search should return the entry after bind")
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	e := Entry{DN: "cn=computer1", Attributes: map[string][][]byte{
+		"sAMAccountName": {[]byte("computer1$")},
+		"objectClass":    {[]byte("top"), []byte("Computer")},
+	}}
+
+	tests := map[string]struct {
+		filter Filter
+
+		wantString string
+		wantMatch  bool
+	}{
+		"Equal matches any value case insensitively": {filter: Equal("objectclass", "computer"), wantString: "(objectclass=computer)", wantMatch: true},
+		"Present matches existing attribute":         {filter: Present("samaccountname"), wantString: "(samaccountname=*)", wantMatch: true},
+		"And matches if all match": {
+			filter:     And(Or(Equal("sAMAccountName", "computer1"), Equal("sAMAccountName", "computer1$")), Equal("objectClass", "computer")),
+			wantString: "(&(|(sAMAccountName=computer1)(sAMAccountName=computer1$))(objectClass=computer))", wantMatch: true,
+		},
+		"Special characters are escaped": {filter: Equal("cn", `a*(b)\c`), wantString: `(cn=a\2a\28b\29\5cc)`},
+
+		"Equal does not match other values":    {filter: Equal("objectClass", "user"), wantString: "(objectClass=user)"},
+		"Present does not match missing value": {filter: Present("member"), wantString: "(member=*)"},
+		"And does not match if one does not":   {filter: And(Present("objectClass"), Present("member")), wantString: "(&(objectClass=*)(member=*))"},
+		"Or does not match if none match":      {filter: Or(Present("cn"), Present("member")), wantString: "(|(cn=*)(member=*))"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tc.wantString, tc.filter.String(), "String should return the RFC 4515 representation")
+			require.Equal(t, tc.wantMatch, tc.filter.Match(e), "Match should return expected result")
+		})
+	}
+}
+
+func FuzzReadElement(f *testing.F) {
+	f.Add(berEncode(tagSequence, berInt(tagInteger, 1), berString(tagOctetString, "cn=test")))
+	f.Add(berString(tagOctetString, string(make([]byte, 300))))
+	f.Add([]byte{tagOctetString, 0x84, 0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{tagOctetString, 0x80})
+
+	f.Fuzz(func(t *testing.T, d []byte) {
+		e, err := readElement(bytes.NewReader(d))
+		if err != nil {
+			return
+		}
+		// A decoded element is encoded back to an element with the same content.
+		got, err := readElement(bytes.NewReader(berEncode(e.tag, e.content)))
+		require.NoError(t, err, "readElement should decode an encoded element")
+		require.Equal(t, e.tag, got.tag, "Tag should be preserved")
+		require.Equal(t, e.content, got.content, "Content should be preserved")
+
+		_, _ = e.children()
+		_, _ = e.int()
+	})
+}
+
+func FuzzParseEntry(f *testing.F) {
+	f.Add(berEncode(appSearchResultEntry, berString(tagOctetString, "cn=user,dc=example,dc=com"),
+		berEncode(tagSequence,
+			berEncode(tagSequence, berString(tagOctetString, "objectClass"),
+				berEncode(tagSet, berString(tagOctetString, "top"), berString(tagOctetString, "user"))),
+			berEncode(tagSequence, berString(tagOctetString, "tokenGroups"), berEncode(tagSet)))))
+	f.Add(berEncode(appSearchResultEntry, berString(tagOctetString, "cn=incomplete")))
+	f.Add(result(appSearchResultDone, ResultSuccess, ""))
+
+	f.Fuzz(func(t *testing.T, d []byte) {
+		op, err := readElement(bytes.NewReader(d))
+		if err != nil {
+			return
+		}
+		if e, err := parseEntry(op); err == nil {
+			require.NotNil(t, e.Attributes, "Attributes of a parsed entry should be initialized")
+		}
+		_, _ = parseResult(op)
+	})
+}
+
+// errAny is used when any error is expected.
+var errAny = errors.New("any error")
+
+// fakeServer is an in process LDAP server answering binds and searches in entries, indexed by base DN.
+type fakeServer struct {
+	conn          net.Conn
+	entries       map[string][]Entry
+	withReference bool
+	malformed     bool
+
+	offeredLayers byte
+	gotLayer      chan byte
+}
+
+func (s fakeServer) serve(t *testing.T) {
+	t.Helper()
+
+	defer s.conn.Close()
+	var r io.Reader = bufio.NewReader(s.conn)
+	var w io.Writer = s.conn
+	sec := &fakeSecurityContext{}
+
+	for {
+		msg, err := readElement(r)
+		if err != nil {
+			return
+		}
+		parts, err := msg.children()
+		require.NoError(t, err, "Setup: server should decode message")
+		id, err := parts[0].int()
+		require.NoError(t, err, "Setup: server should decode message id")
+		reply := func(ops ...[]byte) {
+			for _, op := range ops {
+				if _, err := w.Write(berEncode(tagSequence, berInt(tagInteger, id), op)); err != nil {
+					return
+				}
+			}
+		}
+
+		switch parts[1].tag {
+		case appUnbindRequest:
+			return
+		case appBindRequest:
+			req, err := parts[1].children()
+			require.NoError(t, err, "Setup: server should decode bind request")
+			sasl, err := req[2].children()
+			require.NoError(t, err, "Setup: server should decode SASL credentials")
+			creds := sasl[1].content
+
+			switch {
+			case string(creds) == "client token":
+				reply(bindResponse(resultSaslBindInProgress, []byte("server token")))
+			case len(creds) == 0:
+				offer, _ := sec.wrap([]byte{s.offeredLayers, 0, 0xff, 0xff}, false)
+				reply(bindResponse(resultSaslBindInProgress, offer))
+			default:
+				layer, err := sec.unwrap(creds)
+				require.NoError(t, err, "Setup: server should unwrap client security layer")
+				reply(bindResponse(ResultSuccess, nil))
+				s.gotLayer <- layer[0]
+				if layer[0] != saslLayerNone {
+					sc := &saslConn{conn: s.conn, sec: sec}
+					r, w = bufio.NewReader(sc), sc
+				}
+			}
+		case appSearchRequest:
+			if s.malformed {
+				reply(berEncode(appSearchResultEntry, berString(tagOctetString, "cn=incomplete")))
+				continue
+			}
+			req, err := parts[1].children()
+			require.NoError(t, err, "Setup: server should decode search request")
+			entries, ok := s.entries[string(req[0].content)]
+			if !ok {
+				reply(result(appSearchResultDone, ResultNoSuchObject, "no such object"))
+				continue
+			}
+			if s.withReference {
+				reply(berEncode(appSearchResultRef, berString(tagOctetString, "ldap://other.example.com/dc=other")))
+			}
+			for _, e := range entries {
+				var attrs [][]byte
+				for name, values := range e.Attributes {
+					var vals [][]byte
+					for _, v := range values {
+						vals = append(vals, berEncode(tagOctetString, v))
+					}
+					attrs = append(attrs, berEncode(tagSequence, berString(tagOctetString, name), berEncode(tagSet, vals...)))
+				}
+				reply(berEncode(appSearchResultEntry, berString(tagOctetString, e.DN), berEncode(tagSequence, attrs...)))
+			}
+			reply(result(appSearchResultDone, ResultSuccess, ""))
+		}
+	}
+}
+
+func result(tag byte, code int, msg string) []byte {
+	return berEncode(tag, berInt(tagEnumerated, int64(code)), berString(tagOctetString, ""), berString(tagOctetString, msg))
+}
+
+func bindResponse(code int, creds []byte) []byte {
+	parts := [][]byte{berInt(tagEnumerated, int64(code)), berString(tagOctetString, ""), berString(tagOctetString, "")}
+	if creds != nil {
+		parts = append(parts, berEncode(ctxServerSaslCredential, creds))
+	}
+	return berEncode(appBindResponse, parts...)
+}
+
+// fakeSecurityContext establishes a context in two steps and wraps messages with a prefix.
+type fakeSecurityContext struct {
+	steps   int
+	stepErr bool
+}
+
+var wrapPrefix = []byte("wrapped:")
+
+func (s *fakeSecurityContext) step(in []byte) ([]byte, bool, error) {
+	if s.stepErr {
+		return nil, false, errors.New("step error requested")
+	}
+	s.steps++
+	if s.steps == 1 {
+		return []byte("client token"), false, nil
+	}
+	if string(in) != "server token" {
+		return nil, false, errors.New("unexpected server token")
+	}
+	return nil, true, nil
+}
+
+func (s *fakeSecurityContext) wrap(msg []byte, _ bool) ([]byte, error) {
+	return append(append([]byte{}, wrapPrefix...), msg...), nil
+}
+
+func (s *fakeSecurityContext) unwrap(msg []byte) ([]byte, error) {
+	if !bytes.HasPrefix(msg, wrapPrefix) {
+		return nil, errors.New("message is not wrapped")
+	}
+	return msg[len(wrapPrefix):], nil
+}
+
+func (s *fakeSecurityContext) close() {}
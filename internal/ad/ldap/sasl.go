@@ -0,0 +1,170 @@
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+// SASL GSSAPI security layers, as defined in RFC 4752.
+const (
+	saslLayerNone            = 1
+	saslLayerIntegrity       = 2
+	saslLayerConfidentiality = 4
+)
+
+// securityContext is a GSSAPI security context being established with the server.
+type securityContext interface {
+	// step processes the token from the server, nil on first call, and returns the token to send to it.
+	// done is true once the context is established.
+	step(in []byte) (out []byte, done bool, err error)
+	// wrap signs msg, and encrypts it if conf is set.
+	wrap(msg []byte, conf bool) ([]byte, error)
+	// unwrap verifies and decrypts msg.
+	unwrap(msg []byte) ([]byte, error)
+	close()
+}
+
+// bind authenticates with SASL GSSAPI and negotiates the strongest security layer offered by the server.
+func (c *Conn) bind(ctx context.Context, sec securityContext) (err error) {
+	defer decorate.OnError(&err, gotext.Get("GSSAPI bind failed"))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := c.watch(ctx)
+	defer stop()
+
+	var in []byte
+	for {
+		out, done, err := sec.step(in)
+		if err != nil {
+			return err
+		}
+		in, err = c.saslBind(out)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	// Once the context is established, the server sends its supported security layers and maximum message size.
+	offer, err := sec.unwrap(in)
+	if err != nil {
+		return err
+	}
+	if len(offer) != 4 {
+		return errors.New(gotext.Get("invalid security layer offer of %d bytes", len(offer)))
+	}
+	layer := byte(saslLayerNone)
+	switch {
+	case offer[0]&saslLayerConfidentiality != 0:
+		layer = saslLayerConfidentiality
+	case offer[0]&saslLayerIntegrity != 0:
+		layer = saslLayerIntegrity
+	case offer[0]&saslLayerNone == 0:
+		return errors.New(gotext.Get("no supported security layer offered by the server"))
+	}
+	reply, err := sec.wrap([]byte{layer, offer[1], offer[2], offer[3]}, false)
+	if err != nil {
+		return err
+	}
+	if _, err := c.saslBind(reply); err != nil {
+		return err
+	}
+
+	c.sec = sec
+	if layer != saslLayerNone {
+		s := &saslConn{conn: c.conn, sec: sec, conf: layer == saslLayerConfidentiality}
+		c.r = bufio.NewReader(s)
+		c.w = s
+	}
+
+	return nil
+}
+
+// saslBind sends a GSSAPI bind request with the credentials creds and returns the ones from the server.
+func (c *Conn) saslBind(creds []byte) (serverCreds []byte, err error) {
+	id, err := c.send(berEncode(appBindRequest,
+		berInt(tagInteger, 3),
+		berString(tagOctetString, ""),
+		berEncode(ctxSaslCredentials, berString(tagOctetString, "GSSAPI"), berEncode(tagOctetString, creds)),
+	), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := c.receive(id)
+	if err != nil {
+		return nil, err
+	}
+	if op.tag != appBindResponse {
+		return nil, errors.New(gotext.Get("unexpected LDAP operation 0x%x in bind response", op.tag))
+	}
+	parts, err := parseResult(op)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range parts[3:] {
+		if p.tag == ctxServerSaslCredential {
+			return p.content, nil
+		}
+	}
+	return nil, nil
+}
+
+// saslConn wraps and unwraps the messages exchanged over conn with the negotiated security layer.
+// Each wrapped message is preceded by its length on 4 bytes.
+type saslConn struct {
+	conn net.Conn
+	sec  securityContext
+	conf bool
+
+	buf []byte
+}
+
+func (s *saslConn) Write(p []byte) (int, error) {
+	w, err := s.sec.wrap(p, s.conf)
+	if err != nil {
+		return 0, err
+	}
+
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(w)), uint32(len(w)))
+	if _, err := s.conn.Write(append(frame, w...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *saslConn) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		var h [4]byte
+		if _, err := io.ReadFull(s.conn, h[:]); err != nil {
+			return 0, err
+		}
+		l := binary.BigEndian.Uint32(h[:])
+		if l > maxElementSize {
+			return 0, errors.New(gotext.Get("SASL message of %d bytes is too big", l))
+		}
+		w := make([]byte, l)
+		if _, err := io.ReadFull(s.conn, w); err != nil {
+			return 0, err
+		}
+		buf, err := s.sec.unwrap(w)
+		if err != nil {
+			return 0, err
+		}
+		s.buf = buf
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
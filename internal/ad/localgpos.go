@@ -0,0 +1,199 @@
+package ad
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/consts"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies"
+	"github.com/ubuntu/decorate"
+	"gopkg.in/yaml.v3"
+)
+
+// localGPOsManifest is the name of the manifest listing the GPOs of the local GPO source.
+const localGPOsManifest = "gpos.yaml"
+
+// localGPOs is the manifest of a local GPO source. GPOs are listed from the highest priority to the lowest one.
+type localGPOs struct {
+	Computer []localGPO `yaml:"computer"`
+	User     []localGPO `yaml:"user"`
+	// Objects are the GPOs of specific users or computers, replacing the ones of their object class.
+	Objects map[string][]localGPO `yaml:"objects"`
+}
+
+// localGPO is a GPO of the local GPO source, stored in Policies/<ID>.
+type localGPO struct {
+	ID   string `yaml:"id"`
+	Name string `yaml:"name"`
+}
+
+// WithLocalGPOs reads the GPOs from the directory dir, laid out like SYSVOL, instead of Active Directory.
+// The GPOs applying to each object are listed in its gpos.yaml manifest.
+func WithLocalGPOs(dir string) Option {
+	return func(o *options) error {
+		o.localGPOsDir = dir
+		return nil
+	}
+}
+
+// getLocalPolicies returns the policies of objectName from the local GPO source, without reaching Active Directory.
+// The GPOs and assets are copied to the SYSVOL cache, as if they were downloaded.
+func (ad *AD) getLocalPolicies(ctx context.Context, objectName string, objectClass ObjectClass) (pols policies.Policies, err error) {
+	orderedGPOs, err := ad.listLocalGPOs(ctx, objectName, objectClass)
+	if err != nil {
+		return pols, err
+	}
+
+	ad.Lock()
+	defer ad.Unlock()
+	assetsWereRefreshed, err := ad.fetchLocal(ctx, orderedGPOs)
+	if err != nil {
+		return pols, err
+	}
+
+	return ad.policiesFromSysvol(ctx, orderedGPOs, nil, assetsWereRefreshed, objectName, objectClass, "")
+}
+
+// listLocalGPOs returns the GPOs of objectName listed in the manifest of the local GPO source.
+func (ad *AD) listLocalGPOs(ctx context.Context, objectName string, objectClass ObjectClass) (gpos []gpo, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't list local GPOs"))
+
+	d, err := os.ReadFile(filepath.Join(ad.localGPOsDir, localGPOsManifest))
+	if err != nil {
+		return nil, err
+	}
+	var manifest localGPOs
+	if err := yaml.Unmarshal(d, &manifest); err != nil {
+		return nil, err
+	}
+
+	list, ok := manifest.Objects[objectName]
+	if !ok && objectClass == ComputerObject {
+		list = manifest.Computer
+	} else if !ok {
+		list = manifest.User
+	}
+
+	for _, g := range list {
+		if g.ID == "" || g.ID != filepath.Base(g.ID) || g.ID == "." || g.ID == ".." {
+			return nil, errors.New(gotext.Get("invalid GPO ID %q", g.ID))
+		}
+		name := g.Name
+		if name == "" {
+			name = g.ID
+		}
+		log.Debugf(ctx, "Local GPO %q for %q", name, objectName)
+		gpos = append(gpos, gpo{name: name, url: "file://" + filepath.Join(ad.localGPOsDir, "Policies", g.ID)})
+	}
+	return gpos, nil
+}
+
+// fetchLocal copies the GPOs and assets of the local GPO source to the SYSVOL cache.
+// They are always copied again, as local GPOs are usually edited without updating their version.
+// It returns if the assets were refreshed.
+func (ad *AD) fetchLocal(ctx context.Context, gpos []gpo) (assetsWereRefreshed bool, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't copy local GPOs and assets"))
+
+	for _, g := range gpos {
+		d, ok := ad.downloadables[g.name]
+		if !ok {
+			d = &downloadable{name: g.name, mu: &sync.RWMutex{}}
+			ad.downloadables[g.name] = d
+		}
+		d.url = g.url
+
+		src := filepath.Join(ad.localGPOsDir, "Policies", filepath.Base(g.url))
+		if err := func() error {
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			return copyDir(src, filepath.Join(ad.sysvolCacheDir, "Policies", filepath.Base(g.url)))
+		}(); err != nil {
+			return false, err
+		}
+	}
+
+	// Assets are in <root>/DistroID, like on SYSVOL
+	assetsSrc := filepath.Join(ad.localGPOsDir, consts.DistroID)
+	assetsDest := filepath.Join(ad.sysvolCacheDir, "assets")
+	if _, err := os.Stat(assetsSrc); errors.Is(err, fs.ErrNotExist) {
+		log.Info(ctx, "No assets directory found in local GPOs, skipping assets copy")
+		if _, err := os.Stat(assetsDest); err != nil {
+			return false, nil
+		}
+		return true, os.RemoveAll(assetsDest)
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, copyDir(assetsSrc, assetsDest)
+}
+
+// copyDir copies the directory src to dest in a temporary directory, and only commits it once fully copied.
+func copyDir(src, dest string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("copy of %q failed", src))
+
+	tmpdest, err := os.MkdirTemp(filepath.Dir(dest), fmt.Sprintf("%s.*", filepath.Base(dest)))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpdest); err != nil {
+			log.Info(context.Background(), gotext.Get("Could not clean up temporary directory:"), err)
+		}
+	}()
+
+	err = filepath.WalkDir(src, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(tmpdest, rel)
+
+		switch {
+		case de.IsDir():
+			return os.MkdirAll(target, 0700)
+		case de.Type().IsRegular():
+			return copyFile(p, target)
+		default:
+			return errors.New(gotext.Get("unsupported type %q for entry %s", de.Type(), p))
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	return os.Rename(tmpdest, dest)
+}
+
+// copyFile copies the regular file src to dest.
+func copyFile(src, dest string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer decorate.LogFuncOnError(in.Close)
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
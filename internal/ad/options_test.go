@@ -1,5 +1,11 @@
 package ad
 
+import (
+	"context"
+
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+)
+
 func withoutKerberos() Option {
 	return func(o *options) error {
 		o.withoutKerberos = true
@@ -14,6 +20,22 @@ func withGPOListCmd(cmd []string) Option {
 	}
 }
 
+func withKinitCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.kinitCmd = cmd
+		return nil
+	}
+}
+
+// WithDCLocator specifies the DNS resolver to find the domain controllers from and how to probe them.
+func WithDCLocator(r dclocator.Resolver, probe func(ctx context.Context, dc string) error) Option {
+	return func(o *options) error {
+		o.dcResolver = r
+		o.probeDC = probe
+		return nil
+	}
+}
+
 // WithVersionID specifies a personalized release id.
 func WithVersionID(versionID string) Option {
 	return func(o *options) error {
@@ -0,0 +1,157 @@
+package ad
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/dclocator"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+)
+
+// dcProbeTimeout is the time given to a domain controller to accept a connection when probing it.
+const dcProbeTimeout = 2 * time.Second
+
+// serverCandidates returns the servers of domain to try in order: preferred, returned by the backend, then the other
+// domain controllers advertised in DNS for the site of the machine and for the domain.
+// When there are several of them, the ones which are reachable come first.
+func (ad *AD) serverCandidates(ctx context.Context, domain, preferred string) []string {
+	servers := []string{preferred}
+	dcs, err := dclocator.Candidates(ctx, ad.dcResolver, domain, ad.configBackend.Site())
+	if err != nil {
+		log.Debugf(ctx, "No other server to fail over to: %v", err)
+		return servers
+	}
+	for _, dc := range dcs {
+		if strings.EqualFold(dc, preferred) {
+			continue
+		}
+		servers = append(servers, dc)
+	}
+	if len(servers) == 1 {
+		return servers
+	}
+
+	reachable := make([]bool, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ad.probeDC(ctx, server); err != nil {
+				log.Debug(ctx, err)
+				return
+			}
+			reachable[i] = true
+		}()
+	}
+	wg.Wait()
+
+	// Unreachable servers are still tried last, as the probe only checks the LDAP port
+	var ordered, unreachable []string
+	for i, server := range servers {
+		if !reachable[i] {
+			unreachable = append(unreachable, server)
+			continue
+		}
+		ordered = append(ordered, server)
+	}
+	ordered = append(ordered, unreachable...)
+	log.Debugf(ctx, "Servers of %q to try in order: %s", domain, strings.Join(ordered, ", "))
+	return ordered
+}
+
+// listGPOsWithFailover lists the GPOs of objectName from the first of servers answering. It returns the servers left
+// to try, starting with the one which answered.
+func (ad *AD) listGPOsWithFailover(ctx context.Context, servers []string, krb5CCPath, objectName string, objectClass ObjectClass) (gpos []gpo, remaining []string, err error) {
+	for i, server := range servers {
+		gpos, err = func() ([]gpo, error) {
+			listCtx, cancel := context.WithTimeout(ctx, ad.gpoListTimeout)
+			defer cancel()
+			return ad.gpoLister.listGPOs(listCtx, krb5CCPath, server, objectName, objectClass)
+		}()
+		if err == nil {
+			return gpos, servers[i:], nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(servers)-1 {
+			log.Warningf(ctx, "Can't list GPOs from %q, trying %q: %v", server, servers[i+1], err)
+		}
+	}
+	return nil, nil, err
+}
+
+// fetchWithFailover downloads the downloadables of domain, as listed from the first of servers. It downloads them
+// again from the next servers on failure. It returns if the assets were refreshed and the server used.
+func (ad *AD) fetchWithFailover(ctx context.Context, krb5Ticket, domain string, servers []string, downloadables map[string]string) (assetsWereRefreshed bool, usedServer string, err error) {
+	for i, server := range servers {
+		if i > 0 {
+			if downloadables, err = withServer(downloadables, server); err != nil {
+				return assetsWereRefreshed, "", err
+			}
+		}
+
+		// Assets can have been refreshed by a failed attempt
+		var refreshed bool
+		refreshed, err = ad.fetch(ctx, krb5Ticket, domain, downloadables)
+		assetsWereRefreshed = assetsWereRefreshed || refreshed
+		if err == nil {
+			return assetsWereRefreshed, server, nil
+		}
+		if ctx.Err() != nil || i == len(servers)-1 {
+			return assetsWereRefreshed, "", err
+		}
+		log.Warningf(ctx, "Can't download from %q, trying %q: %v", server, servers[i+1], err)
+	}
+	return assetsWereRefreshed, "", errors.New(gotext.Get("no server to download from"))
+}
+
+// withServer returns the downloadables with their URLs pointing to server.
+func withServer(downloadables map[string]string, server string) (map[string]string, error) {
+	r := make(map[string]string)
+	for name, u := range downloadables {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, err
+		}
+		parsed.Host = server
+		r[name] = parsed.String()
+	}
+	return r, nil
+}
+
+// setUsedServer records server as the last one used for domain, or for the backend domain if empty.
+func (ad *AD) setUsedServer(domain, server string) {
+	ad.usedServersMu.Lock()
+	defer ad.usedServersMu.Unlock()
+	ad.usedServers[domain] = server
+}
+
+// usedServersInfo returns the last server used for each domain, one per line.
+func (ad *AD) usedServersInfo() string {
+	ad.usedServersMu.Lock()
+	defer ad.usedServersMu.Unlock()
+
+	domains := make([]string, 0, len(ad.usedServers))
+	for d := range ad.usedServers {
+		domains = append(domains, d)
+	}
+	sort.Strings(domains)
+
+	var lines []string
+	for _, d := range domains {
+		if d == "" {
+			lines = append(lines, gotext.Get("Last used server: %s", ad.usedServers[d]))
+			continue
+		}
+		lines = append(lines, gotext.Get("Last used server of %s: %s", d, ad.usedServers[d]))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,83 @@
+package ad
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad/krb5cc"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+// renewKrb5CC renews the ticket granting ticket of the krb5CCPath cache copy once half of its lifetime has elapsed,
+// so that it doesn't expire between two refreshes.
+// Tickets which can't be read or renewed are left untouched: the original ticket is copied again once refreshed.
+func (ad *AD) renewKrb5CC(ctx context.Context, krb5CCPath string) {
+	ad.Lock()
+	defer ad.Unlock()
+
+	tgt, err := krb5cc.TGT(krb5CCPath)
+	if err != nil {
+		log.Debugf(ctx, "Not renewing ticket: %v", err)
+		return
+	}
+
+	now := time.Now()
+	if tgt.Expired(now) {
+		log.Warningf(ctx, "Ticket of %s expired on %s and can't be renewed", tgt.Principal, tgt.EndTime.Format(time.DateTime))
+		return
+	}
+	if !tgt.Renewable(now) {
+		log.Debugf(ctx, "Ticket of %s is not renewable", tgt.Principal)
+		return
+	}
+	if now.Before(tgt.StartTime.Add(tgt.EndTime.Sub(tgt.StartTime) / 2)) {
+		return
+	}
+
+	if err := ad.renew(krb5CCPath); err != nil {
+		log.Warningf(ctx, "Can't renew ticket of %s expiring on %s: %v", tgt.Principal, tgt.EndTime.Format(time.DateTime), err)
+		return
+	}
+	log.Infof(ctx, "Renewed ticket of %s", tgt.Principal)
+}
+
+// renew renews the ticket granting ticket of the krb5CCPath cache with kinit.
+// The renewal is done on a copy, replacing the cache atomically once successful.
+func (ad *AD) renew(krb5CCPath string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't renew %s", krb5CCPath))
+
+	renewed := krb5CCPath + ".renew"
+	if err := safeCopyFile(krb5CCPath, renewed, 0600); err != nil {
+		return err
+	}
+	defer func() {
+		if err := os.Remove(renewed); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warningf(context.Background(), "Can't remove %s: %v", renewed, err)
+		}
+	}()
+
+	cmdArgs := append(append([]string{}, ad.kinitCmd...), "-R", "-c", "FILE:"+renewed)
+	smbsafe.WaitExec()
+	out, err := exec.Command(cmdArgs[0], cmdArgs[1:]...).CombinedOutput()
+	smbsafe.DoneExec()
+	if err != nil {
+		return errors.New(gotext.Get("%v: %s", err, out))
+	}
+
+	return os.Rename(renewed, krb5CCPath)
+}
+
+// Krb5Ticket returns the ticket granting ticket used for objectName.
+func (ad *AD) Krb5Ticket(objectName string) (krb5cc.Ticket, error) {
+	ad.RLock()
+	defer ad.RUnlock()
+
+	return krb5cc.TGT(filepath.Join(ad.krb5CacheDir, objectName))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/godbus/dbus/v5"
@@ -15,6 +16,7 @@ import (
 	"github.com/ubuntu/adsys"
 	"github.com/ubuntu/adsys/internal/ad"
 	"github.com/ubuntu/adsys/internal/ad/backends"
+	"github.com/ubuntu/adsys/internal/ad/backends/keytab"
 	"github.com/ubuntu/adsys/internal/ad/backends/sss"
 	"github.com/ubuntu/adsys/internal/ad/backends/winbind"
 	"github.com/ubuntu/adsys/internal/authorizer"
@@ -42,6 +44,12 @@ type Service struct {
 	state          state
 	initSystemTime *time.Time
 
+	fastLogin FastLoginConfig
+	// backgroundCtx is the context of the policies refreshes running after the request which started them ended.
+	backgroundCtx    context.Context
+	cancelBackground context.CancelFunc
+	background       sync.WaitGroup
+
 	bus    *dbus.Conn
 	daemon *daemon.Daemon
 }
@@ -70,9 +78,14 @@ type options struct {
 	systemUnitDir  string
 	globalTrustDir string
 	adBackend      string
+	gpoList        string
+	localGPODir    string
 	sssConfig      sss.Config
 	winbindConfig  winbind.Config
+	keytabConfig   keytab.Config
+	fastLogin      FastLoginConfig
 	authorizer     authorizerer
+	policyOptions  []policies.Option
 }
 type option func(*options) error
 
@@ -170,6 +183,22 @@ func WithADBackend(backend string) func(o *options) error {
 	}
 }
 
+// WithGpoList specifies how to list the GPOs applying to an object.
+func WithGpoList(gpoList string) func(o *options) error {
+	return func(o *options) error {
+		o.gpoList = gpoList
+		return nil
+	}
+}
+
+// WithLocalGPODir specifies a local directory, laid out like SYSVOL, to read the GPOs from instead of AD.
+func WithLocalGPODir(p string) func(o *options) error {
+	return func(o *options) error {
+		o.localGPODir = p
+		return nil
+	}
+}
+
 // WithSSSConfig specifies our specific sss options to override.
 func WithSSSConfig(c sss.Config) func(o *options) error {
 	return func(o *options) error {
@@ -186,6 +215,14 @@ func WithWinbindConfig(c winbind.Config) func(o *options) error {
 	}
 }
 
+// WithKeytabConfig specifies our specific keytab options to override.
+func WithKeytabConfig(c keytab.Config) func(o *options) error {
+	return func(o *options) error {
+		o.keytabConfig = c
+		return nil
+	}
+}
+
 // New returns a new instance of an AD service.
 // If url or domain is empty, we load the missing parameters from sssd.conf, taking first
 // domain in the list if not provided.
@@ -241,6 +278,17 @@ func New(ctx context.Context, opts ...option) (s *Service, err error) {
 		adOptions = append(adOptions, ad.WithRunDir(args.runDir))
 	}
 	adOptions = append(adOptions, ad.WithGpoListTimeout(consts.DefaultGpoListTimeout))
+	switch args.gpoList {
+	default:
+		log.Warningf(ctx, "Unknown configured GPO list method %q. Defaulting to ldap.", args.gpoList)
+	case "", "ldap":
+	case "script":
+		adOptions = append(adOptions, ad.WithGpoListScript())
+	}
+	if args.localGPODir != "" {
+		log.Infof(ctx, "Reading GPOs from local directory %q instead of Active Directory", args.localGPODir)
+		adOptions = append(adOptions, ad.WithLocalGPOs(args.localGPODir))
+	}
 
 	hostname, err := os.Hostname()
 	if err != nil {
@@ -261,6 +309,8 @@ func New(ctx context.Context, opts ...option) (s *Service, err error) {
 		adBackend, err = sss.New(ctx, args.sssConfig, bus)
 	case "winbind":
 		adBackend, err = winbind.New(ctx, args.winbindConfig, hostname)
+	case "keytab":
+		adBackend, err = keytab.New(ctx, args.keytabConfig, hostname)
 	}
 	if err != nil {
 		return nil, errors.New(gotext.Get("could not initialize AD backend: %v", err))
@@ -310,6 +360,7 @@ func New(ctx context.Context, opts ...option) (s *Service, err error) {
 	if args.globalTrustDir != "" {
 		policyOptions = append(policyOptions, policies.WithGlobalTrustDir(args.globalTrustDir))
 	}
+	policyOptions = append(policyOptions, args.policyOptions...)
 	m, err := policies.NewManager(bus, hostname, adBackend, policyOptions...)
 	if err != nil {
 		return nil, err
@@ -318,6 +369,8 @@ func New(ctx context.Context, opts ...option) (s *Service, err error) {
 	// Init system reference time
 	initSysTime := initSystemTime(bus)
 
+	backgroundCtx, cancelBackground := context.WithCancel(context.Background())
+
 	return &Service{
 		adc:           adc,
 		policyManager: m,
@@ -333,8 +386,11 @@ func New(ctx context.Context, opts ...option) (s *Service, err error) {
 			systemUnitDir:  args.systemUnitDir,
 			globalTrustDir: args.globalTrustDir,
 		},
-		initSystemTime: initSysTime,
-		bus:            bus,
+		initSystemTime:   initSysTime,
+		fastLogin:        args.fastLogin,
+		backgroundCtx:    backgroundCtx,
+		cancelBackground: cancelBackground,
+		bus:              bus,
 	}, nil
 }
 
@@ -355,6 +411,9 @@ func (s *Service) RegisterGRPCServer(d *daemon.Daemon) *grpc.Server {
 
 // Quit cleans every ressources than the service was using.
 func (s *Service) Quit(ctx context.Context) {
+	s.cancelBackground()
+	s.background.Wait()
+
 	if err := s.bus.Close(); err != nil {
 		log.Warning(ctx, gotext.Get("Can't disconnect system dbus: %v", err))
 	}
@@ -123,6 +123,31 @@ func TestNew(t *testing.T) {
 	}
 }
 
+// newService returns a new service writing in a temporary directory, with given additional options.
+func newService(t *testing.T, opts ...adsysservice.Option) *adsysservice.Service {
+	t.Helper()
+
+	temp := t.TempDir()
+	options := []adsysservice.Option{
+		adsysservice.WithCacheDir(filepath.Join(temp, "cache")),
+		adsysservice.WithStateDir(filepath.Join(temp, "lib")),
+		adsysservice.WithRunDir(filepath.Join(temp, "run")),
+		adsysservice.WithDconfDir(filepath.Join(temp, "dconf")),
+		adsysservice.WithSudoersDir(filepath.Join(temp, "sudoers.d")),
+		adsysservice.WithPolicyKitDir(filepath.Join(temp, "polkit-1")),
+		adsysservice.WithApparmorDir(filepath.Join(temp, "apparmor.d", "adsys")),
+		adsysservice.WithApparmorFsDir(filepath.Join(temp, "apparmorfs")),
+		adsysservice.WithGlobalTrustDir(filepath.Join(temp, "ca-certificates")),
+		adsysservice.WithSSSConfig(sss.Config{Conf: "testdata/sssd.conf", CacheDir: t.TempDir()}),
+	}
+
+	s, err := adsysservice.New(context.Background(), append(options, opts...)...)
+	require.NoError(t, err, "Setup: New should not return an error")
+	t.Cleanup(func() { s.Quit(context.Background()) })
+
+	return s
+}
+
 func TestMain(m *testing.M) {
 	// export SSSD domain
 	defer testutils.StartLocalSystemBus()()
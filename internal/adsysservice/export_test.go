@@ -3,6 +3,8 @@ package adsysservice
 import (
 	"context"
 	"strings"
+
+	"github.com/ubuntu/adsys/internal/policies"
 )
 
 // Option type exported for tests.
@@ -22,3 +24,19 @@ func (s *Service) SelectedBackend() string {
 
 	return backend
 }
+
+// WithAuthorizer specifies a personalized authorizer for tests.
+func WithAuthorizer(a authorizerer) func(o *options) error {
+	return func(o *options) error {
+		o.authorizer = a
+		return nil
+	}
+}
+
+// WithPolicyOptions specifies additional options for the policy manager in tests.
+func WithPolicyOptions(opts ...policies.Option) func(o *options) error {
+	return func(o *options) error {
+		o.policyOptions = append(o.policyOptions, opts...)
+		return nil
+	}
+}
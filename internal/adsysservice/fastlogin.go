@@ -0,0 +1,142 @@
+package adsysservice
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"slices"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/ad"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies"
+	"github.com/ubuntu/decorate"
+)
+
+// FastLoginConfig is the configuration of the fast login mode.
+// When enabled, the cached policies of a user logging in are applied right away and refreshed in the background.
+type FastLoginConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// LazyManagers are the policy types which can be applied from the cache.
+	// The login waits for the refreshed policies if the cached ones contain any other policy type.
+	LazyManagers []string `mapstructure:"lazy_managers"`
+}
+
+// defaultLazyManagers are the policy types applied from the cache at login when none are configured.
+// Security related policies, like privileges or apparmor, are always refreshed first.
+var defaultLazyManagers = []string{"dconf", "mount", "scripts", "proxy"}
+
+// WithFastLogin specifies the fast login configuration.
+func WithFastLogin(c FastLoginConfig) func(o *options) error {
+	return func(o *options) error {
+		o.fastLogin = c
+		return nil
+	}
+}
+
+// applyCachedPolicies applies the cached policies of the user target and refreshes them in the background.
+// It returns false when the policies need to be fetched before the login proceeds: there is no cache, the cached
+// policies contain rules of a manager which can't be applied lazily, or they can't be applied.
+func (s *Service) applyCachedPolicies(ctx context.Context, target, krb5cc string) bool {
+	cached, err := s.adc.GetCachedPolicies(ctx, target)
+	if err != nil {
+		log.Infof(ctx, "Fetching policies of %s before login: %v", target, err)
+		return false
+	}
+
+	lazyManagers := s.fastLogin.LazyManagers
+	if len(lazyManagers) == 0 {
+		lazyManagers = defaultLazyManagers
+	}
+	for policyType := range cached.GetUniqueRules() {
+		if !slices.Contains(lazyManagers, policyType) {
+			log.Infof(ctx, "Fetching policies of %s before login: %s policies can't be applied from cache", target, policyType)
+			decorate.LogFuncOnError(cached.Close)
+			return false
+		}
+	}
+
+	if err := s.policyManager.ApplyPolicies(ctx, target, false, &cached, false); err != nil {
+		log.Warningf(ctx, "Fetching policies of %s before login: %v", target, err)
+		decorate.LogFuncOnError(cached.Close)
+		return false
+	}
+	log.Infof(ctx, "Applied cached policies of %s, refreshing them in the background", target)
+
+	s.refreshInBackground(target, krb5cc, cached)
+	return true
+}
+
+// refreshInBackground fetches and applies the policies of the user target without blocking the caller.
+// The daemon is kept alive during the refresh, and the user is notified if the policies changed from cached.
+func (s *Service) refreshInBackground(target, krb5cc string, cached policies.Policies) {
+	ctx := s.backgroundCtx
+	// Notify before returning to the client, so that the daemon doesn't idle out.
+	if s.daemon != nil {
+		s.daemon.OnNewConnection(ctx, nil)
+	}
+	s.background.Add(1)
+
+	go func() {
+		defer s.background.Done()
+		if s.daemon != nil {
+			defer s.daemon.OnDoneConnection(ctx, nil)
+		}
+		defer decorate.LogFuncOnError(cached.Close)
+
+		pols, err := s.adc.GetPolicies(ctx, target, ad.UserObject, krb5cc)
+		if err != nil {
+			log.Warningf(ctx, "Can't refresh policies of %s, cached ones are kept: %v", target, err)
+			return
+		}
+
+		changed, err := pols.ChangedPolicyTypes(&cached)
+		if err != nil {
+			log.Warningf(ctx, "Refreshing policies of %s: %v", target, err)
+		}
+
+		if err := s.policyManager.ApplyPolicies(ctx, target, false, &pols, false); err != nil {
+			log.Warningf(ctx, "Can't apply refreshed policies of %s: %v", target, err)
+			return
+		}
+		if len(changed) == 0 {
+			log.Infof(ctx, "Refreshed policies of %s did not change from cache", target)
+			return
+		}
+
+		log.Infof(ctx, "Refreshed policies of %s changed: %s", target, strings.Join(changed, ", "))
+		if err := notifyUser(ctx, target, gotext.Get("Your policies were updated"),
+			gotext.Get("Some %s settings changed since your last login. They may only apply fully in a new session.",
+				strings.Join(changed, ", "))); err != nil {
+			log.Warningf(ctx, "Refreshed policies of %s changed: %v", target, err)
+		}
+	}()
+}
+
+// notifyUser shows a desktop notification in the session of username through its session bus.
+func notifyUser(ctx context.Context, username, summary, body string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't notify %s", username))
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+
+	bus, err := dbus.Dial(fmt.Sprintf("unix:path=/run/user/%s/bus", u.Uid))
+	if err != nil {
+		return err
+	}
+	defer decorate.LogFuncOnError(bus.Close)
+	if err := bus.Auth(nil); err != nil {
+		return err
+	}
+	if err := bus.Hello(); err != nil {
+		return err
+	}
+
+	return bus.Object("org.freedesktop.Notifications", "/org/freedesktop/Notifications").CallWithContext(ctx,
+		"org.freedesktop.Notifications.Notify", 0,
+		"adsys", uint32(0), "", summary, body, []string{}, map[string]dbus.Variant{}, int32(-1)).Err
+}
@@ -0,0 +1,210 @@
+package adsysservice_test
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys"
+	"github.com/ubuntu/adsys/internal/adsysservice"
+	"github.com/ubuntu/adsys/internal/authorizer"
+	"github.com/ubuntu/adsys/internal/policies"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"google.golang.org/grpc"
+)
+
+var (
+	dconfRule     = entry.Entry{Key: "org/gnome/desktop/interface/clock-format", Value: "'24h'", Meta: "s"}
+	privilegeRule = entry.Entry{Key: "allow-local-admins", Disabled: true}
+)
+
+func TestUpdatePolicyAtLogin(t *testing.T) {
+	t.Parallel()
+
+	logs := logrustest.NewGlobal()
+
+	tests := map[string]struct {
+		cachedRules  map[string][]entry.Entry
+		noCache      bool
+		lazyManagers []string
+		noManifest   bool
+
+		wantFromCache  bool
+		wantRefreshLog string
+	}{
+		"Cached policies of lazy types are applied and refreshed in the background": {
+			cachedRules:    map[string][]entry.Entry{"dconf": {dconfRule}},
+			wantFromCache:  true,
+			wantRefreshLog: "changed: dconf",
+		},
+		"Cached policies of configured lazy types are applied and refreshed in the background": {
+			cachedRules:    map[string][]entry.Entry{"privilege": {privilegeRule}},
+			lazyManagers:   []string{"privilege"},
+			wantFromCache:  true,
+			wantRefreshLog: "changed: privilege",
+		},
+		"Refreshed policies identical to cached ones do not notify": {
+			wantFromCache:  true,
+			wantRefreshLog: "did not change from cache",
+		},
+		"Cached policies are kept when they can't be refreshed": {
+			cachedRules:    map[string][]entry.Entry{"dconf": {dconfRule}},
+			noManifest:     true,
+			wantFromCache:  true,
+			wantRefreshLog: "cached ones are kept",
+		},
+
+		// Blocking updates
+		"Policies are fetched before login without cache": {noCache: true},
+		"Policies are fetched before login when cached ones contain a non lazy type": {
+			cachedRules: map[string][]entry.Entry{"dconf": {dconfRule}, "privilege": {privilegeRule}},
+		},
+		"Policies are fetched before login when cached ones are not of configured lazy types": {
+			cachedRules:  map[string][]entry.Entry{"dconf": {dconfRule}},
+			lazyManagers: []string{"mount"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			// Each test has its own user to only check its own logs.
+			target := strings.ToLower(strings.ReplaceAll(name, " ", "")) + "@example.com"
+
+			s, dconfDir := newFastLoginService(t, target, tc.cachedRules, tc.noCache, tc.noManifest, tc.lazyManagers)
+
+			err := s.UpdatePolicy(&adsys.UpdatePolicyRequest{Target: target, Login: true}, &updatePolicyStream{ctx: context.Background()})
+			require.NoError(t, err, "UpdatePolicy should not return an error")
+
+			if !tc.wantFromCache {
+				require.True(t, hasLog(logs, "Fetching policies of "+target+" before login"), "Policies should be fetched before login")
+				require.False(t, hasLog(logs, "Applied cached policies of "+target), "Cached policies should not be applied")
+				return
+			}
+			require.True(t, hasLog(logs, "Applied cached policies of "+target), "Cached policies should be applied")
+
+			require.Eventually(t, func() bool {
+				return hasLog(logs, target, tc.wantRefreshLog)
+			}, 10*time.Second, 10*time.Millisecond, "Policies should be refreshed in the background")
+
+			// Only changes are notified to the user
+			notified := hasLog(logs, "Refreshed policies of "+target+" changed")
+			require.Equal(t, strings.HasPrefix(tc.wantRefreshLog, "changed"), notified, "User should only be notified of changed policies")
+
+			if tc.noManifest {
+				require.FileExists(t, filepath.Join(dconfDir, "db", target+".d", "adsys"), "Cached dconf policy should be kept")
+			}
+		})
+	}
+}
+
+func TestQuitWaitsForBackgroundRefresh(t *testing.T) {
+	t.Parallel()
+
+	logs := logrustest.NewGlobal()
+	target := "quitwaitsforbackgroundrefresh@example.com"
+
+	s, _ := newFastLoginService(t, target, map[string][]entry.Entry{"dconf": {dconfRule}}, false, false, nil)
+
+	err := s.UpdatePolicy(&adsys.UpdatePolicyRequest{Target: target, Login: true}, &updatePolicyStream{ctx: context.Background()})
+	require.NoError(t, err, "UpdatePolicy should not return an error")
+	require.True(t, hasLog(logs, "Applied cached policies of "+target), "Cached policies should be applied")
+
+	s.Quit(context.Background())
+
+	done := hasLog(logs, "Refreshed policies of "+target) || hasLog(logs, "policies of "+target, "cached ones are kept") ||
+		hasLog(logs, "Can't apply refreshed policies of "+target)
+	require.True(t, done, "Quit should wait for the background refresh to end")
+}
+
+// newFastLoginService returns a service with fast login enabled, reading the GPOs from an empty local source.
+// The cached policies of target are created with cachedRules, unless noCache is set. The local GPO source has no
+// manifest, failing the policies refresh, if noManifest is set.
+// It returns the service and its dconf directory.
+func newFastLoginService(t *testing.T, target string, cachedRules map[string][]entry.Entry, noCache, noManifest bool, lazyManagers []string) (*adsysservice.Service, string) {
+	t.Helper()
+
+	temp := t.TempDir()
+	cacheDir := filepath.Join(temp, "cache")
+	dconfDir := filepath.Join(temp, "dconf")
+	localDir := filepath.Join(temp, "gpos")
+
+	// User dconf policies require the machine ones.
+	require.NoError(t, os.MkdirAll(filepath.Join(dconfDir, "db", "machine.d", "locks"), 0750), "Setup: can't create machine dconf database")
+	require.NoError(t, os.WriteFile(filepath.Join(dconfDir, "db", "machine.d", "locks", "adsys"), nil, 0600), "Setup: can't create machine dconf locks")
+
+	require.NoError(t, os.MkdirAll(localDir, 0750), "Setup: can't create local GPOs directory")
+	if !noManifest {
+		require.NoError(t, os.WriteFile(filepath.Join(localDir, "gpos.yaml"), []byte("user: []\n"), 0600),
+			"Setup: can't write local GPOs manifest")
+	}
+
+	if !noCache {
+		var gpos []policies.GPO
+		if cachedRules != nil {
+			gpos = append(gpos, policies.GPO{ID: "cached", Name: "cached", Rules: cachedRules})
+		}
+		pols, err := policies.New(context.Background(), gpos, "")
+		require.NoError(t, err, "Setup: can't create cached policies")
+		require.NoError(t, pols.Save(filepath.Join(cacheDir, "policies", target)), "Setup: can't save cached policies")
+	}
+
+	s := newService(t,
+		adsysservice.WithCacheDir(cacheDir),
+		adsysservice.WithDconfDir(dconfDir),
+		adsysservice.WithLocalGPODir(localDir),
+		adsysservice.WithFastLogin(adsysservice.FastLoginConfig{Enabled: true, LazyManagers: lazyManagers}),
+		adsysservice.WithAuthorizer(allowAllAuthorizer{}),
+		adsysservice.WithPolicyOptions(policies.WithUserLookup(func(string) (*user.User, error) {
+			return &user.User{Uid: strconv.Itoa(os.Getuid()), Gid: strconv.Itoa(os.Getgid())}, nil
+		})))
+
+	return s, dconfDir
+}
+
+// hasLog returns if a logged message contains all of parts.
+func hasLog(logs *logrustest.Hook, parts ...string) bool {
+	for _, e := range logs.AllEntries() {
+		if e.Level > logrus.InfoLevel {
+			continue
+		}
+		found := true
+		for _, p := range parts {
+			if !strings.Contains(e.Message, p) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+type allowAllAuthorizer struct{}
+
+func (allowAllAuthorizer) IsAllowedFromContext(context.Context, authorizer.Action) error {
+	return nil
+}
+
+type updatePolicyStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *updatePolicyStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *updatePolicyStream) Send(*adsys.StringResponse) error {
+	return nil
+}
@@ -2,7 +2,10 @@ package adsysservice
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/leonelquinteros/gotext"
 	"github.com/ubuntu/adsys"
@@ -18,6 +21,7 @@ import (
 
 // UpdatePolicy refreshes or creates a policy for current user or user given as argument.
 // It can purge the policy instead of updating it if requested.
+// In dry run mode, the changes which would be made are streamed to the client, without being applied.
 func (s *Service) UpdatePolicy(r *adsys.UpdatePolicyRequest, stream adsys.Service_UpdatePolicyServer) (err error) {
 	defer decorate.OnError(&err, gotext.Get("error while updating policy"))
 
@@ -41,10 +45,21 @@ func (s *Service) UpdatePolicy(r *adsys.UpdatePolicyRequest, stream adsys.Servic
 		return err
 	}
 
+	// Planned changes for multiple objects can be sent concurrently.
+	var sendMu sync.Mutex
+	sendPlan := func(msg string) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if err := stream.Send(&adsys.StringResponse{Msg: msg}); err != nil {
+			return errors.New(gotext.Get("couldn't send planned changes to client: %v", err))
+		}
+		return nil
+	}
+
 	if r.GetIsComputer() || r.GetAll() {
 		hostname := s.adc.Hostname()
 
-		err = s.updatePolicyFor(stream.Context(), true, hostname, ad.ComputerObject, "", r.GetPurge())
+		err = s.updatePolicyFor(stream.Context(), true, hostname, ad.ComputerObject, "", r.GetPurge(), r.GetDryRun(), r.GetForce(), sendPlan)
 
 		if r.GetAll() {
 			users, err := s.adc.ListUsers(stream.Context(), !r.GetPurge())
@@ -54,7 +69,7 @@ func (s *Service) UpdatePolicy(r *adsys.UpdatePolicyRequest, stream adsys.Servic
 			errg := new(errgroup.Group)
 			for _, user := range users {
 				errg.Go(func() (err error) {
-					return s.updatePolicyFor(stream.Context(), false, user, ad.UserObject, "", r.GetPurge())
+					return s.updatePolicyFor(stream.Context(), false, user, ad.UserObject, "", r.GetPurge(), r.GetDryRun(), r.GetForce(), sendPlan)
 				})
 			}
 			if err := errg.Wait(); err != nil {
@@ -64,12 +79,19 @@ func (s *Service) UpdatePolicy(r *adsys.UpdatePolicyRequest, stream adsys.Servic
 
 		return err
 	}
-	// Update a single user
-	return s.updatePolicyFor(stream.Context(), r.GetIsComputer(), target, objectClass, r.Krb5Cc, r.GetPurge())
+	// Update a single user, applying first the cached policies when logging in
+	if r.GetLogin() && s.fastLogin.Enabled && !r.GetPurge() && !r.GetDryRun() {
+		if s.applyCachedPolicies(stream.Context(), target, r.Krb5Cc) {
+			return nil
+		}
+	}
+	return s.updatePolicyFor(stream.Context(), r.GetIsComputer(), target, objectClass, r.Krb5Cc, r.GetPurge(), r.GetDryRun(), r.GetForce(), sendPlan)
 }
 
 // updatePolicyFor updates the policy for a given object.
-func (s *Service) updatePolicyFor(ctx context.Context, isComputer bool, target string, objectClass ad.ObjectClass, krb5cc string, purge bool) (err error) {
+// If dryRun is true, the planned changes are passed to sendPlan instead of being applied.
+// If force is true, policies which did not change since last update are applied again.
+func (s *Service) updatePolicyFor(ctx context.Context, isComputer bool, target string, objectClass ad.ObjectClass, krb5cc string, purge, dryRun, force bool, sendPlan func(string) error) (err error) {
 	var pols policies.Policies
 	if !purge {
 		pols, err = s.adc.GetPolicies(ctx, target, objectClass, krb5cc)
@@ -78,7 +100,17 @@ func (s *Service) updatePolicyFor(ctx context.Context, isComputer bool, target s
 		}
 	}
 
-	return s.policyManager.ApplyPolicies(ctx, target, isComputer, &pols)
+	if dryRun {
+		changes, err := s.policyManager.PlanPolicies(ctx, target, isComputer, &pols)
+		if err != nil {
+			return err
+		}
+		var out strings.Builder
+		policies.FormatPlan(&out, target, changes)
+		return sendPlan(out.String())
+	}
+
+	return s.policyManager.ApplyPolicies(ctx, target, isComputer, &pols, force)
 }
 
 // DumpPolicies displays all applied policies for a given user.
@@ -103,7 +135,7 @@ func (s *Service) DumpPolicies(r *adsys.DumpPoliciesRequest, stream adsys.Servic
 		}
 	}
 
-	msg, err := s.policyManager.DumpPolicies(stream.Context(), target, r.GetIsComputer(), r.GetDetails(), r.GetAll())
+	msg, err := s.policyManager.DumpPolicies(stream.Context(), target, r.GetIsComputer(), r.GetDetails(), r.GetAll(), r.GetFormat())
 	if err != nil {
 		return err
 	}
@@ -116,6 +148,230 @@ func (s *Service) DumpPolicies(r *adsys.DumpPoliciesRequest, stream adsys.Servic
 	return nil
 }
 
+// ExplainPolicy displays every GPO defining a key for current user or user given as argument, and which one won.
+func (s *Service) ExplainPolicy(r *adsys.ExplainPolicyRequest, stream adsys.Service_ExplainPolicyServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while explaining policy"))
+
+	target, err := s.dumpTarget(stream.Context(), r.GetTarget(), r.GetIsComputer())
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.policyManager.ExplainPolicy(stream.Context(), target, r.GetIsComputer(), r.GetKey())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&adsys.StringResponse{
+		Msg: msg,
+	}); err != nil {
+		log.Warningf(stream.Context(), "couldn't send policy explanation to client: %v", err)
+	}
+
+	return nil
+}
+
+// PoliciesReport returns the resultant set of policies of the machine and of current user or user given as argument.
+func (s *Service) PoliciesReport(r *adsys.PoliciesReportRequest, stream adsys.Service_PoliciesReportServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while generating policies report"))
+
+	target, err := s.dumpTarget(stream.Context(), r.GetTarget(), r.GetIsComputer())
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.policyManager.Report(stream.Context(), target, r.GetIsComputer(), s.adc.GetInfo(stream.Context()), r.GetFormat())
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&adsys.StringResponse{
+		Msg: msg,
+	}); err != nil {
+		log.Warningf(stream.Context(), "couldn't send policies report to client: %v", err)
+	}
+
+	return nil
+}
+
+// PoliciesStatus displays the outcome of the last application of each policy manager to the current user,
+// user given as argument or the machine.
+func (s *Service) PoliciesStatus(r *adsys.PoliciesStatusRequest, stream adsys.Service_PoliciesStatusServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while getting policies status"))
+
+	target, err := s.dumpTarget(stream.Context(), r.GetTarget(), r.GetIsComputer())
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.policyManager.PoliciesStatus(stream.Context(), target)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&adsys.StringResponse{
+		Msg: msg,
+	}); err != nil {
+		log.Warningf(stream.Context(), "couldn't send policies status to client: %v", err)
+	}
+
+	return nil
+}
+
+// CheckPoliciesDrift reports the files owned by the policy managers which changed since policies were applied to
+// current user, user given as argument, the machine or the machine and all connected users.
+// Drifted policies can be applied again from the cache if requested.
+func (s *Service) CheckPoliciesDrift(r *adsys.CheckPoliciesDriftRequest, stream adsys.Service_CheckPoliciesDriftServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while checking policies drift"))
+
+	objectClass := ad.UserObject
+	if r.GetIsComputer() || r.GetAll() {
+		objectClass = ad.ComputerObject
+	}
+	target, err := s.adc.NormalizeTargetName(stream.Context(), r.GetTarget(), objectClass)
+	if err != nil {
+		return err
+	}
+
+	targetForAuthorizer := target
+	// prevent case of username == machine name to allow checking machine or anyone abusing the API passing an user.
+	if r.GetIsComputer() || r.GetAll() {
+		targetForAuthorizer = "root"
+	}
+	if err := s.authorizer.IsAllowedFromContext(context.WithValue(stream.Context(), authorizer.OnUserKey, targetForAuthorizer),
+		actions.ActionPolicyUpdate); err != nil {
+		return err
+	}
+
+	// Drift of multiple objects can be sent concurrently.
+	var sendMu sync.Mutex
+	checkDrift := func(target string, isComputer bool) error {
+		msg, err := s.policyManager.CheckDrift(stream.Context(), target, isComputer, r.GetHeal())
+		if err != nil {
+			return err
+		}
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		if err := stream.Send(&adsys.StringResponse{Msg: msg}); err != nil {
+			log.Warningf(stream.Context(), "couldn't send policies drift to client: %v", err)
+		}
+		return nil
+	}
+
+	if !r.GetIsComputer() && !r.GetAll() {
+		return checkDrift(target, false)
+	}
+
+	err = checkDrift(s.adc.Hostname(), true)
+	if r.GetAll() {
+		users, err := s.adc.ListUsers(stream.Context(), true)
+		if err != nil {
+			return err
+		}
+		errg := new(errgroup.Group)
+		for _, user := range users {
+			errg.Go(func() error {
+				return checkDrift(user, false)
+			})
+		}
+		if err := errg.Wait(); err != nil {
+			return fmt.Errorf("one or more error for checking drift of all users: %w", err)
+		}
+	}
+
+	return err
+}
+
+// ListPoliciesHistory displays the generations of policies applied to current user or user given as argument.
+func (s *Service) ListPoliciesHistory(r *adsys.ListPoliciesHistoryRequest, stream adsys.Service_ListPoliciesHistoryServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while listing policies history"))
+
+	target, err := s.dumpTarget(stream.Context(), r.GetTarget(), r.GetIsComputer())
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.policyManager.PoliciesHistory(stream.Context(), target)
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&adsys.StringResponse{
+		Msg: msg,
+	}); err != nil {
+		log.Warningf(stream.Context(), "couldn't send policies history to client: %v", err)
+	}
+
+	return nil
+}
+
+// DiffPoliciesHistory displays the changes between two generations of policies applied to current user or
+// user given as argument.
+func (s *Service) DiffPoliciesHistory(r *adsys.DiffPoliciesHistoryRequest, stream adsys.Service_DiffPoliciesHistoryServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while comparing policies history"))
+
+	target, err := s.dumpTarget(stream.Context(), r.GetTarget(), r.GetIsComputer())
+	if err != nil {
+		return err
+	}
+
+	msg, err := s.policyManager.DiffPoliciesHistory(stream.Context(), target, int(r.GetFrom()), int(r.GetTo()))
+	if err != nil {
+		return err
+	}
+	if err := stream.Send(&adsys.StringResponse{
+		Msg: msg,
+	}); err != nil {
+		log.Warningf(stream.Context(), "couldn't send policies history changes to client: %v", err)
+	}
+
+	return nil
+}
+
+// dumpTarget returns the normalized object name whose applied policies are requested, if the caller is allowed
+// to see them.
+func (s *Service) dumpTarget(ctx context.Context, target string, isComputer bool) (string, error) {
+	objectClass := ad.UserObject
+	if isComputer {
+		objectClass = ad.ComputerObject
+	}
+
+	target, err := s.adc.NormalizeTargetName(ctx, target, objectClass)
+	if err != nil {
+		return "", err
+	}
+
+	// hostname policy display is allowed to all users
+	if target != s.adc.Hostname() {
+		if err := s.authorizer.IsAllowedFromContext(context.WithValue(ctx, authorizer.OnUserKey, target),
+			actions.ActionPolicyDump); err != nil {
+			return "", err
+		}
+	}
+
+	return target, nil
+}
+
+// RollbackPolicies applies again a previous generation of policies to current user or user given as argument,
+// without contacting the directory service.
+func (s *Service) RollbackPolicies(r *adsys.RollbackPoliciesRequest, stream adsys.Service_RollbackPoliciesServer) (err error) {
+	defer decorate.OnError(&err, gotext.Get("error while rolling back policies"))
+
+	objectClass := ad.UserObject
+	if r.GetIsComputer() {
+		objectClass = ad.ComputerObject
+	}
+	target, err := s.adc.NormalizeTargetName(stream.Context(), r.GetTarget(), objectClass)
+	if err != nil {
+		return err
+	}
+
+	// Rolling back can restore an older generation with weaker restrictions until the next refresh:
+	// only administrators are allowed to do it, even on their own user.
+	if err := s.authorizer.IsAllowedFromContext(context.WithValue(stream.Context(), authorizer.OnUserKey, "root"),
+		actions.ActionPolicyUpdate); err != nil {
+		return err
+	}
+
+	return s.policyManager.RollbackPolicies(stream.Context(), target, r.GetIsComputer(), int(r.GetGeneration()))
+}
+
 // DumpPoliciesDefinitions dumps requested policy definitions stored in daemon at build time.
 func (s *Service) DumpPoliciesDefinitions(r *adsys.DumpPolicyDefinitionsRequest, stream adsys.Service_DumpPoliciesDefinitionsServer) (err error) {
 	defer decorate.OnError(&err, gotext.Get("error while dumping policy definitions"))
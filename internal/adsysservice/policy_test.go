@@ -0,0 +1,82 @@
+package adsysservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys"
+	"github.com/ubuntu/adsys/internal/adsysservice"
+	"github.com/ubuntu/adsys/internal/authorizer"
+	"google.golang.org/grpc"
+)
+
+func TestRollbackPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		target     string
+		isComputer bool
+		callerUser string
+
+		wantErr bool
+	}{
+		"Administrator is allowed to roll back user policies":    {target: "alice@example.com", callerUser: "root"},
+		"Administrator is allowed to roll back machine policies": {target: "host", isComputer: true, callerUser: "root"},
+
+		// Error cases
+		"Error on non administrator rolling back own policies":     {target: "alice@example.com", callerUser: "alice@example.com", wantErr: true},
+		"Error on non administrator rolling back other policies":   {target: "bob@example.com", callerUser: "alice@example.com", wantErr: true},
+		"Error on non administrator rolling back machine policies": {target: "host", isComputer: true, callerUser: "alice@example.com", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			auth := &selfOnlyAuthorizer{caller: tc.callerUser}
+			s := newService(t, adsysservice.WithAuthorizer(auth))
+
+			err := s.RollbackPolicies(&adsys.RollbackPoliciesRequest{Target: tc.target, IsComputer: tc.isComputer, Generation: 1},
+				&rollbackStream{ctx: context.Background()})
+			require.Equal(t, []string{"root"}, auth.requested, "RollbackPolicies should always require administrator rights")
+			if tc.wantErr {
+				require.ErrorIs(t, err, errDenied, "RollbackPolicies should be denied")
+				return
+			}
+			// There is no history to roll back to: only check that authorization was granted.
+			require.NotErrorIs(t, err, errDenied, "RollbackPolicies should be allowed")
+		})
+	}
+}
+
+var errDenied = errors.New("denied by the mock authorizer")
+
+// selfOnlyAuthorizer allows the caller to act on its own user only, as polkit does by default.
+// root is allowed to act on anything.
+type selfOnlyAuthorizer struct {
+	caller    string
+	requested []string
+}
+
+func (a *selfOnlyAuthorizer) IsAllowedFromContext(ctx context.Context, _ authorizer.Action) error {
+	userName, _ := ctx.Value(authorizer.OnUserKey).(string)
+	a.requested = append(a.requested, userName)
+	if a.caller == "root" || a.caller == userName {
+		return nil
+	}
+	return errDenied
+}
+
+type rollbackStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *rollbackStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *rollbackStream) Send(*adsys.Empty) error {
+	return nil
+}
@@ -110,6 +110,7 @@ func (s *Service) Status(_ *adsys.Empty, stream adsys.Service_StatusServer) (err
 	if err == nil {
 		updateMachine = fmt.Sprintf(updateFmt, gotext.Get("Machine"), t.Format(timeLayout))
 	}
+	updateMachine = updateMachine + s.failedManagers(s.adc.Hostname(), "  ", timeLayout)
 
 	updateUsers := fmt.Sprint(gotext.Get("Can't get connected users"))
 	users, err := s.adc.ListUsers(stream.Context(), true)
@@ -121,6 +122,8 @@ func (s *Service) Status(_ *adsys.Empty, stream adsys.Service_StatusServer) (err
 			} else {
 				updateUsers = updateUsers + "\n  " + gotext.Get("%s, no gpo applied found", u)
 			}
+			updateUsers = updateUsers + s.failedManagers(u, "    ", timeLayout)
+			updateUsers = updateUsers + "\n    " + s.ticketLifetime(u, timeLayout)
 		}
 		if len(users) == 0 {
 			updateUsers = updateUsers + "\n  " + gotext.Get("None")
@@ -169,6 +172,47 @@ Daemon:
 	return nil
 }
 
+// failedManagers returns the policy managers which failed on last policies application for objectName,
+// one per line prefixed by indent.
+func (s *Service) failedManagers(objectName, indent, timeLayout string) string {
+	status, err := s.policyManager.Status(objectName)
+	if err != nil {
+		return "\n" + indent + err.Error()
+	}
+
+	policyTypes := make([]string, 0, len(status))
+	for t := range status {
+		policyTypes = append(policyTypes, t)
+	}
+	slices.Sort(policyTypes)
+
+	var out string
+	for _, t := range policyTypes {
+		if status[t].Error == "" {
+			continue
+		}
+		out = out + "\n" + indent + gotext.Get("%s failed on %s: %s", t, status[t].LastAttempt.Format(timeLayout), status[t].Error)
+	}
+	return out
+}
+
+// ticketLifetime returns until when the Kerberos ticket used for objectName is valid and can be renewed.
+func (s *Service) ticketLifetime(objectName, timeLayout string) string {
+	tgt, err := s.adc.Krb5Ticket(objectName)
+	if err != nil {
+		return gotext.Get("Kerberos ticket: unknown")
+	}
+
+	now := time.Now()
+	if tgt.Expired(now) {
+		return gotext.Get("Kerberos ticket expired on %s", tgt.EndTime.Format(timeLayout))
+	}
+	if !tgt.Renewable(now) {
+		return gotext.Get("Kerberos ticket valid until %s, not renewable", tgt.EndTime.Format(timeLayout))
+	}
+	return gotext.Get("Kerberos ticket valid until %s, renewable until %s", tgt.EndTime.Format(timeLayout), tgt.RenewTill.Format(timeLayout))
+}
+
 // Stop requests to stop the service once all connections are done. Force will shut it down immediately and drop
 // existing connections.
 func (s *Service) Stop(r *adsys.StopRequest, stream adsys.Service_StopServer) (err error) {
@@ -204,7 +248,7 @@ func (s *Service) ListUsers(r *adsys.ListUsersRequest, stream adsys.Service_List
 }
 
 // nextRefreshTime returns next adsys schedule refresh call.
-func (s Service) nextRefreshTime() (next *time.Time, err error) {
+func (s *Service) nextRefreshTime() (next *time.Time, err error) {
 	defer decorate.OnError(&err, gotext.Get("error while trying to determine next refresh time"))
 
 	if s.initSystemTime == nil {
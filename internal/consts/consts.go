@@ -67,6 +67,14 @@ const (
 	DefaultSystemUnitDir = "/etc/systemd/system"
 	// DefaultGlobalTrustDir is the default directory for the global trust store.
 	DefaultGlobalTrustDir = "/usr/local/share/ca-certificates"
+	// DefaultNftablesDir is the default directory for the firewall nftables ruleset.
+	DefaultNftablesDir = "/etc/nftables.d"
+	// DefaultSysctlDir is the default directory for the kernel parameters configuration.
+	DefaultSysctlDir = "/etc/sysctl.d"
+	// DefaultModprobeDir is the default directory for the kernel modules configuration.
+	DefaultModprobeDir = "/etc/modprobe.d"
+	// DefaultSSHDir is the default directory for the OpenSSH server configuration.
+	DefaultSSHDir = "/etc/ssh"
 )
 
 // SSSD related properties.
@@ -83,6 +91,16 @@ const (
 	SSSDDbusInterface = "org.freedesktop.sssd.infopipe.Domains.Domain"
 )
 
+// Keytab backend related properties.
+const (
+	// DefaultKrb5Conf is the default krb5.conf location.
+	DefaultKrb5Conf = "/etc/krb5.conf"
+	// DefaultKeytab is the default machine keytab location.
+	DefaultKeytab = "/etc/krb5.keytab"
+	// DefaultKeytabCCache is the default machine ticket cache obtained from the keytab.
+	DefaultKeytabCCache = "/run/adsys/krb5cc_host"
+)
+
 // systemd related properties.
 const (
 	// SystemdDbusRegisteredName is the well-known name of systemd on dbus.
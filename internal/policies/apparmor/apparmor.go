@@ -28,6 +28,7 @@ import (
 	"io/fs"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -38,6 +39,8 @@ import (
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/adsys/internal/smbsafe"
 	"github.com/ubuntu/decorate"
 )
@@ -136,6 +139,10 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	}
 	m.apparmorParserCmd[0] = absPath
 
+	if err := m.journalProfiles(ctx, objectName, isComputer); err != nil {
+		return err
+	}
+
 	// If we have no entries, attempt to unload them and remove the apparmor directory
 	idx := slices.IndexFunc(entries, func(e entry.Entry) bool { return e.Key == fmt.Sprintf("apparmor-%s", objectDir) })
 	if idx == -1 || entries[idx].Disabled {
@@ -158,6 +165,114 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	return err
 }
 
+// AssetsReader is a function which returns policies assets as a read-only file system.
+type AssetsReader func(relSrc string) (fs.FS, error)
+
+// Plan returns the changes ApplyPolicy would make to the apparmor profiles of objectName, without applying them.
+// As apparmor_parser is not called, loaded and unloaded profiles are reported per file.
+// Profiles are compared against the policies assets, without extracting them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry, assetsReader AssetsReader) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan apparmor policy for %s", objectName))
+
+	objectDir := "machine"
+	if !isComputer {
+		objectDir = "users"
+	}
+	apparmorPath := filepath.Join(m.apparmorDir, objectDir)
+	machinePoliciesPath := filepath.Join(m.apparmorDir, "machine")
+
+	// Don't read profiles while they are being updated.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := exec.LookPath(m.apparmorParserCmd[0]); err != nil {
+		if len(entries) > 0 {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	existingProfiles, err := filesInDir(machinePoliciesPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	idx := slices.IndexFunc(entries, func(e entry.Entry) bool { return e.Key == fmt.Sprintf("apparmor-%s", objectDir) })
+	if idx == -1 || entries[idx].Disabled {
+		if !isComputer {
+			return plan.AppendRemoval(nil, filepath.Join(apparmorPath, objectName)), nil
+		}
+		for _, p := range existingProfiles {
+			changes = append(changes, plan.Change{Action: plan.ProfileUnloaded, Target: p})
+		}
+		return plan.AppendRemoval(changes, machinePoliciesPath), nil
+	}
+
+	assets, err := assetsReader("apparmor/")
+	if err != nil {
+		return nil, err
+	}
+	profilePaths, err := filesFromEntry(entries[idx], assets, apparmorPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isComputer {
+		// The user policy is always a single file
+		if len(profilePaths) != 1 {
+			return nil, errors.New(gotext.Get("expected exactly one profile, got %d", len(profilePaths)))
+		}
+		profileContents, err := readAsset(assets, apparmorPath, profilePaths[0])
+		if err != nil {
+			return nil, err
+		}
+		c, changed, err := plan.ForFile(filepath.Join(apparmorPath, objectName), userProfile(objectName, profileContents))
+		if err != nil || !changed {
+			return nil, err
+		}
+		changes = append(changes, c)
+
+		// Machine profiles are reloaded to take the user policy into account
+		for _, p := range existingProfiles {
+			changes = append(changes, plan.Change{Action: plan.ProfileLoaded, Target: p})
+		}
+		return changes, nil
+	}
+
+	// Only the profiles listed in the entry are kept, see removeUnusedAssets.
+	for _, p := range existingProfiles {
+		if slices.Contains(profilePaths, p) {
+			continue
+		}
+		changes = append(changes,
+			plan.Change{Action: plan.ProfileUnloaded, Target: p},
+			plan.Change{Action: plan.FileRemoved, Target: p})
+	}
+	for _, p := range profilePaths {
+		content, err := readAsset(assets, apparmorPath, p)
+		if err != nil {
+			return nil, err
+		}
+		if changes, err = plan.AppendFile(changes, p, string(content)); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range profilePaths {
+		changes = append(changes, plan.Change{Action: plan.ProfileLoaded, Target: p})
+	}
+
+	return changes, nil
+}
+
+// readAsset returns the content of profilePath from the assets, which would be extracted to root.
+func readAsset(assets fs.FS, root, profilePath string) ([]byte, error) {
+	rel, err := filepath.Rel(root, profilePath)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(assets, filepath.ToSlash(rel))
+}
+
 // applyUserPolicy applies apparmor policies for the machine object.
 func (m *Manager) applyMachinePolicy(ctx context.Context, e entry.Entry, apparmorPath string, assetsDumper AssetsDumper) (err error) {
 	defer decorate.OnError(&err, gotext.Get("can't apply machine policy"))
@@ -209,7 +324,7 @@ func (m *Manager) applyMachinePolicy(ctx context.Context, e entry.Entry, apparmo
 	}
 
 	// Get the list of files to run apparmor_parser on
-	filesToLoad, err := filesFromEntry(e, apparmorPath)
+	filesToLoad, err := filesFromEntry(e, os.DirFS(apparmorPath), apparmorPath)
 	if err != nil {
 		return err
 	}
@@ -233,18 +348,8 @@ func (m *Manager) applyMachinePolicy(ctx context.Context, e entry.Entry, apparmo
 	}
 
 	if len(filesToLoad) > 0 && os.Getenv("ADSYS_SKIP_ROOT_CALLS") == "" {
-		// Run apparmor_parser on the files to load, relying on apparmor's caching mechanism
-		apparmorParserCmd := append(m.apparmorParserCmd, []string{"-r", "-W", "-L", m.apparmorCacheDir}...)
-		apparmorParserCmd = append(apparmorParserCmd, filesToLoad...)
-
-		// #nosec G204 - We are in control of the arguments
-		cmd := exec.CommandContext(ctx, apparmorParserCmd[0], apparmorParserCmd[1:]...)
-		cmd.Dir = m.apparmorDir
-		smbsafe.WaitExec()
-		out, err := cmd.CombinedOutput()
-		smbsafe.DoneExec()
-		if err != nil {
-			return errors.New(gotext.Get("failed to load apparmor rules: %v\n%s", err, string(out)))
+		if err := m.loadProfiles(ctx, filesToLoad); err != nil {
+			return err
 		}
 	}
 
@@ -266,7 +371,7 @@ func (m *Manager) applyUserPolicy(ctx context.Context, e entry.Entry, apparmorPa
 		return err
 	}
 	defer os.RemoveAll(tmpdir)
-	profilePaths, err := filesFromEntry(e, tmpdir)
+	profilePaths, err := filesFromEntry(e, os.DirFS(tmpdir), tmpdir)
 	if err != nil {
 		return err
 	}
@@ -281,8 +386,7 @@ func (m *Manager) applyUserPolicy(ctx context.Context, e entry.Entry, apparmorPa
 		return err
 	}
 
-	// Wrap the contents in a profile declaration with the username as the profile name
-	parsedProfile := fmt.Sprintf("^%s {\n%s\n}\n", username, strings.TrimSpace(string(profileContents)))
+	parsedProfile := userProfile(username, profileContents)
 
 	// Write the profile to the user's apparmor directory, getting the previous
 	// contents if available
@@ -307,16 +411,7 @@ func (m *Manager) applyUserPolicy(ctx context.Context, e entry.Entry, apparmorPa
 	if err != nil {
 		return err
 	}
-	apparmorParserCmd := append(m.apparmorParserCmd, []string{"-r", "-W", "-L", m.apparmorCacheDir}...)
-	apparmorParserCmd = append(apparmorParserCmd, existingProfiles...)
-
-	// #nosec G204 - We are in control of the arguments
-	cmd := exec.CommandContext(ctx, apparmorParserCmd[0], apparmorParserCmd[1:]...)
-	cmd.Dir = m.apparmorDir
-	smbsafe.WaitExec()
-	out, err := cmd.CombinedOutput()
-	smbsafe.DoneExec()
-	if err != nil {
+	if err := m.loadProfiles(ctx, existingProfiles); err != nil {
 		// Restore the old content
 		var restoreErr error
 		if len(oldContent) == 0 {
@@ -329,11 +424,91 @@ func (m *Manager) applyUserPolicy(ctx context.Context, e entry.Entry, apparmorPa
 		}
 
 		// Return the execution error
+		return err
+	}
+	return nil
+}
+
+// loadProfiles runs apparmor_parser to load or replace the given profiles, relying on apparmor's caching mechanism.
+func (m *Manager) loadProfiles(ctx context.Context, profiles []string) error {
+	apparmorParserCmd := append(m.apparmorParserCmd, []string{"-r", "-W", "-L", m.apparmorCacheDir}...)
+	apparmorParserCmd = append(apparmorParserCmd, profiles...)
+
+	// #nosec G204 - We are in control of the arguments
+	cmd := exec.CommandContext(ctx, apparmorParserCmd[0], apparmorParserCmd[1:]...)
+	cmd.Dir = m.apparmorDir
+	smbsafe.WaitExec()
+	out, err := cmd.CombinedOutput()
+	smbsafe.DoneExec()
+	if err != nil {
 		return errors.New(gotext.Get("failed to load apparmor rules: %v\n%s", err, string(out)))
 	}
 	return nil
 }
 
+// journalProfiles records the apparmor profiles of objectName in the journal of ctx, if any.
+// On rollback, the machine policies loaded from the new profiles are unloaded, and the previous
+// profiles are reloaded once restored, which applies the restored user profiles too.
+func (m *Manager) journalProfiles(ctx context.Context, objectName string, isComputer bool) error {
+	machinePath := filepath.Join(m.apparmorDir, "machine")
+	profilesPath := machinePath
+	if !isComputer {
+		profilesPath = filepath.Join(m.apparmorDir, "users", objectName)
+	}
+
+	// Rollback actions are run in reverse order: this one is called once profiles are restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if os.Getenv("ADSYS_SKIP_ROOT_CALLS") != "" {
+			return nil
+		}
+		profiles, err := filesInDir(machinePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(profiles) == 0 {
+			return nil
+		}
+		return m.loadProfiles(ctx, profiles)
+	})
+
+	if err := journal.Record(ctx, profilesPath, profilesPath+".old", profilesPath+".new"); err != nil {
+		return err
+	}
+	if !isComputer {
+		return nil
+	}
+
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		profiles, err := filesInDir(machinePath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		loaded, err := m.loadedPolicies()
+		if err != nil {
+			return err
+		}
+		policies, err := m.policiesFromFiles(ctx, profiles)
+		if err != nil {
+			return err
+		}
+		return m.unloadPolicies(ctx, intersection(policies, loaded))
+	})
+
+	return nil
+}
+
 // unloadAllRules unloads all apparmor rules in the given directory that are
 // currently loaded in the system (present in the apparmorfs profiles file) and
 // removes the directory.
@@ -505,6 +680,11 @@ func (m *Manager) loadedPolicies() (policies []string, err error) {
 	return policies, nil
 }
 
+// userProfile wraps the profile contents in a profile declaration with the username as the profile name.
+func userProfile(username string, profileContents []byte) string {
+	return fmt.Sprintf("^%s {\n%s\n}\n", username, strings.TrimSpace(string(profileContents)))
+}
+
 // cleanupOldApparmorDir handles putting the old apparmor policy files back if the
 // new ones failed to apply.
 func cleanupOldApparmorDir(ctx context.Context, oldApparmorPath, apparmorPath string) {
@@ -524,9 +704,10 @@ func cleanupOldApparmorDir(ctx context.Context, oldApparmorPath, apparmorPath st
 	}
 }
 
-// filesFromEntry returns the list of files configured in the given policy entry.
+// filesFromEntry returns the list of files configured in the given policy entry, as located in apparmorPath.
+// profiles is the file system of the profiles, which is checked for their existence.
 // It returns an error if the file does not exist or is a directory.
-func filesFromEntry(e entry.Entry, apparmorPath string) ([]string, error) {
+func filesFromEntry(e entry.Entry, profiles fs.FS, apparmorPath string) ([]string, error) {
 	var filesToLoad []string
 	for _, profile := range strings.Split(e.Value, "\n") {
 		profile = strings.TrimSpace(profile)
@@ -535,7 +716,7 @@ func filesFromEntry(e entry.Entry, apparmorPath string) ([]string, error) {
 		}
 
 		profileFilePath := filepath.Join(apparmorPath, profile)
-		info, err := os.Stat(profileFilePath)
+		info, err := fs.Stat(profiles, path.Clean(profile))
 		if err != nil {
 			return nil, errors.New(gotext.Get("apparmor profile %q is not accessible: %v", profile, err))
 		}
@@ -190,6 +190,90 @@ func TestApplyPolicy(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	defaultMachineProfile := []entry.Entry{{Key: "apparmor-machine", Value: "usr.bin.foo"}}
+
+	tests := map[string]struct {
+		entries []entry.Entry
+		user    bool
+
+		destsAlreadyExist map[string]string // key refers to the source path, value to the destination path
+		noApparmorParser  bool
+		readAssetsError   bool
+
+		wantErr bool
+	}{
+		// computer cases
+		"Computer, one profile":                    {},
+		"Computer, multiple profiles":              {entries: []entry.Entry{{Key: "apparmor-machine", Value: "usr.bin.foo\nusr.bin.bar\nnested/usr.bin.baz"}}},
+		"Computer, previous profiles are unloaded": {destsAlreadyExist: map[string]string{"only-machine": "machine"}},
+		"Computer, no profiles unloads all":        {entries: []entry.Entry{}, destsAlreadyExist: map[string]string{"only-machine": "machine"}},
+		"Computer, no profiles on pristine system": {entries: []entry.Entry{}},
+
+		// user cases
+		"User, valid mapping reloads machine profiles":       {destsAlreadyExist: map[string]string{"machine-with-users": "machine"}, entries: []entry.Entry{{Key: "apparmor-users", Value: "users/privileged_user"}}, user: true},
+		"User, valid mapping, unchanged content":             {destsAlreadyExist: map[string]string{"machine-with-users": "machine", "users": "users"}, entries: []entry.Entry{{Key: "apparmor-users", Value: "users/unchanged_user"}}, user: true},
+		"User, no machine profiles":                          {entries: []entry.Entry{{Key: "apparmor-users", Value: "users/privileged_user"}}, user: true},
+		"User, no entries, existing user profile is removed": {destsAlreadyExist: map[string]string{"users": "users"}, entries: []entry.Entry{}, user: true},
+
+		// other edge cases
+		"No apparmor_parser and no entries": {entries: []entry.Entry{}, noApparmorParser: true},
+
+		// error cases
+		"Error on no apparmor_parser and entries": {noApparmorParser: true, wantErr: true},
+		"Error on reading assets failing":         {readAssetsError: true, wantErr: true},
+		"Error on absent profile":                 {entries: []entry.Entry{{Key: "apparmor-machine", Value: "usr.bin.nonexistent"}}, wantErr: true},
+		"Error on profile being a directory":      {entries: []entry.Entry{{Key: "apparmor-machine", Value: "nested/"}}, wantErr: true},
+		"Error on user multiple profiles":         {entries: []entry.Entry{{Key: "apparmor-users", Value: "users/privileged_user\nusers/confined_user"}}, user: true, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			if tc.entries == nil {
+				tc.entries = defaultMachineProfile
+			}
+
+			apparmorDir := t.TempDir()
+			apparmorParserCmd := []string{"true"}
+			if tc.noApparmorParser {
+				apparmorParserCmd = []string{"this-definitely-does-not-exist"}
+			}
+
+			if tc.destsAlreadyExist != nil {
+				require.NoError(t, os.RemoveAll(apparmorDir), "Setup: can't remove apparmor dir before filing it")
+			}
+			for source, dest := range tc.destsAlreadyExist {
+				require.NoError(t,
+					shutil.CopyTree(
+						filepath.Join("testdata", "TestApplyPolicy", "apparmor_dir", source), filepath.Join(apparmorDir, dest),
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create initial apparmor dir machine profiles content")
+			}
+			mockAssetsDumper := testutils.MockAssetsDumper{Err: tc.readAssetsError, Path: "apparmor/", T: t}
+
+			m := apparmor.New(apparmorDir, apparmor.WithApparmorParserCmd(apparmorParserCmd))
+
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.user, tc.entries, mockAssetsDumper.ReadAssets)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan failed but shouldn't have")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, normalizeOutput(t, c.String(), apparmorDir))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
 func appendToFile(t *testing.T, path string, data []byte) {
 	t.Helper()
 
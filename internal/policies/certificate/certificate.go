@@ -34,6 +34,7 @@ import (
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/adsys/internal/smbsafe"
 	"github.com/ubuntu/decorate"
 )
@@ -194,24 +195,9 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		return nil
 	}
 
-	var polSrvRegistryEntries []gpoEntry
-	for _, entry := range entries {
-		// We already handled the autoenroll entry
-		if entry.Key == "autoenroll" {
-			continue
-		}
-
-		// Samba expects the key parts to be joined by backslashes
-		keyparts := strings.Split(entry.Key, "/")
-		keyname := strings.Join(keyparts[:len(keyparts)-1], `\`)
-		valuename := keyparts[len(keyparts)-1]
-		gpoData, err := gpoData(entry.Value, valuename)
-		if err != nil {
-			return errors.New(gotext.Get("failed to parse policy entry value: %v", err))
-		}
-		polSrvRegistryEntries = append(polSrvRegistryEntries, gpoEntry{keyname, valuename, gpoData, gpoType(valuename)})
-
-		log.Debugf(ctx, "Certificate policy entry: %#v", entry)
+	polSrvRegistryEntries, err := policyServersEntries(ctx, entries)
+	if err != nil {
+		return err
 	}
 
 	var action string
@@ -233,6 +219,64 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	return nil
 }
 
+// Plan returns the changes ApplyPolicy would make to enroll or un-enroll the machine, without applying them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer, isOnline bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan certificate policy"))
+
+	if !isComputer || !isOnline {
+		return nil, nil
+	}
+
+	idx := slices.IndexFunc(entries, func(e entry.Entry) bool { return e.Key == "autoenroll" })
+	if idx == -1 {
+		if _, err := os.Stat(filepath.Join(m.stateDir, "samba")); err != nil && os.IsNotExist(err) {
+			return nil, nil
+		}
+		return []plan.Change{{Action: plan.CommandRun, Target: fmt.Sprintf("certificate autoenrollment script (unenroll %s)", objectName)}}, nil
+	}
+
+	value, err := strconv.Atoi(entries[idx].Value)
+	if err != nil {
+		return nil, errors.New(gotext.Get("failed to parse certificate policy entry value: %v", err))
+	}
+	if value&disabledFlag == disabledFlag {
+		return nil, nil
+	}
+	if _, err := policyServersEntries(ctx, entries); err != nil {
+		return nil, err
+	}
+
+	action := "unenroll"
+	if value&enrollFlag == enrollFlag {
+		action = "enroll"
+	}
+	return []plan.Change{{Action: plan.CommandRun, Target: fmt.Sprintf("certificate autoenrollment script (%s %s)", action, objectName)}}, nil
+}
+
+// policyServersEntries returns the policy server registry entries, in the format Samba expects, from entries.
+func policyServersEntries(ctx context.Context, entries []entry.Entry) (polSrvRegistryEntries []gpoEntry, err error) {
+	for _, entry := range entries {
+		// The autoenroll entry is handled separately
+		if entry.Key == "autoenroll" {
+			continue
+		}
+
+		// Samba expects the key parts to be joined by backslashes
+		keyparts := strings.Split(entry.Key, "/")
+		keyname := strings.Join(keyparts[:len(keyparts)-1], `\`)
+		valuename := keyparts[len(keyparts)-1]
+		gpoData, err := gpoData(entry.Value, valuename)
+		if err != nil {
+			return nil, errors.New(gotext.Get("failed to parse policy entry value: %v", err))
+		}
+		polSrvRegistryEntries = append(polSrvRegistryEntries, gpoEntry{keyname, valuename, gpoData, gpoType(valuename)})
+
+		log.Debugf(ctx, "Certificate policy entry: %#v", entry)
+	}
+
+	return polSrvRegistryEntries, nil
+}
+
 // runScript runs the certificate autoenrollment script with the given arguments.
 func (m *Manager) runScript(ctx context.Context, action, objectName string, extraArgs ...string) error {
 	scriptArgs := []string{action, objectName, m.domain, "--state_dir", m.stateDir, "--global_trust_dir", m.globalTrustDir}
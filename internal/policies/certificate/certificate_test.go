@@ -122,6 +122,76 @@ func TestApplyPolicy(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries []entry.Entry
+
+		isUser    bool
+		isOffline bool
+
+		sambaDirExists bool
+
+		wantErr bool
+	}{
+		// No-op cases
+		"Computer, no entries":           {},
+		"Computer, autoenroll disabled":  {entries: []entry.Entry{{Key: "autoenroll", Value: disabledValue}}},
+		"Computer, domain is offline":    {entries: []entry.Entry{enrollEntry}, isOffline: true},
+		"User, autoenroll not supported": {isUser: true, entries: []entry.Entry{enrollEntry}},
+
+		// Enroll cases
+		"Computer, configured to enroll":                         {entries: []entry.Entry{enrollEntry}},
+		"Computer, configured to enroll, advanced configuration": {entries: append(advancedConfigurationEntries, enrollEntry)},
+
+		// Unenroll cases
+		"Computer, configured to unenroll":          {entries: []entry.Entry{{Key: "autoenroll", Value: unenrollValue}}},
+		"Computer, no entries, Samba cache present": {sambaDirExists: true},
+
+		// Error cases
+		"Error on invalid autoenroll value": {entries: []entry.Entry{{Key: "autoenroll", Value: "notanumber"}}, wantErr: true},
+		"Error on invalid advanced configuration value": {
+			entries: []entry.Entry{
+				enrollEntry,
+				{Key: "Software/Policies/Microsoft/Cryptography/PolicyServers/37c9dc30f207f27f61a2f7c3aed598a6e2920b54/Flags", Value: "NotANumber"},
+			}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tmpdir := t.TempDir()
+			if tc.sambaDirExists {
+				require.NoError(t, os.MkdirAll(filepath.Join(tmpdir, "statedir", "samba"), 0750), "Setup: Samba cache dir should be created")
+			}
+
+			m := certificate.New(
+				"example.com",
+				certificate.WithStateDir(filepath.Join(tmpdir, "statedir")),
+				certificate.WithRunDir(filepath.Join(tmpdir, "rundir")),
+				certificate.WithShareDir(filepath.Join(tmpdir, "sharedir")),
+				certificate.WithCertAutoenrollCmd([]string{"this-should-not-be-called"}),
+			)
+
+			changes, err := m.Plan(context.Background(), "keypress", !tc.isUser, !tc.isOffline, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should fail")
+				return
+			}
+			require.NoError(t, err, "Plan should succeed")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, c)
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
 func mockAutoenrollScript(t *testing.T, scriptOutputFile string, autoenrollScriptError bool) []string {
 	t.Helper()
 
@@ -44,6 +44,8 @@ import (
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/adsys/internal/smbsafe"
 	"github.com/ubuntu/decorate"
 )
@@ -101,6 +103,15 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		}
 	}
 
+	// Keep the previous sources and compiled database, and user profile, to restore them on rollback.
+	toRecord := []string{dbPath, filepath.Join(dbsPath, objectName)}
+	if !isComputer {
+		toRecord = append(toRecord, filepath.Join(profilesPath, objectName))
+	}
+	if err := journal.Record(ctx, toRecord...); err != nil {
+		return err
+	}
+
 	// Create profiles for users only
 	if !isComputer {
 		//nolint:gosec // G301 - Profile must be readable by everyone
@@ -112,45 +123,9 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		}
 	}
 
-	// Generate defaults and locks content from policy
-	dataWithGroups := make(map[string][]string)
-	var locks []string
-	var errMsgs []string
-	for _, e := range entries {
-		log.Debugf(ctx, "Analyzing entry %+v", e)
-
-		if !e.Disabled {
-			section := filepath.Dir(e.Key)
-
-			// normalize common user error cases and check gsettings schema signature match.
-			e.Value = normalizeValue(e.Meta, e.Value)
-			if err := checkSignature(e.Meta, e.Value); err != nil {
-				errMsgs = append(errMsgs, gotext.Get("- error on %s: %v", e.Key, err))
-				continue
-			}
-
-			l := fmt.Sprintf("%s=%s", filepath.Base(e.Key), e.Value)
-			dataWithGroups[section] = append(dataWithGroups[section], l)
-		}
-		locks = append(locks, "/"+e.Key)
-	}
-
-	// Stop on any error
-	if errMsgs != nil {
-		return errors.New(strings.Join(errMsgs, "\n"))
-	}
-
-	// Prepare file contents
-	// Order sections to have a reliable output
-	var data []string
-	sections := make([]string, 0, len(dataWithGroups))
-	for s := range dataWithGroups {
-		sections = append(sections, s)
-	}
-	sort.Strings(sections)
-	for _, s := range sections {
-		data = append(data, fmt.Sprintf("[%s]", s))
-		data = append(data, dataWithGroups[s]...)
+	defaults, locks, err := policyContent(ctx, entries)
+	if err != nil {
+		return err
 	}
 
 	var needsRefresh bool
@@ -162,14 +137,14 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	}
 
 	defaultPath := filepath.Join(dbPath, "adsys")
-	changed, err := writeIfChanged(defaultPath, strings.Join(data, "\n")+"\n")
+	changed, err := writeIfChanged(defaultPath, defaults)
 	if err != nil {
 		return err
 	}
 	needsRefresh = needsRefresh || changed
 
 	locksPath := filepath.Join(dbPath, "locks", "adsys")
-	changed, err = writeIfChanged(locksPath, strings.Join(locks, "\n")+"\n")
+	changed, err = writeIfChanged(locksPath, locks)
 	if err != nil {
 		return err
 	}
@@ -199,6 +174,105 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	return nil
 }
 
+// Plan returns the changes ApplyPolicy would make to the dconf profiles and databases for objectName,
+// without applying them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan dconf policy for %s", objectName))
+
+	dconfDir := m.dconfDir
+	if dconfDir == "" {
+		dconfDir = consts.DefaultDconfDir
+	}
+
+	// Prevent reading the machine database while it's being updated.
+	m.dconfMu.RLock()
+	defer m.dconfMu.RUnlock()
+
+	if isComputer {
+		objectName = "machine"
+	}
+	dbsPath := filepath.Join(dconfDir, "db")
+	dbPath := filepath.Join(dbsPath, objectName+".d")
+
+	if !isComputer {
+		profilePath := filepath.Join(dconfDir, "profile", objectName)
+		content, err := os.ReadFile(profilePath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		if changes, err = plan.AppendFile(changes, profilePath, profileContent(objectName, content, err == nil)); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults, locks, err := policyContent(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	nProfileChanges := len(changes)
+	if changes, err = plan.AppendFile(changes, filepath.Join(dbPath, "adsys"), defaults); err != nil {
+		return nil, err
+	}
+	if changes, err = plan.AppendFile(changes, filepath.Join(dbPath, "locks", "adsys"), locks); err != nil {
+		return nil, err
+	}
+
+	needsRefresh := len(changes) > nProfileChanges || dconfNeedsUpdate(filepath.Join(dbsPath, "machine"))
+	if !isComputer {
+		needsRefresh = needsRefresh || dconfNeedsUpdate(filepath.Join(dbsPath, objectName))
+	}
+	if needsRefresh {
+		changes = append(changes, plan.Change{Action: plan.CommandRun, Target: fmt.Sprintf("dconf update %s", dbsPath)})
+	}
+
+	return changes, nil
+}
+
+// policyContent returns the defaults and locks database content generated from entries.
+func policyContent(ctx context.Context, entries []entry.Entry) (defaults, locks string, err error) {
+	dataWithGroups := make(map[string][]string)
+	var lockKeys []string
+	var errMsgs []string
+	for _, e := range entries {
+		log.Debugf(ctx, "Analyzing entry %+v", e)
+
+		if !e.Disabled {
+			section := filepath.Dir(e.Key)
+
+			// normalize common user error cases and check gsettings schema signature match.
+			e.Value = normalizeValue(e.Meta, e.Value)
+			if err := checkSignature(e.Meta, e.Value); err != nil {
+				errMsgs = append(errMsgs, gotext.Get("- error on %s: %v", e.Key, err))
+				continue
+			}
+
+			l := fmt.Sprintf("%s=%s", filepath.Base(e.Key), e.Value)
+			dataWithGroups[section] = append(dataWithGroups[section], l)
+		}
+		lockKeys = append(lockKeys, "/"+e.Key)
+	}
+
+	// Stop on any error
+	if errMsgs != nil {
+		return "", "", errors.New(strings.Join(errMsgs, "\n"))
+	}
+
+	// Prepare file contents
+	// Order sections to have a reliable output
+	var data []string
+	sections := make([]string, 0, len(dataWithGroups))
+	for s := range dataWithGroups {
+		sections = append(sections, s)
+	}
+	sort.Strings(sections)
+	for _, s := range sections {
+		data = append(data, fmt.Sprintf("[%s]", s))
+		data = append(data, dataWithGroups[s]...)
+	}
+
+	return strings.Join(data, "\n") + "\n", strings.Join(lockKeys, "\n") + "\n", nil
+}
+
 // writeIfChanged will only write to path if content is different from current content.
 func writeIfChanged(path string, content string) (done bool, err error) {
 	defer decorate.OnError(&err, gotext.Get("can't save %s", path))
@@ -219,17 +293,12 @@ func writeIfChanged(path string, content string) (done bool, err error) {
 }
 
 // writeProfile creates or updates a dconf profile file.
-// The adsys system-db should always be the first system-db in the file to enforce their values
-// (upper system-db in the profile wins).
 func writeProfile(ctx context.Context, user, profilesPath string) (err error) {
 	defer decorate.OnError(&err, gotext.Get("can't update user profile %s", profilesPath))
 
 	profilePath := filepath.Join(profilesPath, user)
 	log.Debugf(ctx, "Update user profile %s", profilePath)
 
-	adsysMachineDB := "system-db:machine"
-	adsysUserDB := fmt.Sprintf("system-db:%s", user)
-
 	// Read existing content and create file if doesn’t exists
 	content, err := os.ReadFile(profilePath)
 	if err != nil {
@@ -237,21 +306,10 @@ func writeProfile(ctx context.Context, user, profilesPath string) (err error) {
 			return err
 		}
 		// #nosec G306. This asset needs to be world-readable.
-		return os.WriteFile(profilePath, []byte(fmt.Sprintf("user-db:user\n%s\n%s", adsysUserDB, adsysMachineDB)), 0644)
-	}
-
-	// Read file to insert them at the end, removing duplicates
-	var out []string
-	for _, d := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
-		// Add current line if it’s not an adsys one
-		if string(d) == adsysMachineDB || string(d) == adsysUserDB {
-			continue
-		}
-		out = append(out, string(d))
+		return os.WriteFile(profilePath, []byte(profileContent(user, nil, false)), 0644)
 	}
-	out = append(out, adsysUserDB, adsysMachineDB)
 
-	newContent := []byte(strings.Join(out, "\n"))
+	newContent := []byte(profileContent(user, content, true))
 
 	// Is file already up to date?
 	if string(content) == string(newContent) {
@@ -269,6 +327,31 @@ func writeProfile(ctx context.Context, user, profilesPath string) (err error) {
 	return nil
 }
 
+// profileContent returns the dconf profile content for user, based on the current profile content if it exists.
+// The adsys system-db should always be the first system-db in the file to enforce their values
+// (upper system-db in the profile wins).
+func profileContent(user string, content []byte, exists bool) string {
+	adsysMachineDB := "system-db:machine"
+	adsysUserDB := fmt.Sprintf("system-db:%s", user)
+
+	if !exists {
+		return fmt.Sprintf("user-db:user\n%s\n%s", adsysUserDB, adsysMachineDB)
+	}
+
+	// Read file to insert them at the end, removing duplicates
+	var out []string
+	for _, d := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+		// Add current line if it’s not an adsys one
+		if string(d) == adsysMachineDB || string(d) == adsysUserDB {
+			continue
+		}
+		out = append(out, string(d))
+	}
+	out = append(out, adsysUserDB, adsysMachineDB)
+
+	return strings.Join(out, "\n")
+}
+
 // dconfNeedsUpdate will notify if we need to run dconf update for that binary database.
 // For now, it only checks its existence.
 func dconfNeedsUpdate(path string) bool {
@@ -2,8 +2,10 @@ package dconf_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -219,3 +221,89 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		isComputer       bool
+		entries          []entry.Entry
+		existingDconfDir string
+
+		wantErr bool
+	}{
+		// User cases
+		"New user": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}}},
+		"User updates existing value": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-thirdvalue'", Meta: "s"}},
+			existingDconfDir: "existing-user"},
+		"User updates existing profile without needed db": {entries: nil,
+			existingDconfDir: "existing-user-no-adsysdb"},
+
+		// Machine cases
+		"First boot": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}},
+			isComputer: true, existingDconfDir: "-"},
+		"Machine updates existing value": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-thirdvalue'", Meta: "s"}},
+			isComputer: true},
+		"Machine updates key is now disabled": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Disabled: true, Meta: "s"}},
+			isComputer: true},
+
+		// Update edge cases
+		"No change when up to date": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}},
+			existingDconfDir: "existing-user"},
+		"Missing machine compiled db for machine": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}},
+			isComputer: true, existingDconfDir: "missing-machine-compiled-db"},
+		"Missing user compiled db for user": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}},
+			existingDconfDir: "missing-user-compiled-db"},
+
+		// Error cases
+		"Error on invalid ai": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-ai", Value: "[1,b]", Meta: "ai"},
+		}, wantErr: true},
+		"Error on invalid type": {entries: []entry.Entry{
+			{Key: "com/ubuntu/category/key-something", Value: "value", Meta: "sometype"},
+		}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dconfDir := t.TempDir()
+
+			if tc.existingDconfDir == "" {
+				tc.existingDconfDir = "machine-base"
+			}
+			if tc.existingDconfDir != "-" {
+				require.NoError(t, os.Remove(dconfDir), "Setup: can't delete dconf base directory before recreation")
+				require.NoError(t,
+					shutil.CopyTree(
+						filepath.Join("testdata", "TestApplyPolicy", "dconf", tc.existingDconfDir), dconfDir,
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create initial dconf directory")
+			}
+
+			m := dconf.NewWithDconfDir(dconfDir)
+			changes, err := m.Plan(context.Background(), "ubuntu", tc.isComputer, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan failed but shouldn't have")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), dconfDir, "#DCONFDIR#"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
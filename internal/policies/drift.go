@@ -0,0 +1,91 @@
+package policies
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/decorate"
+)
+
+// CheckDrift compares the files owned by the policy managers for objectName with what its cached policies produce.
+// Scripts are not checked, as they are only updated between sessions.
+// If heal is set and some files drifted, the cached policies are applied again.
+func (m *Manager) CheckDrift(ctx context.Context, objectName string, isComputer, heal bool) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to check policies drift for %q", objectName))
+
+	log.Infof(ctx, "Checking policies drift for %s", objectName)
+
+	pols, err := NewFromCache(ctx, filepath.Join(m.policiesCacheDir, objectName))
+	if err != nil {
+		return "", err
+	}
+	defer pols.Close()
+
+	changes, err := m.PlanPolicies(ctx, objectName, isComputer, &pols)
+	if err != nil {
+		return "", err
+	}
+	drift := driftedFiles(changes)
+
+	var out strings.Builder
+	FormatDrift(&out, objectName, drift)
+	if !heal || len(drift) == 0 {
+		return out.String(), nil
+	}
+
+	log.Warning(ctx, gotext.Get("Policies of %s drifted, applying them again", objectName))
+	// Unchanged policies would be skipped otherwise.
+	if err := m.ApplyPolicies(ctx, objectName, isComputer, &pols, true); err != nil {
+		return "", err
+	}
+	fmt.Fprintln(&out, gotext.Get("Policies applied again for %s", objectName))
+
+	return out.String(), nil
+}
+
+// driftedFiles only keeps the file changes of changes, excluding scripts.
+// Other changes, like loading profiles or running commands, are done on every application.
+func driftedFiles(changes map[string][]plan.Change) map[string][]plan.Change {
+	fileActions := []plan.Action{plan.FileCreated, plan.FileModified, plan.FileRemoved}
+
+	drift := make(map[string][]plan.Change)
+	for policyType, c := range changes {
+		if policyType == "scripts" {
+			continue
+		}
+		for _, change := range c {
+			if slices.Contains(fileActions, change.Action) {
+				drift[policyType] = append(drift[policyType], change)
+			}
+		}
+	}
+	return drift
+}
+
+// FormatDrift writes to w the files which drifted for objectName, ordered by policy type.
+func FormatDrift(w io.Writer, objectName string, drift map[string][]plan.Change) {
+	if len(drift) == 0 {
+		fmt.Fprintln(w, gotext.Get("No drift for %s", objectName))
+		return
+	}
+
+	fmt.Fprintln(w, gotext.Get("Drift detected for %s:", objectName))
+	policyTypes := make([]string, 0, len(drift))
+	for t := range drift {
+		policyTypes = append(policyTypes, t)
+	}
+	slices.Sort(policyTypes)
+	for _, t := range policyTypes {
+		fmt.Fprintf(w, "* %s\n", t)
+		for _, c := range drift[t] {
+			fmt.Fprintf(w, "** %s\n", c)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package policies
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats supported to dump policies.
+const (
+	// FormatText is the human readable format, as built by GPO.Format.
+	FormatText = "text"
+	// FormatJSON is the machine readable JSON format.
+	FormatJSON = "json"
+	// FormatYAML is the machine readable YAML format.
+	FormatYAML = "yaml"
+)
+
+// Dump is the machine readable representation of the policies applied to an object.
+type Dump struct {
+	Object string      `json:"object" yaml:"object"`
+	GPOs   []GPOOrigin `json:"gpos" yaml:"gpos"`
+	Rules  []DumpRule  `json:"rules" yaml:"rules"`
+	// Filters are the host filters of the GPOs, with their result. GPOs whose filter is false are not applied.
+	Filters []GPOFilter `json:"filters,omitempty" yaml:"filters,omitempty"`
+	// Targets are the item-level targeting conditions of the rules, with their result. Rules whose condition is false
+	// are not applied.
+	Targets []RuleTarget `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// GPOOrigin identifies a GPO and the configuration it was applied from.
+type GPOOrigin struct {
+	ID   string `json:"id" yaml:"id"`
+	Name string `json:"name" yaml:"name"`
+	// Source is either "machine" or "user", the configuration the GPO is coming from.
+	Source string `json:"source" yaml:"source"`
+	// Loopback is true if the GPO is linked to the computer and applies its user settings with loopback processing.
+	Loopback bool `json:"loopback,omitempty" yaml:"loopback,omitempty"`
+}
+
+// GPOFilter is the host filter of a GPO, with its result when the policies were fetched.
+type GPOFilter struct {
+	GPO    GPOOrigin `json:"gpo" yaml:"gpo"`
+	Filter string    `json:"filter" yaml:"filter"`
+	Result bool      `json:"result" yaml:"result"`
+}
+
+// RuleTarget is the item-level targeting condition of a rule, with its result when the policies were fetched.
+type RuleTarget struct {
+	GPO    GPOOrigin `json:"gpo" yaml:"gpo"`
+	Domain string    `json:"domain" yaml:"domain"`
+	Key    string    `json:"key" yaml:"key"`
+	Target string    `json:"target" yaml:"target"`
+	Result bool      `json:"result" yaml:"result"`
+}
+
+// DumpRule is an applied rule, with the GPO it is coming from and the GPOs it took precedence over.
+type DumpRule struct {
+	Domain   string `json:"domain" yaml:"domain"`
+	Key      string `json:"key" yaml:"key"`
+	Value    string `json:"value" yaml:"value"`
+	Disabled bool   `json:"disabled" yaml:"disabled"`
+	Strategy string `json:"strategy" yaml:"strategy"`
+	Meta     string `json:"meta,omitempty" yaml:"meta,omitempty"`
+	Target   string `json:"target,omitempty" yaml:"target,omitempty"`
+
+	GPO GPOOrigin `json:"gpo" yaml:"gpo"`
+	// Merged are the GPOs whose values were appended to the value of the winning GPO.
+	Merged []GPOOrigin `json:"merged,omitempty" yaml:"merged,omitempty"`
+	// Overridden are the GPOs also defining this rule, whose values were discarded.
+	Overridden []GPOOrigin `json:"overridden,omitempty" yaml:"overridden,omitempty"`
+}
+
+// newDump returns the machine readable representation of the policies of objectName.
+// machineGPOs take precedence over targetGPOs, in the same way as they are displayed by GPO.Format.
+func newDump(objectName string, machineGPOs, targetGPOs []GPO, targetSource string) Dump {
+	d := Dump{Object: objectName}
+
+	var gpos []GPO
+	for _, g := range machineGPOs {
+		gpos = append(gpos, g)
+		d.GPOs = append(d.GPOs, GPOOrigin{ID: g.ID, Name: g.Name, Source: "machine"})
+	}
+	for _, g := range targetGPOs {
+		gpos = append(gpos, g)
+		d.GPOs = append(d.GPOs, GPOOrigin{ID: g.ID, Name: g.Name, Source: targetSource, Loopback: g.Loopback})
+	}
+
+	// Effective values are the ones which are applied, merging appended values.
+	effective := Policies{GPOs: gpos}.GetUniqueRules()
+
+	// Attribute each rule to the GPO whose value is applied, following GetUniqueRules precedence.
+	type provenance struct {
+		winner     *GPOOrigin
+		strategy   string
+		merged     []GPOOrigin
+		overridden []GPOOrigin
+	}
+	provenances := make(map[string]map[string]*provenance)
+	for i, g := range gpos {
+		origin := d.GPOs[i]
+		for domain, entries := range g.Rules {
+			if provenances[domain] == nil {
+				provenances[domain] = make(map[string]*provenance)
+			}
+			for _, e := range entries {
+				p := provenances[domain][e.Key]
+				if p == nil {
+					p = &provenance{}
+					provenances[domain][e.Key] = p
+				}
+
+				switch {
+				// Disabled appended values are never applied.
+				case e.Strategy == entry.StrategyAppend && e.Disabled:
+					p.overridden = append(p.overridden, origin)
+				case p.winner == nil:
+					p.winner = &origin
+					p.strategy = e.Strategy
+				case p.strategy == entry.StrategyAppend && e.Strategy == entry.StrategyAppend:
+					p.merged = append(p.merged, origin)
+				default:
+					p.overridden = append(p.overridden, origin)
+				}
+			}
+		}
+	}
+
+	for i, g := range gpos {
+		d.addTargets(d.GPOs[i], g)
+	}
+
+	var domains []string
+	for domain := range effective {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	for _, domain := range domains {
+		for _, e := range effective[domain] {
+			p := provenances[domain][e.Key]
+			strategy := e.Strategy
+			if strategy == "" {
+				strategy = entry.StrategyOverride
+			}
+			d.Rules = append(d.Rules, DumpRule{
+				Domain:     domain,
+				Key:        e.Key,
+				Value:      e.Value,
+				Disabled:   e.Disabled,
+				Strategy:   strategy,
+				Meta:       e.Meta,
+				Target:     e.Target,
+				GPO:        *p.winner,
+				Merged:     p.merged,
+				Overridden: p.overridden,
+			})
+		}
+	}
+
+	return d
+}
+
+// addTargets records the item-level targeting conditions of the rules of g, coming from origin.
+func (d *Dump) addTargets(origin GPOOrigin, g GPO) {
+	add := func(rules map[string][]entry.Entry, result bool) {
+		var domains []string
+		for domain := range rules {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			for _, e := range rules[domain] {
+				if e.Target == "" {
+					continue
+				}
+				d.Targets = append(d.Targets, RuleTarget{GPO: origin, Domain: domain, Key: e.Key, Target: e.Target, Result: result})
+			}
+		}
+	}
+	add(g.Rules, true)
+	add(g.TargetedOutRules, false)
+}
+
+// addFilters records the host filters of the applied and filteredOut GPOs, coming from the source configuration.
+func (d *Dump) addFilters(applied, filteredOut []GPO, source string) {
+	for _, g := range applied {
+		if g.Filter == "" {
+			continue
+		}
+		d.Filters = append(d.Filters, GPOFilter{GPO: GPOOrigin{ID: g.ID, Name: g.Name, Source: source, Loopback: g.Loopback}, Filter: g.Filter, Result: true})
+	}
+	for _, g := range filteredOut {
+		d.Filters = append(d.Filters, GPOFilter{GPO: GPOOrigin{ID: g.ID, Name: g.Name, Source: source}, Filter: g.Filter})
+	}
+}
+
+// marshal serializes d in the requested machine readable format.
+func (d Dump) marshal(format string) (string, error) {
+	switch format {
+	case FormatJSON:
+		out, err := json.MarshalIndent(d, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out) + "\n", nil
+	case FormatYAML:
+		out, err := yaml.Marshal(d)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	return "", errors.New(gotext.Get("unsupported format %q", format))
+}
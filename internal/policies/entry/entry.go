@@ -13,6 +13,12 @@ type Entry struct {
 	// Strategy are overlay rules for the same keys between multiple GPOs.
 	// Default (empty or unknown value) means "override".
 	Strategy string `yaml:",omitempty"`
+	// ReleaseOverride is the release whose specific value replaced the value set for all releases, if any.
+	ReleaseOverride string `yaml:",omitempty"`
+	// AllReleasesValue is the value set for all releases, before being replaced by the release specific one.
+	AllReleasesValue string `yaml:",omitempty"`
+	// Target is the item-level targeting condition restricting where and for whom the entry applies, if any.
+	Target string `yaml:",omitempty"`
 	// Err is set if there was an error parsing the entry. It is ignored if the
 	// underlying key is not supported by adsys.
 	Err error `yaml:"-"`
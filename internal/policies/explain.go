@@ -0,0 +1,84 @@
+package policies
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+)
+
+// explainRule writes to w every GPO defining key, in precedence order, with the value it sets and whether
+// this value is applied, merged with others or overridden.
+// key is the rule type followed by the rule key, like dconf/org/gnome/desktop/screensaver/lock-delay.
+// machineGPOs take precedence over targetGPOs, in the same way as they are displayed by GPO.Format.
+func explainRule(w io.Writer, key string, machineGPOs, targetGPOs []GPO, targetSource string) error {
+	key = strings.Trim(key, "/")
+	ruleType, ruleKey, found := strings.Cut(key, "/")
+	if !found || ruleKey == "" {
+		return errors.New(gotext.Get("invalid key %q: it should be the policy type followed by the key, like dconf/path/to/key", key))
+	}
+
+	d := newDump("", machineGPOs, targetGPOs, targetSource)
+	var rule *DumpRule
+	for i, r := range d.Rules {
+		if r.Domain == ruleType && r.Key == ruleKey {
+			rule = &d.Rules[i]
+			break
+		}
+	}
+
+	var gpos []GPO
+	gpos = append(gpos, machineGPOs...)
+	gpos = append(gpos, targetGPOs...)
+
+	fmt.Fprintln(w, gotext.Get("Explanation for %s:", key))
+	var definedBy int
+	for i, g := range gpos {
+		origin := d.GPOs[i]
+		for _, e := range g.Rules[ruleType] {
+			if e.Key != ruleKey {
+				continue
+			}
+			definedBy++
+
+			status := gotext.Get("overridden")
+			switch {
+			case e.Strategy == entry.StrategyAppend && e.Disabled:
+				status = gotext.Get("ignored: disabled appended value")
+			case rule != nil && rule.GPO == origin:
+				status = gotext.Get("applied")
+			case rule != nil && slices.Contains(rule.Merged, origin):
+				status = gotext.Get("merged")
+			}
+
+			fmt.Fprintf(w, "* %s (%s), %s\n", g.Name, g.ID, gotext.Get("from %s configuration: %s", origin.Source, status))
+			fmt.Fprintf(w, "** %s\n", gotext.Get("value: %s", formatEntryValue(e.Value, e.Disabled)))
+			if e.Strategy == entry.StrategyAppend {
+				fmt.Fprintf(w, "** %s\n", gotext.Get("strategy: append"))
+			}
+			if e.ReleaseOverride != "" {
+				fmt.Fprintf(w, "** %s\n", gotext.Get("release %s override replaced the value for all releases: %s",
+					e.ReleaseOverride, formatEntryValue(e.AllReleasesValue, false)))
+			}
+		}
+	}
+
+	if definedBy == 0 {
+		fmt.Fprintln(w, gotext.Get("No GPO defines this key."))
+		return nil
+	}
+	if rule == nil {
+		fmt.Fprintln(w, gotext.Get("Effective value: none"))
+		return nil
+	}
+	if len(rule.Merged) > 0 {
+		fmt.Fprintln(w, gotext.Get("Appended values are merged, from the furthest GPO to the closest one."))
+	}
+	fmt.Fprintln(w, gotext.Get("Effective value: %s", formatEntryValue(rule.Value, rule.Disabled)))
+
+	return nil
+}
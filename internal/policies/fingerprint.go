@@ -0,0 +1,123 @@
+package policies
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/decorate"
+	"gopkg.in/yaml.v3"
+)
+
+// fingerprintsRunBaseName is the base directory where the fingerprints of the last applied policies are stored.
+// It is in the run directory, so that every policy is applied again after a reboot.
+const fingerprintsRunBaseName = "fingerprints"
+
+// incrementalPolicyTypes are the policy types which are not applied again when their rules and assets did not change.
+// Scripts are excluded as they are not updated while a session is running, and certificates as the auto-enrollment
+// depends on the backend being online and renews the certificates.
+var incrementalPolicyTypes = []string{"dconf", "privilege", "mount", "apparmor", "gdm", "proxy"}
+
+// assetsPolicyTypes are the policy types shipping some of their content as policies assets.
+var assetsPolicyTypes = []string{"apparmor", "scripts", "ssh"}
+
+// fingerprints are the hashes of the rules and assets applied by each policy manager, indexed by policy type.
+type fingerprints map[string]string
+
+// fingerprint returns the hash of rules and, if withAssets is set, of the policies assets.
+func (pols *Policies) fingerprint(rules []entry.Entry, withAssets bool) (fp string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't compute policies fingerprint"))
+
+	d, err := yaml.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write(d)
+
+	if withAssets && pols.assets != nil {
+		a, err := assetsHash(pols.assets.assetsFrom)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(a))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ChangedPolicyTypes returns the sorted policy types whose rules or assets differ between previous and pols.
+func (pols *Policies) ChangedPolicyTypes(previous *Policies) (changed []string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't compare policies"))
+
+	rules := pols.GetUniqueRules()
+	previousRules := previous.GetUniqueRules()
+
+	policyTypes := make(map[string]struct{})
+	for t := range rules {
+		policyTypes[t] = struct{}{}
+	}
+	for t := range previousRules {
+		policyTypes[t] = struct{}{}
+	}
+
+	for t := range policyTypes {
+		withAssets := slices.Contains(assetsPolicyTypes, t)
+		fp, err := pols.fingerprint(rules[t], withAssets)
+		if err != nil {
+			return nil, err
+		}
+		previousFp, err := previous.fingerprint(previousRules[t], withAssets)
+		if err != nil {
+			return nil, err
+		}
+		if fp != previousFp {
+			changed = append(changed, t)
+		}
+	}
+	slices.Sort(changed)
+
+	return changed, nil
+}
+
+// loadFingerprints returns the fingerprints of the policies last applied to objectName.
+// Any error is only logged, as all policies are then applied again.
+func (m *Manager) loadFingerprints(ctx context.Context, objectName string) fingerprints {
+	fps := make(fingerprints)
+	d, err := os.ReadFile(filepath.Join(m.fingerprintsDir, objectName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fps
+	} else if err != nil {
+		log.Warning(ctx, gotext.Get("Can't read last applied policies fingerprints, applying all policies: %v", err))
+		return fps
+	}
+	if err := yaml.Unmarshal(d, &fps); err != nil {
+		log.Warning(ctx, gotext.Get("Can't read last applied policies fingerprints, applying all policies: %v", err))
+		return make(fingerprints)
+	}
+	return fps
+}
+
+// saveFingerprints atomically writes the fingerprints of the policies applied to objectName.
+func (m *Manager) saveFingerprints(objectName string, fps fingerprints) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't save policies fingerprints"))
+
+	d, err := yaml.Marshal(fps)
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(m.fingerprintsDir, objectName)
+	if err := os.WriteFile(p+".new", d, 0600); err != nil {
+		return err
+	}
+	return os.Rename(p+".new", p)
+}
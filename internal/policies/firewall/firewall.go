@@ -0,0 +1,446 @@
+// Package firewall provides a manager to apply firewall policies with nftables.
+//
+// The policy sets the default incoming and outgoing policies, and the ports, services and source
+// subnets from which incoming connections are allowed. It is rendered as an nftables ruleset in the
+// "inet adsys" table, which is the only one adsys owns: the tables of the system and of other tools,
+// like ufw, are left untouched.
+//
+// The ruleset starts by deleting the adsys table before recreating it, so that loading it with nft
+// replaces the previous adsys rules in a single transaction. The new ruleset is written next to the
+// current one, which is kept as .old until the new one is loaded. If nft rejects the new ruleset, the
+// previous one is restored and loaded again.
+//
+// If there are no entries to apply, the adsys table is deleted along with its ruleset.
+//
+// Those policies are only supported on computers.
+package firewall
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	defaultIncomingKey = "default-incoming"
+	defaultOutgoingKey = "default-outgoing"
+	allowedPortsKey    = "allowed-ports"
+	allowedSourcesKey  = "allowed-sources"
+)
+
+var supportedKeys = []string{defaultIncomingKey, defaultOutgoingKey, allowedPortsKey, allowedSourcesKey}
+
+const (
+	// rulesetName is the name of the adsys ruleset in the nftables directory.
+	rulesetName = "adsys.nft"
+	// table is the nftables table owned by adsys.
+	table = "inet adsys"
+)
+
+// unloadRuleset deletes the adsys table. Declaring the table first prevents any failure if it doesn't exist.
+const unloadRuleset = "table " + table + "\ndelete table " + table + "\n"
+
+// portRe matches a port, a range of ports or a service name, optionally restricted to a protocol.
+var portRe = regexp.MustCompile(`^(?:([0-9]+)(?:-([0-9]+))?|[a-z][a-z0-9-]*)(?:/(tcp|udp))?$`)
+
+// Manager prevents running multiple firewall updates in parallel.
+type Manager struct {
+	nftablesDir string
+	nftCmd      []string
+
+	mu sync.Mutex // Prevents loading multiple rulesets concurrently
+}
+
+type options struct {
+	nftCmd []string
+}
+
+// Option reprents an optional function to change the firewall manager.
+type Option func(*options)
+
+// WithNftCmd overrides the default nft command.
+func WithNftCmd(cmd []string) Option {
+	return func(o *options) {
+		o.nftCmd = cmd
+	}
+}
+
+// New returns a new firewall policy manager, writing its ruleset in nftablesDir.
+func New(nftablesDir string, opts ...Option) *Manager {
+	// defaults
+	args := options{
+		nftCmd: []string{"nft"},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	return &Manager{
+		nftablesDir: nftablesDir,
+		nftCmd:      args.nftCmd,
+	}
+}
+
+// ApplyPolicy generates the adsys nftables ruleset from entries and loads it, replacing the previous one.
+// If the new ruleset can't be loaded, the previous one is restored.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply firewall policy"))
+
+	// Firewall policies are only supported on computers
+	if !isComputer {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rulesetPath := filepath.Join(m.nftablesDir, rulesetName)
+
+	content, err := rulesetContent(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	if content == "" {
+		if _, err := os.Stat(rulesetPath); errors.Is(err, fs.ErrNotExist) {
+			log.Debug(ctx, gotext.Get("No entries found for the firewall policy"))
+			return nil
+		}
+		log.Debug(ctx, gotext.Get("No entries found for the firewall policy, unloading adsys firewall rules"))
+		if err := m.journalRuleset(ctx, rulesetPath); err != nil {
+			return err
+		}
+		if err := os.Remove(rulesetPath); err != nil {
+			return err
+		}
+		return m.load(ctx, unloadRuleset)
+	}
+
+	log.Debugf(ctx, "Applying firewall policy to %s", objectName)
+	if _, err := exec.LookPath(m.nftCmd[0]); err != nil {
+		return err
+	}
+	if err := m.journalRuleset(ctx, rulesetPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.nftablesDir, 0750); err != nil {
+		return err
+	}
+
+	// Remove any stale ruleset from a previous failed update
+	oldRulesetPath, newRulesetPath := rulesetPath+".old", rulesetPath+".new"
+	for _, p := range []string{oldRulesetPath, newRulesetPath} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	if err := os.WriteFile(newRulesetPath, []byte(content), 0600); err != nil {
+		return err
+	}
+	hadRuleset := true
+	if err := os.Rename(rulesetPath, oldRulesetPath); errors.Is(err, fs.ErrNotExist) {
+		hadRuleset = false
+	} else if err != nil {
+		return err
+	}
+	if err := os.Rename(newRulesetPath, rulesetPath); err != nil {
+		return err
+	}
+
+	if err := m.load(ctx, content); err != nil {
+		m.restore(ctx, rulesetPath, hadRuleset)
+		return err
+	}
+
+	if hadRuleset {
+		return os.Remove(oldRulesetPath)
+	}
+	return nil
+}
+
+// restore puts back the previous ruleset, kept as .old, and loads it again.
+// If there was no previous ruleset, the adsys table is deleted.
+func (m *Manager) restore(ctx context.Context, rulesetPath string, hadRuleset bool) {
+	previous := unloadRuleset
+	if hadRuleset {
+		if err := os.Rename(rulesetPath+".old", rulesetPath); err != nil {
+			log.Warning(ctx, gotext.Get("Couldn't restore previous firewall ruleset: %v", err))
+			return
+		}
+		content, err := os.ReadFile(rulesetPath)
+		if err != nil {
+			log.Warning(ctx, gotext.Get("Couldn't read previous firewall ruleset: %v", err))
+			return
+		}
+		previous = string(content)
+	} else if err := os.Remove(rulesetPath); err != nil {
+		log.Warning(ctx, gotext.Get("Couldn't remove new firewall ruleset: %v", err))
+	}
+
+	if err := m.load(ctx, previous); err != nil {
+		log.Warning(ctx, gotext.Get("Couldn't reload previous firewall ruleset: %v", err))
+	}
+}
+
+// journalRuleset records the nftables directory in the journal of ctx, if any.
+// On rollback, the restored ruleset is loaded again, or the adsys table is deleted if there was none.
+func (m *Manager) journalRuleset(ctx context.Context, rulesetPath string) error {
+	// Rollback actions are run in reverse order: this one is called once the ruleset is restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		content, err := os.ReadFile(rulesetPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			return m.load(ctx, unloadRuleset)
+		} else if err != nil {
+			return err
+		}
+		return m.load(ctx, string(content))
+	})
+
+	// The whole directory is recorded, as it may be created to store the ruleset.
+	return journal.Record(ctx, m.nftablesDir)
+}
+
+// load loads ruleset with nft, in a single transaction.
+func (m *Manager) load(ctx context.Context, ruleset string) error {
+	// #nosec G204 - We are in control of the arguments
+	cmd := exec.CommandContext(ctx, m.nftCmd[0], append(slices.Clone(m.nftCmd[1:]), "-f", "-")...)
+	cmd.Stdin = strings.NewReader(ruleset)
+	smbsafe.WaitExec()
+	out, err := cmd.CombinedOutput()
+	smbsafe.DoneExec()
+	if err != nil {
+		return errors.New(gotext.Get("failed to load firewall rules: %v\n%s", err, string(out)))
+	}
+	return nil
+}
+
+// Plan returns the changes ApplyPolicy would make to the adsys firewall rules, without applying them.
+func (m *Manager) Plan(ctx context.Context, _ string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan firewall policy"))
+
+	if !isComputer {
+		return nil, nil
+	}
+
+	// Don't read the ruleset while it is being updated.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rulesetPath := filepath.Join(m.nftablesDir, rulesetName)
+
+	content, err := rulesetContent(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	if content == "" {
+		c, exists := plan.ForRemoval(rulesetPath)
+		if !exists {
+			return nil, nil
+		}
+		return []plan.Change{c, {Action: plan.CommandRun, Target: "nft delete table " + table}}, nil
+	}
+
+	c, changed, err := plan.ForFile(rulesetPath, content)
+	if err != nil || !changed {
+		return nil, err
+	}
+	return []plan.Change{c, {Action: plan.CommandRun, Target: "nft -f " + rulesetPath}}, nil
+}
+
+// rulesetContent returns the nftables ruleset generated from entries.
+// It is empty if there are no enabled entries.
+func rulesetContent(ctx context.Context, entries []entry.Entry) (content string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to parse firewall entries"))
+
+	incoming, outgoing := "drop", "accept"
+	ports := make(map[string][]string)
+	var sources4, sources6 []string
+
+	var enabled bool
+	for _, e := range entries {
+		key := e.Key[strings.LastIndex(e.Key, "/")+1:]
+		if !slices.Contains(supportedKeys, key) {
+			log.Warning(ctx, gotext.Get("Encountered unsupported key '%s' while parsing firewall entries, skipping it", key))
+			continue
+		}
+		if e.Disabled {
+			log.Debug(ctx, gotext.Get("The entry %q is disabled and will be skipped", e.Key))
+			continue
+		}
+		if e.Err != nil {
+			return "", errors.New(gotext.Get("entry %q is errored: %v", e.Key, e.Err))
+		}
+		enabled = true
+
+		switch key {
+		case defaultIncomingKey:
+			if incoming, err = nftPolicy(e); err != nil {
+				return "", err
+			}
+		case defaultOutgoingKey:
+			if outgoing, err = nftPolicy(e); err != nil {
+				return "", err
+			}
+		case allowedPortsKey:
+			for _, p := range values(e) {
+				protocols, port, err := parsePort(p)
+				if err != nil {
+					return "", errors.New(gotext.Get("invalid port %q in %q: %v", p, e.Key, err))
+				}
+				for _, proto := range protocols {
+					if !slices.Contains(ports[proto], port) {
+						ports[proto] = append(ports[proto], port)
+					}
+				}
+			}
+		case allowedSourcesKey:
+			for _, s := range values(e) {
+				source, isIPv6, err := parseSource(s)
+				if err != nil {
+					return "", errors.New(gotext.Get("invalid source subnet %q in %q: %v", s, e.Key, err))
+				}
+				if !isIPv6 && !slices.Contains(sources4, source) {
+					sources4 = append(sources4, source)
+				} else if isIPv6 && !slices.Contains(sources6, source) {
+					sources6 = append(sources6, source)
+				}
+			}
+		}
+	}
+
+	if !enabled {
+		return "", nil
+	}
+
+	var ruleset strings.Builder
+	ruleset.WriteString(`# This file is managed by adsys.
+# Do not edit this file manually.
+# Any changes will be overwritten.
+
+`)
+	ruleset.WriteString(unloadRuleset)
+	fmt.Fprintf(&ruleset, "\ntable %s {\n", table)
+
+	fmt.Fprintf(&ruleset, "\tchain input {\n\t\ttype filter hook input priority filter; policy %s;\n", incoming)
+	ruleset.WriteString("\t\tct state established,related accept\n\t\tct state invalid drop\n\t\tiif \"lo\" accept\n")
+	ruleset.WriteString("\t\tmeta l4proto { icmp, ipv6-icmp } accept\n")
+	for _, proto := range []string{"tcp", "udp"} {
+		if len(ports[proto]) > 0 {
+			fmt.Fprintf(&ruleset, "\t\t%s dport { %s } accept\n", proto, strings.Join(ports[proto], ", "))
+		}
+	}
+	if len(sources4) > 0 {
+		fmt.Fprintf(&ruleset, "\t\tip saddr { %s } accept\n", strings.Join(sources4, ", "))
+	}
+	if len(sources6) > 0 {
+		fmt.Fprintf(&ruleset, "\t\tip6 saddr { %s } accept\n", strings.Join(sources6, ", "))
+	}
+	ruleset.WriteString("\t}\n\n")
+
+	fmt.Fprintf(&ruleset, "\tchain output {\n\t\ttype filter hook output priority filter; policy %s;\n", outgoing)
+	if outgoing == "drop" {
+		ruleset.WriteString("\t\tct state established,related accept\n\t\toif \"lo\" accept\n")
+	}
+	ruleset.WriteString("\t}\n}\n")
+
+	return ruleset.String(), nil
+}
+
+// nftPolicy returns the nftables chain policy of a default policy entry.
+func nftPolicy(e entry.Entry) (string, error) {
+	switch strings.TrimSpace(e.Value) {
+	case "allow":
+		return "accept", nil
+	case "deny":
+		return "drop", nil
+	}
+	return "", errors.New(gotext.Get("invalid value %q for %q, expected allow or deny", e.Value, e.Key))
+}
+
+// values returns the non empty lines of the entry value.
+func values(e entry.Entry) (values []string) {
+	for _, v := range strings.Split(e.Value, "\n") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// parsePort returns the protocols and the nftables port of p, which is a port, a range of ports or a service
+// name, optionally followed by /tcp or /udp. If no protocol is specified, ports apply to both protocols and
+// services to tcp only.
+func parsePort(p string) (protocols []string, port string, err error) {
+	m := portRe.FindStringSubmatch(p)
+	if m == nil {
+		return nil, "", errors.New(gotext.Get("expected a port, a range of ports or a service name, optionally followed by /tcp or /udp"))
+	}
+
+	port, _, _ = strings.Cut(p, "/")
+	if m[1] != "" {
+		first, err := strconv.Atoi(m[1])
+		last := first
+		if err == nil && m[2] != "" {
+			last, err = strconv.Atoi(m[2])
+		}
+		if err != nil || first < 1 || last > 65535 || first > last {
+			return nil, "", errors.New(gotext.Get("ports must be between 1 and 65535, in increasing order"))
+		}
+	}
+
+	switch {
+	case m[3] != "":
+		return []string{m[3]}, port, nil
+	case m[1] == "":
+		// Most services in /etc/services are only defined for tcp, which nft would fail to resolve for udp
+		return []string{"tcp"}, port, nil
+	}
+	return []string{"tcp", "udp"}, port, nil
+}
+
+// parseSource returns the nftables address or subnet of s, which is an IPv4 or IPv6 address or subnet,
+// and if it is an IPv6 one.
+func parseSource(s string) (source string, isIPv6 bool, err error) {
+	prefix, err := netip.ParsePrefix(s)
+	if !strings.Contains(s, "/") {
+		var addr netip.Addr
+		if addr, err = netip.ParseAddr(s); err == nil && addr.Zone() != "" {
+			err = errors.New(gotext.Get("addresses with a zone are not supported"))
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	isIPv6 = prefix.Addr().Is6()
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String(), isIPv6, nil
+	}
+	// nft rejects subnets with host bits set
+	return prefix.Masked().String(), isIPv6, nil
+}
@@ -0,0 +1,235 @@
+package firewall_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/termie/go-shutil"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/firewall"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing string
+		isUser   bool
+		noNft    bool
+
+		wantErr bool
+	}{
+		"Allow ports and sources": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "22/tcp\nhttps"},
+			{Key: "firewall/allowed-sources", Value: "10.0.0.0/8"},
+		}},
+		"Default policies only": {entries: []entry.Entry{
+			{Key: "firewall/default-incoming", Value: "allow"},
+			{Key: "firewall/default-outgoing", Value: "allow"},
+		}},
+		"Deny outgoing connections": {entries: []entry.Entry{
+			{Key: "firewall/default-outgoing", Value: "deny"},
+			{Key: "firewall/allowed-ports", Value: "22"},
+		}},
+		"Ports with protocols, ranges and services": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "22/tcp\n53/udp\n60000-61000/udp\n8080\nssh\nhttps/tcp"},
+		}},
+		"IPv4 and IPv6 sources": {entries: []entry.Entry{
+			{Key: "firewall/allowed-sources", Value: "192.168.1.0/24\n10.1.2.3\nfd00::/8\n2001:db8::1"},
+		}},
+		"Subnets with host bits set are masked": {entries: []entry.Entry{
+			{Key: "firewall/allowed-sources", Value: "192.168.1.42/24\nfd00::1/8"},
+		}},
+		"Duplicated ports and sources are listed once": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "22/tcp\n22\n22/tcp"},
+			{Key: "firewall/allowed-sources", Value: "10.0.0.0/8\n10.0.0.0/8\n10.1.0.0/8"},
+		}},
+		"Empty lines and spaces are ignored": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "\n  22/tcp  \n\n"},
+			{Key: "firewall/default-incoming", Value: " deny "},
+		}},
+		"Disabled entries are ignored": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "22/tcp"},
+			{Key: "firewall/default-incoming", Value: "allow", Disabled: true},
+		}},
+		"Unsupported keys are ignored": {entries: []entry.Entry{
+			{Key: "firewall/allowed-ports", Value: "22/tcp"},
+			{Key: "firewall/allowed-interfaces", Value: "eth0"},
+		}},
+		"Replace existing ruleset":   {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "https"}}, existing: "existing"},
+		"Stale rulesets are removed": {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "https"}}, existing: "stale"},
+
+		"No entries without existing ruleset is a no-op":  {},
+		"No entries unloads existing ruleset":             {existing: "existing"},
+		"All entries disabled unloads existing ruleset":   {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22", Disabled: true}}, existing: "existing"},
+		"Firewall policy is not applied for users":        {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22"}}, isUser: true},
+		"No entries does not need nft without a ruleset":  {noNft: true},
+		"Firewall policy for users does not need nft":     {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22"}}, isUser: true, noNft: true},
+		"No entries keeps other files in nftables folder": {existing: "other-files"},
+
+		// Error cases
+		"Error when nft rejects the ruleset, previous one is restored": {
+			entries:  []entry.Entry{{Key: "firewall/allowed-ports", Value: "broken-service"}},
+			existing: "existing",
+			wantErr:  true,
+		},
+		"Error when nft rejects the ruleset without previous one": {
+			entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "broken-service"}},
+			wantErr: true,
+		},
+		"Error when nft is not available":           {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22"}}, noNft: true, wantErr: true},
+		"Error on invalid default policy":           {entries: []entry.Entry{{Key: "firewall/default-incoming", Value: "reject"}}, wantErr: true},
+		"Error on invalid port":                     {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22/sctp"}}, wantErr: true},
+		"Error on port out of range":                {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "65536"}}, wantErr: true},
+		"Error on port range in decreasing order":   {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "2000-1000"}}, wantErr: true},
+		"Error on service name with nft statements": {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "ssh } accept; drop {"}}, wantErr: true},
+		"Error on invalid source":                   {entries: []entry.Entry{{Key: "firewall/allowed-sources", Value: "10.0.0.0/33"}}, wantErr: true},
+		"Error on source address with a zone":       {entries: []entry.Entry{{Key: "firewall/allowed-sources", Value: "fe80::1%eth0"}}, wantErr: true},
+		"Error on errored entry":                    {entries: []entry.Entry{{Key: "firewall/allowed-ports", Err: errors.New("some error")}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			if tc.existing != "" {
+				require.NoError(t, os.RemoveAll(root), "Setup: can't remove test root")
+				require.NoError(t,
+					shutil.CopyTree(filepath.Join("testdata", tc.existing), root,
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create existing nftables state")
+			}
+			nftablesDir := filepath.Join(root, "nftables.d")
+
+			nftCmd := mockNft(t, root)
+			if tc.noNft {
+				nftCmd = []string{"doesnotexist-nft"}
+			}
+
+			m := firewall.New(nftablesDir, firewall.WithNftCmd(nftCmd))
+			err := m.ApplyPolicy(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "ApplyPolicy should have failed but didn't")
+			} else {
+				require.NoError(t, err, "ApplyPolicy should not have failed")
+			}
+
+			testutils.CompareTreesWithFiltering(t, root, testutils.GoldenPath(t), testutils.UpdateEnabled())
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing string
+		isUser   bool
+
+		wantErr bool
+	}{
+		"New ruleset":                              {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22/tcp"}}},
+		"Modified ruleset":                         {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "https"}}, existing: "existing"},
+		"Unchanged ruleset":                        {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22/tcp"}}, existing: "existing"},
+		"No entries with a ruleset":                {existing: "existing"},
+		"No entries without any ruleset":           {},
+		"Firewall policy is not planned for users": {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "22"}}, isUser: true},
+
+		// Error cases
+		"Error on invalid port": {entries: []entry.Entry{{Key: "firewall/allowed-ports", Value: "not a port"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			nftablesDir := filepath.Join(t.TempDir(), "nftables.d")
+			if tc.existing != "" {
+				testutils.Copy(t, filepath.Join("testdata", tc.existing, "nftables.d"), nftablesDir)
+			}
+
+			m := firewall.New(nftablesDir, firewall.WithNftCmd([]string{"this-should-not-be-called"}))
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan should not have failed")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), nftablesDir, "NFTABLES_DIR"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
+// mockNft returns a mocked nft command, storing the last loaded ruleset in root/loaded.
+func mockNft(t *testing.T, root string) []string {
+	t.Helper()
+
+	return []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockNft", "--", root}
+}
+
+func TestMockNft(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	root, args := args[0], args[1:]
+
+	if strings.Join(args, " ") != "-f -" {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %v\n", args)
+		os.Exit(1)
+	}
+	ruleset, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: can't read ruleset: %v\n", err)
+		os.Exit(1)
+	}
+	// Like nft, reject unknown service names
+	if strings.Contains(string(ruleset), "broken") {
+		fmt.Fprintln(os.Stderr, "Error: Could not resolve service: Servname not supported for ai_socktype")
+		os.Exit(1)
+	}
+
+	// The ruleset deleting the adsys table leaves nothing loaded
+	if !strings.Contains(string(ruleset), "table inet adsys {") {
+		if err := os.Remove(filepath.Join(root, "loaded")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Error: can't unload ruleset: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := os.WriteFile(filepath.Join(root, "loaded"), ruleset, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: can't load ruleset: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+	testutils.MergeCoverages()
+}
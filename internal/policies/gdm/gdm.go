@@ -13,6 +13,7 @@ import (
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/dconf"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/decorate"
 	"golang.org/x/sync/errgroup"
 )
@@ -61,13 +62,7 @@ func (m *Manager) ApplyPolicy(ctx context.Context, entries []entry.Entry) (err e
 
 	log.Debug(ctx, "ApplyPolicy gdm policy")
 
-	// Order all entries by keytype for gdm
-	sortedEntries := make(map[string][]entry.Entry)
-	for _, e := range entries {
-		keyType := strings.Split(e.Key, "/")[0]
-		e.Key = strings.TrimPrefix(e.Key, keyType+"/")
-		sortedEntries[keyType] = append(sortedEntries[keyType], e)
-	}
+	sortedEntries := sortEntries(entries)
 
 	var g errgroup.Group
 	g.Go(func() error { return m.dconf.ApplyPolicy(ctx, "gdm", false, sortedEntries["dconf"]) })
@@ -78,3 +73,21 @@ func (m *Manager) ApplyPolicy(ctx context.Context, entries []entry.Entry) (err e
 
 	return nil
 }
+
+// Plan returns the changes ApplyPolicy would make to the gdm dconf database, without applying them.
+func (m *Manager) Plan(ctx context.Context, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan gdm policy"))
+
+	return m.dconf.Plan(ctx, "gdm", false, sortEntries(entries)["dconf"])
+}
+
+// sortEntries orders all entries by keytype for gdm.
+func sortEntries(entries []entry.Entry) map[string][]entry.Entry {
+	sortedEntries := make(map[string][]entry.Entry)
+	for _, e := range entries {
+		keyType := strings.Split(e.Key, "/")[0]
+		e.Key = strings.TrimPrefix(e.Key, keyType+"/")
+		sortedEntries[keyType] = append(sortedEntries[keyType], e)
+	}
+	return sortedEntries
+}
@@ -2,7 +2,10 @@ package gdm_test
 
 import (
 	"context"
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -50,3 +53,63 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries      []entry.Entry
+		applyEntries bool
+
+		wantErr bool
+	}{
+		"dconf policy":                             {entries: []entry.Entry{{Key: "dconf/com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}}},
+		"dconf policy already applied is no-op":    {entries: []entry.Entry{{Key: "dconf/com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}}, applyEntries: true},
+		"Other entry types than dconf are ignored": {entries: []entry.Entry{{Key: "other/com/ubuntu/category/key-s", Value: "'onekey-s-othervalue'", Meta: "s"}}},
+
+		"Error on invalid dconf entry": {entries: []entry.Entry{{Key: "dconf/com/ubuntu/category/key-i", Value: "NaN", Meta: "i"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dconfDir := t.TempDir()
+
+			// Apply machine configuration
+			dconfManager := dconf.NewWithDconfDir(dconfDir)
+			err := dconfManager.ApplyPolicy(context.Background(), "ubuntu", true, nil)
+			require.NoError(t, err, "Setup: ApplyPolicy failed but shouldn't have")
+
+			m, err := gdm.New(gdm.WithDconf(dconfManager))
+			require.NoError(t, err, "Setup: can't create gdm manager")
+
+			if tc.applyEntries {
+				err = m.ApplyPolicy(context.Background(), tc.entries)
+				require.NoError(t, err, "Setup: ApplyPolicy failed but shouldn't have")
+				// Compiled dconf databases are only created if dconf is installed.
+				for _, db := range []string{"machine", "gdm"} {
+					p := filepath.Join(dconfDir, "db", db)
+					if _, err := os.Stat(p); err == nil {
+						continue
+					}
+					require.NoError(t, os.WriteFile(p, nil, 0600), "Setup: can't create compiled dconf database")
+				}
+			}
+
+			changes, err := m.Plan(context.Background(), tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan failed but shouldn't have")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), dconfDir, "#DCONFDIR#"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
@@ -14,13 +14,30 @@ import (
 type GPO struct {
 	ID   string
 	Name string
+	// Filter is the host filter restricting the machines the GPO applies to, if any.
+	Filter string `yaml:",omitempty"`
+	// Loopback is true if the GPO is linked to the computer and applies its user settings with loopback processing.
+	Loopback bool `yaml:",omitempty"`
 	// the string is the domain of rules (dconf, install…)
 	Rules map[string][]entry.Entry
+	// TargetedOutRules are the rules which are not applied as their item-level targeting evaluated to false.
+	TargetedOutRules map[string][]entry.Entry `yaml:",omitempty"`
 }
 
 // Format write to w a formatted GPO. overridden entries are prepended with -.
 func (g GPO) Format(w io.Writer, withRules, withOverridden bool, alreadyProcessedRules map[string]struct{}) map[string]struct{} {
-	fmt.Fprintf(w, "* %s (%s)\n", g.Name, g.ID)
+	var tags []string
+	if g.Loopback {
+		tags = append(tags, "loopback")
+	}
+	if g.Filter != "" {
+		tags = append(tags, "filter: "+g.Filter)
+	}
+	if len(tags) > 0 {
+		fmt.Fprintf(w, "* %s (%s) [%s]\n", g.Name, g.ID, strings.Join(tags, ", "))
+	} else {
+		fmt.Fprintf(w, "* %s (%s)\n", g.Name, g.ID)
+	}
 
 	if !withRules {
 		return nil
@@ -34,6 +51,11 @@ func (g GPO) Format(w io.Writer, withRules, withOverridden bool, alreadyProcesse
 	for domain := range g.Rules {
 		domains = append(domains, domain)
 	}
+	for domain := range g.TargetedOutRules {
+		if _, ok := g.Rules[domain]; !ok {
+			domains = append(domains, domain)
+		}
+	}
 	sort.Strings(domains)
 
 	for _, d := range domains {
@@ -48,14 +70,11 @@ func (g GPO) Format(w io.Writer, withRules, withOverridden bool, alreadyProcesse
 			if overr {
 				prefix += "-"
 			}
-			// Trim EOL \n and replace them all with \n in text to keep each value printed in one single line
-			v := strings.ReplaceAll(strings.TrimSpace(r.Value), "\n", `\n`)
-			if r.Disabled {
-				prefix += "+"
-				fmt.Fprintf(w, "%s %s\n", prefix, r.Key)
-			} else {
-				fmt.Fprintf(w, "%s %s: %s\n", prefix, r.Key, v)
+			var suffix string
+			if r.Target != "" {
+				suffix = fmt.Sprintf(" [target: %s]", r.Target)
 			}
+			formatRule(w, prefix, suffix, r)
 
 			// Do not add non overridable key to the alreadyProcessedRules override detection map.
 			if r.Strategy == "append" {
@@ -63,7 +82,27 @@ func (g GPO) Format(w io.Writer, withRules, withOverridden bool, alreadyProcesse
 			}
 			alreadyProcessedRules[k] = struct{}{}
 		}
+		// Rules excluded by their item-level targeting are never applied.
+		for _, r := range g.TargetedOutRules[d] {
+			formatRule(w, "***-", fmt.Sprintf(" [targeted out: %s]", r.Target), r)
+		}
 	}
 
 	return alreadyProcessedRules
 }
+
+// FormatFilteredOut writes to w a GPO which is not applied as its host filter evaluated to false.
+func (g GPO) FormatFilteredOut(w io.Writer) {
+	fmt.Fprintf(w, "*- %s (%s) [filtered out: %s]\n", g.Name, g.ID, g.Filter)
+}
+
+// formatRule writes to w a single rule, with prefix and suffix.
+func formatRule(w io.Writer, prefix, suffix string, r entry.Entry) {
+	if r.Disabled {
+		fmt.Fprintf(w, "%s+ %s%s\n", prefix, r.Key, suffix)
+		return
+	}
+	// Trim EOL \n and replace them all with \n in text to keep each value printed in one single line
+	v := strings.ReplaceAll(strings.TrimSpace(r.Value), "\n", `\n`)
+	fmt.Fprintf(w, "%s %s: %s%s\n", prefix, r.Key, v, suffix)
+}
@@ -0,0 +1,370 @@
+package policies
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	historyDirName = "history"
+	// historySize is the maximum number of generations kept in the history of an object.
+	historySize = 10
+)
+
+// Generation is a version of the policies applied to an object, as kept in its history.
+type Generation struct {
+	ID int
+	// AppliedAt is the first time this version of the policies was applied.
+	AppliedAt time.Time
+	// AssetsHash is the sha256 of the assets database, empty if there was no asset.
+	AssetsHash string
+	GPOs       []GPO
+
+	path string
+}
+
+// History returns the generations of policies kept in the p cache directory, oldest first.
+func History(p string) (gens []Generation, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't read policies history from %s", p))
+
+	ids, err := generationIDs(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		g, err := loadGeneration(filepath.Join(p, historyDirName, strconv.Itoa(id)), id)
+		if err != nil {
+			return nil, err
+		}
+		gens = append(gens, g)
+	}
+
+	return gens, nil
+}
+
+// generationIDs returns the ids of the generations kept in the history of the p cache directory, oldest first.
+func generationIDs(p string) (ids []int, err error) {
+	dirs, err := os.ReadDir(filepath.Join(p, historyDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, d := range dirs {
+		id, err := strconv.Atoi(d.Name())
+		if err != nil || !d.IsDir() {
+			// Ignore any generation being written.
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	return ids, nil
+}
+
+// GenerationFromHistory returns the generation id from the history of the p cache directory.
+func GenerationFromHistory(p string, id int) (g Generation, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't get generation %d of policies history", id))
+
+	genPath := filepath.Join(p, historyDirName, strconv.Itoa(id))
+	if _, err := os.Stat(genPath); err != nil {
+		return g, errors.New(gotext.Get("no generation %d in history", id))
+	}
+	return loadGeneration(genPath, id)
+}
+
+// loadGeneration reads the generation id stored in p.
+func loadGeneration(p string, id int) (g Generation, err error) {
+	info, err := os.Stat(filepath.Join(p, policiesFileName))
+	if err != nil {
+		return g, err
+	}
+	hash, err := assetsHash(filepath.Join(p, policiesAssetsFileName))
+	if err != nil {
+		return g, err
+	}
+	pols, err := NewFromCache(context.Background(), p)
+	if err != nil {
+		return g, err
+	}
+	defer pols.Close()
+
+	return Generation{
+		ID:         id,
+		AppliedAt:  info.ModTime(),
+		AssetsHash: hash,
+		GPOs:       pols.GPOs,
+		path:       p,
+	}, nil
+}
+
+// Policies returns the policies of this generation, with their assets.
+func (g Generation) Policies(ctx context.Context) (Policies, error) {
+	return NewFromCache(ctx, g.path)
+}
+
+// saveToHistory adds the policies saved in p as a new generation in its history, unless they are identical
+// to the last generation. The oldest generations are removed to keep historySize of them.
+// Only the last generation is read: older ones, even corrupted, are never loaded.
+func saveToHistory(p string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't save policies to history"))
+
+	ids, err := generationIDs(p)
+	if err != nil {
+		return err
+	}
+
+	content, err := os.ReadFile(filepath.Join(p, policiesFileName))
+	if err != nil {
+		return err
+	}
+	assetsPath := filepath.Join(p, policiesAssetsFileName)
+	hash, err := assetsHash(assetsPath)
+	if err != nil {
+		return err
+	}
+
+	id := 1
+	var lastPath, lastHash string
+	if len(ids) > 0 {
+		id = ids[len(ids)-1] + 1
+		lastPath = filepath.Join(p, historyDirName, strconv.Itoa(ids[len(ids)-1]))
+		// An unreadable last generation is considered different: the new one replaces it as the current one.
+		lastContent, errContent := os.ReadFile(filepath.Join(lastPath, policiesFileName))
+		lastHash, err = assetsHash(filepath.Join(lastPath, policiesAssetsFileName))
+		if errContent == nil && err == nil && bytes.Equal(content, lastContent) && hash == lastHash {
+			return nil
+		}
+	}
+
+	// Write the generation aside, so that a partial one is never listed.
+	genPath := filepath.Join(p, historyDirName, strconv.Itoa(id))
+	tmpPath := genPath + ".new"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(tmpPath, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpPath, policiesFileName), content, 0600); err != nil {
+		return err
+	}
+	if hash != "" {
+		// Share the assets with the previous generation when they didn't change.
+		src := assetsPath
+		if lastPath != "" && hash == lastHash {
+			src = filepath.Join(lastPath, policiesAssetsFileName)
+		}
+		if err := linkOrCopy(src, filepath.Join(tmpPath, policiesAssetsFileName)); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmpPath, genPath); err != nil {
+		return err
+	}
+
+	// Prune oldest generations
+	ids = append(ids, id)
+	for len(ids) > historySize {
+		if err := os.RemoveAll(filepath.Join(p, historyDirName, strconv.Itoa(ids[0]))); err != nil {
+			return err
+		}
+		ids = ids[1:]
+	}
+
+	return nil
+}
+
+// assetsHash returns the sha256 of the assets database in p, or an empty string if there is none.
+func assetsHash(p string) (string, error) {
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// linkOrCopy hard links src to dst, or copies it if it can't be linked.
+func linkOrCopy(src, dst string) (err error) {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errClose := out.Close(); err == nil {
+			err = errClose
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// FormatHistory writes to w the list of generations of policies applied to objectName, most recent first.
+func FormatHistory(w io.Writer, objectName string, gens []Generation) {
+	if len(gens) == 0 {
+		fmt.Fprintln(w, gotext.Get("No policies history for %s", objectName))
+		return
+	}
+
+	fmt.Fprintln(w, gotext.Get("Policies history for %s:", objectName))
+	for i := len(gens) - 1; i >= 0; i-- {
+		g := gens[i]
+		current := ""
+		if i == len(gens)-1 {
+			current = gotext.Get(" (current)")
+		}
+		fmt.Fprintf(w, "* %d%s: %s\n", g.ID, current, g.AppliedAt.UTC().Format(time.RFC3339))
+		for _, gpo := range g.GPOs {
+			fmt.Fprintf(w, "** %s (%s)\n", gpo.Name, gpo.ID)
+		}
+		if g.AssetsHash != "" {
+			fmt.Fprintln(w, gotext.Get("** assets: %s", g.AssetsHash))
+		}
+	}
+}
+
+// FormatDiff writes to w the changes of GPOs, rules and assets between the generations from and to.
+func FormatDiff(w io.Writer, from, to Generation) {
+	var out strings.Builder
+
+	var gpoChanges []string
+	for _, g := range from.GPOs {
+		if !slices.ContainsFunc(to.GPOs, func(o GPO) bool { return o.ID == g.ID }) {
+			gpoChanges = append(gpoChanges, fmt.Sprintf("- %s (%s)", g.Name, g.ID))
+		}
+	}
+	for _, g := range to.GPOs {
+		if !slices.ContainsFunc(from.GPOs, func(o GPO) bool { return o.ID == g.ID }) {
+			gpoChanges = append(gpoChanges, fmt.Sprintf("+ %s (%s)", g.Name, g.ID))
+		}
+	}
+	if len(gpoChanges) > 0 {
+		fmt.Fprintln(&out, gotext.Get("* GPOs"))
+		for _, c := range gpoChanges {
+			fmt.Fprintf(&out, "** %s\n", c)
+		}
+	}
+
+	fromRules := Policies{GPOs: from.GPOs}.GetUniqueRules()
+	toRules := Policies{GPOs: to.GPOs}.GetUniqueRules()
+	var ruleTypes []string
+	for t := range fromRules {
+		ruleTypes = append(ruleTypes, t)
+	}
+	for t := range toRules {
+		if _, ok := fromRules[t]; !ok {
+			ruleTypes = append(ruleTypes, t)
+		}
+	}
+	slices.Sort(ruleTypes)
+
+	for _, t := range ruleTypes {
+		var changes []string
+		fromValues := make(map[string]string)
+		for _, e := range fromRules[t] {
+			fromValues[e.Key] = formatEntryValue(e.Value, e.Disabled)
+		}
+		toValues := make(map[string]string)
+		for _, e := range toRules[t] {
+			toValues[e.Key] = formatEntryValue(e.Value, e.Disabled)
+		}
+
+		var keys []string
+		for k := range fromValues {
+			keys = append(keys, k)
+		}
+		for k := range toValues {
+			if _, ok := fromValues[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			oldV, inFrom := fromValues[k]
+			newV, inTo := toValues[k]
+			switch {
+			case !inTo:
+				changes = append(changes, fmt.Sprintf("- %s: %s", k, oldV))
+			case !inFrom:
+				changes = append(changes, fmt.Sprintf("+ %s: %s", k, newV))
+			case oldV != newV:
+				changes = append(changes, fmt.Sprintf("~ %s: %s -> %s", k, oldV, newV))
+			}
+		}
+		if len(changes) == 0 {
+			continue
+		}
+		fmt.Fprintf(&out, "* %s\n", t)
+		for _, c := range changes {
+			fmt.Fprintf(&out, "** %s\n", c)
+		}
+	}
+
+	if from.AssetsHash != to.AssetsHash {
+		fmt.Fprintln(&out, gotext.Get("* assets"))
+		fmt.Fprintf(&out, "** %s -> %s\n", formatAssetsHash(from.AssetsHash), formatAssetsHash(to.AssetsHash))
+	}
+
+	if out.Len() == 0 {
+		fmt.Fprintln(w, gotext.Get("No changes between generations %d and %d", from.ID, to.ID))
+		return
+	}
+	fmt.Fprintln(w, gotext.Get("Changes between generations %d and %d:", from.ID, to.ID))
+	fmt.Fprint(w, out.String())
+}
+
+// formatEntryValue returns the value of an entry on a single line.
+func formatEntryValue(v string, disabled bool) string {
+	if disabled {
+		return gotext.Get("Disabled")
+	}
+	return strings.ReplaceAll(strings.TrimSpace(v), "\n", `\n`)
+}
+
+// formatAssetsHash returns the hash of an assets database for display.
+func formatAssetsHash(h string) string {
+	if h == "" {
+		return gotext.Get("none")
+	}
+	return h
+}
@@ -0,0 +1,269 @@
+// Package journal records the state of the system before policy managers modify it, so that a
+// failed policy application can be rolled back as a whole.
+//
+// Policy managers record every file or directory they are about to change with Record, and register
+// with OnRollback the actions needed to revert any state which is not stored on disk, like loaded
+// apparmor profiles or started systemd units. Rollback then restores recorded paths and runs those
+// actions in reverse order. Commit discards the journal once every manager succeeded.
+//
+// The journal is carried in the context: managers called without a journal don't record anything.
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/decorate"
+)
+
+// Journal keeps the prior state of every artifact touched during a policy application.
+type Journal struct {
+	dir string
+
+	mu       sync.Mutex
+	recorded []string
+	steps    []step
+}
+
+// step is a single revertible modification: either a recorded path or a rollback action.
+type step struct {
+	path string
+	// backup is the copy of path before its modification, empty if path didn't exist.
+	backup string
+
+	undo func(context.Context) error
+}
+
+// New returns a new journal storing its backups in dir.
+// Any leftover from a previous journal in dir is discarded.
+func New(dir string) (j *Journal, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't create journal in %q", dir))
+
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Journal{dir: dir}, nil
+}
+
+// Record saves the current state of path, which can be a file, a directory or a symlink, so that it is
+// restored on rollback. A missing path is removed on rollback, along with any parent directory created
+// after it was recorded.
+// Recording the same path, or a path inside an already recorded directory, is a no-op as its state
+// was already saved.
+func (j *Journal) Record(path string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't record %q in journal", path))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	path = filepath.Clean(path)
+	exists := true
+	if _, err := os.Lstat(path); errors.Is(err, fs.ErrNotExist) {
+		exists = false
+	} else if err != nil {
+		return err
+	}
+	if !exists {
+		// Record the topmost missing directory instead, so that rollback removes all created parents.
+		for parent := filepath.Dir(path); parent != path; parent = filepath.Dir(parent) {
+			if _, err := os.Lstat(parent); err == nil {
+				break
+			}
+			path = parent
+		}
+	}
+
+	for _, p := range j.recorded {
+		if path == p || strings.HasPrefix(path, p+string(os.PathSeparator)) {
+			return nil
+		}
+	}
+
+	s := step{path: path}
+	if exists {
+		s.backup = filepath.Join(j.dir, fmt.Sprint(len(j.steps)))
+		if err := copyTree(path, s.backup); err != nil {
+			return err
+		}
+	}
+
+	j.recorded = append(j.recorded, path)
+	j.steps = append(j.steps, s)
+	return nil
+}
+
+// OnRollback registers undo to be called on rollback. Actions and recorded paths are reverted in the
+// reverse order of their registration.
+func (j *Journal) OnRollback(undo func(context.Context) error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.steps = append(j.steps, step{undo: undo})
+}
+
+// Rollback restores every recorded path and calls every registered action, in reverse order.
+// It carries on after a failure, to revert as much as possible, and returns all encountered errors.
+// The journal can't be used anymore afterwards.
+func (j *Journal) Rollback(ctx context.Context) (err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to roll back policy changes"))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var errs []error
+	for i := len(j.steps) - 1; i >= 0; i-- {
+		s := j.steps[i]
+		if s.undo != nil {
+			errs = append(errs, s.undo(ctx))
+			continue
+		}
+
+		log.Debugf(ctx, "Restoring %q", s.path)
+		if err := os.RemoveAll(s.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if s.backup == "" {
+			continue
+		}
+		if err := copyTree(s.backup, s.path); err != nil {
+			errs = append(errs, errors.New(gotext.Get("can't restore %q: %v", s.path, err)))
+		}
+	}
+	j.steps = nil
+	j.recorded = nil
+
+	errs = append(errs, os.RemoveAll(j.dir))
+	return errors.Join(errs...)
+}
+
+// Commit discards the journal, keeping all changes made on the system.
+func (j *Journal) Commit() (err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to commit policy changes"))
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.steps = nil
+	j.recorded = nil
+	return os.RemoveAll(j.dir)
+}
+
+// copyTree copies src to dst, preserving symlinks, permissions and ownership.
+func copyTree(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := os.Mkdir(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		default:
+			if err := copyFile(p, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			if err := os.Lchown(target, int(stat.Uid), int(stat.Gid)); err != nil {
+				return err
+			}
+		}
+		// Mkdir and OpenFile are subject to umask: force the original permissions.
+		if info.Mode()&fs.ModeSymlink == 0 {
+			return os.Chmod(target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+// copyFile copies the content of regular file src to dst with the given permissions.
+func copyFile(src, dst string, perm fs.FileMode) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if errClose := out.Close(); err == nil {
+			err = errClose
+		}
+	}()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+type journalKey struct{}
+
+// WithJournal returns a copy of ctx carrying j, used by Record and OnRollback.
+func WithJournal(ctx context.Context, j *Journal) context.Context {
+	return context.WithValue(ctx, journalKey{}, j)
+}
+
+// Record saves the current state of paths in the journal carried by ctx, if any.
+func Record(ctx context.Context, paths ...string) error {
+	j, ok := ctx.Value(journalKey{}).(*Journal)
+	if !ok {
+		return nil
+	}
+	for _, p := range paths {
+		if err := j.Record(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnRollback registers undo in the journal carried by ctx, if any.
+func OnRollback(ctx context.Context, undo func(context.Context) error) {
+	j, ok := ctx.Value(journalKey{}).(*Journal)
+	if !ok {
+		return
+	}
+	j.OnRollback(undo)
+}
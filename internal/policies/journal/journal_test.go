@@ -0,0 +1,219 @@
+package journal_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+)
+
+func TestRollback(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		existing string
+		record   []string
+
+		wantErr bool
+	}{
+		"Modified file is restored":              {existing: "file"},
+		"Modified directory is restored":         {existing: "dir"},
+		"Modified symlink is restored":           {existing: "symlink"},
+		"Created file is removed":                {},
+		"Created parent directories are removed": {record: []string{"missing/parent/target"}},
+		"Recording twice keeps the first state":  {existing: "file", record: []string{"target", "target"}},
+		"Path inside recorded directory is kept": {existing: "dir", record: []string{"target", "target/subdir/file"}},
+
+		// Error cases
+		"Error on restoring path with unwritable parent": {existing: "file", record: []string{"readonly/target"}, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := t.TempDir()
+			record := tc.record
+			if record == nil {
+				record = []string{"target"}
+			}
+			target := filepath.Join(root, record[0])
+			if tc.existing != "" {
+				require.NoError(t, os.MkdirAll(filepath.Dir(target), 0700), "Setup: can not create target parent directory")
+			}
+
+			switch tc.existing {
+			case "file":
+				require.NoError(t, os.WriteFile(target, []byte("previous"), 0640), "Setup: can not create file")
+			case "dir":
+				require.NoError(t, os.MkdirAll(filepath.Join(target, "subdir"), 0750), "Setup: can not create directory")
+				require.NoError(t, os.WriteFile(filepath.Join(target, "subdir", "file"), []byte("previous"), 0600), "Setup: can not create file in directory")
+				require.NoError(t, os.Symlink("subdir/file", filepath.Join(target, "link")), "Setup: can not create symlink in directory")
+			case "symlink":
+				require.NoError(t, os.Symlink("previous", target), "Setup: can not create symlink")
+			}
+			want := treeContent(t, root)
+
+			j, err := journal.New(filepath.Join(t.TempDir(), "journal"))
+			require.NoError(t, err, "Setup: can not create journal")
+
+			ctx := journal.WithJournal(context.Background(), j)
+			for _, p := range record {
+				require.NoError(t, journal.Record(ctx, filepath.Join(root, p)), "Record should not fail")
+				modify(t, filepath.Join(root, p))
+			}
+			if tc.wantErr {
+				require.NoError(t, os.Chmod(filepath.Dir(target), 0500), "Setup: can not make target parent read only")
+				t.Cleanup(func() { _ = os.Chmod(filepath.Dir(target), 0700) })
+			}
+
+			err = j.Rollback(context.Background())
+			if tc.wantErr {
+				require.Error(t, err, "Rollback should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "Rollback should not fail")
+
+			require.Equal(t, want, treeContent(t, root), "Rollback should restore the previous state")
+		})
+	}
+}
+
+func TestRollbackOrder(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	target := filepath.Join(root, "target")
+	require.NoError(t, os.WriteFile(target, []byte("previous"), 0600), "Setup: can not create file")
+
+	j, err := journal.New(filepath.Join(t.TempDir(), "journal"))
+	require.NoError(t, err, "Setup: can not create journal")
+
+	var calls []string
+	j.OnRollback(func(context.Context) error {
+		content, err := os.ReadFile(target)
+		require.NoError(t, err, "Target should be restored before this rollback action")
+		calls = append(calls, "after restore: "+string(content))
+		return nil
+	})
+	require.NoError(t, j.Record(target), "Record should not fail")
+	j.OnRollback(func(context.Context) error {
+		content, err := os.ReadFile(target)
+		require.NoError(t, err, "Target should still be modified before this rollback action")
+		calls = append(calls, "before restore: "+string(content))
+		return errors.New("rollback action error")
+	})
+	require.NoError(t, os.WriteFile(target, []byte("new"), 0600), "Setup: can not modify file")
+
+	err = j.Rollback(context.Background())
+	require.Error(t, err, "Rollback should return errors from rollback actions")
+	require.Equal(t, []string{"before restore: new", "after restore: previous"}, calls,
+		"Rollback actions should be called in reverse order, even after an error")
+}
+
+func TestCommit(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	target := filepath.Join(root, "target")
+	require.NoError(t, os.WriteFile(target, []byte("previous"), 0600), "Setup: can not create file")
+
+	dir := filepath.Join(t.TempDir(), "journal")
+	j, err := journal.New(dir)
+	require.NoError(t, err, "Setup: can not create journal")
+
+	var called bool
+	j.OnRollback(func(context.Context) error {
+		called = true
+		return nil
+	})
+	require.NoError(t, j.Record(target), "Record should not fail")
+	require.NoError(t, os.WriteFile(target, []byte("new"), 0600), "Setup: can not modify file")
+
+	require.NoError(t, j.Commit(), "Commit should not fail")
+
+	content, err := os.ReadFile(target)
+	require.NoError(t, err, "Target should still exist after commit")
+	require.Equal(t, "new", string(content), "Commit should keep changes")
+	require.False(t, called, "Commit should not call rollback actions")
+	require.NoDirExists(t, dir, "Commit should remove the journal directory")
+}
+
+func TestNewDiscardsPreviousJournal(t *testing.T) {
+	t.Parallel()
+
+	dir := filepath.Join(t.TempDir(), "journal")
+	require.NoError(t, os.MkdirAll(dir, 0700), "Setup: can not create journal directory")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0"), []byte("stale"), 0600), "Setup: can not create stale backup")
+
+	_, err := journal.New(dir)
+	require.NoError(t, err, "New should not fail")
+	require.NoFileExists(t, filepath.Join(dir, "0"), "New should discard previous journal content")
+}
+
+func TestContextWithoutJournal(t *testing.T) {
+	t.Parallel()
+
+	target := filepath.Join(t.TempDir(), "target")
+
+	require.NoError(t, journal.Record(context.Background(), target), "Record without journal should be a no-op")
+	journal.OnRollback(context.Background(), func(context.Context) error {
+		t.Error("Rollback action should never be called without a journal")
+		return nil
+	})
+}
+
+// modify changes p so that it differs from its recorded state. Directories get a new file.
+func modify(t *testing.T, p string) {
+	t.Helper()
+
+	if info, err := os.Lstat(p); err == nil && info.IsDir() {
+		require.NoError(t, os.WriteFile(filepath.Join(p, "added"), []byte("added"), 0600), "Setup: can not add file in recorded directory")
+		require.NoError(t, os.Chmod(p, 0700), "Setup: can not change mode of recorded directory")
+		return
+	}
+
+	require.NoError(t, os.RemoveAll(p), "Setup: can not remove recorded path")
+	require.NoError(t, os.MkdirAll(filepath.Dir(p), 0700), "Setup: can not create recorded path parent")
+	require.NoError(t, os.WriteFile(p, []byte("modified"), 0600), "Setup: can not modify recorded path")
+}
+
+// treeContent returns the content, mode and symlink targets of every element under root.
+func treeContent(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	content := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			content[rel] = "symlink to " + link
+		case info.IsDir():
+			content[rel] = "dir " + info.Mode().Perm().String()
+		default:
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			content[rel] = info.Mode().Perm().String() + " " + string(data)
+		}
+		return nil
+	})
+	require.NoError(t, err, "Setup: can not read tree content")
+
+	return content
+}
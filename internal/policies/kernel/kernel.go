@@ -0,0 +1,446 @@
+// Package kernel provides a manager to set kernel parameters and to blacklist kernel modules on the machine.
+//
+// Kernel parameters from the sysctl entry are written to a sysctl configuration file, and applied live
+// with sysctl. Each parameter is validated against /proc/sys before anything is written, so that a typo
+// in a key doesn't go unnoticed.
+// Modules from the blacklisted-modules entry are written to a modprobe configuration file, which prevents
+// them from being loaded, either automatically or manually. Blacklisted modules which are currently loaded
+// are unloaded if they are not in use.
+//
+// Those policies are only supported on computers. Parameters which are not listed anymore keep their
+// current value until the next reboot.
+package kernel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	sysctlKey             = "sysctl"
+	blacklistedModulesKey = "blacklisted-modules"
+)
+
+var supportedKeys = []string{sysctlKey, blacklistedModulesKey}
+
+const (
+	// sysctlConfName is the name of the adsys configuration file in the sysctl directory.
+	sysctlConfName = "99-adsys.conf"
+	// modprobeConfName is the name of the adsys configuration file in the modprobe directory.
+	modprobeConfName = "adsys-blacklist.conf"
+)
+
+// header is the header of the configuration files written by adsys.
+const header = `# This file is managed by adsys.
+# Do not edit this file manually.
+# Any changes will be overwritten.
+
+`
+
+var (
+	// paramPathRe matches the path of a kernel parameter relative to /proc/sys.
+	// Path components can't start with a dot, to stay in /proc/sys.
+	paramPathRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+(/[a-zA-Z0-9_:@-][a-zA-Z0-9_.:@-]*)+$`)
+	// moduleNameRe matches a kernel module name.
+	moduleNameRe = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// param is a kernel parameter and its requested value.
+type param struct {
+	key   string
+	value string
+}
+
+// Manager prevents running multiple kernel updates in parallel.
+type Manager struct {
+	sysctlDir    string
+	modprobeDir  string
+	procSysDir   string
+	sysModuleDir string
+	sysctlCmd    []string
+	modprobeCmd  []string
+
+	mu sync.Mutex // Prevents applying kernel parameters concurrently
+}
+
+type options struct {
+	procSysDir   string
+	sysModuleDir string
+	sysctlCmd    []string
+	modprobeCmd  []string
+}
+
+// Option reprents an optional function to change the kernel manager.
+type Option func(*options)
+
+// WithProcSysDir overrides the default /proc/sys directory, used to validate and read kernel parameters.
+func WithProcSysDir(p string) Option {
+	return func(o *options) {
+		o.procSysDir = p
+	}
+}
+
+// WithSysModuleDir overrides the default /sys/module directory, used to check which modules are loaded.
+func WithSysModuleDir(p string) Option {
+	return func(o *options) {
+		o.sysModuleDir = p
+	}
+}
+
+// WithSysctlCmd overrides the default sysctl command.
+func WithSysctlCmd(cmd []string) Option {
+	return func(o *options) {
+		o.sysctlCmd = cmd
+	}
+}
+
+// WithModprobeCmd overrides the default modprobe command.
+func WithModprobeCmd(cmd []string) Option {
+	return func(o *options) {
+		o.modprobeCmd = cmd
+	}
+}
+
+// New returns a new kernel policy manager, writing its configuration files in sysctlDir and modprobeDir.
+func New(sysctlDir, modprobeDir string, opts ...Option) *Manager {
+	// defaults
+	args := options{
+		procSysDir:   "/proc/sys",
+		sysModuleDir: "/sys/module",
+		sysctlCmd:    []string{"sysctl"},
+		modprobeCmd:  []string{"modprobe"},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	return &Manager{
+		sysctlDir:    sysctlDir,
+		modprobeDir:  modprobeDir,
+		procSysDir:   args.procSysDir,
+		sysModuleDir: args.sysModuleDir,
+		sysctlCmd:    args.sysctlCmd,
+		modprobeCmd:  args.modprobeCmd,
+	}
+}
+
+// ApplyPolicy writes the kernel parameters and blacklisted modules from entries, applies the parameters
+// and unloads the blacklisted modules.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply kernel policy"))
+
+	// Kernel policies are only supported on computers
+	if !isComputer {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	params, modules, err := m.parseEntries(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	sysctlPath := filepath.Join(m.sysctlDir, sysctlConfName)
+	modprobePath := filepath.Join(m.modprobeDir, modprobeConfName)
+	if len(params) == 0 && len(modules) == 0 && !exists(sysctlPath) && !exists(modprobePath) {
+		log.Debug(ctx, gotext.Get("No entries found for the kernel policy"))
+		return nil
+	}
+
+	log.Debugf(ctx, "Applying kernel policy to %s", objectName)
+
+	if err := m.journalParams(ctx, params, sysctlPath, modprobePath); err != nil {
+		return err
+	}
+
+	if err := writeOrRemove(sysctlPath, sysctlContent(params)); err != nil {
+		return err
+	}
+	if err := writeOrRemove(modprobePath, modprobeContent(modules)); err != nil {
+		return err
+	}
+
+	if len(params) > 0 {
+		if err := m.run(ctx, m.sysctlCmd, "-q", "-p", sysctlPath); err != nil {
+			return errors.New(gotext.Get("failed to apply kernel parameters: %v", err))
+		}
+	}
+
+	for _, module := range modules {
+		if !m.isLoaded(module) {
+			continue
+		}
+		log.Infof(ctx, gotext.Get("Unloading blacklisted kernel module %s", module))
+		if err := m.run(ctx, m.modprobeCmd, "-r", module); err != nil {
+			log.Warning(ctx, gotext.Get("Failed to unload kernel module %q, it will be unloaded on next reboot: %v", module, err))
+		}
+	}
+
+	return nil
+}
+
+// Plan returns the changes ApplyPolicy would make to the kernel configuration, without applying them.
+func (m *Manager) Plan(ctx context.Context, _ string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan kernel policy"))
+
+	if !isComputer {
+		return nil, nil
+	}
+
+	// Don't read the configuration files while they are being updated.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	params, modules, err := m.parseEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	sysctlPath := filepath.Join(m.sysctlDir, sysctlConfName)
+	modprobePath := filepath.Join(m.modprobeDir, modprobeConfName)
+
+	if len(params) == 0 {
+		changes = plan.AppendRemoval(changes, sysctlPath)
+	} else {
+		c, changed, err := plan.ForFile(sysctlPath, sysctlContent(params))
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			changes = append(changes, c, plan.Change{Action: plan.CommandRun, Target: "sysctl -p " + sysctlPath})
+		}
+	}
+
+	if len(modules) == 0 {
+		return plan.AppendRemoval(changes, modprobePath), nil
+	}
+	if changes, err = plan.AppendFile(changes, modprobePath, modprobeContent(modules)); err != nil {
+		return nil, err
+	}
+	for _, module := range modules {
+		if m.isLoaded(module) {
+			changes = append(changes, plan.Change{Action: plan.CommandRun, Target: "modprobe -r " + module})
+		}
+	}
+
+	return changes, nil
+}
+
+// journalParams records the configuration files in the journal of ctx, if any.
+// On rollback, once the files are restored, the parameters get back the live values they have now.
+func (m *Manager) journalParams(ctx context.Context, params []param, paths ...string) error {
+	var previous []string
+	for _, p := range params {
+		v, err := os.ReadFile(m.procPath(p.key))
+		// Some parameters are write-only, their value can't be restored.
+		if err != nil {
+			continue
+		}
+		previous = append(previous, fmt.Sprintf("%s=%s", p.key, strings.Join(strings.Fields(string(v)), " ")))
+	}
+
+	// Rollback actions are run in reverse order: this one is called once the files are restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		if len(previous) == 0 {
+			return nil
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.run(ctx, m.sysctlCmd, append([]string{"-q", "-w"}, previous...)...)
+	})
+
+	return journal.Record(ctx, paths...)
+}
+
+// isLoaded returns if the loadable module is currently loaded. Built-in modules are never considered loaded.
+func (m *Manager) isLoaded(module string) bool {
+	_, err := os.Stat(filepath.Join(m.sysModuleDir, strings.ReplaceAll(module, "-", "_"), "initstate"))
+	return err == nil
+}
+
+// procPath returns the path of the kernel parameter key in /proc/sys.
+// Keys can be separated either with dots or slashes, like sysctl does.
+func (m *Manager) procPath(key string) string {
+	if !strings.Contains(key, "/") {
+		key = strings.ReplaceAll(key, ".", "/")
+	}
+	return filepath.Join(m.procSysDir, key)
+}
+
+// run runs cmd with args and returns its combined output in the error, if any.
+func (m *Manager) run(ctx context.Context, cmd []string, args ...string) error {
+	// #nosec G204 - We are in control of the arguments, and keys and modules are validated
+	c := exec.CommandContext(ctx, cmd[0], append(slices.Clone(cmd[1:]), args...)...)
+	smbsafe.WaitExec()
+	out, err := c.CombinedOutput()
+	smbsafe.DoneExec()
+	if msg := strings.TrimSpace(string(out)); err != nil && msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// parseEntries returns the kernel parameters and the blacklisted modules listed in entries.
+// Each parameter is validated against the kernel parameters available in /proc/sys.
+func (m *Manager) parseEntries(ctx context.Context, entries []entry.Entry) (params []param, modules []string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to parse kernel entries"))
+
+	for _, e := range entries {
+		key := e.Key[strings.LastIndex(e.Key, "/")+1:]
+		if !slices.Contains(supportedKeys, key) {
+			log.Warning(ctx, gotext.Get("Encountered unsupported key '%s' while parsing kernel entries, skipping it", key))
+			continue
+		}
+		if e.Disabled {
+			log.Debug(ctx, gotext.Get("The entry %q is disabled and will be skipped", e.Key))
+			continue
+		}
+		if e.Err != nil {
+			return nil, nil, errors.New(gotext.Get("entry %q is errored: %v", e.Key, e.Err))
+		}
+
+		for _, line := range strings.Split(e.Value, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" {
+				continue
+			}
+
+			switch key {
+			case sysctlKey:
+				p, err := m.parseParam(line)
+				if err != nil {
+					return nil, nil, errors.New(gotext.Get("invalid kernel parameter %q in %q: %v", line, e.Key, err))
+				}
+				i := slices.IndexFunc(params, func(prev param) bool { return m.procPath(prev.key) == m.procPath(p.key) })
+				if i != -1 {
+					if params[i].value != p.value {
+						log.Warning(ctx, gotext.Get("Kernel parameter %q was already set to %q, ignoring value %q", p.key, params[i].value, p.value))
+					}
+					continue
+				}
+				params = append(params, p)
+			case blacklistedModulesKey:
+				if !moduleNameRe.MatchString(line) {
+					return nil, nil, errors.New(gotext.Get("invalid kernel module name %q in %q", line, e.Key))
+				}
+				// Dashes and underscores are interchangeable in module names.
+				if slices.ContainsFunc(modules, func(prev string) bool {
+					return strings.ReplaceAll(prev, "-", "_") == strings.ReplaceAll(line, "-", "_")
+				}) {
+					log.Debug(ctx, gotext.Get("Kernel module %s is duplicated.", line))
+					continue
+				}
+				modules = append(modules, line)
+			}
+		}
+	}
+
+	return params, modules, nil
+}
+
+// parseParam parses a key = value line and checks that the kernel parameter exists.
+func (m *Manager) parseParam(line string) (p param, err error) {
+	key, value, found := strings.Cut(line, "=")
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if !found || value == "" {
+		return param{}, errors.New(gotext.Get("expected a key = value pair"))
+	}
+
+	rel := key
+	if !strings.Contains(rel, "/") {
+		rel = strings.ReplaceAll(rel, ".", "/")
+	}
+	if !paramPathRe.MatchString(rel) {
+		return param{}, errors.New(gotext.Get("invalid key %q", key))
+	}
+
+	fi, err := os.Stat(m.procPath(key))
+	if err != nil || fi.IsDir() {
+		return param{}, errors.New(gotext.Get("unknown kernel parameter %q", key))
+	}
+
+	return param{key: key, value: value}, nil
+}
+
+// sysctlContent returns the sysctl configuration setting params. It is empty if there are no parameters.
+func sysctlContent(params []param) string {
+	if len(params) == 0 {
+		return ""
+	}
+
+	var content strings.Builder
+	content.WriteString(header)
+	for _, p := range params {
+		fmt.Fprintf(&content, "%s = %s\n", p.key, p.value)
+	}
+	return content.String()
+}
+
+// modprobeContent returns the modprobe configuration blacklisting modules. It is empty if there are no modules.
+// Modules are both blacklisted, to prevent them from being loaded automatically, and their loading is
+// replaced by a failing command, to prevent them from being loaded manually or as a dependency.
+func modprobeContent(modules []string) string {
+	if len(modules) == 0 {
+		return ""
+	}
+
+	var content strings.Builder
+	content.WriteString(header)
+	for _, module := range modules {
+		fmt.Fprintf(&content, "blacklist %s\ninstall %s /bin/false\n", module, module)
+	}
+	return content.String()
+}
+
+// writeOrRemove writes content to path if it changed, or removes path if content is empty.
+func writeOrRemove(path, content string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't update %s", path))
+
+	if content == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if old, err := os.ReadFile(path); err == nil && string(old) == content {
+		return nil
+	}
+
+	// #nosec G301 - /etc/sysctl.d and /etc/modprobe.d permissions are 0755, so we should keep the same pattern.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// #nosec G306 - This file needs to be world-readable, like other kernel configuration files.
+	if err := os.WriteFile(path+".new", []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
+
+// exists returns if path exists.
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
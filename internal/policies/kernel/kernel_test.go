@@ -0,0 +1,305 @@
+package kernel_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/kernel"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing string
+		isUser   bool
+		noCmds   bool
+		rollback bool
+
+		wantErr bool
+	}{
+		"Set kernel parameters": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0\nnet.ipv4.conf.all.accept_redirects=0"},
+		}},
+		"Blacklist kernel modules": {entries: []entry.Entry{
+			{Key: "kernel/blacklisted-modules", Value: "usb-storage\ncramfs"},
+		}},
+		"Set kernel parameters and blacklist kernel modules": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "kernel.kptr_restrict = 2"},
+			{Key: "kernel/blacklisted-modules", Value: "usb-storage"},
+		}},
+		"Keys separated with slashes": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net/ipv4/ip_forward = 0"},
+		}},
+		"Values with multiple fields": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.tcp_rmem = 4096 87380 6291456"},
+		}},
+		"Duplicated parameters and modules are listed once, first value is used": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0\nnet/ipv4/ip_forward = 1\nnet.ipv4.ip_forward = 0"},
+			{Key: "kernel/blacklisted-modules", Value: "usb-storage\nusb_storage\nusb-storage"},
+		}},
+		"Empty lines and spaces are ignored": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "\n  net.ipv4.ip_forward   =   0  \n\n"},
+			{Key: "kernel/blacklisted-modules", Value: "\n  usb-storage  \n"},
+		}},
+		"Disabled entries are ignored": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"},
+			{Key: "kernel/blacklisted-modules", Value: "usb-storage", Disabled: true},
+		}},
+		"Unsupported keys are ignored": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"},
+			{Key: "kernel/boot-parameters", Value: "quiet"},
+		}},
+		"Only emit a warning when unloading a module fails": {entries: []entry.Entry{
+			{Key: "kernel/blacklisted-modules", Value: "busy-module"},
+		}},
+		"Replace existing configuration": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "kernel.kptr_restrict = 2"},
+			{Key: "kernel/blacklisted-modules", Value: "cramfs"},
+		}, existing: "existing"},
+
+		"No entries without existing configuration is a no-op": {},
+		"No entries removes existing configuration":            {existing: "existing"},
+		"All entries disabled removes existing configuration": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0", Disabled: true},
+		}, existing: "existing"},
+		"No entries does not need sysctl nor modprobe": {existing: "existing", noCmds: true},
+		"Kernel policy is not applied for users":       {entries: []entry.Entry{{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"}}, isUser: true},
+		"Kernel policy for users does not need sysctl": {entries: []entry.Entry{{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"}}, isUser: true, noCmds: true},
+		"Rollback restores configuration and previous values": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "kernel.kptr_restrict = 2\nnet.ipv4.ip_forward = 0"},
+			{Key: "kernel/blacklisted-modules", Value: "cramfs"},
+		}, existing: "existing", rollback: true},
+
+		// Error cases
+		"Error on unknown kernel parameter": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forwarding = 0"},
+		}, wantErr: true},
+		"Error on kernel parameter directory": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4 = 0"},
+		}, wantErr: true},
+		"Error on kernel parameter outside of proc sys": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net/../../../etc/passwd = 0"},
+		}, wantErr: true},
+		"Error on kernel parameter without value": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward"},
+		}, wantErr: true},
+		"Error on kernel parameter with empty value": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward ="},
+		}, wantErr: true},
+		"Error on invalid module name": {entries: []entry.Entry{
+			{Key: "kernel/blacklisted-modules", Value: "usb storage"},
+		}, wantErr: true},
+		"Error on errored entry": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Err: errors.New("some error")},
+		}, wantErr: true},
+		"Error when sysctl rejects a value": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = invalid"},
+		}, wantErr: true},
+		"Error when sysctl is not available": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"},
+		}, noCmds: true, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+
+			sysctlCmd, modprobeCmd := mockCmd(t, "sysctl", root), mockCmd(t, "modprobe", root)
+			if tc.noCmds {
+				sysctlCmd, modprobeCmd = []string{"doesnotexist-sysctl"}, []string{"doesnotexist-modprobe"}
+			}
+
+			ctx := context.Background()
+			var j *journal.Journal
+			if tc.rollback {
+				var err error
+				j, err = journal.New(filepath.Join(t.TempDir(), "journal"))
+				require.NoError(t, err, "Setup: can't create journal")
+				ctx = journal.WithJournal(ctx, j)
+			}
+
+			m := newManager(root, sysctlCmd, modprobeCmd)
+			err := m.ApplyPolicy(ctx, "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "ApplyPolicy should have failed but didn't")
+			} else {
+				require.NoError(t, err, "ApplyPolicy should not have failed")
+			}
+
+			if tc.rollback {
+				require.NoError(t, j.Rollback(context.Background()), "Rollback should not have failed")
+			}
+
+			testutils.CompareTreesWithFiltering(t, root, testutils.GoldenPath(t), testutils.UpdateEnabled())
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing string
+		isUser   bool
+
+		wantErr bool
+	}{
+		"New configuration": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"},
+			{Key: "kernel/blacklisted-modules", Value: "usb-storage\ncramfs"},
+		}},
+		"Modified configuration": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "kernel.kptr_restrict = 2"},
+			{Key: "kernel/blacklisted-modules", Value: "cramfs"},
+		}, existing: "existing"},
+		"Unchanged configuration": {entries: []entry.Entry{
+			{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"},
+			{Key: "kernel/blacklisted-modules", Value: "firewire-core"},
+		}, existing: "existing"},
+		"No entries with a configuration":        {existing: "existing"},
+		"No entries without any configuration":   {},
+		"Kernel policy is not planned for users": {entries: []entry.Entry{{Key: "kernel/sysctl", Value: "net.ipv4.ip_forward = 0"}}, isUser: true},
+
+		// Error cases
+		"Error on unknown kernel parameter": {entries: []entry.Entry{{Key: "kernel/sysctl", Value: "does.not.exist = 0"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+
+			m := newManager(root, []string{"this-should-not-be-called"}, []string{"this-should-not-be-called"})
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan should not have failed")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), root, "ROOT"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
+// setupRoot returns a fake system root, with the kernel parameters and modules of testdata/system and the
+// configuration files of the existing testdata directory, if any.
+func setupRoot(t *testing.T, existing string) string {
+	t.Helper()
+
+	root := filepath.Join(t.TempDir(), "root")
+	testutils.Copy(t, filepath.Join("testdata", "system"), root)
+	if existing != "" {
+		testutils.Copy(t, filepath.Join("testdata", existing, "etc"), filepath.Join(root, "etc"))
+	}
+
+	return root
+}
+
+func newManager(root string, sysctlCmd, modprobeCmd []string) *kernel.Manager {
+	return kernel.New(filepath.Join(root, "etc", "sysctl.d"), filepath.Join(root, "etc", "modprobe.d"),
+		kernel.WithProcSysDir(filepath.Join(root, "proc", "sys")),
+		kernel.WithSysModuleDir(filepath.Join(root, "sys", "module")),
+		kernel.WithSysctlCmd(sysctlCmd),
+		kernel.WithModprobeCmd(modprobeCmd))
+}
+
+// mockCmd returns a mocked sysctl or modprobe command, changing the fake system in root.
+func mockCmd(t *testing.T, name, root string) []string {
+	t.Helper()
+
+	return []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockCmd", "--", name, root}
+}
+
+func TestMockCmd(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	name, root, args := args[0], args[1], args[2:]
+
+	var err error
+	switch {
+	case name == "sysctl" && len(args) == 3 && args[0] == "-q" && args[1] == "-p":
+		var d []byte
+		if d, err = os.ReadFile(args[2]); err != nil {
+			break
+		}
+		var values []string
+		for _, line := range strings.Split(string(d), "\n") {
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			k, v, _ := strings.Cut(line, " = ")
+			values = append(values, k+"="+v)
+		}
+		err = setValues(root, values)
+	case name == "sysctl" && len(args) > 2 && args[0] == "-q" && args[1] == "-w":
+		err = setValues(root, args[2:])
+	case name == "modprobe" && len(args) == 2 && args[0] == "-r":
+		// Like modprobe, fail on modules in use
+		if strings.HasPrefix(args[1], "busy") {
+			err = fmt.Errorf("Module %s is in use", strings.ReplaceAll(args[1], "-", "_"))
+			break
+		}
+		err = os.RemoveAll(filepath.Join(root, "sys", "module", strings.ReplaceAll(args[1], "-", "_")))
+	default:
+		err = fmt.Errorf("unexpected arguments %v", args)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// setValues writes each key=value of values to the fake /proc/sys of root.
+func setValues(root string, values []string) error {
+	for _, kv := range values {
+		k, v, _ := strings.Cut(kv, "=")
+		if v == "invalid" {
+			return fmt.Errorf("setting key %q: Invalid argument", k)
+		}
+		if !strings.Contains(k, "/") {
+			k = strings.ReplaceAll(k, ".", "/")
+		}
+		if err := os.WriteFile(filepath.Join(root, "proc", "sys", k), []byte(v+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+	testutils.MergeCoverages()
+}
@@ -27,7 +27,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/user"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -43,11 +45,18 @@ import (
 	"github.com/ubuntu/adsys/internal/policies/certificate"
 	"github.com/ubuntu/adsys/internal/policies/dconf"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/firewall"
 	"github.com/ubuntu/adsys/internal/policies/gdm"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/kernel"
 	"github.com/ubuntu/adsys/internal/policies/mount"
+	"github.com/ubuntu/adsys/internal/policies/packages"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/adsys/internal/policies/privilege"
 	"github.com/ubuntu/adsys/internal/policies/proxy"
 	"github.com/ubuntu/adsys/internal/policies/scripts"
+	"github.com/ubuntu/adsys/internal/policies/services"
+	"github.com/ubuntu/adsys/internal/policies/ssh"
 	"github.com/ubuntu/adsys/internal/systemd"
 	"github.com/ubuntu/decorate"
 	"golang.org/x/sync/errgroup"
@@ -55,11 +64,14 @@ import (
 
 // ProOnlyRules are the rules that are only available for Pro subscribers. They
 // will be filtered otherwise.
-var ProOnlyRules = []string{"privilege", "scripts", "mount", "apparmor", "proxy", "certificate"}
+var ProOnlyRules = []string{"privilege", "scripts", "mount", "apparmor", "proxy", "certificate", "packages", "firewall", "services", "kernel", "ssh"}
 
 // Manager handles all managers for various policy handlers.
 type Manager struct {
 	policiesCacheDir string
+	journalDir       string
+	statusDir        string
+	fingerprintsDir  string
 	hostname         string
 
 	backend backends.Backend
@@ -72,6 +84,11 @@ type Manager struct {
 	apparmor    *apparmor.Manager
 	proxy       *proxy.Manager
 	certificate *certificate.Manager
+	packages    *packages.Manager
+	firewall    *firewall.Manager
+	services    *services.Manager
+	kernel      *kernel.Manager
+	ssh         *ssh.Manager
 
 	subscriptionDbus dbus.BusObject
 
@@ -104,12 +121,27 @@ type options struct {
 	apparmorFsDir  string
 	systemUnitDir  string
 	globalTrustDir string
+	nftablesDir    string
+	sysctlDir      string
+	modprobeDir    string
+	procSysDir     string
+	sysModuleDir   string
+	sshDir         string
 	proxyApplier   proxy.Caller
 	systemdCaller  systemdCaller
+	userLookup     func(string) (*user.User, error)
 	gdm            *gdm.Manager
 
 	apparmorParserCmd []string
 	certAutoenrollCmd []string
+	dpkgQueryCmd      []string
+	aptGetCmd         []string
+	snapCmd           []string
+	nftCmd            []string
+	systemctlCmd      []string
+	sysctlCmd         []string
+	modprobeCmd       []string
+	sshdCmd           []string
 }
 
 // Option reprents an optional function to change Policies behavior.
@@ -229,6 +261,14 @@ func WithSystemdCaller(p systemdCaller) Option {
 	}
 }
 
+// WithUserLookup specifies a personalized function to look up users for the scripts and mount policy managers.
+func WithUserLookup(f func(string) (*user.User, error)) Option {
+	return func(o *options) error {
+		o.userLookup = f
+		return nil
+	}
+}
+
 // WithCertAutoenrollCmd specifies a personalized certificate autoenroll command.
 func WithCertAutoenrollCmd(cmd []string) Option {
 	return func(o *options) error {
@@ -237,6 +277,120 @@ func WithCertAutoenrollCmd(cmd []string) Option {
 	}
 }
 
+// WithDpkgQueryCmd specifies a personalized dpkg-query command for the packages manager.
+func WithDpkgQueryCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.dpkgQueryCmd = cmd
+		return nil
+	}
+}
+
+// WithAptGetCmd specifies a personalized apt-get command for the packages manager.
+func WithAptGetCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.aptGetCmd = cmd
+		return nil
+	}
+}
+
+// WithSnapCmd specifies a personalized snap command for the packages manager.
+func WithSnapCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.snapCmd = cmd
+		return nil
+	}
+}
+
+// WithNftablesDir specifies a personalized directory for the firewall nftables ruleset.
+func WithNftablesDir(p string) Option {
+	return func(o *options) error {
+		o.nftablesDir = p
+		return nil
+	}
+}
+
+// WithNftCmd specifies a personalized nft command for the firewall manager.
+func WithNftCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.nftCmd = cmd
+		return nil
+	}
+}
+
+// WithSystemctlCmd specifies a personalized systemctl command for the services and ssh managers.
+func WithSystemctlCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.systemctlCmd = cmd
+		return nil
+	}
+}
+
+// WithSysctlDir specifies a personalized directory for the kernel parameters configuration.
+func WithSysctlDir(p string) Option {
+	return func(o *options) error {
+		o.sysctlDir = p
+		return nil
+	}
+}
+
+// WithModprobeDir specifies a personalized directory for the kernel modules blacklist.
+func WithModprobeDir(p string) Option {
+	return func(o *options) error {
+		o.modprobeDir = p
+		return nil
+	}
+}
+
+// WithProcSysDir specifies a personalized directory for the kernel parameters
+// exposed by the proc filesystem.
+func WithProcSysDir(p string) Option {
+	return func(o *options) error {
+		o.procSysDir = p
+		return nil
+	}
+}
+
+// WithSysModuleDir specifies a personalized directory for the loaded kernel
+// modules exposed by the sys filesystem.
+func WithSysModuleDir(p string) Option {
+	return func(o *options) error {
+		o.sysModuleDir = p
+		return nil
+	}
+}
+
+// WithSysctlCmd specifies a personalized sysctl command for the kernel manager.
+func WithSysctlCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.sysctlCmd = cmd
+		return nil
+	}
+}
+
+// WithModprobeCmd specifies a personalized modprobe command for the kernel manager.
+func WithModprobeCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.modprobeCmd = cmd
+		return nil
+	}
+}
+
+// WithSSHDir specifies a personalized directory for the OpenSSH server configuration.
+func WithSSHDir(p string) Option {
+	return func(o *options) error {
+		o.sshDir = p
+		return nil
+	}
+}
+
+// WithSshdCmd specifies a personalized sshd command for the ssh manager.
+func WithSshdCmd(cmd []string) Option {
+	return func(o *options) error {
+		o.sshdCmd = cmd
+		return nil
+	}
+}
+
 // NewManager returns a new manager with all default policy handlers.
 func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts ...Option) (m *Manager, err error) {
 	defer decorate.OnError(&err, gotext.Get("can't create a new policy handlers manager"))
@@ -255,6 +409,10 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 		apparmorDir:    consts.DefaultApparmorDir,
 		systemUnitDir:  consts.DefaultSystemUnitDir,
 		globalTrustDir: consts.DefaultGlobalTrustDir,
+		nftablesDir:    consts.DefaultNftablesDir,
+		sysctlDir:      consts.DefaultSysctlDir,
+		modprobeDir:    consts.DefaultModprobeDir,
+		sshDir:         consts.DefaultSSHDir,
 		systemdCaller:  defaultSystemdCaller,
 		gdm:            nil,
 	}
@@ -274,13 +432,21 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 	privilegeManager := privilege.NewWithDirs(args.sudoersDir, args.policyKitDir)
 
 	// scripts manager
-	scriptsManager, err := scripts.New(args.runDir, args.systemdCaller)
+	var scriptsOptions []scripts.Option
+	if args.userLookup != nil {
+		scriptsOptions = append(scriptsOptions, scripts.WithUserLookup(args.userLookup))
+	}
+	scriptsManager, err := scripts.New(args.runDir, args.systemdCaller, scriptsOptions...)
 	if err != nil {
 		return nil, err
 	}
 
 	// mount manager
-	mountManager, err := mount.New(args.runDir, args.systemUnitDir, args.systemdCaller)
+	var mountOptions []mount.Option
+	if args.userLookup != nil {
+		mountOptions = append(mountOptions, mount.WithUserLookup(args.userLookup))
+	}
+	mountManager, err := mount.New(args.runDir, args.systemUnitDir, args.systemdCaller, mountOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -314,6 +480,59 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 	}
 	certificateManager := certificate.New(backend.Domain(), certificateOpts...)
 
+	// packages manager
+	var packagesOpts []packages.Option
+	if args.dpkgQueryCmd != nil {
+		packagesOpts = append(packagesOpts, packages.WithDpkgQueryCmd(args.dpkgQueryCmd))
+	}
+	if args.aptGetCmd != nil {
+		packagesOpts = append(packagesOpts, packages.WithAptGetCmd(args.aptGetCmd))
+	}
+	if args.snapCmd != nil {
+		packagesOpts = append(packagesOpts, packages.WithSnapCmd(args.snapCmd))
+	}
+	packagesManager := packages.New(packagesOpts...)
+
+	// firewall manager
+	var firewallOpts []firewall.Option
+	if args.nftCmd != nil {
+		firewallOpts = append(firewallOpts, firewall.WithNftCmd(args.nftCmd))
+	}
+	firewallManager := firewall.New(args.nftablesDir, firewallOpts...)
+
+	// services manager
+	var servicesOpts []services.Option
+	if args.systemctlCmd != nil {
+		servicesOpts = append(servicesOpts, services.WithSystemctlCmd(args.systemctlCmd))
+	}
+	servicesManager := services.New(args.stateDir, args.systemUnitDir, args.systemdCaller, servicesOpts...)
+
+	// kernel manager
+	var kernelOpts []kernel.Option
+	if args.procSysDir != "" {
+		kernelOpts = append(kernelOpts, kernel.WithProcSysDir(args.procSysDir))
+	}
+	if args.sysModuleDir != "" {
+		kernelOpts = append(kernelOpts, kernel.WithSysModuleDir(args.sysModuleDir))
+	}
+	if args.sysctlCmd != nil {
+		kernelOpts = append(kernelOpts, kernel.WithSysctlCmd(args.sysctlCmd))
+	}
+	if args.modprobeCmd != nil {
+		kernelOpts = append(kernelOpts, kernel.WithModprobeCmd(args.modprobeCmd))
+	}
+	kernelManager := kernel.New(args.sysctlDir, args.modprobeDir, kernelOpts...)
+
+	// ssh manager
+	var sshOpts []ssh.Option
+	if args.sshdCmd != nil {
+		sshOpts = append(sshOpts, ssh.WithSshdCmd(args.sshdCmd))
+	}
+	if args.systemctlCmd != nil {
+		sshOpts = append(sshOpts, ssh.WithSystemctlCmd(args.systemctlCmd))
+	}
+	sshManager := ssh.New(args.sshDir, sshOpts...)
+
 	// inject applied dconf mangager if we need to build a gdm manager
 	if args.gdm == nil {
 		if args.gdm, err = gdm.New(gdm.WithDconf(dconfManager)); err != nil {
@@ -325,6 +544,20 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 	if err := os.MkdirAll(policiesCacheDir, 0700); err != nil {
 		return nil, err
 	}
+	journalDir := filepath.Join(args.cacheDir, journalCacheBaseName)
+	if err := os.MkdirAll(journalDir, 0700); err != nil {
+		return nil, err
+	}
+
+	statusDir := filepath.Join(args.cacheDir, statusCacheBaseName)
+	if err := os.MkdirAll(statusDir, 0700); err != nil {
+		return nil, err
+	}
+
+	fingerprintsDir := filepath.Join(args.runDir, fingerprintsRunBaseName)
+	if err := os.MkdirAll(fingerprintsDir, 0700); err != nil {
+		return nil, err
+	}
 
 	subscriptionDbus := bus.Object(consts.SubscriptionDbusRegisteredName,
 		dbus.ObjectPath(consts.SubscriptionDbusObjectPath))
@@ -332,6 +565,9 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 	return &Manager{
 		backend:          backend,
 		policiesCacheDir: policiesCacheDir,
+		journalDir:       journalDir,
+		statusDir:        statusDir,
+		fingerprintsDir:  fingerprintsDir,
 		hostname:         hostname,
 		dconf:            dconfManager,
 		privilege:        privilegeManager,
@@ -340,6 +576,11 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 		apparmor:         apparmorManager,
 		proxy:            proxyManager,
 		certificate:      certificateManager,
+		packages:         packagesManager,
+		firewall:         firewallManager,
+		services:         servicesManager,
+		kernel:           kernelManager,
+		ssh:              sshManager,
 		gdm:              args.gdm,
 
 		subscriptionDbus: subscriptionDbus,
@@ -351,17 +592,16 @@ func NewManager(bus *dbus.Conn, hostname string, backend backends.Backend, opts
 
 // ApplyPolicies generates a computer or user policy based on a list of entries
 // retrieved from a directory service.
-func (m *Manager) ApplyPolicies(ctx context.Context, objectName string, isComputer bool, pols *Policies) (err error) {
+// The application is transactional: every manager records in a journal the state of what it changes, and
+// all changes are rolled back if any manager fails. Proxy, certificate and packages policies, which are applied
+// through external services or tools and can't be reverted, are only applied once all other managers succeeded
+// and their changes are committed: their failures are reported per manager, without rolling back the others.
+// Managers whose rules and assets did not change since their last application are skipped, unless force is set.
+func (m *Manager) ApplyPolicies(ctx context.Context, objectName string, isComputer bool, pols *Policies, force bool) (err error) {
 	defer decorate.OnError(&err, gotext.Get("failed to apply policy to %q", objectName))
 
 	// We have a lock per objectName to prevent multiple instances of ApplyPolicies for the same object.
-	m.muMu.Lock()
-	if _, ok := m.objectMu[objectName]; !ok {
-		m.objectMu[objectName] = &sync.Mutex{}
-	}
-	m.objectMu[objectName].Lock()
-	defer m.objectMu[objectName].Unlock()
-	m.muMu.Unlock()
+	defer m.lockObject(objectName)()
 
 	rules := pols.GetUniqueRules()
 	action := gotext.Get("Applying")
@@ -370,73 +610,282 @@ func (m *Manager) ApplyPolicies(ctx context.Context, objectName string, isComput
 	}
 	log.Info(ctx, gotext.Get("%s policies for %s (machine: %v)", action, objectName, isComputer))
 
+	previousFingerprints := m.loadFingerprints(ctx, objectName)
+	currentFingerprints := make(fingerprints)
+
+	// Record the outcome of each manager once the policies are applied or rolled back.
+	var muResults sync.Mutex
+	results := make(map[string]error)
+	// items are the outcome of each item of the managers reporting them, like packages.
+	items := make(map[string]map[string]string)
+	apply := func(policyType string, f func() error) func() error {
+		var fp string
+		if slices.Contains(incrementalPolicyTypes, policyType) {
+			var errFp error
+			if fp, errFp = pols.fingerprint(rules[policyType], slices.Contains(assetsPolicyTypes, policyType)); errFp != nil {
+				log.Warning(ctx, gotext.Get("Applying %s policies for %s: %v", policyType, objectName, errFp))
+			}
+		}
+		return func() error {
+			if fp != "" && !force && fp == previousFingerprints[policyType] {
+				log.Info(ctx, gotext.Get("%s policies for %s did not change, skipping", policyType, objectName))
+				muResults.Lock()
+				currentFingerprints[policyType] = fp
+				muResults.Unlock()
+				return nil
+			}
+
+			err := f()
+			muResults.Lock()
+			defer muResults.Unlock()
+			results[policyType] = err
+			// Only record the fingerprint of applied policies, so that failed ones are applied again next time.
+			if err == nil && fp != "" {
+				currentFingerprints[policyType] = fp
+			}
+			return err
+		}
+	}
+	defer func() { m.recordStatus(ctx, objectName, rules, results, items, err) }()
+
+	j, err := journal.New(filepath.Join(m.journalDir, objectName))
+	if err != nil {
+		return err
+	}
+	// committed is set once all the journaled managers succeeded and their changes can't be rolled back anymore.
+	var committed bool
+	defer func() {
+		if committed {
+			return
+		}
+		log.Warning(ctx, gotext.Get("Rolling back policies for %s: %v", objectName, err))
+		// Rollback needs to run to completion, even if the request was cancelled.
+		if errRollback := j.Rollback(context.WithoutCancel(ctx)); errRollback != nil {
+			err = errors.Join(err, errRollback)
+		}
+	}()
+	jctx := journal.WithJournal(ctx, j)
+
 	var g errgroup.Group
 	// Applying dconf policies take a while to complete, so it's better to start applying them before
 	// querying dbus for the Pro subscription state, as it does not rely on that.
-	g.Go(func() error {
-		return m.dconf.ApplyPolicy(ctx, objectName, isComputer, rules["dconf"])
-	})
+	g.Go(apply("dconf", func() error {
+		return m.dconf.ApplyPolicy(jctx, objectName, isComputer, rules["dconf"])
+	}))
 	if !m.GetSubscriptionState(ctx) {
 		if filteredRules := filterRules(ctx, rules); len(filteredRules) > 0 {
 			log.Warning(ctx, gotext.Get("Rules from the following policy types will be filtered out as the machine is not enrolled to Ubuntu Pro: %s", strings.Join(filteredRules, ", ")))
 		}
 	}
 
-	g.Go(func() error {
-		return m.privilege.ApplyPolicy(ctx, objectName, isComputer, rules["privilege"])
-	})
-	g.Go(func() error {
-		return m.scripts.ApplyPolicy(ctx, objectName, isComputer, rules["scripts"], pols.SaveAssetsTo)
-	})
-	g.Go(func() error {
-		return m.mount.ApplyPolicy(ctx, objectName, isComputer, rules["mount"])
-	})
-	g.Go(func() error {
-		return m.apparmor.ApplyPolicy(ctx, objectName, isComputer, rules["apparmor"], pols.SaveAssetsTo)
-	})
-	g.Go(func() error {
-		return m.proxy.ApplyPolicy(ctx, objectName, isComputer, rules["proxy"])
-	})
-	g.Go(func() error {
-		// Ignore error as we don't want to fail because of online status this late in the process
-		isOnline, _ := m.backend.IsOnline()
-		return m.certificate.ApplyPolicy(ctx, objectName, isComputer, isOnline, rules["certificate"])
-	})
+	g.Go(apply("privilege", func() error {
+		return m.privilege.ApplyPolicy(jctx, objectName, isComputer, rules["privilege"])
+	}))
+	g.Go(apply("scripts", func() error {
+		return m.scripts.ApplyPolicy(jctx, objectName, isComputer, rules["scripts"], pols.SaveAssetsTo)
+	}))
+	g.Go(apply("mount", func() error {
+		return m.mount.ApplyPolicy(jctx, objectName, isComputer, rules["mount"])
+	}))
+	g.Go(apply("apparmor", func() error {
+		return m.apparmor.ApplyPolicy(jctx, objectName, isComputer, rules["apparmor"], pols.SaveAssetsTo)
+	}))
+	g.Go(apply("firewall", func() error {
+		return m.firewall.ApplyPolicy(jctx, objectName, isComputer, rules["firewall"])
+	}))
+	g.Go(apply("services", func() error {
+		return m.services.ApplyPolicy(jctx, objectName, isComputer, rules["services"])
+	}))
+	g.Go(apply("kernel", func() error {
+		return m.kernel.ApplyPolicy(jctx, objectName, isComputer, rules["kernel"])
+	}))
+	g.Go(apply("ssh", func() error {
+		return m.ssh.ApplyPolicy(jctx, objectName, isComputer, rules["ssh"], pols.AssetsFS)
+	}))
 	if err := g.Wait(); err != nil {
 		return err
 	}
 
 	if isComputer {
 		// Apply GDM policy only now as we need dconf machine database to be ready first
-		if err := m.gdm.ApplyPolicy(ctx, rules["gdm"]); err != nil {
+		if err := apply("gdm", func() error { return m.gdm.ApplyPolicy(jctx, rules["gdm"]) })(); err != nil {
 			return err
 		}
 	}
 
+	committed = true
+	if err := j.Commit(); err != nil {
+		log.Warning(ctx, gotext.Get("Failed to clean up policy journal for %s: %v", objectName, err))
+	}
+
+	// Proxy, certificate and packages policies can't be rolled back: only apply them once everything else succeeded.
+	var gExternal errgroup.Group
+	gExternal.Go(apply("proxy", func() error {
+		return m.proxy.ApplyPolicy(ctx, objectName, isComputer, rules["proxy"])
+	}))
+	gExternal.Go(apply("certificate", func() error {
+		// Ignore error as we don't want to fail because of online status this late in the process
+		isOnline, _ := m.backend.IsOnline()
+		return m.certificate.ApplyPolicy(ctx, objectName, isComputer, isOnline, rules["certificate"])
+	}))
+	gExternal.Go(apply("packages", func() error {
+		outcomes, err := m.packages.ApplyPolicy(ctx, objectName, isComputer, rules["packages"])
+		muResults.Lock()
+		defer muResults.Unlock()
+		items["packages"] = outcomes
+		return err
+	}))
+	// Each manager error is recorded in results: report all of them once the applied policies are saved.
+	_ = gExternal.Wait()
+	errExternal := errors.Join(results["proxy"], results["certificate"], results["packages"])
+
 	// Write cache Policies
-	return pols.Save(filepath.Join(m.policiesCacheDir, objectName))
+	if err := pols.Save(filepath.Join(m.policiesCacheDir, objectName)); err != nil {
+		return err
+	}
+
+	if err := m.saveFingerprints(objectName, currentFingerprints); err != nil {
+		log.Warning(ctx, gotext.Get("Failed to record applied policies fingerprints for %s: %v", objectName, err))
+	}
+	return errExternal
+}
+
+// lockObject takes the lock of objectName, preventing any concurrent modification of its policies.
+// It returns the function to release it.
+func (m *Manager) lockObject(objectName string) (unlock func()) {
+	m.muMu.Lock()
+	if _, ok := m.objectMu[objectName]; !ok {
+		m.objectMu[objectName] = &sync.Mutex{}
+	}
+	mu := m.objectMu[objectName]
+	m.muMu.Unlock()
+
+	mu.Lock()
+	return mu.Unlock
+}
+
+// PlanPolicies returns, per policy type, the changes ApplyPolicies would make for objectName,
+// without applying them nor updating the policies cache.
+func (m *Manager) PlanPolicies(ctx context.Context, objectName string, isComputer bool, pols *Policies) (changes map[string][]plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to plan policy for %q", objectName))
+
+	// Planning reads the current state of the system, which shouldn't be modified concurrently for this object.
+	defer m.lockObject(objectName)()
+
+	log.Info(ctx, gotext.Get("Planning policies for %s (machine: %v)", objectName, isComputer))
+
+	rules := pols.GetUniqueRules()
+	if !m.GetSubscriptionState(ctx) {
+		if filteredRules := filterRules(ctx, rules); len(filteredRules) > 0 {
+			log.Warning(ctx, gotext.Get("Rules from the following policy types will be filtered out as the machine is not enrolled to Ubuntu Pro: %s", strings.Join(filteredRules, ", ")))
+		}
+	}
+
+	// Ignore error as we don't want to fail because of online status
+	isOnline, _ := m.backend.IsOnline()
+
+	type planner struct {
+		policyType string
+		plan       func() ([]plan.Change, error)
+	}
+	planners := []planner{
+		{"dconf", func() ([]plan.Change, error) { return m.dconf.Plan(ctx, objectName, isComputer, rules["dconf"]) }},
+		{"privilege", func() ([]plan.Change, error) {
+			return m.privilege.Plan(ctx, objectName, isComputer, rules["privilege"])
+		}},
+		{"scripts", func() ([]plan.Change, error) {
+			return m.scripts.Plan(ctx, objectName, isComputer, rules["scripts"], pols.AssetsFS)
+		}},
+		{"mount", func() ([]plan.Change, error) { return m.mount.Plan(ctx, objectName, isComputer, rules["mount"]) }},
+		{"apparmor", func() ([]plan.Change, error) {
+			return m.apparmor.Plan(ctx, objectName, isComputer, rules["apparmor"], pols.AssetsFS)
+		}},
+		{"firewall", func() ([]plan.Change, error) { return m.firewall.Plan(ctx, objectName, isComputer, rules["firewall"]) }},
+		{"services", func() ([]plan.Change, error) { return m.services.Plan(ctx, objectName, isComputer, rules["services"]) }},
+		{"kernel", func() ([]plan.Change, error) { return m.kernel.Plan(ctx, objectName, isComputer, rules["kernel"]) }},
+		{"ssh", func() ([]plan.Change, error) {
+			return m.ssh.Plan(ctx, objectName, isComputer, rules["ssh"], pols.AssetsFS)
+		}},
+		{"proxy", func() ([]plan.Change, error) { return m.proxy.Plan(ctx, objectName, isComputer, rules["proxy"]) }},
+		{"certificate", func() ([]plan.Change, error) {
+			return m.certificate.Plan(ctx, objectName, isComputer, isOnline, rules["certificate"])
+		}},
+		{"packages", func() ([]plan.Change, error) { return m.packages.Plan(ctx, objectName, isComputer, rules["packages"]) }},
+	}
+	if isComputer {
+		planners = append(planners, planner{"gdm", func() ([]plan.Change, error) { return m.gdm.Plan(ctx, rules["gdm"]) }})
+	}
+
+	changes = make(map[string][]plan.Change)
+	for _, p := range planners {
+		c, err := p.plan()
+		if err != nil {
+			return nil, err
+		}
+		if len(c) > 0 {
+			changes[p.policyType] = c
+		}
+	}
+
+	return changes, nil
+}
+
+// FormatPlan writes to w the changes planned for objectName, ordered by policy type.
+func FormatPlan(w io.Writer, objectName string, changes map[string][]plan.Change) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, gotext.Get("No changes for %s", objectName))
+		return
+	}
+
+	fmt.Fprintln(w, gotext.Get("Planned changes for %s:", objectName))
+	policyTypes := make([]string, 0, len(changes))
+	for t := range changes {
+		policyTypes = append(policyTypes, t)
+	}
+	slices.Sort(policyTypes)
+	for _, t := range policyTypes {
+		fmt.Fprintf(w, "* %s\n", t)
+		for _, c := range changes[t] {
+			fmt.Fprintf(w, "** %s\n", c)
+		}
+	}
 }
 
 // DumpPolicies displays the currently applied policies and rules (since last update) for objectName.
 // It can in addition show the rules and overridden content.
-func (m *Manager) DumpPolicies(ctx context.Context, objectName string, computerOnly, withRules, withOverridden bool) (msg string, err error) {
+// With the json or yaml format, all rules are listed with the GPO they come from and the GPOs they overrode,
+// regardless of withRules and withOverridden.
+func (m *Manager) DumpPolicies(ctx context.Context, objectName string, computerOnly, withRules, withOverridden bool, format string) (msg string, err error) {
 	defer decorate.OnError(&err, gotext.Get("failed to dump policies for %q", objectName))
 
 	log.Infof(ctx, "Dumping policies for %s", objectName)
 
+	if format == "" {
+		format = FormatText
+	}
+	if format != FormatText && format != FormatJSON && format != FormatYAML {
+		return "", errors.New(gotext.Get("unsupported format %q", format))
+	}
+
 	var out strings.Builder
 
+	var policiesHost Policies
 	var alreadyProcessedRules map[string]struct{}
 	if !computerOnly {
-		fmt.Fprintln(&out, gotext.Get("Policies from machine configuration:"))
-		policiesHost, err := NewFromCache(ctx, filepath.Join(m.policiesCacheDir, m.hostname))
+		policiesHost, err = NewFromCache(ctx, filepath.Join(m.policiesCacheDir, m.hostname))
 		if err != nil {
 			return "", errors.New(gotext.Get("no policy applied for %q: %v", m.hostname, err))
 		}
-		for _, g := range policiesHost.GPOs {
-			alreadyProcessedRules = g.Format(&out, withRules, withOverridden, alreadyProcessedRules)
+		if format == FormatText {
+			fmt.Fprintln(&out, gotext.Get("Policies from machine configuration:"))
+			for _, g := range policiesHost.GPOs {
+				alreadyProcessedRules = g.Format(&out, withRules, withOverridden, alreadyProcessedRules)
+			}
+			for _, g := range policiesHost.FilteredGPOs {
+				g.FormatFilteredOut(&out)
+			}
+			fmt.Fprintln(&out, gotext.Get("Policies from user configuration:"))
 		}
-		fmt.Fprintln(&out, gotext.Get("Policies from user configuration:"))
 	}
 
 	// Load target policies
@@ -445,10 +894,56 @@ func (m *Manager) DumpPolicies(ctx context.Context, objectName string, computerO
 		log.Info(ctx, gotext.Get("User %q not found on cache.", objectName))
 		return "", errors.New(gotext.Get("no policy applied for %q: %v", objectName, err))
 	}
+
+	if format != FormatText {
+		targetSource := "user"
+		if computerOnly {
+			targetSource = "machine"
+		}
+		d := newDump(objectName, policiesHost.GPOs, policiesTarget.GPOs, targetSource)
+		d.addFilters(policiesHost.GPOs, policiesHost.FilteredGPOs, "machine")
+		d.addFilters(policiesTarget.GPOs, policiesTarget.FilteredGPOs, targetSource)
+		return d.marshal(format)
+	}
+
 	for _, g := range policiesTarget.GPOs {
 		alreadyProcessedRules = g.Format(&out, withRules, withOverridden, alreadyProcessedRules)
 	}
+	for _, g := range policiesTarget.FilteredGPOs {
+		g.FormatFilteredOut(&out)
+	}
+
+	return out.String(), nil
+}
+
+// ExplainPolicy shows every GPO applied to objectName defining key, in precedence order, and why the key
+// ends up with its effective value.
+// For users, machine GPOs are considered first, like in DumpPolicies.
+func (m *Manager) ExplainPolicy(ctx context.Context, objectName string, computerOnly bool, key string) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to explain policy %q for %q", key, objectName))
+
+	log.Infof(ctx, "Explaining policy %s for %s", key, objectName)
+
+	var machineGPOs []GPO
+	targetSource := "machine"
+	if !computerOnly {
+		policiesHost, err := NewFromCache(ctx, filepath.Join(m.policiesCacheDir, m.hostname))
+		if err != nil {
+			return "", errors.New(gotext.Get("no policy applied for %q: %v", m.hostname, err))
+		}
+		machineGPOs = policiesHost.GPOs
+		targetSource = "user"
+	}
 
+	policiesTarget, err := NewFromCache(ctx, filepath.Join(m.policiesCacheDir, objectName))
+	if err != nil {
+		return "", errors.New(gotext.Get("no policy applied for %q: %v", objectName, err))
+	}
+
+	var out strings.Builder
+	if err := explainRule(&out, key, machineGPOs, policiesTarget.GPOs, targetSource); err != nil {
+		return "", err
+	}
 	return out.String(), nil
 }
 
@@ -469,6 +964,64 @@ func (m *Manager) LastUpdateFor(ctx context.Context, objectName string, isMachin
 	return info.ModTime(), nil
 }
 
+// PoliciesHistory lists the generations of policies applied to objectName, which can be restored.
+func (m *Manager) PoliciesHistory(ctx context.Context, objectName string) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to list policies history for %q", objectName))
+
+	log.Infof(ctx, "Listing policies history for %s", objectName)
+
+	gens, err := History(filepath.Join(m.policiesCacheDir, objectName))
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	FormatHistory(&out, objectName, gens)
+	return out.String(), nil
+}
+
+// DiffPoliciesHistory shows the changes between the generations from and to of policies applied to objectName.
+func (m *Manager) DiffPoliciesHistory(ctx context.Context, objectName string, from, to int) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to compare policies history for %q", objectName))
+
+	log.Infof(ctx, "Comparing policies generations %d and %d for %s", from, to, objectName)
+
+	p := filepath.Join(m.policiesCacheDir, objectName)
+	genFrom, err := GenerationFromHistory(p, from)
+	if err != nil {
+		return "", err
+	}
+	genTo, err := GenerationFromHistory(p, to)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	FormatDiff(&out, genFrom, genTo)
+	return out.String(), nil
+}
+
+// RollbackPolicies applies again the policies of a previous generation to objectName, without contacting
+// the directory service. The restored policies become the latest generation of the history.
+func (m *Manager) RollbackPolicies(ctx context.Context, objectName string, isComputer bool, generation int) (err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to roll back policies for %q to generation %d", objectName, generation))
+
+	log.Infof(ctx, "Rolling back policies for %s to generation %d", objectName, generation)
+
+	g, err := GenerationFromHistory(filepath.Join(m.policiesCacheDir, objectName), generation)
+	if err != nil {
+		return err
+	}
+	pols, err := g.Policies(ctx)
+	if err != nil {
+		return err
+	}
+	defer pols.Close()
+
+	// Apply again every policy of the generation, as the system may have changed since it was applied.
+	return m.ApplyPolicies(ctx, objectName, isComputer, &pols, true)
+}
+
 // GetSubscriptionState returns the subscription status from Ubuntu Pro.
 func (m *Manager) GetSubscriptionState(ctx context.Context) (subscriptionEnabled bool) {
 	log.Debug(ctx, "Refresh subscription state")
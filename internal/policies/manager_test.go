@@ -6,8 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -40,13 +43,21 @@ func TestApplyPolicies(t *testing.T) {
 		makeDirReadOnly                 string
 		isNotSubscribed                 bool
 		secondCallWithNoSubscription    bool
+		secondCallWithSameRules         bool
+		forceSecondCall                 bool
 		noUbuntuProxyManager            bool
+		failingPackageInstall           bool
 		backendOfflineError             bool
+		secondCallFailingPoliciesDir    string
+		rollbackToGeneration            int
 
-		wantErr bool
+		wantErr         bool
+		wantNoRollback  bool
+		wantRollbackErr bool
 	}{
 		"Succeed": {policiesDir: "all_entry_types"},
 		"Succeed if checking for backend online status returns an error":         {backendOfflineError: true, policiesDir: "all_entry_types"},
+		"Succeed with failing packages, reporting them in status":                {failingPackageInstall: true, policiesDir: "all_entry_types"},
 		"Second call with no rules deletes everything":                           {policiesDir: "all_entry_types", secondCallWithNoRules: true, scriptSessionEndedForSecondCall: true},
 		"Second call with no rules don't remove scripts if session hasn’t ended": {policiesDir: "all_entry_types", secondCallWithNoRules: true, scriptSessionEndedForSecondCall: false},
 
@@ -55,14 +66,29 @@ func TestApplyPolicies(t *testing.T) {
 		"Second call with no subscription should remove everything but dconf content":   {policiesDir: "all_entry_types", secondCallWithNoSubscription: true, scriptSessionEndedForSecondCall: true},
 		"Second call with no subscription don't remove scripts if session hasn’t ended": {policiesDir: "all_entry_types", secondCallWithNoSubscription: true, scriptSessionEndedForSecondCall: false},
 
+		// incremental application
+		"Second call with same rules skips unchanged policies":      {policiesDir: "all_entry_types", secondCallWithSameRules: true, scriptSessionEndedForSecondCall: true},
+		"Second call with same rules and force applies all of them": {policiesDir: "all_entry_types", secondCallWithSameRules: true, forceSecondCall: true, scriptSessionEndedForSecondCall: true},
+
 		// Error cases
 		"Error when applying dconf policy":       {policiesDir: "dconf_failing", wantErr: true},
 		"Error when applying privilege policy":   {makeDirReadOnly: "etc/sudoers.d", policiesDir: "all_entry_types", wantErr: true},
 		"Error when applying scripts policy":     {makeDirReadOnly: "run/adsys/machine", policiesDir: "all_entry_types", wantErr: true},
 		"Error when applying apparmor policy":    {makeDirReadOnly: "etc/apparmor.d/adsys", policiesDir: "all_entry_types", wantErr: true},
 		"Error when applying mount policy":       {makeDirReadOnly: "etc/systemd/system", policiesDir: "all_entry_types", wantErr: true},
-		"Error when applying proxy policy":       {noUbuntuProxyManager: true, policiesDir: "all_entry_types", wantErr: true},
-		"Error when applying certificate policy": {policiesDir: "certificate_failing", wantErr: true},
+		"Error when applying firewall policy":    {makeDirReadOnly: "etc/nftables.d", policiesDir: "all_entry_types", wantErr: true},
+		"Error when applying services policy":    {makeDirReadOnly: "var/lib/adsys", policiesDir: "all_entry_types", wantErr: true},
+		"Error when applying kernel policy":      {makeDirReadOnly: "etc/sysctl.d", policiesDir: "all_entry_types", wantErr: true},
+		"Error when applying ssh policy":         {makeDirReadOnly: "etc/ssh", policiesDir: "all_entry_types", wantErr: true},
+		"Error when applying proxy policy":       {noUbuntuProxyManager: true, policiesDir: "all_entry_types", wantErr: true, wantNoRollback: true},
+		"Error when applying certificate policy": {policiesDir: "certificate_failing", wantErr: true, wantNoRollback: true},
+
+		// Rollback cases
+		"Error on second call restores previously applied policies": {policiesDir: "all_entry_types", secondCallFailingPoliciesDir: "dconf_failing"},
+
+		// Rollback to a previous generation
+		"Rollback to first generation applies its policies again": {policiesDir: "all_entry_types", secondCallWithNoRules: true, scriptSessionEndedForSecondCall: true, rollbackToGeneration: 1},
+		"Error on rollback to unknown generation":                 {policiesDir: "all_entry_types", secondCallWithNoRules: true, scriptSessionEndedForSecondCall: true, rollbackToGeneration: 42, wantRollbackErr: true},
 	}
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
@@ -99,6 +125,11 @@ func TestApplyPolicies(t *testing.T) {
 				require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", false), "Teardown: can not restore subscription status")
 			}()
 
+			aptGetCmd := []string{"/bin/true"}
+			if tc.failingPackageInstall {
+				aptGetCmd = []string{"/bin/false"}
+			}
+
 			m, err := policies.NewManager(bus,
 				hostname,
 				mockBackend{},
@@ -113,6 +144,20 @@ func TestApplyPolicies(t *testing.T) {
 				policies.WithApparmorFsDir(filepath.Dir(loadedPoliciesFile)),
 				policies.WithApparmorParserCmd([]string{"/bin/true"}),
 				policies.WithCertAutoenrollCmd([]string{"/bin/true"}),
+				policies.WithDpkgQueryCmd([]string{"/bin/true"}),
+				policies.WithAptGetCmd(aptGetCmd),
+				policies.WithSnapCmd([]string{"/bin/true"}),
+				policies.WithNftablesDir(filepath.Join(fakeRootDir, "etc", "nftables.d")),
+				policies.WithNftCmd([]string{"/bin/true"}),
+				policies.WithSystemctlCmd([]string{"/bin/true"}),
+				policies.WithSysctlDir(filepath.Join(fakeRootDir, "etc", "sysctl.d")),
+				policies.WithModprobeDir(filepath.Join(fakeRootDir, "etc", "modprobe.d")),
+				policies.WithProcSysDir(filepath.Join("testdata", "proc", "sys")),
+				policies.WithSysModuleDir(filepath.Join(fakeRootDir, "sys", "module")),
+				policies.WithSysctlCmd([]string{"/bin/true"}),
+				policies.WithModprobeCmd([]string{"/bin/true"}),
+				policies.WithSSHDir(filepath.Join(fakeRootDir, "etc", "ssh")),
+				policies.WithSshdCmd([]string{"/bin/true"}),
 				policies.WithSystemUnitDir(systemUnitDir),
 				policies.WithProxyApplier(&mockProxyApplier{wantApplyError: tc.noUbuntuProxyManager}),
 				policies.WithSystemdCaller(&testutils.MockSystemdCaller{}),
@@ -133,7 +178,8 @@ func TestApplyPolicies(t *testing.T) {
 			orig := logrus.StandardLogger().Out
 			logrus.StandardLogger().SetOutput(w)
 
-			err = m.ApplyPolicies(context.Background(), "hostname", true, &pols)
+			before := treeContent(t, fakeRootDir)
+			err = m.ApplyPolicies(context.Background(), "hostname", true, &pols, false)
 
 			logrus.StandardLogger().SetOutput(orig)
 			w.Close()
@@ -149,9 +195,41 @@ func TestApplyPolicies(t *testing.T) {
 
 			if tc.wantErr {
 				require.Error(t, err, "ApplyPolicy should return an error but got none")
+				checkAndCleanStatus(t, m, cacheDir, "hostname", true)
+				if tc.wantNoRollback {
+					require.DirExists(t, filepath.Join(cacheDir, policies.PoliciesCacheBaseName, "hostname"), "ApplyPolicy should save applied policies when only external managers failed")
+					require.NotEqual(t, before, treeContent(t, fakeRootDir), "ApplyPolicy should not roll back committed changes when only external managers failed")
+					return
+				}
+				require.Equal(t, before, treeContent(t, fakeRootDir), "ApplyPolicy should roll back all changes on error")
 				return
 			}
 			require.NoError(t, err, "ApplyPolicy should return no error but got one")
+			if tc.failingPackageInstall {
+				status, err := m.Status("hostname")
+				require.NoError(t, err, "Status should return no error but got one")
+				var failed bool
+				for _, outcome := range status["packages"].Items {
+					if strings.HasPrefix(outcome, "failed") {
+						failed = true
+					}
+				}
+				require.True(t, failed, "Status should record failing packages in their outcome")
+			}
+			checkAndCleanStatus(t, m, cacheDir, "hostname", false)
+
+			if tc.secondCallFailingPoliciesDir != "" {
+				failingPols, err := policies.NewFromCache(context.Background(), filepath.Join("testdata", "cache", "policies", tc.secondCallFailingPoliciesDir))
+				require.NoError(t, err, "Setup: can not load failing policies list")
+				defer failingPols.Close()
+
+				before := treeContent(t, fakeRootDir)
+				err = m.ApplyPolicies(context.Background(), "hostname", true, &failingPols, false)
+				require.Error(t, err, "ApplyPolicy should return an error but got none")
+				checkAndCleanStatus(t, m, cacheDir, "hostname", true)
+				require.Equal(t, before, treeContent(t, fakeRootDir), "ApplyPolicy should restore previously applied policies on error")
+				return
+			}
 
 			// Fake starting scripts session when we ran scripts
 			runningFlag := filepath.Join(runDir, "machine", "scripts", ".running")
@@ -171,10 +249,27 @@ func TestApplyPolicies(t *testing.T) {
 			} else if tc.secondCallWithNoSubscription {
 				runSecondCall = true
 				require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", false), "Setup: can not set subscription status for second call to disabled")
+			} else if tc.secondCallWithSameRules {
+				runSecondCall = true
+				// Unchanged policies are not applied again: the removed file should only be restored when forcing.
+				require.NoError(t, os.Remove(filepath.Join(sudoersDir, "99-adsys-privilege-enforcement")), "Setup: can not remove applied sudoers file before second call")
 			}
 			if runSecondCall {
-				err = m.ApplyPolicies(context.Background(), "hostname", true, &pols)
+				err = m.ApplyPolicies(context.Background(), "hostname", true, &pols, tc.forceSecondCall)
 				require.NoError(t, err, "ApplyPolicy should return no error but got one")
+				checkAndCleanStatus(t, m, cacheDir, "hostname", false)
+			}
+
+			if tc.rollbackToGeneration != 0 {
+				before := treeContent(t, fakeRootDir)
+				err = m.RollbackPolicies(context.Background(), "hostname", true, tc.rollbackToGeneration)
+				if tc.wantRollbackErr {
+					require.Error(t, err, "RollbackPolicies should return an error but got none")
+					require.Equal(t, before, treeContent(t, fakeRootDir), "RollbackPolicies should not change anything on error")
+					return
+				}
+				require.NoError(t, err, "RollbackPolicies should return no error but got one")
+				checkAndCleanStatus(t, m, cacheDir, "hostname", false)
 			}
 
 			testutils.CompareTreesWithFiltering(t, fakeRootDir, testutils.GoldenPath(t), testutils.UpdateEnabled())
@@ -182,6 +277,281 @@ func TestApplyPolicies(t *testing.T) {
 	}
 }
 
+func TestPlanPolicies(t *testing.T) {
+	//t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname for tests.")
+
+	bus := testutils.NewDbusConn(t)
+
+	subscriptionDbus := bus.Object(consts.SubscriptionDbusRegisteredName,
+		dbus.ObjectPath(consts.SubscriptionDbusObjectPath))
+
+	currentUser, err := user.Current()
+	require.NoError(t, err, "Setup: failed to get current user for tests.")
+
+	tests := map[string]struct {
+		policiesDir     string
+		isUser          bool
+		applyFirst      bool
+		planWithNoRules bool
+		isNotSubscribed bool
+
+		wantErr bool
+	}{
+		"Plan on a pristine system":                                            {policiesDir: "all_entry_types"},
+		"Plan after applying the same policies":                                {policiesDir: "all_entry_types", applyFirst: true},
+		"Plan after applying other policies":                                   {policiesDir: "all_entry_types", applyFirst: true, planWithNoRules: true},
+		"Plan with no rules on a pristine system only creates dconf databases": {planWithNoRules: true},
+		"No subscription only plans dconf content":                             {policiesDir: "all_entry_types", isNotSubscribed: true},
+
+		// User cases
+		"User plan on a pristine system":             {policiesDir: "user_entry_types", isUser: true},
+		"User plan after applying the same policies": {policiesDir: "user_entry_types", isUser: true, applyFirst: true},
+		"User plan after applying other policies":    {policiesDir: "user_entry_types", isUser: true, applyFirst: true, planWithNoRules: true},
+
+		// Error cases
+		"Error when planning dconf policy":      {policiesDir: "dconf_failing", wantErr: true},
+		"Error when planning user dconf policy": {policiesDir: "dconf_failing", isUser: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// We change the dbus returned values to simulate a subscription
+			//t.Parallel()
+
+			pols, err := policies.New(context.Background(), nil, "")
+			require.NoError(t, err, "Setup: can not create empty policies")
+			if tc.policiesDir != "" {
+				pols, err = policies.NewFromCache(context.Background(), filepath.Join("testdata", "cache", "policies", tc.policiesDir))
+				require.NoError(t, err, "Setup: can not load policies list")
+			}
+			defer pols.Close()
+
+			fakeRootDir := t.TempDir()
+			loadedPoliciesFile := filepath.Join(fakeRootDir, "sys", "kernel", "security", "apparmor", "profiles")
+			err = os.MkdirAll(filepath.Dir(loadedPoliciesFile), 0700)
+			require.NoError(t, err, "Setup: can not create loadedPoliciesFile dir")
+			err = os.WriteFile(loadedPoliciesFile, []byte("someprofile (enforce)\n"), 0600)
+			require.NoError(t, err, "Setup: can not create loadedPoliciesFile")
+
+			require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", !tc.isNotSubscribed), "Setup: can not set subscription status")
+			defer func() {
+				require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", false), "Teardown: can not restore subscription status")
+			}()
+
+			m, err := policies.NewManager(bus,
+				hostname,
+				mockBackend{},
+				policies.WithCacheDir(filepath.Join(fakeRootDir, "var", "cache", "adsys")),
+				policies.WithStateDir(filepath.Join(fakeRootDir, "var", "lib", "adsys")),
+				policies.WithRunDir(filepath.Join(fakeRootDir, "run", "adsys")),
+				policies.WithShareDir(filepath.Join(fakeRootDir, "usr", "share", "adsys")),
+				policies.WithDconfDir(filepath.Join(fakeRootDir, "etc", "dconf")),
+				policies.WithPolicyKitDir(filepath.Join(fakeRootDir, "etc", "polkit-1")),
+				policies.WithSudoersDir(filepath.Join(fakeRootDir, "etc", "sudoers.d")),
+				policies.WithApparmorDir(filepath.Join(fakeRootDir, "etc", "apparmor.d", "adsys")),
+				policies.WithApparmorFsDir(filepath.Dir(loadedPoliciesFile)),
+				policies.WithApparmorParserCmd([]string{"/bin/true"}),
+				policies.WithCertAutoenrollCmd([]string{"/bin/true"}),
+				policies.WithDpkgQueryCmd([]string{"/bin/true"}),
+				policies.WithAptGetCmd([]string{"/bin/true"}),
+				policies.WithSnapCmd([]string{"/bin/true"}),
+				policies.WithNftablesDir(filepath.Join(fakeRootDir, "etc", "nftables.d")),
+				policies.WithNftCmd([]string{"/bin/true"}),
+				policies.WithSystemctlCmd([]string{"/bin/true"}),
+				policies.WithSysctlDir(filepath.Join(fakeRootDir, "etc", "sysctl.d")),
+				policies.WithModprobeDir(filepath.Join(fakeRootDir, "etc", "modprobe.d")),
+				policies.WithProcSysDir(filepath.Join("testdata", "proc", "sys")),
+				policies.WithSysModuleDir(filepath.Join(fakeRootDir, "sys", "module")),
+				policies.WithSysctlCmd([]string{"/bin/true"}),
+				policies.WithModprobeCmd([]string{"/bin/true"}),
+				policies.WithSSHDir(filepath.Join(fakeRootDir, "etc", "ssh")),
+				policies.WithSshdCmd([]string{"/bin/true"}),
+				policies.WithSystemUnitDir(filepath.Join(fakeRootDir, "etc", "systemd", "system")),
+				policies.WithProxyApplier(&mockProxyApplier{}),
+				policies.WithSystemdCaller(&testutils.MockSystemdCaller{}),
+			)
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			objectName, isComputer := "hostname", true
+			if tc.isUser {
+				objectName, isComputer = currentUser.Username, false
+			}
+
+			if tc.isUser {
+				// The machine policy is always applied before any user one.
+				machinePols, err := policies.New(context.Background(), nil, "")
+				require.NoError(t, err, "Setup: can not create empty machine policies")
+				err = m.ApplyPolicies(context.Background(), "hostname", true, &machinePols, false)
+				require.NoError(t, err, "Setup: ApplyPolicies for the machine should return no error but got one")
+			}
+			if tc.applyFirst {
+				err = m.ApplyPolicies(context.Background(), objectName, isComputer, &pols, false)
+				require.NoError(t, err, "Setup: ApplyPolicies should return no error but got one")
+				// Compiled dconf databases are only created if dconf is installed: mimic a successful dconf update
+				// so that planning the same policies again is a no-op on any system.
+				for _, db := range []string{"machine", "gdm", objectName} {
+					p := filepath.Join(fakeRootDir, "etc", "dconf", "db", db)
+					if _, err := os.Stat(p); err == nil {
+						continue
+					}
+					require.NoError(t, os.WriteFile(p, nil, 0600), "Setup: can not create compiled dconf database")
+				}
+				if tc.planWithNoRules {
+					pols, err = policies.New(context.Background(), nil, "")
+					require.NoError(t, err, "Setup: can not empty policies before planning")
+				}
+			}
+
+			before := treeContent(t, fakeRootDir)
+
+			changes, err := m.PlanPolicies(context.Background(), objectName, isComputer, &pols)
+			if tc.wantErr {
+				require.Error(t, err, "PlanPolicies should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "PlanPolicies should return no error but got one")
+
+			require.Equal(t, before, treeContent(t, fakeRootDir), "PlanPolicies should not modify the system")
+
+			var out strings.Builder
+			policies.FormatPlan(&out, objectName, changes)
+			got := strings.ReplaceAll(out.String(), fakeRootDir, "#TMPDIR#")
+			if tc.isUser {
+				got = strings.ReplaceAll(got, "/users/"+currentUser.Uid+"/", "/users/#UID#/")
+				got = strings.ReplaceAll(got, currentUser.Username, "#USER#")
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "PlanPolicies returned unexpected changes")
+		})
+	}
+}
+
+func TestCheckDrift(t *testing.T) {
+	//t.Parallel()
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname for tests.")
+
+	bus := testutils.NewDbusConn(t)
+
+	subscriptionDbus := bus.Object(consts.SubscriptionDbusRegisteredName,
+		dbus.ObjectPath(consts.SubscriptionDbusObjectPath))
+
+	tests := map[string]struct {
+		modifyFile string
+		removeFile string
+		heal       bool
+		noCache    bool
+
+		wantErr bool
+	}{
+		"No drift after applying policies": {},
+		"Modified sudoers file":            {modifyFile: "etc/sudoers.d/99-adsys-privilege-enforcement"},
+		"Removed dconf keyfile":            {removeFile: "etc/dconf/db/machine.d/adsys"},
+		"Modified apparmor profile":        {modifyFile: "etc/apparmor.d/adsys/machine/usr.bin.foo"},
+		"Modified scripts are ignored":     {modifyFile: "run/adsys/machine/scripts/startup"},
+		"Heal applies drifted policies":    {modifyFile: "etc/sudoers.d/99-adsys-privilege-enforcement", heal: true},
+		"Heal without drift does nothing":  {heal: true},
+
+		// Error cases
+		"Error on missing policies cache": {noCache: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// We change the dbus returned values to simulate a subscription
+			//t.Parallel()
+
+			pols, err := policies.NewFromCache(context.Background(), filepath.Join("testdata", "cache", "policies", "all_entry_types"))
+			require.NoError(t, err, "Setup: can not load policies list")
+			defer pols.Close()
+
+			fakeRootDir := t.TempDir()
+			loadedPoliciesFile := filepath.Join(fakeRootDir, "sys", "kernel", "security", "apparmor", "profiles")
+			err = os.MkdirAll(filepath.Dir(loadedPoliciesFile), 0700)
+			require.NoError(t, err, "Setup: can not create loadedPoliciesFile dir")
+			err = os.WriteFile(loadedPoliciesFile, []byte("someprofile (enforce)\n"), 0600)
+			require.NoError(t, err, "Setup: can not create loadedPoliciesFile")
+
+			require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", true), "Setup: can not set subscription status")
+			defer func() {
+				require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", false), "Teardown: can not restore subscription status")
+			}()
+
+			m, err := policies.NewManager(bus,
+				hostname,
+				mockBackend{},
+				policies.WithCacheDir(filepath.Join(fakeRootDir, "var", "cache", "adsys")),
+				policies.WithStateDir(filepath.Join(fakeRootDir, "var", "lib", "adsys")),
+				policies.WithRunDir(filepath.Join(fakeRootDir, "run", "adsys")),
+				policies.WithShareDir(filepath.Join(fakeRootDir, "usr", "share", "adsys")),
+				policies.WithDconfDir(filepath.Join(fakeRootDir, "etc", "dconf")),
+				policies.WithPolicyKitDir(filepath.Join(fakeRootDir, "etc", "polkit-1")),
+				policies.WithSudoersDir(filepath.Join(fakeRootDir, "etc", "sudoers.d")),
+				policies.WithApparmorDir(filepath.Join(fakeRootDir, "etc", "apparmor.d", "adsys")),
+				policies.WithApparmorFsDir(filepath.Dir(loadedPoliciesFile)),
+				policies.WithApparmorParserCmd([]string{"/bin/true"}),
+				policies.WithCertAutoenrollCmd([]string{"/bin/true"}),
+				policies.WithDpkgQueryCmd([]string{"/bin/true"}),
+				policies.WithAptGetCmd([]string{"/bin/true"}),
+				policies.WithSnapCmd([]string{"/bin/true"}),
+				policies.WithNftablesDir(filepath.Join(fakeRootDir, "etc", "nftables.d")),
+				policies.WithNftCmd([]string{"/bin/true"}),
+				policies.WithSystemctlCmd([]string{"/bin/true"}),
+				policies.WithSysctlDir(filepath.Join(fakeRootDir, "etc", "sysctl.d")),
+				policies.WithModprobeDir(filepath.Join(fakeRootDir, "etc", "modprobe.d")),
+				policies.WithProcSysDir(filepath.Join("testdata", "proc", "sys")),
+				policies.WithSysModuleDir(filepath.Join(fakeRootDir, "sys", "module")),
+				policies.WithSysctlCmd([]string{"/bin/true"}),
+				policies.WithModprobeCmd([]string{"/bin/true"}),
+				policies.WithSSHDir(filepath.Join(fakeRootDir, "etc", "ssh")),
+				policies.WithSshdCmd([]string{"/bin/true"}),
+				policies.WithSystemUnitDir(filepath.Join(fakeRootDir, "etc", "systemd", "system")),
+				policies.WithProxyApplier(&mockProxyApplier{}),
+				policies.WithSystemdCaller(&testutils.MockSystemdCaller{}),
+			)
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			if !tc.noCache {
+				err = m.ApplyPolicies(context.Background(), "hostname", true, &pols, false)
+				require.NoError(t, err, "Setup: ApplyPolicies should return no error but got one")
+			}
+
+			if tc.modifyFile != "" {
+				// Some files, like sudoers ones, are read only.
+				require.NoError(t, os.Chmod(filepath.Join(fakeRootDir, tc.modifyFile), 0600), "Setup: can not make file writable")
+				f, err := os.OpenFile(filepath.Join(fakeRootDir, tc.modifyFile), os.O_APPEND|os.O_WRONLY, 0600)
+				require.NoError(t, err, "Setup: can not open file to modify")
+				_, err = f.WriteString("local modification\n")
+				f.Close()
+				require.NoError(t, err, "Setup: can not modify file")
+			}
+			if tc.removeFile != "" {
+				require.NoError(t, os.Remove(filepath.Join(fakeRootDir, tc.removeFile)), "Setup: can not remove file")
+			}
+
+			got, err := m.CheckDrift(context.Background(), "hostname", true, tc.heal)
+			if tc.wantErr {
+				require.Error(t, err, "CheckDrift should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "CheckDrift should return no error but got one")
+
+			got = strings.ReplaceAll(got, fakeRootDir, "#TMPDIR#")
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "CheckDrift returned unexpected drift")
+
+			if !tc.heal {
+				return
+			}
+			got, err = m.CheckDrift(context.Background(), "hostname", true, false)
+			require.NoError(t, err, "CheckDrift should return no error but got one")
+			require.Equal(t, "No drift for hostname\n", got, "Healed policies should not drift anymore")
+		})
+	}
+}
+
 func TestDumpPolicies(t *testing.T) {
 	t.Parallel()
 
@@ -197,6 +567,7 @@ func TestDumpPolicies(t *testing.T) {
 		computerOnly       bool
 		withRules          bool
 		withOverridden     bool
+		format             string
 
 		wantErr bool
 	}{
@@ -254,6 +625,70 @@ func TestDumpPolicies(t *testing.T) {
 			withOverridden:     true,
 		},
 
+		// Machine readable formats
+		"JSON format with rules provenance": {
+			cachePoliciesUser:  "one_gpo",
+			cachePolicyMachine: "two_gpos_override_one_gpo",
+			format:             "json",
+		},
+		"YAML format with rules provenance": {
+			cachePoliciesUser:  "one_gpo",
+			cachePolicyMachine: "two_gpos_override_one_gpo",
+			format:             "yaml",
+		},
+		"JSON format for machine only": {
+			cachePolicyMachine: "two_gpos_with_overrides",
+			target:             hostname,
+			computerOnly:       true,
+			format:             "json",
+		},
+		"JSON format with appended values": {
+			cachePoliciesUser:  "with_assets",
+			cachePolicyMachine: "with_assets_other",
+			format:             "json",
+		},
+		"Text format is the default one": {
+			cachePoliciesUser: "two_gpos_with_overrides",
+			withRules:         true,
+			format:            "text",
+		},
+
+		// Host filters
+		"GPOs with host filters": {
+			cachePoliciesUser:  "with_filters",
+			cachePolicyMachine: "with_filters_other",
+			withRules:          true,
+		},
+		"JSON format with host filters": {
+			cachePoliciesUser:  "with_filters",
+			cachePolicyMachine: "with_filters_other",
+			format:             "json",
+		},
+
+		// Item-level targeting
+		"Rules with item-level targeting": {
+			cachePoliciesUser: "with_targets",
+			withRules:         true,
+		},
+		"Rules with item-level targeting are not shown without details": {
+			cachePoliciesUser: "with_targets",
+		},
+		"YAML format with item-level targeting": {
+			cachePoliciesUser: "with_targets",
+			format:            "yaml",
+		},
+
+		// Loopback processing
+		"GPOs with loopback processing": {
+			cachePoliciesUser: "with_loopback",
+			withRules:         true,
+			withOverridden:    true,
+		},
+		"JSON format with loopback processing": {
+			cachePoliciesUser: "with_loopback",
+			format:            "json",
+		},
+
 		// Edge cases
 		"Same GPO Machine and User": {
 			cachePoliciesUser:  "one_gpo",
@@ -280,6 +715,11 @@ func TestDumpPolicies(t *testing.T) {
 			cachePolicyMachine: "-",
 			wantErr:            true,
 		},
+		"Error on unsupported format": {
+			cachePoliciesUser: "one_gpo",
+			format:            "xml",
+			wantErr:           true,
+		},
 	}
 
 	for name, tc := range tests {
@@ -312,7 +752,7 @@ func TestDumpPolicies(t *testing.T) {
 			if tc.target == "" {
 				tc.target = "user"
 			}
-			got, err := m.DumpPolicies(context.Background(), tc.target, tc.computerOnly, tc.withRules, tc.withOverridden)
+			got, err := m.DumpPolicies(context.Background(), tc.target, tc.computerOnly, tc.withRules, tc.withOverridden, tc.format)
 			if tc.wantErr {
 				require.Error(t, err, "DumpPolicies should return an error but got none")
 				return
@@ -325,6 +765,192 @@ func TestDumpPolicies(t *testing.T) {
 	}
 }
 
+func TestExplainPolicy(t *testing.T) {
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname")
+
+	tests := map[string]struct {
+		cachePoliciesUser  string
+		cachePolicyMachine string
+		target             string
+		computerOnly       bool
+		key                string
+
+		wantErr bool
+	}{
+		"Key defined by one GPO":                {cachePoliciesUser: "one_gpo", key: "dconf/path/to/key1"},
+		"Key overridden by other GPOs":          {cachePoliciesUser: "two_gpos_with_overrides", key: "dconf/path/to/Gpo1key1"},
+		"Key overridden by machine GPO":         {cachePoliciesUser: "one_gpo", cachePolicyMachine: "two_gpos_override_one_gpo", key: "dconf/path/to/key1"},
+		"Appended values are merged":            {cachePoliciesUser: "with_assets", cachePolicyMachine: "with_assets_other", key: "scripts/path/to/key3"},
+		"Disabled key":                          {cachePoliciesUser: "one_gpo", key: "scripts/path/to/key3"},
+		"Release override replaced value":       {cachePoliciesUser: "release_override", key: "dconf/path/to/key1"},
+		"Machine only policies":                 {cachePolicyMachine: "two_gpos_override_one_gpo", target: hostname, computerOnly: true, key: "dconf/path/to/key2"},
+		"Key with leading and trailing slashes": {cachePoliciesUser: "one_gpo", key: "/dconf/path/to/key1/"},
+		"Key not defined by any GPO":            {cachePoliciesUser: "one_gpo", key: "dconf/path/to/doesnotexist"},
+
+		// Error cases
+		"Error on key without policy type":                   {cachePoliciesUser: "one_gpo", key: "dconf", wantErr: true},
+		"Error on missing target cache":                      {key: "dconf/path/to/key1", wantErr: true},
+		"Error on missing machine cache when targeting user": {cachePoliciesUser: "one_gpo", cachePolicyMachine: "-", key: "dconf/path/to/key1", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir, runDir := t.TempDir(), t.TempDir()
+			m, err := policies.NewManager(bus, hostname, mockBackend{}, policies.WithCacheDir(cacheDir), policies.WithRunDir(runDir))
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			err = os.MkdirAll(filepath.Join(cacheDir, policies.PoliciesCacheBaseName), 0750)
+			require.NoError(t, err, "Setup: cant not create policies cache directory")
+
+			if tc.cachePoliciesUser != "" {
+				err := shutil.CopyTree(filepath.Join("testdata", "cache", "policies", tc.cachePoliciesUser), filepath.Join(cacheDir, policies.PoliciesCacheBaseName, "user"), nil)
+				require.NoError(t, err, "Setup: couldn’t copy user policies cache")
+			}
+			if tc.cachePolicyMachine == "" {
+				machinePolicyCache := filepath.Join(cacheDir, policies.PoliciesCacheBaseName, hostname)
+				err = os.MkdirAll(machinePolicyCache, 0750)
+				require.NoError(t, err, "Setup: cant not create machine policies cache directory")
+				f, err := os.Create(filepath.Join(machinePolicyCache, "policies"))
+				require.NoError(t, err, "Setup: failed to create empty machine policies cache")
+				f.Close()
+			} else if tc.cachePolicyMachine != "-" {
+				err := shutil.CopyTree(filepath.Join("testdata", "cache", "policies", tc.cachePolicyMachine), filepath.Join(cacheDir, policies.PoliciesCacheBaseName, hostname), nil)
+				require.NoError(t, err, "Setup: couldn’t copy machine policies cache")
+			}
+
+			if tc.target == "" {
+				tc.target = "user"
+			}
+			got, err := m.ExplainPolicy(context.Background(), tc.target, tc.computerOnly, tc.key)
+			if tc.wantErr {
+				require.Error(t, err, "ExplainPolicy should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "ExplainPolicy should return no error but got one")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "ExplainPolicy returned unexpected output")
+		})
+	}
+}
+
+func TestReport(t *testing.T) {
+	//t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	subscriptionDbus := bus.Object(consts.SubscriptionDbusRegisteredName,
+		dbus.ObjectPath(consts.SubscriptionDbusObjectPath))
+
+	// Use a fixed hostname as it is part of the report.
+	hostname := "myhost"
+
+	tests := map[string]struct {
+		cachePoliciesUser  string
+		cachePolicyMachine string
+		target             string
+		computerOnly       bool
+		format             string
+		status             string
+		isNotSubscribed    bool
+
+		wantErr bool
+	}{
+		"Html report of machine and user":                  {cachePoliciesUser: "one_gpo", cachePolicyMachine: "two_gpos_override_one_gpo"},
+		"Json report of machine and user":                  {cachePoliciesUser: "one_gpo", cachePolicyMachine: "two_gpos_override_one_gpo", format: "json"},
+		"Html is the default format":                       {cachePoliciesUser: "one_gpo", format: "-"},
+		"All rules are reported applied with subscription": {cachePoliciesUser: "all_entry_types", format: "json"},
+		"Pro only rules are reported filtered":             {cachePoliciesUser: "all_entry_types", format: "json", isNotSubscribed: true},
+		"Html report of filtered rules":                    {cachePoliciesUser: "all_entry_types", isNotSubscribed: true},
+		"Appended values are reported merged":              {cachePoliciesUser: "with_assets", cachePolicyMachine: "with_assets_other", format: "json"},
+		"Recorded status of managers is reported":          {cachePoliciesUser: "one_gpo", status: "all_succeeded", format: "json"},
+		"Failed managers are reported":                     {cachePoliciesUser: "one_gpo", status: "with_failures", format: "json"},
+		"Html report of failed managers":                   {cachePoliciesUser: "one_gpo", status: "with_failures"},
+		"Machine only report":                              {cachePolicyMachine: "two_gpos_override_one_gpo", target: hostname, computerOnly: true, format: "json"},
+
+		// Error cases
+		"Error on unsupported format":                        {cachePoliciesUser: "one_gpo", format: "xml", wantErr: true},
+		"Error on invalid status":                            {cachePoliciesUser: "one_gpo", status: "invalid", wantErr: true},
+		"Error on missing target cache":                      {wantErr: true},
+		"Error on missing machine cache when targeting user": {cachePoliciesUser: "one_gpo", cachePolicyMachine: "-", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// We change the dbus returned values to simulate a subscription
+			//t.Parallel()
+
+			require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", !tc.isNotSubscribed), "Setup: can not set subscription status")
+			defer func() {
+				require.NoError(t, subscriptionDbus.SetProperty(consts.SubscriptionDbusInterface+".Attached", false), "Teardown: can not restore subscription status")
+			}()
+
+			cacheDir, runDir := t.TempDir(), t.TempDir()
+			m, err := policies.NewManager(bus, hostname, mockBackend{}, policies.WithCacheDir(cacheDir), policies.WithRunDir(runDir))
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			err = os.MkdirAll(filepath.Join(cacheDir, policies.PoliciesCacheBaseName), 0750)
+			require.NoError(t, err, "Setup: cant not create policies cache directory")
+
+			if tc.cachePoliciesUser != "" {
+				err := shutil.CopyTree(filepath.Join("testdata", "cache", "policies", tc.cachePoliciesUser), filepath.Join(cacheDir, policies.PoliciesCacheBaseName, "user"), nil)
+				require.NoError(t, err, "Setup: couldn’t copy user policies cache")
+			}
+			if tc.cachePolicyMachine == "" {
+				machinePolicyCache := filepath.Join(cacheDir, policies.PoliciesCacheBaseName, hostname)
+				err = os.MkdirAll(machinePolicyCache, 0750)
+				require.NoError(t, err, "Setup: cant not create machine policies cache directory")
+				f, err := os.Create(filepath.Join(machinePolicyCache, "policies"))
+				require.NoError(t, err, "Setup: failed to create empty machine policies cache")
+				f.Close()
+			} else if tc.cachePolicyMachine != "-" {
+				err := shutil.CopyTree(filepath.Join("testdata", "cache", "policies", tc.cachePolicyMachine), filepath.Join(cacheDir, policies.PoliciesCacheBaseName, hostname), nil)
+				require.NoError(t, err, "Setup: couldn’t copy machine policies cache")
+			}
+
+			if tc.status != "" {
+				err := shutil.CopyFile(filepath.Join("testdata", "status", tc.status), filepath.Join(cacheDir, "status", "user"), false)
+				require.NoError(t, err, "Setup: couldn’t copy policies status")
+			}
+
+			// Fix last update time of each object for reproducible reports.
+			for _, object := range []string{"user", hostname} {
+				p := filepath.Join(cacheDir, policies.PoliciesCacheBaseName, object)
+				if _, err := os.Stat(p); err != nil {
+					continue
+				}
+				updateTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+				require.NoError(t, os.Chtimes(p, updateTime, updateTime), "Setup: failed to set last update time")
+			}
+
+			if tc.target == "" {
+				tc.target = "user"
+			}
+			if tc.format == "" {
+				tc.format = "html"
+			} else if tc.format == "-" {
+				tc.format = ""
+			}
+			got, err := m.Report(context.Background(), tc.target, tc.computerOnly, "Backend: mock", tc.format)
+			if tc.wantErr {
+				require.Error(t, err, "Report should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "Report should return no error but got one")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "Report returned unexpected output")
+		})
+	}
+}
+
 func TestLastUpdateFor(t *testing.T) {
 	t.Parallel()
 
@@ -382,6 +1008,158 @@ func TestLastUpdateFor(t *testing.T) {
 	}
 }
 
+func TestPoliciesStatus(t *testing.T) {
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname")
+
+	tests := map[string]struct {
+		status string
+
+		wantErr bool
+	}{
+		"All managers succeeded":            {status: "all_succeeded"},
+		"Managers failed on last attempt":   {status: "with_failures"},
+		"No status recorded for the object": {},
+
+		// Error cases
+		"Error on invalid status": {status: "invalid", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir, runDir := t.TempDir(), t.TempDir()
+			m, err := policies.NewManager(bus, hostname, mockBackend{}, policies.WithCacheDir(cacheDir), policies.WithRunDir(runDir))
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			if tc.status != "" {
+				err := shutil.CopyFile(filepath.Join("testdata", "status", tc.status), filepath.Join(cacheDir, "status", "user"), false)
+				require.NoError(t, err, "Setup: couldn’t copy policies status")
+			}
+
+			got, err := m.PoliciesStatus(context.Background(), "user")
+			if tc.wantErr {
+				require.Error(t, err, "PoliciesStatus should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "PoliciesStatus should return no error but got one")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "PoliciesStatus returned unexpected output")
+		})
+	}
+}
+
+func TestPoliciesHistory(t *testing.T) {
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname")
+
+	tests := map[string]struct {
+		saved            []string
+		corruptedHistory bool
+
+		wantErr bool
+	}{
+		"One generation":                         {saved: []string{"one_gpo"}},
+		"Multiple generations":                   {saved: []string{"one_gpo", "with_assets", "two_gpos_no_override"}},
+		"Identical policies are not duplicated":  {saved: []string{"one_gpo", "one_gpo", "with_assets", "with_assets"}},
+		"Previous policies are a new generation": {saved: []string{"one_gpo", "with_assets", "one_gpo"}},
+		"Oldest generations are pruned": {saved: []string{
+			"one_gpo", "simple", "one_gpo", "simple", "one_gpo", "simple",
+			"one_gpo", "simple", "one_gpo", "simple", "one_gpo", "with_assets"}},
+
+		// Edge cases
+		"No history": {},
+
+		// Error cases
+		"Error on corrupted history": {saved: []string{"one_gpo"}, corruptedHistory: true, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir, runDir := t.TempDir(), t.TempDir()
+			m, err := policies.NewManager(bus, hostname, mockBackend{}, policies.WithCacheDir(cacheDir), policies.WithRunDir(runDir))
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			userCache := filepath.Join(cacheDir, policies.PoliciesCacheBaseName, "user")
+			saveGenerations(t, userCache, tc.saved)
+			if tc.corruptedHistory {
+				require.NoError(t, os.Remove(filepath.Join(userCache, "history", "1", "policies")), "Setup: can't remove generation policies")
+			}
+
+			got, err := m.PoliciesHistory(context.Background(), "user")
+			if tc.wantErr {
+				require.Error(t, err, "PoliciesHistory should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "PoliciesHistory should return no error but got one")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "PoliciesHistory returned unexpected output")
+		})
+	}
+}
+
+func TestDiffPoliciesHistory(t *testing.T) {
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err, "Setup: failed to get hostname")
+
+	tests := map[string]struct {
+		saved    []string
+		from, to int
+
+		wantErr bool
+	}{
+		"Rules are added":              {saved: []string{"one_gpo", "two_gpos_no_override"}, from: 1, to: 2},
+		"Rules are removed":            {saved: []string{"one_gpo", "two_gpos_no_override"}, from: 2, to: 1},
+		"Rules are modified":           {saved: []string{"one_gpo", "one_gpo_other"}, from: 1, to: 2},
+		"Overridden rules are ignored": {saved: []string{"two_gpos_no_override", "two_gpos_with_overrides"}, from: 1, to: 2},
+		"Assets are changed":           {saved: []string{"with_assets", "with_assets_other"}, from: 1, to: 2},
+		"No changes":                   {saved: []string{"one_gpo", "simple"}, from: 1, to: 1},
+
+		// Error cases
+		"Error on missing from generation": {saved: []string{"one_gpo"}, from: 3, to: 1, wantErr: true},
+		"Error on missing to generation":   {saved: []string{"one_gpo"}, from: 1, to: 3, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			cacheDir, runDir := t.TempDir(), t.TempDir()
+			m, err := policies.NewManager(bus, hostname, mockBackend{}, policies.WithCacheDir(cacheDir), policies.WithRunDir(runDir))
+			require.NoError(t, err, "Setup: couldn’t get a new policy manager")
+
+			saveGenerations(t, filepath.Join(cacheDir, policies.PoliciesCacheBaseName, "user"), tc.saved)
+
+			got, err := m.DiffPoliciesHistory(context.Background(), "user", tc.from, tc.to)
+			if tc.wantErr {
+				require.Error(t, err, "DiffPoliciesHistory should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "DiffPoliciesHistory should return no error but got one")
+
+			want := testutils.LoadWithUpdateFromGolden(t, got)
+			require.Equal(t, want, got, "DiffPoliciesHistory returned unexpected output")
+		})
+	}
+}
+
 func TestGetSubscriptionState(t *testing.T) {
 	//t.Parallel()
 
@@ -421,6 +1199,77 @@ func TestGetSubscriptionState(t *testing.T) {
 	}
 }
 
+// saveGenerations saves successively the policies of each testdata cache in saved to p,
+// with a fixed application time for each generation of the history.
+func saveGenerations(t *testing.T, p string, saved []string) {
+	t.Helper()
+
+	for _, src := range saved {
+		pols, err := policies.NewFromCache(context.Background(), filepath.Join("testdata", "cache", "policies", src))
+		require.NoError(t, err, "Setup: can not load policies %q", src)
+		require.NoError(t, pols.Save(p), "Setup: can not save policies %q", src)
+		require.NoError(t, pols.Close(), "Setup: can not close policies %q", src)
+	}
+
+	gens, err := os.ReadDir(filepath.Join(p, "history"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	require.NoError(t, err, "Setup: can not read policies history")
+	for _, g := range gens {
+		id, err := strconv.Atoi(g.Name())
+		require.NoError(t, err, "Setup: unexpected generation %q in history", g.Name())
+		appliedAt := time.Date(2024, time.January, id, 10, 0, 0, 0, time.UTC)
+		require.NoError(t, os.Chtimes(filepath.Join(p, "history", g.Name(), "policies"), appliedAt, appliedAt),
+			"Setup: can not set application time of generation %d", id)
+	}
+}
+
+// checkAndCleanStatus asserts that the recorded status of objectName reports a failing manager or not.
+// It then removes it, as it contains the time policies were applied.
+func checkAndCleanStatus(t *testing.T, m *policies.Manager, cacheDir, objectName string, wantFailure bool) {
+	t.Helper()
+
+	status, err := m.Status(objectName)
+	require.NoError(t, err, "Status should return no error but got one")
+	require.NotEmpty(t, status, "Status should be recorded once policies are applied")
+
+	var failed bool
+	for _, s := range status {
+		if s.Error != "" {
+			failed = true
+		}
+	}
+	require.Equal(t, wantFailure, failed, "Status should record failures of last application")
+
+	require.NoError(t, os.Remove(filepath.Join(cacheDir, "status", objectName)), "Teardown: can not remove policies status")
+}
+
+// treeContent returns the content of every file under root, indexed by path.
+func treeContent(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	content := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			content[p] = "<dir>"
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		content[p] = string(data)
+		return nil
+	})
+	require.NoError(t, err, "Setup: can not read tree content")
+
+	return content
+}
+
 // mockProxyApplier is a mock for the proxy apply object.
 type mockProxyApplier struct {
 	wantApplyError bool
@@ -452,4 +1301,8 @@ func (m mockBackend) IsOnline() (bool, error) {
 	}
 	return true, nil
 }
+func (m mockBackend) DomainServerFQDN(context.Context, string) (string, bool, error) {
+	return "adc.example.com", false, nil
+}
 func (m mockBackend) Config() string { return "mock config" }
+func (m mockBackend) Site() string   { return "" }
@@ -18,10 +18,12 @@ import (
 	_ "embed"
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"os/user"
 	"path/filepath"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -29,6 +31,8 @@ import (
 	"github.com/leonelquinteros/gotext"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/decorate"
 )
 
@@ -40,6 +44,13 @@ type options struct {
 // Option represents an optional function that is able to alter a default behavior used in mount.
 type Option func(*options)
 
+// WithUserLookup specifies a personalized function to look up users.
+func WithUserLookup(f func(string) (*user.User, error)) Option {
+	return func(o *options) {
+		o.userLookup = f
+	}
+}
+
 //go:embed adsys-mount-template.mount
 var systemdUnitTemplate string
 
@@ -155,6 +166,10 @@ func (m *Manager) applyUserMountsPolicy(ctx context.Context, username string, en
 	objectPath := filepath.Join(m.runDir, "users", u.Uid)
 	mountsPath := filepath.Join(objectPath, "mounts")
 
+	if err := journal.Record(ctx, mountsPath); err != nil {
+		return err
+	}
+
 	// This creates the user directory and set its ownership to the current user.
 	if err := mkdirAllWithUIDGID(objectPath, uid, gid); err != nil {
 		return errors.New(gotext.Get("can't create user directory %q for %q: %v", objectPath, username, err))
@@ -196,6 +211,9 @@ func (m *Manager) applySystemMountsPolicy(ctx context.Context, machineName strin
 	var unitsToEnable []string
 
 	prevUnits := m.currentSystemMountUnits()
+	if err := m.journalUnits(ctx, prevUnits, newUnits); err != nil {
+		return err
+	}
 
 	// Removes from the map all the units that are supposed to be written or updated.
 	for name := range newUnits {
@@ -244,6 +262,112 @@ func (m *Manager) applySystemMountsPolicy(ctx context.Context, machineName strin
 	return nil
 }
 
+// Plan returns the changes ApplyPolicy would make to the mounts file or the mount units, without applying them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan mount policy for %s", objectName))
+
+	if len(entries) == 0 {
+		return m.planCleanup(objectName, isComputer)
+	}
+
+	key := "user"
+	if isComputer {
+		key = "system"
+	}
+	i := slices.IndexFunc(entries, func(e entry.Entry) bool {
+		return e.Key == key+"-mounts"
+	})
+	if i == -1 || entries[i].Disabled {
+		return m.planCleanup(objectName, isComputer)
+	}
+
+	parsedValues, err := parseEntryValues(ctx, entries[i])
+	if err != nil {
+		return nil, err
+	}
+
+	if key == "user" {
+		u, err := m.userLookup(objectName)
+		if err != nil {
+			return nil, errors.New(gotext.Get("could not retrieve user for %q: %v", objectName, err))
+		}
+		mountsPath := filepath.Join(m.runDir, "users", u.Uid, "mounts")
+
+		s := strings.Join(parsedValues, "\n")
+		if s == "" {
+			return plan.AppendRemoval(nil, mountsPath), nil
+		}
+		return plan.AppendFile(nil, mountsPath, s+"\n")
+	}
+
+	newUnits := createUnits(parsedValues)
+	prevUnits := m.currentSystemMountUnits()
+	for name := range newUnits {
+		delete(prevUnits, name)
+	}
+	changes = planUnitsCleanup(m.systemUnitDir, prevUnits)
+
+	var names []string
+	for name := range newUnits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var unitsToEnable []string
+	for _, name := range names {
+		c, changed, err := plan.ForFile(filepath.Join(m.systemUnitDir, name), newUnits[name])
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		changes = append(changes, c)
+		unitsToEnable = append(unitsToEnable, name)
+	}
+
+	if len(unitsToEnable) == 0 {
+		return changes, nil
+	}
+
+	changes = append(changes, plan.Change{Action: plan.CommandRun, Target: "systemctl daemon-reload"})
+	for _, name := range unitsToEnable {
+		changes = append(changes,
+			plan.Change{Action: plan.UnitEnabled, Target: name},
+			plan.Change{Action: plan.UnitStarted, Target: name})
+	}
+
+	return changes, nil
+}
+
+// planCleanup returns the changes cleanup would make for objectName.
+func (m *Manager) planCleanup(objectName string, isComputer bool) ([]plan.Change, error) {
+	if !isComputer {
+		u, err := m.userLookup(objectName)
+		if err != nil {
+			return nil, err
+		}
+		return plan.AppendRemoval(nil, filepath.Join(m.runDir, "users", u.Uid, "mounts")), nil
+	}
+
+	return planUnitsCleanup(m.systemUnitDir, m.currentSystemMountUnits()), nil
+}
+
+// planUnitsCleanup returns the changes cleanupMountUnits would make to remove units.
+func planUnitsCleanup(systemUnitDir string, units map[string]struct{}) (changes []plan.Change) {
+	var names []string
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		changes = append(changes,
+			plan.Change{Action: plan.UnitStopped, Target: name},
+			plan.Change{Action: plan.UnitDisabled, Target: name},
+			plan.Change{Action: plan.FileRemoved, Target: filepath.Join(systemUnitDir, name)})
+	}
+	return changes
+}
+
 // mountInfo stores relevant information about a mount.
 type mountInfo struct {
 	hostname   string
@@ -476,8 +600,13 @@ func (m *Manager) cleanup(ctx context.Context, objectName string, isComputer boo
 		return m.cleanupMountsFile(ctx, u.Uid)
 	}
 
+	prevUnits := m.currentSystemMountUnits()
+	if err := m.journalUnits(ctx, prevUnits, nil); err != nil {
+		return err
+	}
+
 	var units []string
-	for k := range m.currentSystemMountUnits() {
+	for k := range prevUnits {
 		units = append(units, k)
 	}
 	return m.cleanupMountUnits(ctx, units)
@@ -490,6 +619,9 @@ func (m *Manager) cleanupMountsFile(ctx context.Context, uid string) (err error)
 	log.Debug(ctx, gotext.Get("Cleaning up mounts file for user with uid %q", uid))
 
 	p := filepath.Join(m.runDir, "users", uid, "mounts")
+	if err := journal.Record(ctx, p); err != nil {
+		return err
+	}
 
 	// Since the function might be called even if there is not a mounts file, we
 	// must ignore the ErrNotExist returned by os.Remove.
@@ -522,6 +654,60 @@ func (m *Manager) cleanupMountUnits(ctx context.Context, units []string) (err er
 	return nil
 }
 
+// journalUnits records the previous and new system mount units in the journal of ctx, if any.
+// On rollback, the units which didn't exist are stopped and disabled before being removed, while the
+// previous units are enabled and started again once restored.
+func (m *Manager) journalUnits(ctx context.Context, prevUnits map[string]struct{}, newUnits map[string]string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to record mount units"))
+
+	// prevUnits is modified by the caller once recorded.
+	prevUnits = maps.Clone(prevUnits)
+
+	// Rollback actions are run in reverse order: this one is called once unit files are restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		if err := m.systemdCaller.DaemonReload(ctx); err != nil {
+			return err
+		}
+		for name := range prevUnits {
+			if err := m.systemdCaller.EnableUnit(ctx, name); err != nil {
+				return err
+			}
+			if err := m.systemdCaller.StartUnit(ctx, name); err != nil {
+				log.Warning(ctx, gotext.Get("failed to start unit %q: %v", name, err))
+			}
+		}
+		return nil
+	})
+
+	var paths []string
+	for name := range prevUnits {
+		paths = append(paths, filepath.Join(m.systemUnitDir, name))
+	}
+	for name := range newUnits {
+		paths = append(paths, filepath.Join(m.systemUnitDir, name))
+	}
+	if err := journal.Record(ctx, paths...); err != nil {
+		return err
+	}
+
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		for name := range newUnits {
+			if _, ok := prevUnits[name]; ok {
+				continue
+			}
+			if err := m.systemdCaller.StopUnit(ctx, name); err != nil {
+				log.Warning(ctx, gotext.Get("Failed to stop unit %q: %v", name, err))
+			}
+			if err := m.systemdCaller.DisableUnit(ctx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return nil
+}
+
 // currentSystemMountUnits reads the unit directory and returns a map containing the adsys mount units found.
 func (m *Manager) currentSystemMountUnits() map[string]struct{} {
 	paths, _ := filepath.Glob(filepath.Join(m.systemUnitDir, "adsys-*.mount"))
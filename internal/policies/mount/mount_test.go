@@ -3,9 +3,11 @@ package mount_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -277,6 +279,121 @@ func TestApplyPolicy(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	u, err := user.Current()
+	require.NoError(t, err, "Setup: failed to get current user")
+
+	tests := map[string]struct {
+		entries    []string
+		isDisabled bool
+		objectName string
+		isComputer bool
+
+		// applied are the entries applied before planning.
+		applied []string
+
+		pathAlreadyExists bool
+
+		wantErr bool
+	}{
+		/***************************** USER ****************************/
+		"User, mounts file is created on a pristine system":    {},
+		"User, no change when applying the same entries":       {applied: []string{"entry with one value"}},
+		"User, mounts file is modified with new entries":       {entries: []string{"entry with multiple values"}, applied: []string{"entry with one value"}},
+		"User, mounts file is removed with no entries":         {entries: []string{"no entries"}, applied: []string{"entry with one value"}},
+		"User, mounts file is removed with an empty entry":     {entries: []string{"entry with no value"}, applied: []string{"entry with one value"}},
+		"User, mounts file is removed with a disabled entry":   {isDisabled: true, applied: []string{"entry with one value"}},
+		"User, no change with no entries on a pristine system": {entries: []string{"no entries"}},
+
+		/**************************** SYSTEM ***************************/
+		"System, units are created, enabled and started on a pristine system": {isComputer: true},
+		"System, no change when applying the same entries":                    {isComputer: true, applied: []string{"entry with one value"}},
+		"System, units are added with some matching values":                   {entries: []string{"entry with multiple matching values"}, applied: []string{"entry with multiple values"}, isComputer: true},
+		"System, units are removed with no entries":                           {entries: []string{"no entries"}, applied: []string{"entry with multiple values"}, isComputer: true},
+		"System, units are removed with a disabled entry":                     {isDisabled: true, applied: []string{"entry with multiple values"}, isComputer: true},
+		"System, no change with an empty entry on a pristine system":          {entries: []string{"entry with no value"}, isComputer: true},
+
+		// Error cases.
+		"Error when user is not found":                               {objectName: "dont exist", wantErr: true},
+		"Error when cleaning up user policy with invalid user":       {entries: []string{"no entries"}, objectName: "dont exist", wantErr: true},
+		"Error when entry is errored":                                {entries: []string{"errored entry"}, wantErr: true},
+		"Error when entry contains badly formatted value":            {entries: []string{"entry with badly formatted value"}, isComputer: true, wantErr: true},
+		"Error when mounts file path already exists as a directory":  {pathAlreadyExists: true, wantErr: true},
+		"Error when system mount unit already exists as a directory": {pathAlreadyExists: true, isComputer: true, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			rootDir := t.TempDir()
+			runDir := filepath.Join(rootDir, "run", "adsys")
+			systemUnitDir := filepath.Join(rootDir, "etc", "systemd", "system")
+
+			key := "user-mounts"
+			if tc.isComputer {
+				key = "system-mounts"
+			}
+			toEntries := func(values []string, disabled bool) []entry.Entry {
+				entries := []entry.Entry{}
+				for _, v := range values {
+					if v == "no entries" {
+						break
+					}
+					e := mount.EntriesForTests[v]
+					e.Key = key
+					e.Disabled = disabled
+					entries = append(entries, e)
+				}
+				return entries
+			}
+			if tc.entries == nil {
+				tc.entries = []string{"entry with one value"}
+			}
+
+			opts := []mount.Option{}
+			if !tc.isComputer && tc.objectName == "" {
+				tc.objectName = "ubuntu"
+				opts = append(opts, mount.WithUserLookup(func(string) (*user.User, error) {
+					return &user.User{Uid: u.Uid, Gid: u.Gid}, nil
+				}))
+			}
+
+			if tc.pathAlreadyExists {
+				p := filepath.Join(runDir, "users", u.Uid, "mounts")
+				if tc.isComputer {
+					p = filepath.Join(systemUnitDir, "adsys-protocol-domain.com-mountpath.mount")
+				}
+				testutils.CreatePath(t, filepath.Join(p, "not_empty"))
+			}
+
+			m, err := mount.New(runDir, systemUnitDir, &mockSystemdCaller{}, opts...)
+			require.NoError(t, err, "Setup: Failed to create manager for the tests.")
+
+			if tc.applied != nil {
+				err = m.ApplyPolicy(context.Background(), tc.objectName, tc.isComputer, toEntries(tc.applied, false))
+				require.NoError(t, err, "Setup: ApplyPolicy should not have returned an error but did")
+			}
+
+			changes, err := m.Plan(context.Background(), tc.objectName, tc.isComputer, toEntries(tc.entries, tc.isDisabled))
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have returned an error but did not")
+				return
+			}
+			require.NoError(t, err, "Plan should not have returned an error but did")
+
+			var got strings.Builder
+			for _, c := range changes {
+				l := strings.ReplaceAll(c.String(), rootDir, "#ROOTDIR#")
+				fmt.Fprintln(&got, strings.ReplaceAll(l, "/users/"+u.Uid+"/", "/users/4242/"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
 // makeIndependentOfCurrentUID renames any file or directory which exactly match uid in path and replace it with 4242.
 func makeIndependentOfCurrentUID(t *testing.T, path string, uid string) {
 	t.Helper()
@@ -0,0 +1,350 @@
+// Package packages provides a manager to install and remove packages on the machine.
+//
+// Deb packages are installed and removed with apt-get, and snaps with snap, from the lists of
+// the install, remove, install-snaps and remove-snaps entries. Those policies are only supported
+// on computers.
+//
+// The manager is idempotent: the state of each package is queried first, and a package which is
+// already installed or removed is left untouched. Packages are never removed because they are not
+// listed anymore: they need to be listed explicitly in the removal lists.
+//
+// Each package is handled independently, so that a failing package doesn't prevent the other ones
+// to be installed or removed. The outcome of each package, including its failure, is returned: a
+// package failing doesn't fail the policy, and is attempted again on next update.
+package packages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	installKey      = "install"
+	removeKey       = "remove"
+	installSnapsKey = "install-snaps"
+	removeSnapsKey  = "remove-snaps"
+)
+
+// aptLockTimeout is the time, in seconds, apt-get waits for the dpkg lock held by another package manager,
+// like unattended-upgrades, before failing.
+const aptLockTimeout = 300
+
+// supportedKeys are the entry keys supported by the packages manager, in the order they are processed.
+// Removals are done first to free some space before installing packages.
+var supportedKeys = []string{removeKey, installKey, removeSnapsKey, installSnapsKey}
+
+var (
+	// debNameRe matches a deb package name, optionally qualified by its architecture.
+	debNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]+(:[a-z0-9-]+)?$`)
+	// snapNameRe matches a snap name.
+	snapNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+)
+
+// request is the state a package is requested to be in.
+type request struct {
+	name    string
+	snap    bool
+	install bool
+}
+
+// String returns the name of the package, as reported in its outcome.
+func (r request) String() string {
+	if r.snap {
+		return r.name + " (snap)"
+	}
+	return r.name
+}
+
+// Manager prevents running multiple package operations in parallel.
+type Manager struct {
+	dpkgQueryCmd []string
+	aptGetCmd    []string
+	snapCmd      []string
+
+	mu sync.Mutex // Prevents concurrent apt-get or snap operations from adsys
+}
+
+type options struct {
+	dpkgQueryCmd []string
+	aptGetCmd    []string
+	snapCmd      []string
+}
+
+// Option reprents an optional function to change the packages manager.
+type Option func(*options)
+
+// WithDpkgQueryCmd overrides the default dpkg-query command.
+func WithDpkgQueryCmd(cmd []string) Option {
+	return func(o *options) {
+		o.dpkgQueryCmd = cmd
+	}
+}
+
+// WithAptGetCmd overrides the default apt-get command.
+func WithAptGetCmd(cmd []string) Option {
+	return func(o *options) {
+		o.aptGetCmd = cmd
+	}
+}
+
+// WithSnapCmd overrides the default snap command.
+func WithSnapCmd(cmd []string) Option {
+	return func(o *options) {
+		o.snapCmd = cmd
+	}
+}
+
+// New returns a new packages policy manager.
+func New(opts ...Option) *Manager {
+	// defaults
+	args := options{
+		dpkgQueryCmd: []string{"dpkg-query"},
+		aptGetCmd:    []string{"apt-get"},
+		snapCmd:      []string{"snap"},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	return &Manager{
+		dpkgQueryCmd: args.dpkgQueryCmd,
+		aptGetCmd:    args.aptGetCmd,
+		snapCmd:      args.snapCmd,
+	}
+}
+
+// ApplyPolicy installs and removes the packages listed in entries which are not in their requested state yet.
+// It returns the outcome of each listed package. Packages which can't be installed or removed are reported in
+// their outcome only, as they should not fail the policy update.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (outcomes map[string]string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply packages policy"))
+
+	// Packages policies are only supported on computers
+	if !isComputer {
+		return nil, nil
+	}
+
+	// Exit early if we don't have any entries to apply
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	requests, err := parseEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	log.Debugf(ctx, "Applying packages policy to %s", objectName)
+
+	outcomes = make(map[string]string)
+	for _, r := range requests {
+		done, err := m.apply(ctx, r)
+		if err != nil {
+			log.Warning(ctx, gotext.Get("Package %s: %v", r, err))
+			outcomes[r.String()] = gotext.Get("failed: %v", err)
+			continue
+		}
+		outcomes[r.String()] = done
+	}
+
+	return outcomes, nil
+}
+
+// apply installs or removes the package of r if needed, and returns what was done.
+func (m *Manager) apply(ctx context.Context, r request) (done string, err error) {
+	installed, err := m.isInstalled(ctx, r)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case r.install && installed:
+		return gotext.Get("already installed"), nil
+	case !r.install && !installed:
+		return gotext.Get("not installed"), nil
+	}
+
+	cmdArgs := m.commandFor(r, false)
+	log.Info(ctx, gotext.Get("Running %s", strings.Join(cmdArgs, " ")))
+	if _, err := m.run(ctx, cmdArgs); err != nil {
+		return "", err
+	}
+	if r.install {
+		return gotext.Get("installed"), nil
+	}
+	return gotext.Get("removed"), nil
+}
+
+// Plan returns the changes ApplyPolicy would make to install and remove packages, without applying them.
+func (m *Manager) Plan(ctx context.Context, _ string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan packages policy"))
+
+	if !isComputer || len(entries) == 0 {
+		return nil, nil
+	}
+
+	requests, err := parseEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range requests {
+		installed, err := m.isInstalled(ctx, r)
+		if err != nil {
+			return nil, err
+		}
+		if r.install == installed {
+			continue
+		}
+		changes = append(changes, plan.Change{Action: plan.CommandRun, Target: strings.Join(m.commandFor(r, true), " ")})
+	}
+
+	return changes, nil
+}
+
+// isInstalled returns if the package of r is currently installed.
+func (m *Manager) isInstalled(ctx context.Context, r request) (bool, error) {
+	var cmdArgs []string
+	if r.snap {
+		cmdArgs = append(append(cmdArgs, m.snapCmd...), "list", r.name)
+	} else {
+		cmdArgs = append(append(cmdArgs, m.dpkgQueryCmd...), "-W", "-f=${db:Status-Status}", r.name)
+	}
+
+	out, err := m.run(ctx, cmdArgs)
+	// Both commands exit with an error when the package is not known
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if r.snap {
+		return true, nil
+	}
+	// Removed packages with remaining configuration files are still known by dpkg
+	return strings.TrimSpace(string(out)) == "installed", nil
+}
+
+// commandFor returns the command to run to put the package of r in its requested state.
+// If display is true, the default tool is named instead of its overridden command.
+func (m *Manager) commandFor(r request, display bool) []string {
+	tool, cmdArgs := m.aptGetCmd, []string{actionName(r), "-y", "-q", "-o", fmt.Sprintf("DPkg::Lock::Timeout=%d", aptLockTimeout), r.name}
+	if r.snap {
+		tool, cmdArgs = m.snapCmd, []string{actionName(r), r.name}
+	}
+	if display {
+		tool = []string{"apt-get"}
+		if r.snap {
+			tool = []string{"snap"}
+		}
+	}
+	return append(slices.Clone(tool), cmdArgs...)
+}
+
+// run runs cmdArgs non interactively, and returns its standard output.
+func (m *Manager) run(ctx context.Context, cmdArgs []string) (out []byte, err error) {
+	// #nosec G204 - cmdArgs is under our control (package tools or mock for tests) and package names are validated
+	cmd := exec.CommandContext(ctx, cmdArgs[0], cmdArgs[1:]...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	smbsafe.WaitExec()
+	defer smbsafe.DoneExec()
+	out, err = cmd.Output()
+	if msg := strings.TrimSpace(stderr.String()); err != nil && msg != "" {
+		return out, fmt.Errorf("%w: %s", err, msg)
+	}
+	return out, err
+}
+
+// actionName returns the apt-get or snap subcommand of r.
+func actionName(r request) string {
+	if r.install {
+		return "install"
+	}
+	return "remove"
+}
+
+// parseEntries returns the package requests from entries, in the order they should be processed.
+// Duplicated packages are only requested once, and a package requested to be both installed and removed
+// is an error.
+func parseEntries(ctx context.Context, entries []entry.Entry) (requests []request, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to parse packages entries"))
+
+	byKey := make(map[string]entry.Entry)
+	for _, e := range entries {
+		key := e.Key[strings.LastIndex(e.Key, "/")+1:]
+		if !slices.Contains(supportedKeys, key) {
+			log.Warning(ctx, gotext.Get("Encountered unsupported key '%s' while parsing packages entries, skipping it", key))
+			continue
+		}
+		if e.Disabled {
+			log.Debug(ctx, gotext.Get("The entry %q is disabled and will be skipped", e.Key))
+			continue
+		}
+		if e.Err != nil {
+			return nil, errors.New(gotext.Get("entry %q is errored: %v", e.Key, e.Err))
+		}
+		byKey[key] = e
+	}
+
+	seen := make(map[request]bool)
+	for _, key := range supportedKeys {
+		e, ok := byKey[key]
+		if !ok {
+			continue
+		}
+
+		isSnap := key == installSnapsKey || key == removeSnapsKey
+		install := key == installKey || key == installSnapsKey
+		nameRe := debNameRe
+		if isSnap {
+			nameRe = snapNameRe
+		}
+
+		for _, name := range strings.Split(e.Value, "\n") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if !nameRe.MatchString(name) {
+				return nil, errors.New(gotext.Get("invalid package name %q in %q", name, e.Key))
+			}
+
+			r := request{name: name, snap: isSnap, install: install}
+			if seen[r] {
+				log.Debug(ctx, gotext.Get("Package %s is duplicated.", r))
+				continue
+			}
+			if seen[request{name: name, snap: isSnap, install: !install}] {
+				return nil, errors.New(gotext.Get("package %s is requested to be both installed and removed", r))
+			}
+			seen[r] = true
+			requests = append(requests, r)
+		}
+	}
+
+	return requests, nil
+}
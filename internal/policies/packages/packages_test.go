@@ -0,0 +1,320 @@
+package packages_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/packages"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries   []entry.Entry
+		installed []string
+		isUser    bool
+		noSnap    bool
+
+		wantFailedPackages bool
+		wantErr            bool
+	}{
+		"Install missing packages": {entries: []entry.Entry{{Key: "packages/install", Value: "vpnclient\nhtop"}}},
+		"Remove installed packages": {
+			entries:   []entry.Entry{{Key: "packages/remove", Value: "aisleriot\ngnome-mines"}},
+			installed: []string{"aisleriot", "gnome-mines"},
+		},
+		"Install and remove snaps": {
+			entries: []entry.Entry{
+				{Key: "packages/install-snaps", Value: "vpn-client"},
+				{Key: "packages/remove-snaps", Value: "firefox"},
+			},
+			installed: []string{"snap:firefox"},
+		},
+		"Removals are done before installations": {
+			entries: []entry.Entry{
+				{Key: "packages/install", Value: "vpnclient"},
+				{Key: "packages/remove", Value: "aisleriot"},
+			},
+			installed: []string{"aisleriot"},
+		},
+		"Packages in requested state are left untouched": {
+			entries: []entry.Entry{
+				{Key: "packages/install", Value: "htop"},
+				{Key: "packages/remove", Value: "aisleriot"},
+				{Key: "packages/install-snaps", Value: "firefox"},
+				{Key: "packages/remove-snaps", Value: "vlc"},
+			},
+			installed: []string{"htop", "snap:firefox"},
+		},
+		"Packages with remaining configuration files are not installed": {
+			entries:   []entry.Entry{{Key: "packages/install", Value: "vpnclient"}, {Key: "packages/remove", Value: "aisleriot"}},
+			installed: []string{"config:vpnclient", "config:aisleriot"},
+		},
+		"Packages qualified with their architecture": {entries: []entry.Entry{{Key: "packages/install", Value: "libc6:i386"}}},
+		"Duplicated packages are handled once":       {entries: []entry.Entry{{Key: "packages/install", Value: "vpnclient\nhtop\nvpnclient"}}},
+		"Empty lines and spaces are ignored":         {entries: []entry.Entry{{Key: "packages/install", Value: "\n  vpnclient  \n\n"}}},
+		"Disabled entries are ignored": {entries: []entry.Entry{
+			{Key: "packages/install", Value: "vpnclient"},
+			{Key: "packages/remove", Value: "aisleriot", Disabled: true},
+		}, installed: []string{"aisleriot"}},
+		"Unsupported keys are ignored": {entries: []entry.Entry{
+			{Key: "packages/install", Value: "vpnclient"},
+			{Key: "packages/upgrade", Value: "htop"},
+		}},
+
+		"No entries": {},
+		"Packages policy is not applied for users": {entries: []entry.Entry{{Key: "packages/install", Value: "vpnclient"}}, isUser: true},
+
+		// Failing packages
+		"Failing package is reported, other packages are handled": {
+			entries:            []entry.Entry{{Key: "packages/install", Value: "broken-package\nvpnclient"}, {Key: "packages/remove", Value: "aisleriot"}},
+			installed:          []string{"aisleriot"},
+			wantFailedPackages: true,
+		},
+		"Snaps are reported as failing when snap is not available": {
+			entries:            []entry.Entry{{Key: "packages/install", Value: "vpnclient"}, {Key: "packages/install-snaps", Value: "firefox"}},
+			noSnap:             true,
+			wantFailedPackages: true,
+		},
+
+		// Error cases
+		"Error on invalid package name":          {entries: []entry.Entry{{Key: "packages/install", Value: "vpnclient; rm -rf /"}}, wantErr: true},
+		"Error on invalid snap name":             {entries: []entry.Entry{{Key: "packages/install-snaps", Value: "vpn.client"}}, wantErr: true},
+		"Error on package installed and removed": {entries: []entry.Entry{{Key: "packages/install", Value: "htop"}, {Key: "packages/remove", Value: "htop"}}, wantErr: true},
+		"Error on errored entry":                 {entries: []entry.Entry{{Key: "packages/install", Err: errors.New("some error")}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stateDir := setupPackagesState(t, tc.installed)
+			snapCmd := mockTool(t, "snap", stateDir)
+			if tc.noSnap {
+				snapCmd = []string{"doesnotexist-snap"}
+			}
+
+			m := packages.New(
+				packages.WithDpkgQueryCmd(mockTool(t, "dpkg-query", stateDir)),
+				packages.WithAptGetCmd(mockTool(t, "apt-get", stateDir)),
+				packages.WithSnapCmd(snapCmd),
+			)
+
+			outcomes, err := m.ApplyPolicy(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "ApplyPolicy should have failed but didn't")
+			} else {
+				require.NoError(t, err, "ApplyPolicy should not have failed")
+			}
+
+			var got strings.Builder
+			calls, err := os.ReadFile(filepath.Join(stateDir, "calls"))
+			if !errors.Is(err, fs.ErrNotExist) {
+				require.NoError(t, err, "Setup: can't read package tools calls")
+			}
+			fmt.Fprintf(&got, "Calls:\n%s", calls)
+			fmt.Fprintln(&got, "Outcomes:")
+			var pkgs []string
+			for p := range outcomes {
+				pkgs = append(pkgs, p)
+			}
+			slices.Sort(pkgs)
+			for _, p := range pkgs {
+				fmt.Fprintf(&got, "%s: %s\n", p, outcomes[p])
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "ApplyPolicy did not run the expected commands")
+
+			var failed bool
+			for _, o := range outcomes {
+				if strings.HasPrefix(o, "failed") {
+					failed = true
+				}
+			}
+			require.Equal(t, tc.wantFailedPackages, failed, "ApplyPolicy should report failing packages in their outcome")
+
+			// Failing packages are attempted again on next update
+			if tc.wantErr || tc.wantFailedPackages {
+				return
+			}
+			// Applying the same policy again should be a no-op
+			require.NoError(t, os.RemoveAll(filepath.Join(stateDir, "calls")), "Setup: can't reset package tools calls")
+			_, err = m.ApplyPolicy(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			require.NoError(t, err, "ApplyPolicy should not have failed on second run")
+			require.NoFileExists(t, filepath.Join(stateDir, "calls"), "ApplyPolicy should not change anything on second run")
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries   []entry.Entry
+		installed []string
+		isUser    bool
+
+		wantErr bool
+	}{
+		"Install and remove packages": {
+			entries: []entry.Entry{
+				{Key: "packages/install", Value: "vpnclient\nhtop"},
+				{Key: "packages/remove", Value: "aisleriot"},
+				{Key: "packages/install-snaps", Value: "vpn-client"},
+				{Key: "packages/remove-snaps", Value: "firefox"},
+			},
+			installed: []string{"htop", "aisleriot", "snap:firefox"},
+		},
+		"Packages in requested state are left untouched": {
+			entries:   []entry.Entry{{Key: "packages/install", Value: "htop"}, {Key: "packages/remove", Value: "aisleriot"}},
+			installed: []string{"htop"},
+		},
+		"No entries": {},
+		"Packages policy is not planned for users": {entries: []entry.Entry{{Key: "packages/install", Value: "vpnclient"}}, isUser: true},
+
+		// Error cases
+		"Error on invalid package name": {entries: []entry.Entry{{Key: "packages/install", Value: "Not A Package"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			stateDir := setupPackagesState(t, tc.installed)
+			m := packages.New(
+				packages.WithDpkgQueryCmd(mockTool(t, "dpkg-query", stateDir)),
+				packages.WithAptGetCmd([]string{"this-should-not-be-called"}),
+				packages.WithSnapCmd(mockTool(t, "snap", stateDir)),
+			)
+
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan should not have failed")
+			require.NoFileExists(t, filepath.Join(stateDir, "calls"), "Plan should not install nor remove anything")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, c)
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
+// setupPackagesState creates the state of the mocked package tools, with the installed packages.
+// Snaps are prefixed with "snap:", and packages only having configuration files left with "config:".
+func setupPackagesState(t *testing.T, installed []string) string {
+	t.Helper()
+
+	stateDir := t.TempDir()
+	for _, d := range []string{"deb", "snap"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(stateDir, d), 0700), "Setup: can't create packages state")
+	}
+	for _, p := range installed {
+		path, status := filepath.Join(stateDir, "deb", p), "installed"
+		if name, ok := strings.CutPrefix(p, "snap:"); ok {
+			path = filepath.Join(stateDir, "snap", name)
+		} else if name, ok := strings.CutPrefix(p, "config:"); ok {
+			path, status = filepath.Join(stateDir, "deb", name), "config-files"
+		}
+		require.NoError(t, os.WriteFile(path, []byte(status), 0600), "Setup: can't install package %s", p)
+	}
+	return stateDir
+}
+
+func mockTool(t *testing.T, tool, stateDir string) []string {
+	t.Helper()
+
+	return []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockPackageTool", "--", tool, stateDir}
+}
+
+func TestMockPackageTool(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	tool, stateDir, args := args[0], args[1], args[2:]
+	name := args[len(args)-1]
+
+	if os.Getenv("DEBIAN_FRONTEND") != "noninteractive" {
+		fmt.Fprintln(os.Stderr, "package tools should run non interactively")
+		os.Exit(2)
+	}
+
+	pkgPath := filepath.Join(stateDir, "deb", name)
+	if tool == "snap" {
+		pkgPath = filepath.Join(stateDir, "snap", name)
+	}
+
+	// Queries
+	switch {
+	case tool == "dpkg-query":
+		d, err := os.ReadFile(pkgPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dpkg-query: no packages found matching %s\n", name)
+			os.Exit(1)
+		}
+		fmt.Print(string(d))
+		return
+	case tool == "snap" && args[0] == "list":
+		if _, err := os.Stat(pkgPath); err != nil {
+			fmt.Fprintf(os.Stderr, "error: no matching snaps installed\n")
+			os.Exit(1)
+		}
+		fmt.Printf("Name  Version  Rev  Tracking  Publisher  Notes\n%s  1.0  1  latest/stable  canonical  -\n", name)
+		return
+	}
+
+	// Modifications
+	f, err := os.OpenFile(filepath.Join(stateDir, "calls"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't record call: %v\n", err)
+		os.Exit(2)
+	}
+	fmt.Fprintf(f, "%s %s\n", tool, strings.Join(args, " "))
+	_ = f.Close()
+
+	if strings.HasPrefix(name, "broken") {
+		fmt.Fprintf(os.Stderr, "E: Unable to locate package %s\n", name)
+		os.Exit(100)
+	}
+	switch args[0] {
+	case "install":
+		err = os.WriteFile(pkgPath, []byte("installed"), 0600)
+	case "remove":
+		err = os.Remove(pkgPath)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't %s %s: %v\n", args[0], name, err)
+		os.Exit(2)
+	}
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+	testutils.MergeCoverages()
+}
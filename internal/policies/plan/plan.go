@@ -0,0 +1,159 @@
+// Package plan describes the changes a policy manager would make on the system to apply a policy.
+//
+// Policy managers can compute a plan without writing any file, starting or stopping any unit or
+// loading any profile, which allows to preview what an update would do before running it.
+package plan
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/leonelquinteros/gotext"
+)
+
+// Action is the kind of modification a policy manager would make on the system.
+type Action string
+
+const (
+	// FileCreated is a file which would be created.
+	FileCreated Action = "create"
+	// FileModified is an existing file which content would be changed.
+	FileModified Action = "modify"
+	// FileRemoved is an existing file or directory which would be removed.
+	FileRemoved Action = "remove"
+	// UnitStarted is a systemd unit which would be started.
+	UnitStarted Action = "start"
+	// UnitStopped is a systemd unit which would be stopped.
+	UnitStopped Action = "stop"
+	// UnitEnabled is a systemd unit which would be enabled.
+	UnitEnabled Action = "enable"
+	// UnitDisabled is a systemd unit which would be disabled.
+	UnitDisabled Action = "disable"
+	// ProfileLoaded is an apparmor profile file which would be loaded or reloaded in the kernel.
+	ProfileLoaded Action = "load"
+	// ProfileUnloaded is an apparmor profile file which would be unloaded from the kernel.
+	ProfileUnloaded Action = "unload"
+	// CommandRun is an external command or service which would be called to apply the policy.
+	CommandRun Action = "run"
+)
+
+// Change is a single modification a policy manager would make on the system.
+type Change struct {
+	Action Action
+	Target string
+}
+
+// String returns a human readable description of the change.
+func (c Change) String() string {
+	switch c.Action {
+	case FileCreated:
+		return gotext.Get("create file %s", c.Target)
+	case FileModified:
+		return gotext.Get("modify file %s", c.Target)
+	case FileRemoved:
+		return gotext.Get("remove %s", c.Target)
+	case UnitStarted:
+		return gotext.Get("start unit %s", c.Target)
+	case UnitStopped:
+		return gotext.Get("stop unit %s", c.Target)
+	case UnitEnabled:
+		return gotext.Get("enable unit %s", c.Target)
+	case UnitDisabled:
+		return gotext.Get("disable unit %s", c.Target)
+	case ProfileLoaded:
+		return gotext.Get("load apparmor profile %s", c.Target)
+	case ProfileUnloaded:
+		return gotext.Get("unload apparmor profile %s", c.Target)
+	case CommandRun:
+		return gotext.Get("run %s", c.Target)
+	}
+	return gotext.Get("%s %s", c.Action, c.Target)
+}
+
+// ForFile returns the change needed for path to have the given content.
+// changed is false if the file is already up to date.
+func ForFile(path, content string) (c Change, changed bool, err error) {
+	oldContent, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Change{Action: FileCreated, Target: path}, true, nil
+	} else if err != nil {
+		return Change{}, false, err
+	}
+
+	if string(oldContent) == content {
+		return Change{}, false, nil
+	}
+	return Change{Action: FileModified, Target: path}, true, nil
+}
+
+// ForRemoval returns the change needed to remove path.
+// exists is false if there is nothing to remove.
+func ForRemoval(path string) (c Change, exists bool) {
+	if _, err := os.Lstat(path); err != nil {
+		return Change{}, false
+	}
+	return Change{Action: FileRemoved, Target: path}, true
+}
+
+// AppendFile appends to changes the change needed for path to have the given content, if any.
+func AppendFile(changes []Change, path, content string) ([]Change, error) {
+	c, changed, err := ForFile(path, content)
+	if err != nil || !changed {
+		return changes, err
+	}
+	return append(changes, c), nil
+}
+
+// AppendRemoval appends to changes the removal of path, if it exists.
+func AppendRemoval(changes []Change, path string) []Change {
+	if c, exists := ForRemoval(path); exists {
+		return append(changes, c)
+	}
+	return changes
+}
+
+// AppendTree appends to changes the changes needed for the dst directory to have the same files as src.
+// Files only present in dst are removed. A missing src or dst directory is considered empty.
+func AppendTree(changes []Change, src fs.FS, dst string) ([]Change, error) {
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == "." {
+			return fs.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := fs.ReadFile(src, p)
+		if err != nil {
+			return err
+		}
+		changes, err = AppendFile(changes, filepath.Join(dst, filepath.FromSlash(p)), string(content))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && p == dst {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		if _, err := fs.Stat(src, filepath.ToSlash(rel)); errors.Is(err, fs.ErrNotExist) {
+			changes = append(changes, Change{Action: FileRemoved, Target: p})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
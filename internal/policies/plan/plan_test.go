@@ -0,0 +1,228 @@
+package plan_test
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+)
+
+func TestForFile(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		existingContent *string
+		content         string
+
+		wantAction  plan.Action
+		wantChanged bool
+		wantErr     bool
+	}{
+		"Missing file is created":            {content: "new", wantAction: plan.FileCreated, wantChanged: true},
+		"Identical content is not changed":   {existingContent: ptr("same"), content: "same"},
+		"Different content is modified":      {existingContent: ptr("old"), content: "new", wantAction: plan.FileModified, wantChanged: true},
+		"Empty content on empty file":        {existingContent: ptr(""), content: ""},
+		"Empty content on missing file":      {content: "", wantAction: plan.FileCreated, wantChanged: true},
+		"Trailing newline is a modification": {existingContent: ptr("content"), content: "content\n", wantAction: plan.FileModified, wantChanged: true},
+
+		// Error cases
+		"Error on path being a directory": {existingContent: ptr("<dir>"), content: "new", wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "file")
+			if tc.existingContent != nil {
+				if *tc.existingContent == "<dir>" {
+					require.NoError(t, os.Mkdir(p, 0700), "Setup: can not create directory")
+				} else {
+					require.NoError(t, os.WriteFile(p, []byte(*tc.existingContent), 0600), "Setup: can not create existing file")
+				}
+			}
+
+			c, changed, err := plan.ForFile(p, tc.content)
+			if tc.wantErr {
+				require.Error(t, err, "ForFile should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "ForFile should return no error but got one")
+
+			require.Equal(t, tc.wantChanged, changed, "ForFile returned unexpected changed status")
+			if !tc.wantChanged {
+				require.Equal(t, plan.Change{}, c, "ForFile should return no change")
+				return
+			}
+			require.Equal(t, plan.Change{Action: tc.wantAction, Target: p}, c, "ForFile returned unexpected change")
+		})
+	}
+}
+
+func TestForRemoval(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		existing string
+
+		wantExists bool
+	}{
+		"Existing file is removed":             {existing: "file", wantExists: true},
+		"Existing directory is removed":        {existing: "dir", wantExists: true},
+		"Existing dangling symlink is removed": {existing: "symlink", wantExists: true},
+		"Missing file has nothing to remove":   {},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			p := filepath.Join(t.TempDir(), "target")
+			switch tc.existing {
+			case "file":
+				require.NoError(t, os.WriteFile(p, []byte("content"), 0600), "Setup: can not create file")
+			case "dir":
+				require.NoError(t, os.Mkdir(p, 0700), "Setup: can not create directory")
+			case "symlink":
+				require.NoError(t, os.Symlink("doesnotexist", p), "Setup: can not create symlink")
+			}
+
+			c, exists := plan.ForRemoval(p)
+			require.Equal(t, tc.wantExists, exists, "ForRemoval returned unexpected existence status")
+			if !tc.wantExists {
+				require.Equal(t, plan.Change{}, c, "ForRemoval should return no change")
+				return
+			}
+			require.Equal(t, plan.Change{Action: plan.FileRemoved, Target: p}, c, "ForRemoval returned unexpected change")
+		})
+	}
+}
+
+func TestAppendTree(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		src        fstest.MapFS
+		missingSrc bool
+		dst        map[string]string
+		missingDst bool
+
+		wantChanges []plan.Change
+	}{
+		"Files are created in missing destination": {
+			src:        fstest.MapFS{"a": {Data: []byte("a")}, "b": {Data: []byte("b")}},
+			missingDst: true,
+			wantChanges: []plan.Change{
+				{Action: plan.FileCreated, Target: "a"},
+				{Action: plan.FileCreated, Target: "b"},
+			}},
+		"Nested directories are walked": {
+			src: fstest.MapFS{"dir/a": {Data: []byte("a")}, "dir/subdir/b": {Data: []byte("b")}},
+			dst: map[string]string{"dir/subdir/b": "b"},
+			wantChanges: []plan.Change{
+				{Action: plan.FileCreated, Target: "dir/a"},
+			}},
+		"Different files are modified": {
+			src: fstest.MapFS{"a": {Data: []byte("new")}, "b": {Data: []byte("b")}},
+			dst: map[string]string{"a": "old", "b": "b"},
+			wantChanges: []plan.Change{
+				{Action: plan.FileModified, Target: "a"},
+			}},
+		"Extra destination files are removed": {
+			src: fstest.MapFS{"a": {Data: []byte("a")}},
+			dst: map[string]string{"a": "a", "extra": "extra", "dir/nested-extra": "extra"},
+			wantChanges: []plan.Change{
+				{Action: plan.FileRemoved, Target: "dir/nested-extra"},
+				{Action: plan.FileRemoved, Target: "extra"},
+			}},
+		"Missing source removes every destination file": {
+			missingSrc: true,
+			dst:        map[string]string{"a": "a", "dir/b": "b"},
+			wantChanges: []plan.Change{
+				{Action: plan.FileRemoved, Target: "a"},
+				{Action: plan.FileRemoved, Target: "dir/b"},
+			}},
+		"Identical trees have no changes": {
+			src: fstest.MapFS{"a": {Data: []byte("a")}, "dir/b": {Data: []byte("b")}},
+			dst: map[string]string{"a": "a", "dir/b": "b"},
+		},
+		"Missing source and destination have no changes": {missingSrc: true, missingDst: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dst := filepath.Join(t.TempDir(), "dst")
+			if !tc.missingDst {
+				require.NoError(t, os.MkdirAll(dst, 0700), "Setup: can not create destination directory")
+			}
+			for p, content := range tc.dst {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dst, p)), 0700), "Setup: can not create destination subdirectory")
+				require.NoError(t, os.WriteFile(filepath.Join(dst, p), []byte(content), 0600), "Setup: can not create destination file")
+			}
+
+			var srcFS fs.FS = tc.src
+			if tc.missingSrc {
+				srcFS = os.DirFS(filepath.Join(t.TempDir(), "doesnotexist"))
+			}
+
+			changes, err := plan.AppendTree(nil, srcFS, dst)
+			require.NoError(t, err, "AppendTree should return no error but got one")
+
+			var want []plan.Change
+			for _, c := range tc.wantChanges {
+				want = append(want, plan.Change{Action: c.Action, Target: filepath.Join(dst, c.Target)})
+			}
+			require.Equal(t, want, changes, "AppendTree returned unexpected changes")
+		})
+	}
+}
+
+func TestAppendTreeKeepsPreviousChanges(t *testing.T) {
+	t.Parallel()
+
+	previous := []plan.Change{{Action: plan.CommandRun, Target: "something"}}
+	dst := t.TempDir()
+
+	changes, err := plan.AppendTree(previous, fstest.MapFS{"a": {Data: []byte("a")}}, dst)
+	require.NoError(t, err, "AppendTree should return no error but got one")
+	require.Equal(t, []plan.Change{
+		{Action: plan.CommandRun, Target: "something"},
+		{Action: plan.FileCreated, Target: filepath.Join(dst, "a")},
+	}, changes, "AppendTree should append to previous changes")
+}
+
+func TestChangeString(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		change plan.Change
+
+		want string
+	}{
+		"File created":     {change: plan.Change{Action: plan.FileCreated, Target: "/a"}, want: "create file /a"},
+		"File modified":    {change: plan.Change{Action: plan.FileModified, Target: "/a"}, want: "modify file /a"},
+		"File removed":     {change: plan.Change{Action: plan.FileRemoved, Target: "/a"}, want: "remove /a"},
+		"Unit started":     {change: plan.Change{Action: plan.UnitStarted, Target: "u"}, want: "start unit u"},
+		"Unit stopped":     {change: plan.Change{Action: plan.UnitStopped, Target: "u"}, want: "stop unit u"},
+		"Unit enabled":     {change: plan.Change{Action: plan.UnitEnabled, Target: "u"}, want: "enable unit u"},
+		"Unit disabled":    {change: plan.Change{Action: plan.UnitDisabled, Target: "u"}, want: "disable unit u"},
+		"Profile loaded":   {change: plan.Change{Action: plan.ProfileLoaded, Target: "p"}, want: "load apparmor profile p"},
+		"Profile unloaded": {change: plan.Change{Action: plan.ProfileUnloaded, Target: "p"}, want: "unload apparmor profile p"},
+		"Command run":      {change: plan.Change{Action: plan.CommandRun, Target: "cmd"}, want: "run cmd"},
+		"Unknown action":   {change: plan.Change{Action: "frobnicate", Target: "x"}, want: "frobnicate x"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tc.want, tc.change.String(), "String returned unexpected description")
+		})
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
@@ -28,6 +28,10 @@ const (
 	PoliciesCacheBaseName  = "policies"
 	policiesFileName       = "policies"
 	policiesAssetsFileName = "assets.db"
+	// journalCacheBaseName is the base directory where the journals of policies being applied are stored.
+	journalCacheBaseName = "journal"
+	// statusCacheBaseName is the base directory where the status of each policy manager per object is stored.
+	statusCacheBaseName = "status"
 )
 
 type assetsFromMMAP struct {
@@ -38,8 +42,10 @@ type assetsFromMMAP struct {
 
 // Policies is the list of GPOs applied to a particular object, with the global data cache.
 type Policies struct {
-	GPOs   []GPO
-	assets *assetsFromMMAP `yaml:"-"`
+	GPOs []GPO
+	// FilteredGPOs are the GPOs which are not applied as their host filter evaluated to false. They have no rules.
+	FilteredGPOs []GPO           `yaml:",omitempty"`
+	assets       *assetsFromMMAP `yaml:"-"`
 }
 
 // New returns new policies with GPOs and assets loaded from DB.
@@ -118,9 +124,23 @@ func openAssetsInMemory(assetsDB string) (assets *assetsFromMMAP, err error) {
 
 // Save serializes in p policies.
 // Do not save again if p is already the origin. We don’t allow modifying GPOs or assets on the object.
+// The saved policies are also kept as a new generation in the history of p, if they changed. The history is only
+// informative: failing to update it never fails the save.
 func (pols *Policies) Save(p string) (err error) {
 	defer decorate.OnError(&err, gotext.Get("can't save policies to %s", p))
 
+	if err := pols.save(p); err != nil {
+		return err
+	}
+
+	if err := saveToHistory(p); err != nil {
+		log.Warning(context.Background(), gotext.Get("Policies history of %s is not updated: %v", p, err))
+	}
+	return nil
+}
+
+// save writes policies and assets to the p cache directory.
+func (pols *Policies) save(p string) (err error) {
 	if err := os.MkdirAll(p, 0700); err != nil {
 		return err
 	}
@@ -234,6 +254,24 @@ func (pols *Policies) SaveAssetsTo(ctx context.Context, relSrc, dest string, uid
 	return pols.saveAssetsRecursively(relSrc, dest, baseDir, uid, gid)
 }
 
+// AssetsFS returns the assets under relSrc path as a read-only file system, without extracting them to disk.
+// If there is no asset attached or relSrc doesn't exist, it returns an error.
+func (pols *Policies) AssetsFS(relSrc string) (fsys fs.FS, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't read assets from %s", relSrc))
+
+	if pols.assets == nil {
+		return nil, errors.New(gotext.Get("no assets attached"))
+	}
+
+	// zip doesn’t like final /, even when listing them return it.
+	relSrc = strings.TrimSuffix(relSrc, "/")
+	if _, err := fs.Stat(pols.assets, relSrc); err != nil {
+		return nil, err
+	}
+
+	return fs.Sub(pols.assets, relSrc)
+}
+
 func (pols *Policies) saveAssetsRecursively(relSrc, dest, baseDir string, uid, gid int) (err error) {
 	// zip doesn’t like final /, even when listing them return it.
 	relSrc = strings.TrimSuffix(relSrc, "/")
@@ -364,6 +402,8 @@ func CompressAssets(ctx context.Context, p string) (err error) {
 
 // GetUniqueRules return order rules, with one entry per key for a given type.
 // Returned file is a map of type to its entries.
+// GPOs applied with loopback processing in merge mode come first, so that their user settings win over the user GPOs
+// ones and their appended values are listed first.
 func (pols Policies) GetUniqueRules() map[string][]entry.Entry {
 	r := make(map[string][]entry.Entry)
 	keys := make(map[string][]string)
@@ -178,6 +178,16 @@ func TestSave(t *testing.T) {
 			initialCacheDir: "with_assets_other",
 			transformDest:   "read only asset file",
 		},
+		"Corrupted history does not prevent saving": {
+			cacheSrc:        "one_gpo",
+			initialCacheDir: "one_gpo_other",
+			transformDest:   "corrupted history",
+		},
+		"Unwritable history does not prevent saving": {
+			cacheSrc:        "one_gpo",
+			initialCacheDir: "one_gpo_other",
+			transformDest:   "read only history",
+		},
 
 		// Error cases
 		"Error on can’t write to policies base dir": {
@@ -227,6 +237,13 @@ func TestSave(t *testing.T) {
 				testutils.MakeReadOnly(t, filepath.Dir(dest))
 			case "read only destination directory":
 				testutils.MakeReadOnly(t, dest)
+			case "corrupted history":
+				require.NoError(t, os.MkdirAll(filepath.Join(dest, "history", "1"), 0700), "Setup: can't create history")
+				require.NoError(t, os.WriteFile(filepath.Join(dest, "history", "1", "policies"), []byte("invalid: [yaml"), 0600),
+					"Setup: can't write corrupted generation")
+			case "read only history":
+				require.NoError(t, os.MkdirAll(filepath.Join(dest, "history"), 0700), "Setup: can't create history")
+				testutils.MakeReadOnly(t, filepath.Join(dest, "history"))
 			case "read only asset file":
 				testutils.MakeReadOnly(t, filepath.Join(dest, policies.PoliciesAssetsFileName))
 			case "unremovable asset":
@@ -419,6 +436,66 @@ func TestSaveAssetsTo(t *testing.T) {
 	}
 }
 
+func TestAssetsFS(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		relSrc   string
+		cacheSrc string
+
+		wantFiles []string
+		wantErr   bool
+	}{
+		"Sub directory": {
+			relSrc:    "scripts",
+			cacheSrc:  "with_assets",
+			wantFiles: []string{"script-no-extension", "script-other.sh", "script-simple.sh", "subdir/script-in-subdir.sh"},
+		},
+		"Sub directory ending with slash": {
+			relSrc:    "scripts/",
+			cacheSrc:  "with_assets",
+			wantFiles: []string{"script-no-extension", "script-other.sh", "script-simple.sh", "subdir/script-in-subdir.sh"},
+		},
+		"Nested sub directory": {
+			relSrc:    "random/subdir",
+			cacheSrc:  "with_assets",
+			wantFiles: []string{"asset-in-subdir"},
+		},
+
+		// Error cases
+		"Error on unexisting relSrc in cache": {relSrc: "doesnotexists", cacheSrc: "with_assets", wantErr: true},
+		"Error on no assets":                  {relSrc: "scripts", cacheSrc: "one_gpo", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			pols, err := policies.NewFromCache(context.Background(), filepath.Join("testdata", "cache", "policies", tc.cacheSrc))
+			require.NoError(t, err, "Setup: NewFromCache should return no error but got one")
+			defer pols.Close()
+
+			fsys, err := pols.AssetsFS(tc.relSrc)
+			if tc.wantErr {
+				require.Error(t, err, "AssetsFS should return an error but got none")
+				return
+			}
+			require.NoError(t, err, "AssetsFS should return no error but got one")
+
+			var got []string
+			err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				got = append(got, p)
+				return nil
+			})
+			require.NoError(t, err, "Walking the returned file system should return no error")
+			require.Equal(t, tc.wantFiles, got, "AssetsFS should return the assets under relSrc")
+		})
+	}
+}
+
 func TestCompressAssets(t *testing.T) {
 	t.Parallel()
 
@@ -884,6 +961,62 @@ func TestGetUniqueRules(t *testing.T) {
 	}
 }
 
+func TestChangedPolicyTypes(t *testing.T) {
+	t.Parallel()
+
+	gpo := policies.GPO{ID: "standard", Name: "standard-name", Rules: map[string][]entry.Entry{
+		"dconf":   {{Key: "A", Value: "standardA"}},
+		"scripts": {{Key: "B", Value: "standardB"}},
+	}}
+	otherDconfGPO := policies.GPO{ID: "standard", Name: "standard-name", Rules: map[string][]entry.Entry{
+		"dconf":   {{Key: "A", Value: "otherA"}},
+		"scripts": {{Key: "B", Value: "standardB"}},
+	}}
+	otherTypesGPO := policies.GPO{ID: "other", Name: "other-name", Rules: map[string][]entry.Entry{
+		"dconf": {{Key: "A", Value: "standardA"}},
+		"mount": {{Key: "C", Value: "otherC"}},
+	}}
+	assets := filepath.Join("testdata", "cache", "policies", "with_assets", "assets.db")
+	otherAssets := filepath.Join("testdata", "cache", "policies", "with_assets_other", "assets.db")
+
+	tests := map[string]struct {
+		previousGPOs   []policies.GPO
+		previousAssets string
+		gpos           []policies.GPO
+		assets         string
+
+		want []string
+	}{
+		"Same policies":                     {previousGPOs: []policies.GPO{gpo}, gpos: []policies.GPO{gpo}},
+		"Same policies with same assets":    {previousGPOs: []policies.GPO{gpo}, previousAssets: assets, gpos: []policies.GPO{gpo}, assets: assets},
+		"No policies":                       {},
+		"Changed rules":                     {previousGPOs: []policies.GPO{gpo}, gpos: []policies.GPO{otherDconfGPO}, want: []string{"dconf"}},
+		"Added and removed policy types":    {previousGPOs: []policies.GPO{gpo}, gpos: []policies.GPO{otherTypesGPO}, want: []string{"mount", "scripts"}},
+		"Overridden rules are not compared": {previousGPOs: []policies.GPO{gpo}, gpos: []policies.GPO{gpo, otherDconfGPO}},
+		"Every policy type of new policies": {gpos: []policies.GPO{gpo}, want: []string{"dconf", "scripts"}},
+		"Every policy type of old policies": {previousGPOs: []policies.GPO{gpo}, want: []string{"dconf", "scripts"}},
+		"Changed assets":                    {previousGPOs: []policies.GPO{gpo}, previousAssets: assets, gpos: []policies.GPO{gpo}, assets: otherAssets, want: []string{"scripts"}},
+		"Added assets":                      {previousGPOs: []policies.GPO{gpo}, gpos: []policies.GPO{gpo}, assets: assets, want: []string{"scripts"}},
+		"Assets are ignored by other types": {previousGPOs: []policies.GPO{otherTypesGPO}, previousAssets: assets, gpos: []policies.GPO{otherTypesGPO}, assets: otherAssets},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			previous, err := policies.New(context.Background(), tc.previousGPOs, tc.previousAssets)
+			require.NoError(t, err, "Setup: can't create previous policies")
+			defer previous.Close()
+			pols, err := policies.New(context.Background(), tc.gpos, tc.assets)
+			require.NoError(t, err, "Setup: can't create policies")
+			defer pols.Close()
+
+			got, err := pols.ChangedPolicyTypes(&previous)
+			require.NoError(t, err, "ChangedPolicyTypes should not return an error")
+			require.Equal(t, tc.want, got, "ChangedPolicyTypes should return the policy types which changed")
+		})
+	}
+}
+
 // equalPoliciesToGolden compares the policies to the given file.
 func equalPoliciesToGolden(t *testing.T, got policies.Policies, golden string, update bool) {
 	t.Helper()
@@ -892,6 +1025,9 @@ func equalPoliciesToGolden(t *testing.T, got policies.Policies, golden string, u
 	compareDir := t.TempDir()
 	err := got.Save(compareDir)
 	require.NoError(t, err, "Teardown: saving gpo should work")
+	// History keeps a copy of the saved policies and assets, which is covered by Save tests.
+	err = os.RemoveAll(filepath.Join(compareDir, "history"))
+	require.NoError(t, err, "Teardown: cleaning up policies history")
 	if got.HasAssets() {
 		err = got.SaveAssetsTo(context.Background(), ".", filepath.Join(compareDir, "assets.db.uncompressed"), -1, -1)
 		require.NoError(t, err, "Teardown: deserializing assets should work")
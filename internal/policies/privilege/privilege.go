@@ -29,6 +29,8 @@ import (
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/decorate"
 	"gopkg.in/ini.v1"
 )
@@ -73,19 +75,15 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		return nil
 	}
 
-	sudoersDir := m.sudoersDir
-	if sudoersDir == "" {
-		sudoersDir = consts.DefaultSudoersDir
-	}
-	policyKitDir := m.policyKitDir
-	if policyKitDir == "" {
-		policyKitDir = consts.DefaultPolicyKitDir
-	}
-	sudoersConf := filepath.Join(sudoersDir, adsysBaseConfName)
-	policyKitConf := filepath.Join(policyKitDir, "localauthority.conf.d", adsysBaseConfName+".conf")
+	sudoersConf, policyKitConf, policyKitDir := m.confPaths()
 
 	log.Debugf(ctx, "Applying privilege policy to %s", objectName)
 
+	// Keep the previous configuration, and drop our temporary files, on rollback.
+	if err := journal.Record(ctx, sudoersConf, sudoersConf+".new", policyKitConf, policyKitConf+".new"); err != nil {
+		return err
+	}
+
 	// We don’t create empty files if there is no entries. Still remove any previous version.
 	if len(entries) == 0 {
 		if err := os.Remove(sudoersConf); err != nil && !errors.Is(err, fs.ErrNotExist) {
@@ -97,34 +95,89 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		return nil
 	}
 
+	contentSudo, contentPolicyKit, err := policyContents(ctx, entries, policyKitDir)
+	if err != nil {
+		return err
+	}
+
 	// Create our temp files and parent directories
 	// nolint:gosec // G301 match distribution permission
 	if err := os.MkdirAll(filepath.Dir(sudoersConf), 0755); err != nil {
 		return err
 	}
 	// nolint:gosec // G302 match distribution permission
-	sudoersF, err := os.OpenFile(sudoersConf+".new", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0440)
-	if err != nil {
+	if err := os.WriteFile(sudoersConf+".new", []byte(contentSudo), 0440); err != nil {
 		return err
 	}
-	defer sudoersF.Close()
 	// nolint:gosec // G301 match distribution permission
 	if err := os.MkdirAll(filepath.Dir(policyKitConf), 0755); err != nil {
 		return err
 	}
-	// nolint:gosec // G302 match distribution permission
-	policyKitConfF, err := os.OpenFile(policyKitConf+".new", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
-	if err != nil {
+	// nolint:gosec // G306 match distribution permission
+	if err := os.WriteFile(policyKitConf+".new", []byte(contentPolicyKit), 0644); err != nil {
+		return err
+	}
+
+	// Move temp files to their final destination
+	if err := os.Rename(sudoersConf+".new", sudoersConf); err != nil {
+		return err
+	}
+	if err := os.Rename(policyKitConf+".new", policyKitConf); err != nil {
 		return err
 	}
-	defer policyKitConfF.Close()
 
+	return nil
+}
+
+// Plan returns the changes ApplyPolicy would make to the sudoers and polkit configuration, without applying them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan privilege policy for %s", objectName))
+
+	if !isComputer {
+		return nil, nil
+	}
+
+	sudoersConf, policyKitConf, policyKitDir := m.confPaths()
+
+	if len(entries) == 0 {
+		changes = plan.AppendRemoval(changes, sudoersConf)
+		return plan.AppendRemoval(changes, policyKitConf), nil
+	}
+
+	contentSudo, contentPolicyKit, err := policyContents(ctx, entries, policyKitDir)
+	if err != nil {
+		return nil, err
+	}
+	if changes, err = plan.AppendFile(changes, sudoersConf, contentSudo); err != nil {
+		return nil, err
+	}
+	return plan.AppendFile(changes, policyKitConf, contentPolicyKit)
+}
+
+// confPaths returns the sudoers and polkit configuration files managed by adsys, as well as the polkit directory.
+func (m *Manager) confPaths() (sudoersConf, policyKitConf, policyKitDir string) {
+	sudoersDir := m.sudoersDir
+	if sudoersDir == "" {
+		sudoersDir = consts.DefaultSudoersDir
+	}
+	policyKitDir = m.policyKitDir
+	if policyKitDir == "" {
+		policyKitDir = consts.DefaultPolicyKitDir
+	}
+	return filepath.Join(sudoersDir, adsysBaseConfName),
+		filepath.Join(policyKitDir, "localauthority.conf.d", adsysBaseConfName+".conf"),
+		policyKitDir
+}
+
+// policyContents returns the sudoers and polkit configuration contents generated from entries.
+func policyContents(ctx context.Context, entries []entry.Entry, policyKitDir string) (contentSudo, contentPolicyKit string, err error) {
 	systemPolkitAdmins, err := getSystemPolkitAdminIdentities(ctx, policyKitDir)
 	if err != nil {
-		return err
+		return "", "", err
 	}
 
-	// Parse our rules and write to temp files
+	// Parse our rules
+	var sudoers strings.Builder
 	var headerWritten bool
 	header := `# This file is managed by adsys.
 # Do not edit this file manually.
@@ -170,13 +223,10 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 			polkitAdditionalUsersGroups = polkitElem
 		}
 
-		// Write to our files
-		if _, err := sudoersF.WriteString(contentSudo + "\n"); err != nil {
-			return err
-		}
+		sudoers.WriteString(contentSudo + "\n")
 		headerWritten = true
 	}
-	// PolicyKitConf files depends on multiple keys, so we need to write it at the end
+	// PolicyKitConf files depends on multiple keys, so we need to generate it at the end
 	if !allowLocalAdmins || polkitAdditionalUsersGroups != nil {
 		users := strings.Join(polkitAdditionalUsersGroups, ";")
 		// We need to set system local admin here as we override the key from the previous file
@@ -188,20 +238,10 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 			users = systemPolkitAdmins + users
 		}
 
-		if _, err := policyKitConfF.WriteString(fmt.Sprintf("%s[Configuration]\nAdminIdentities=%s", header, users) + "\n"); err != nil {
-			return err
-		}
-	}
-
-	// Move temp files to their final destination
-	if err := os.Rename(sudoersConf+".new", sudoersConf); err != nil {
-		return err
-	}
-	if err := os.Rename(policyKitConf+".new", policyKitConf); err != nil {
-		return err
+		contentPolicyKit = fmt.Sprintf("%s[Configuration]\nAdminIdentities=%s", header, users) + "\n"
 	}
 
-	return nil
+	return sudoers.String(), contentPolicyKit, nil
 }
 
 // splitAndNormalizeUsersAndGroups allow splitting on lines and ,.
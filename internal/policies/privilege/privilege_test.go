@@ -2,8 +2,10 @@ package privilege_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -131,3 +133,84 @@ func TestApplyPolicy(t *testing.T) {
 		})
 	}
 }
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	defaultLocalAdminDisabledRule := []entry.Entry{{Key: "allow-local-admins", Disabled: true}}
+
+	tests := map[string]struct {
+		notComputer        bool
+		entries            []entry.Entry
+		existingSudoersDir string
+		existingPolkitDir  string
+		destIsDir          string
+
+		wantErr bool
+	}{
+		"Disallow local admins": {entries: defaultLocalAdminDisabledRule},
+		"Disallow local admins and set client admins": {entries: []entry.Entry{
+			{Key: "allow-local-admins", Disabled: true},
+			{Key: "client-admins", Value: "alice@domain.com"}}},
+		"Allow local admins with previous local admin conf and set client admins": {
+			existingPolkitDir: "existing-previous-local-admins-multi",
+			entries: []entry.Entry{
+				{Key: "allow-local-admins", Disabled: false},
+				{Key: "client-admins", Value: "alice@domain.com"}}},
+
+		// Existing files
+		"No rules and no existing history means no changes": {},
+		"Overwrite existing sudoers file":                   {existingSudoersDir: "existing-files", entries: defaultLocalAdminDisabledRule},
+		"No rules removes existing files":                   {existingSudoersDir: "existing-files", existingPolkitDir: "existing-files"},
+		"Don't touch other existing files":                  {existingSudoersDir: "existing-other-files", existingPolkitDir: "existing-other-files", entries: defaultLocalAdminDisabledRule},
+
+		// Not a computer, don’t do anything
+		"Not a computer": {notComputer: true, existingSudoersDir: "existing-other-files", existingPolkitDir: "existing-other-files", entries: defaultLocalAdminDisabledRule},
+
+		// Error cases
+		"Error if sudoers file destination is a directory":     {destIsDir: "sudoers.d/99-adsys-privilege-enforcement", entries: defaultLocalAdminDisabledRule, wantErr: true},
+		"Error if polkit conf file destination is a directory": {destIsDir: "polkit-1/localauthority.conf.d/99-adsys-privilege-enforcement.conf", entries: defaultLocalAdminDisabledRule, wantErr: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			tempEtc := t.TempDir()
+			sudoersDir := filepath.Join(tempEtc, "sudoers.d")
+			policyKitDir := filepath.Join(tempEtc, "polkit-1")
+
+			if tc.existingSudoersDir != "" {
+				require.NoError(t,
+					shutil.CopyTree(
+						filepath.Join("testdata", tc.existingSudoersDir, "sudoers.d"), sudoersDir,
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create initial sudoer directory")
+			}
+			if tc.existingPolkitDir != "" {
+				require.NoError(t,
+					shutil.CopyTree(
+						filepath.Join("testdata", tc.existingPolkitDir, "polkit-1"), policyKitDir,
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create initial polkit directory")
+			}
+			if tc.destIsDir != "" {
+				require.NoError(t, os.MkdirAll(filepath.Join(tempEtc, tc.destIsDir), 0750), "Setup: can't create fake unreadable file")
+			}
+
+			m := privilege.NewWithDirs(sudoersDir, policyKitDir)
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.notComputer, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan failed but shouldn't have")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), tempEtc, "#ETCDIR#"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
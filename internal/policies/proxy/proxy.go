@@ -22,6 +22,7 @@ import (
 	"github.com/leonelquinteros/gotext"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/decorate"
 )
 
@@ -119,3 +120,12 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 
 	return nil
 }
+
+// Plan returns the changes ApplyPolicy would make to the system proxy settings, without applying them.
+// As idempotency is handled by ubuntu-proxy-manager, any proxy entry results in a call to the service.
+func (m *Manager) Plan(_ context.Context, _ string, isComputer bool, entries []entry.Entry) ([]plan.Change, error) {
+	if !isComputer || len(entries) == 0 {
+		return nil, nil
+	}
+	return []plan.Change{{Action: plan.CommandRun, Target: "com.ubuntu.ProxyManager.Apply"}}, nil
+}
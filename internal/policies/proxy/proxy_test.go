@@ -12,6 +12,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/adsys/internal/policies/proxy"
 	"github.com/ubuntu/adsys/internal/testutils"
 )
@@ -93,6 +94,47 @@ func TestApplyPolicy(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	t.Cleanup(testutils.StartLocalSystemBus())
+	t.Parallel()
+
+	bus := testutils.NewDbusConn(t)
+	tests := map[string]struct {
+		entries []entry.Entry
+
+		isUser bool
+
+		wantChanges []plan.Change
+	}{
+		"Computer, no entries": {},
+		"Computer, entries call the proxy manager": {
+			entries:     []entry.Entry{{Key: "proxy/auto", Value: "http://example.com:8080/proxy.pac"}},
+			wantChanges: []plan.Change{{Action: plan.CommandRun, Target: "com.ubuntu.ProxyManager.Apply"}},
+		},
+		"Computer, disabled entries call the proxy manager": {
+			entries:     []entry.Entry{{Key: "proxy/http", Value: "", Disabled: true}},
+			wantChanges: []plan.Change{{Action: plan.CommandRun, Target: "com.ubuntu.ProxyManager.Apply"}},
+		},
+
+		"User, no entries":        {isUser: true},
+		"User, non-empty entries": {isUser: true, entries: []entry.Entry{{Key: "proxy/http", Value: "http://example.com:8080"}}},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			proxyApplier := &mockProxyApplier{}
+			m := proxy.New(bus, proxy.WithProxyApplier(proxyApplier))
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			require.NoError(t, err, "Plan should have succeeded but it didn't")
+
+			require.Equal(t, tc.wantChanges, changes, "Plan returned unexpected changes")
+			require.Empty(t, proxyApplier.Args(), "Plan should not call the proxy manager")
+		})
+	}
+}
+
 func TestWarnOnUnsupportedKeys(t *testing.T) {
 	// capture log output (set to stderr, but captured when loading logrus)
 	r, w, err := os.Pipe()
@@ -0,0 +1,185 @@
+package policies
+
+import (
+	"context"
+	_ "embed" // embed html report template
+	"encoding/json"
+	"errors"
+	"html/template"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/decorate"
+)
+
+// FormatHTML is the html format of the resultant set of policies report.
+const FormatHTML = "html"
+
+// Manager statuses in the report.
+const (
+	// ReportStatusApplied is the status of a manager which applied its rules on last update.
+	ReportStatusApplied = "applied"
+	// ReportStatusFiltered is the status of a manager whose rules are filtered out without Ubuntu Pro subscription.
+	ReportStatusFiltered = "filtered"
+	// ReportStatusFailed is the status of a manager which failed to apply its rules on last update.
+	ReportStatusFailed = "failed"
+)
+
+//go:embed report.html.template
+var reportTemplate string
+
+// Report is the resultant set of policies of the machine and, optionally, of a user.
+type Report struct {
+	Hostname        string `json:"hostname"`
+	Backend         string `json:"backend"`
+	ProSubscription bool   `json:"pro_subscription"`
+
+	Machine ObjectReport  `json:"machine"`
+	User    *ObjectReport `json:"user,omitempty"`
+}
+
+// ObjectReport is the resultant set of policies applied to an object.
+type ObjectReport struct {
+	Name       string      `json:"name"`
+	LastUpdate time.Time   `json:"last_update"`
+	GPOs       []GPOOrigin `json:"gpos"`
+	// FilteredRules are the policy types which are not applied as the machine is not subscribed to Ubuntu Pro.
+	FilteredRules []string        `json:"filtered_rules,omitempty"`
+	Managers      []ManagerReport `json:"managers"`
+}
+
+// ManagerReport is the result of a policy manager for an object, with its effective rules.
+type ManagerReport struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// LastApply is the recorded outcome of the last application of the manager rules, if any.
+	LastApply *ManagerStatus `json:"last_apply,omitempty"`
+	Rules     []DumpRule     `json:"rules"`
+}
+
+// Report returns the resultant set of policies of the machine and, unless computerOnly is set, of objectName,
+// in the html or json format.
+// backendInfo describes the directory service backend the policies come from.
+func (m *Manager) Report(ctx context.Context, objectName string, computerOnly bool, backendInfo, format string) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to generate policies report for %q", objectName))
+
+	log.Infof(ctx, "Generating policies report for %s", objectName)
+
+	if format == "" {
+		format = FormatHTML
+	}
+	if format != FormatHTML && format != FormatJSON {
+		return "", errors.New(gotext.Get("unsupported format %q", format))
+	}
+
+	r := Report{
+		Hostname:        m.hostname,
+		Backend:         backendInfo,
+		ProSubscription: m.GetSubscriptionState(ctx),
+	}
+
+	r.Machine, err = m.objectReport(ctx, m.hostname, true, r.ProSubscription)
+	if err != nil {
+		return "", err
+	}
+	if !computerOnly {
+		u, err := m.objectReport(ctx, objectName, false, r.ProSubscription)
+		if err != nil {
+			return "", err
+		}
+		r.User = &u
+	}
+
+	if format == FormatJSON {
+		out, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(out) + "\n", nil
+	}
+
+	t, err := template.New("report").Funcs(template.FuncMap{
+		"entryValue": formatEntryValue,
+		"date":       func(t time.Time) string { return t.UTC().Format(time.RFC3339) },
+	}).Parse(reportTemplate)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	if err := t.Execute(&out, r); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// objectReport returns the resultant set of policies applied to objectName, from its policies cache.
+func (m *Manager) objectReport(ctx context.Context, objectName string, isComputer, proSubscription bool) (r ObjectReport, err error) {
+	pols, err := NewFromCache(ctx, filepath.Join(m.policiesCacheDir, objectName))
+	if err != nil {
+		return r, errors.New(gotext.Get("no policy applied for %q: %v", objectName, err))
+	}
+	defer pols.Close()
+
+	lastUpdate, err := m.LastUpdateFor(ctx, objectName, false)
+	if err != nil {
+		return r, err
+	}
+
+	source := "user"
+	if isComputer {
+		source = "machine"
+	}
+	d := newDump(objectName, nil, pols.GPOs, source)
+
+	status, err := m.Status(objectName)
+	if err != nil {
+		return r, err
+	}
+
+	rulesPerManager := make(map[string][]DumpRule)
+	for _, rule := range d.Rules {
+		rulesPerManager[rule.Domain] = append(rulesPerManager[rule.Domain], rule)
+	}
+	// Failed managers are reported even without any rule applied.
+	for name, s := range status {
+		if _, ok := rulesPerManager[name]; !ok && s.Error != "" {
+			rulesPerManager[name] = nil
+		}
+	}
+	var managers []string
+	for name := range rulesPerManager {
+		managers = append(managers, name)
+	}
+	sort.Strings(managers)
+
+	r = ObjectReport{
+		Name:       objectName,
+		LastUpdate: lastUpdate,
+		GPOs:       d.GPOs,
+	}
+	for _, name := range managers {
+		managerReport := ManagerReport{
+			Name:   name,
+			Status: ReportStatusApplied,
+			Rules:  rulesPerManager[name],
+		}
+		if s, ok := status[name]; ok {
+			managerReport.LastApply = &s
+			if s.Error != "" {
+				managerReport.Status = ReportStatusFailed
+			}
+		}
+		if !proSubscription && slices.Contains(ProOnlyRules, name) {
+			managerReport.Status = ReportStatusFiltered
+			r.FilteredRules = append(r.FilteredRules, name)
+		}
+		r.Managers = append(r.Managers, managerReport)
+	}
+
+	return r, nil
+}
@@ -18,10 +18,13 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"os/user"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -29,6 +32,8 @@ import (
 	"github.com/ubuntu/adsys/internal/consts"
 	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
 	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
 	"github.com/ubuntu/decorate"
 )
 
@@ -57,6 +62,13 @@ type options struct {
 // Option reprents an optional function to change scripts manager.
 type Option func(*options)
 
+// WithUserLookup specifies a personalized function to look up users.
+func WithUserLookup(userLookup func(string) (*user.User, error)) Option {
+	return func(o *options) {
+		o.userLookup = userLookup
+	}
+}
+
 // New creates a manager with a specific scripts directory.
 func New(runDir string, unitStarter unitStarter, opts ...Option) (m *Manager, err error) {
 	defer decorate.OnError(&err, gotext.Get("can't create scripts manager"))
@@ -96,21 +108,9 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 
 	log.Debugf(ctx, "Applying scripts policy to %s", objectName)
 
-	objectDir := "machine"
-	uid, gid := -1, -1
-	if !isComputer {
-		user, err := m.userLookup(objectName)
-		if err != nil {
-			return errors.New(gotext.Get("couldn't retrieve user for %q: %v", objectName, err))
-		}
-		if uid, err = strconv.Atoi(user.Uid); err != nil {
-			return errors.New(gotext.Get("couldn't convert %q to a valid uid for %q", user.Uid, objectName))
-		}
-		if gid, err = strconv.Atoi(user.Gid); err != nil {
-			return errors.New(gotext.Get("couldn't convert %q to a valid gid for %q", user.Gid, objectName))
-		}
-
-		objectDir = filepath.Join("users", user.Uid)
+	objectDir, uid, gid, err := m.objectDir(objectName, isComputer)
+	if err != nil {
+		return err
 	}
 
 	objectPath := filepath.Join(m.runDir, objectDir)
@@ -125,6 +125,9 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 		return nil
 	}
 
+	if err := journal.Record(ctx, scriptsPath); err != nil {
+		return err
+	}
 	if err := os.RemoveAll(scriptsPath); err != nil {
 		return err
 	}
@@ -150,32 +153,17 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 
 	// create order files, check that the scripts existings in the destination
 	log.Debugf(ctx, "Creating script order file for user %q", objectName)
-	orderFilesContent := make(map[string][]string)
-	for _, e := range entries {
-		lifecycle := filepath.Base(e.Key)
-		for _, script := range strings.Split(e.Value, "\n") {
-			script = strings.TrimSpace(script)
-			if script == "" {
-				continue
-			}
-
-			// check that the script exists and make it executable
-			scriptFilePath := filepath.Join(scriptsPath, executableDir, script)
-			log.Debugf(ctx, "%q: found %q. Marking as executable %q", e.Key, script, scriptFilePath)
-			info, err := os.Stat(scriptFilePath)
-			if errors.Is(err, os.ErrNotExist) {
-				return errors.New(gotext.Get("script %q doesn't exist in SYSVOL scripts/ subdirectory", script))
-			}
-			if info.IsDir() {
-				return errors.New(gotext.Get("script %q is a directory and not a file to execute", script))
-			}
+	orderFilesContent, err := orderFiles(ctx, entries, os.DirFS(dest))
+	if err != nil {
+		return err
+	}
+	for _, scripts := range orderFilesContent {
+		for _, script := range scripts {
+			scriptFilePath := filepath.Join(scriptsPath, script)
 			// nolint:gosec // G302 - scripts need rx permissions
 			if err := os.Chmod(scriptFilePath, 0550); err != nil {
 				return errors.New(gotext.Get("can't change mode of script %qto %o: %v", scriptFilePath, 0550, err))
 			}
-
-			// append it to the list of our scripts
-			orderFilesContent[lifecycle] = append(orderFilesContent[lifecycle], filepath.Join(executableDir, script))
 		}
 	}
 
@@ -221,6 +209,128 @@ func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer
 	return m.unitStarter.StartUnit(ctx, consts.AdysMachineScriptsServiceName)
 }
 
+// AssetsReader is a function which returns policies assets as a read-only file system.
+type AssetsReader func(relSrc string) (fs.FS, error)
+
+// Plan returns the changes ApplyPolicy would make to the scripts directory of objectName, without applying them.
+// Scripts are compared against the policies assets, without extracting them.
+func (m *Manager) Plan(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry, assetsReader AssetsReader) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan scripts policy for %s", objectName))
+
+	objectDir, _, _, err := m.objectDir(objectName, isComputer)
+	if err != nil {
+		return nil, err
+	}
+	scriptsPath := filepath.Join(m.runDir, objectDir, executableDir)
+
+	// A session in progress prevents any update, see ApplyPolicy.
+	if _, err := os.Stat(filepath.Join(scriptsPath, inSessionFlag)); err == nil {
+		return nil, nil
+	}
+
+	if len(entries) == 0 {
+		return plan.AppendRemoval(nil, scriptsPath), nil
+	}
+
+	assets, err := assetsReader("scripts/")
+	if err != nil {
+		return nil, err
+	}
+	orderFilesContent, err := orderFiles(ctx, entries, assets)
+	if err != nil {
+		return nil, err
+	}
+
+	if changes, err = plan.AppendTree(changes, assets, filepath.Join(scriptsPath, executableDir)); err != nil {
+		return nil, err
+	}
+	lifecycles := make([]string, 0, len(orderFilesContent))
+	for lifecycle := range orderFilesContent {
+		lifecycles = append(lifecycles, lifecycle)
+	}
+	slices.Sort(lifecycles)
+	for _, lifecycle := range lifecycles {
+		content := strings.Join(orderFilesContent[lifecycle], "\n") + "\n"
+		if changes, err = plan.AppendFile(changes, filepath.Join(scriptsPath, lifecycle), content); err != nil {
+			return nil, err
+		}
+	}
+	if changes, err = plan.AppendFile(changes, filepath.Join(scriptsPath, readyFlag), ""); err != nil {
+		return nil, err
+	}
+
+	// Any other file is removed as the scripts directory is recreated from scratch.
+	existing, err := os.ReadDir(scriptsPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, e := range existing {
+		if _, ok := orderFilesContent[e.Name()]; ok || e.Name() == executableDir || e.Name() == readyFlag {
+			continue
+		}
+		changes = plan.AppendRemoval(changes, filepath.Join(scriptsPath, e.Name()))
+	}
+
+	if isComputer && orderFilesContent["startup"] != nil {
+		changes = append(changes, plan.Change{Action: plan.UnitStarted, Target: consts.AdysMachineScriptsServiceName})
+	}
+
+	return changes, nil
+}
+
+// objectDir returns the directory, relative to the run directory, storing the scripts of objectName.
+// It also returns the uid and gid owning it, which are -1 for the machine.
+func (m *Manager) objectDir(objectName string, isComputer bool) (objectDir string, uid, gid int, err error) {
+	if isComputer {
+		return "machine", -1, -1, nil
+	}
+
+	user, err := m.userLookup(objectName)
+	if err != nil {
+		return "", 0, 0, errors.New(gotext.Get("couldn't retrieve user for %q: %v", objectName, err))
+	}
+	if uid, err = strconv.Atoi(user.Uid); err != nil {
+		return "", 0, 0, errors.New(gotext.Get("couldn't convert %q to a valid uid for %q", user.Uid, objectName))
+	}
+	if gid, err = strconv.Atoi(user.Gid); err != nil {
+		return "", 0, 0, errors.New(gotext.Get("couldn't convert %q to a valid gid for %q", user.Gid, objectName))
+	}
+
+	return filepath.Join("users", user.Uid), uid, gid, nil
+}
+
+// orderFiles returns, per lifecycle, the list of scripts to execute relative to the scripts directory.
+// It checks that every script exists in executables, the file system containing the scripts.
+func orderFiles(ctx context.Context, entries []entry.Entry, executables fs.FS) (map[string][]string, error) {
+	orderFilesContent := make(map[string][]string)
+	for _, e := range entries {
+		lifecycle := filepath.Base(e.Key)
+		for _, script := range strings.Split(e.Value, "\n") {
+			script = strings.TrimSpace(script)
+			if script == "" {
+				continue
+			}
+
+			// check that the script exists
+			log.Debugf(ctx, "%q: found %q", e.Key, script)
+			info, err := fs.Stat(executables, path.Clean(script))
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, errors.New(gotext.Get("script %q doesn't exist in SYSVOL scripts/ subdirectory", script))
+			} else if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				return nil, errors.New(gotext.Get("script %q is a directory and not a file to execute", script))
+			}
+
+			// append it to the list of our scripts
+			orderFilesContent[lifecycle] = append(orderFilesContent[lifecycle], filepath.Join(executableDir, script))
+		}
+	}
+
+	return orderFilesContent, nil
+}
+
 // RunScripts executes all scripts in directory if ready and not already executed.
 // allowOrderMissing will not require order to exists if we are ready to execute.
 func RunScripts(ctx context.Context, order string, allowOrderMissing bool) (err error) {
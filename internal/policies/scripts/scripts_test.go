@@ -3,10 +3,12 @@ package scripts_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"os/user"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -169,6 +171,99 @@ func TestApplyPolicy(t *testing.T) {
 	}
 }
 
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	u, err := user.Current()
+	require.NoError(t, err, "Setup: failed to get current user")
+
+	defaultSingleScript := []entry.Entry{{Key: "s", Value: "script1.sh"}}
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		computer bool
+
+		readAssetsError   bool
+		userLookupError   bool
+		destAlreadyExists string
+
+		wantErr bool
+	}{
+		// User cases
+		"One script": {entries: defaultSingleScript},
+		"Multiple directories": {entries: []entry.Entry{
+			{Key: "s", Value: "script3.sh\nscript1.sh\nscript2.sh"},
+			{Key: "e", Value: "script93.sh\nscript91.sh\nscript92.sh"}}},
+		"Subfolder with script":       {entries: []entry.Entry{{Key: "s", Value: "subfolder/script1.sh"}}},
+		"No entries is no change":     {},
+		"Empty entries are discarded": {entries: []entry.Entry{{Key: "s", Value: "script3.sh\n\nscript1.sh"}}},
+
+		// Computer cases
+		"Startup script for computer starts the unit": {computer: true, entries: []entry.Entry{{Key: "startup", Value: "script1.sh"}}},
+
+		// Destination already exists. Using computer to be uid independent
+		"Destination is already running, no change":    {destAlreadyExists: "already running", computer: true, entries: defaultSingleScript},
+		"Destination is already ready, refreshing":     {destAlreadyExists: "already ready", computer: true, entries: defaultSingleScript},
+		"Destination is not ready, refreshing":         {destAlreadyExists: "not ready", computer: true, entries: defaultSingleScript},
+		"No entries removes existing non ready folder": {destAlreadyExists: "not ready", computer: true},
+
+		// Special cases
+		"User lookup failing does not impact machine plan": {computer: true, userLookupError: true, entries: defaultSingleScript},
+
+		// Error cases
+		"Error on subfolder listed":       {entries: []entry.Entry{{Key: "s", Value: "subfolder"}}, wantErr: true},
+		"Error on script does not exist":  {entries: []entry.Entry{{Key: "s", Value: "doestnotexists"}}, wantErr: true},
+		"Error on reading assets failing": {entries: defaultSingleScript, readAssetsError: true, wantErr: true},
+		"Error on user lookup failing":    {userLookupError: true, entries: defaultSingleScript, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			runDir := t.TempDir()
+
+			userLookup := func(string) (*user.User, error) {
+				return &user.User{Uid: u.Uid, Gid: u.Gid}, nil
+			}
+			if tc.userLookupError {
+				userLookup = func(string) (*user.User, error) {
+					return nil, errors.New("User error requested")
+				}
+			}
+
+			if tc.destAlreadyExists != "" {
+				require.NoError(t, os.RemoveAll(runDir), "Setup: can't remove run dir before filing it")
+				require.NoError(t,
+					shutil.CopyTree(
+						filepath.Join("testdata", "TestApplyPolicy", "run_dir", tc.destAlreadyExists), runDir,
+						&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+					"Setup: can't create initial run dir scripts content")
+			}
+
+			mockAssetsDumper := testutils.MockAssetsDumper{T: t, Err: tc.readAssetsError, Path: "scripts/"}
+
+			m, err := scripts.New(runDir, &mockUnitStarter{}, scripts.WithUserLookup(userLookup))
+			require.NoError(t, err, "Setup: can't create scripts manager")
+
+			changes, err := m.Plan(context.Background(), "ubuntu", tc.computer, tc.entries, mockAssetsDumper.ReadAssets)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan failed but shouldn't have")
+
+			var got strings.Builder
+			for _, c := range changes {
+				l := strings.ReplaceAll(c.String(), runDir, "#RUNDIR#")
+				fmt.Fprintln(&got, strings.ReplaceAll(l, "/users/"+u.Uid+"/", "/users/4242/"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
 // makeIndependentOfCurrentUID renames any file or directory which exactly match uid in path and replace it with 4242.
 func makeIndependentOfCurrentUID(t *testing.T, path string, uid string) {
 	t.Helper()
@@ -0,0 +1,617 @@
+// Package services provides a manager to enable, disable, mask or start systemd units on the machine.
+//
+// Units are listed by name, like bluetooth.service or fstrim.timer, in the enable, disable, mask and
+// start entries. Those policies are only supported on computers:
+//   - enabled units are enabled and started;
+//   - disabled units are disabled and stopped;
+//   - masked units are masked, with a symlink to /dev/null in the system unit directory, and stopped;
+//   - started units are started, without changing whether they are enabled.
+//
+// The manager is idempotent: the state of each unit is queried first, and only the units which are
+// not in their requested state are changed. The original state of every unit changed by adsys is
+// stored, so that it is restored once the unit is not listed anymore.
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	enableKey  = "enable"
+	disableKey = "disable"
+	maskKey    = "mask"
+	startKey   = "start"
+)
+
+// supportedKeys are the entry keys supported by the services manager.
+var supportedKeys = []string{enableKey, disableKey, maskKey, startKey}
+
+// unitNameRe matches a systemd unit name, with its type suffix.
+var unitNameRe = regexp.MustCompile(`^[a-zA-Z0-9:_.\\-]+(@[a-zA-Z0-9:_.\\-]*)?\.(service|socket|device|mount|automount|swap|target|path|timer|slice)$`)
+
+// maskTarget is where a masked unit points to.
+const maskTarget = "/dev/null"
+
+// unitState is the state of a unit, as reported by systemd.
+type unitState struct {
+	// UnitFileState is whether the unit is enabled, disabled, masked, static…
+	// It is empty when unknown.
+	UnitFileState string `json:"unit_file_state"`
+	// Active is whether the unit is currently running.
+	Active bool `json:"active"`
+}
+
+// masked returns if the unit is masked, either permanently or for the current boot only.
+func (s unitState) masked() bool {
+	return strings.HasPrefix(s.UnitFileState, "masked")
+}
+
+// mayBeDisabled returns if the unit is disabled, or if its state is unknown.
+// Units which can't be enabled, like static units, are never considered disabled.
+func (s unitState) mayBeDisabled() bool {
+	return s.UnitFileState == "" || s.UnitFileState == "disabled"
+}
+
+// mayBeEnabled returns if the unit is enabled, or if its state is unknown.
+func (s unitState) mayBeEnabled() bool {
+	return s.UnitFileState == "" || strings.HasPrefix(s.UnitFileState, "enabled")
+}
+
+// operation is a single change made on a unit.
+type operation struct {
+	action plan.Action
+	unit   string
+}
+
+// isMask returns if op creates or removes the mask of a unit.
+func (op operation) isMask() bool {
+	return op.action == plan.FileCreated || op.action == plan.FileRemoved
+}
+
+// Manager prevents running multiple units updates in parallel.
+type Manager struct {
+	statePath     string
+	systemUnitDir string
+	systemdCaller systemdCaller
+	systemctlCmd  []string
+
+	mu sync.Mutex // Prevents concurrent changes of the units and of their original states
+}
+
+type systemdCaller interface {
+	StartUnit(context.Context, string) error
+	StopUnit(context.Context, string) error
+	EnableUnit(context.Context, string) error
+	DisableUnit(context.Context, string) error
+	DaemonReload(context.Context) error
+}
+
+type options struct {
+	systemctlCmd []string
+}
+
+// Option reprents an optional function to change the services manager.
+type Option func(*options)
+
+// WithSystemctlCmd overrides the default systemctl command, used to query the state of the units.
+func WithSystemctlCmd(cmd []string) Option {
+	return func(o *options) {
+		o.systemctlCmd = cmd
+	}
+}
+
+// New returns a new services policy manager.
+// The original state of the units changed by adsys is stored in stateDir, and units are masked in systemUnitDir.
+func New(stateDir, systemUnitDir string, systemdCaller systemdCaller, opts ...Option) *Manager {
+	// defaults
+	args := options{
+		systemctlCmd: []string{"systemctl"},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	return &Manager{
+		statePath:     filepath.Join(stateDir, "services", "units.json"),
+		systemUnitDir: systemUnitDir,
+		systemdCaller: systemdCaller,
+		systemctlCmd:  args.systemctlCmd,
+	}
+}
+
+// ApplyPolicy puts the units listed in entries in their requested state, and restores the original
+// state of the units which were changed by adsys and are not listed anymore.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply services policy"))
+
+	// Services policies are only supported on computers
+	if !isComputer {
+		return nil
+	}
+
+	requested, err := parseEntries(ctx, entries)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	originals, err := m.loadOriginalStates()
+	if err != nil {
+		return err
+	}
+	if len(requested) == 0 && len(originals) == 0 {
+		log.Debug(ctx, gotext.Get("No entries found for the services policy"))
+		return nil
+	}
+
+	log.Debugf(ctx, "Applying services policy to %s", objectName)
+
+	units := unitNames(requested, originals)
+	states, err := m.queryStates(ctx, units)
+	if err != nil {
+		return err
+	}
+	ops, err := m.operations(requested, originals, states)
+	if err != nil {
+		return err
+	}
+	newOriginals := updateOriginalStates(ops, requested, originals, states)
+	if len(ops) == 0 && maps.Equal(originals, newOriginals) {
+		return nil
+	}
+
+	if err := m.journalUnits(ctx, units, states); err != nil {
+		return err
+	}
+
+	// Masks are created or removed first, as units can't be changed while they are masked.
+	var needsReload bool
+	for _, op := range ops {
+		path := filepath.Join(m.systemUnitDir, op.unit)
+		switch op.action {
+		case plan.FileCreated:
+			log.Infof(ctx, gotext.Get("Masking unit %s", op.unit))
+			if err := os.Symlink(maskTarget, path); err != nil {
+				return err
+			}
+		case plan.FileRemoved:
+			log.Infof(ctx, gotext.Get("Unmasking unit %s", op.unit))
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		default:
+			continue
+		}
+		needsReload = true
+	}
+	if needsReload {
+		if err := m.systemdCaller.DaemonReload(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, op := range ops {
+		switch op.action {
+		case plan.UnitEnabled:
+			log.Infof(ctx, gotext.Get("Enabling unit %s", op.unit))
+			if err := m.systemdCaller.EnableUnit(ctx, op.unit); err != nil {
+				return err
+			}
+		case plan.UnitDisabled:
+			log.Infof(ctx, gotext.Get("Disabling unit %s", op.unit))
+			if err := m.systemdCaller.DisableUnit(ctx, op.unit); err != nil {
+				return err
+			}
+		case plan.UnitStarted:
+			log.Infof(ctx, gotext.Get("Starting unit %s", op.unit))
+			if err := m.systemdCaller.StartUnit(ctx, op.unit); err != nil {
+				log.Warning(ctx, gotext.Get("Failed to start unit %q: %v", op.unit, err))
+			}
+		case plan.UnitStopped:
+			log.Infof(ctx, gotext.Get("Stopping unit %s", op.unit))
+			if err := m.systemdCaller.StopUnit(ctx, op.unit); err != nil {
+				log.Warning(ctx, gotext.Get("Failed to stop unit %q: %v", op.unit, err))
+			}
+		}
+	}
+
+	return m.saveOriginalStates(newOriginals)
+}
+
+// Plan returns the changes ApplyPolicy would make to the units, without applying them.
+func (m *Manager) Plan(ctx context.Context, _ string, isComputer bool, entries []entry.Entry) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan services policy"))
+
+	if !isComputer {
+		return nil, nil
+	}
+
+	requested, err := parseEntries(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// Don't read the units states while they are being updated.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	originals, err := m.loadOriginalStates()
+	if err != nil {
+		return nil, err
+	}
+	if len(requested) == 0 && len(originals) == 0 {
+		return nil, nil
+	}
+
+	states, err := m.queryStates(ctx, unitNames(requested, originals))
+	if err != nil {
+		return nil, err
+	}
+	ops, err := m.operations(requested, originals, states)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range ops {
+		if op.isMask() {
+			changes = append(changes, plan.Change{Action: op.action, Target: filepath.Join(m.systemUnitDir, op.unit)})
+		}
+	}
+	if len(changes) > 0 {
+		changes = append(changes, plan.Change{Action: plan.CommandRun, Target: "systemctl daemon-reload"})
+	}
+	for _, op := range ops {
+		if !op.isMask() {
+			changes = append(changes, plan.Change{Action: op.action, Target: op.unit})
+		}
+	}
+
+	return changes, nil
+}
+
+// updateOriginalStates returns the original states of the units once ops are applied: the original state of the
+// units changed for the first time is added, and the units which are not requested anymore are forgotten.
+func updateOriginalStates(ops []operation, requested map[string]string, originals, states map[string]unitState) map[string]unitState {
+	newOriginals := make(map[string]unitState)
+	for unit, s := range originals {
+		if _, ok := requested[unit]; ok {
+			newOriginals[unit] = s
+		}
+	}
+	for _, op := range ops {
+		if _, ok := requested[op.unit]; !ok {
+			continue
+		}
+		if _, ok := newOriginals[op.unit]; !ok {
+			newOriginals[op.unit] = states[op.unit]
+		}
+	}
+	return newOriginals
+}
+
+// operations returns the operations needed to put the requested units in their requested state, and to
+// restore the original state of the units which are not requested anymore.
+// Masks creations and removals come first, followed by the operations on the units themselves.
+func (m *Manager) operations(requested map[string]string, originals, states map[string]unitState) (ops []operation, err error) {
+	var unitOps []operation
+	for _, unit := range unitNames(requested, originals) {
+		s := states[unit]
+		action, isRequested := requested[unit]
+
+		// The mask in the system unit directory is the one adsys can set or remove.
+		hasMask, err := m.hasMask(unit)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isRequested {
+			// Masks removed by adsys are set back, the other ones are removed.
+			if originals[unit].UnitFileState == "masked" {
+				if !hasMask {
+					ops = append(ops, operation{plan.FileCreated, unit})
+				}
+			} else if hasMask {
+				ops = append(ops, operation{plan.FileRemoved, unit})
+				// The state of the unit once unmasked is unknown.
+				s = unitState{}
+			}
+			unitOps = append(unitOps, restoreOperations(unit, originals[unit], s)...)
+			continue
+		}
+
+		if hasMask && action != maskKey {
+			ops = append(ops, operation{plan.FileRemoved, unit})
+			s = unitState{}
+		}
+
+		switch action {
+		case enableKey:
+			if s.mayBeDisabled() {
+				unitOps = append(unitOps, operation{plan.UnitEnabled, unit})
+			}
+			if !s.Active {
+				unitOps = append(unitOps, operation{plan.UnitStarted, unit})
+			}
+		case disableKey:
+			if s.mayBeEnabled() {
+				unitOps = append(unitOps, operation{plan.UnitDisabled, unit})
+			}
+			if s.Active {
+				unitOps = append(unitOps, operation{plan.UnitStopped, unit})
+			}
+		case maskKey:
+			if !hasMask && !s.masked() {
+				if _, err := os.Lstat(filepath.Join(m.systemUnitDir, unit)); err == nil {
+					return nil, errors.New(gotext.Get("unit %q is defined in %s and can't be masked", unit, m.systemUnitDir))
+				}
+				ops = append(ops, operation{plan.FileCreated, unit})
+			}
+			if s.Active {
+				unitOps = append(unitOps, operation{plan.UnitStopped, unit})
+			}
+		case startKey:
+			if !s.Active {
+				unitOps = append(unitOps, operation{plan.UnitStarted, unit})
+			}
+		}
+	}
+
+	return append(ops, unitOps...), nil
+}
+
+// restoreOperations returns the operations needed for unit to go back from its current state to its original one.
+// Masks are handled separately.
+func restoreOperations(unit string, original, current unitState) (ops []operation) {
+	switch original.UnitFileState {
+	case "enabled":
+		if current.mayBeDisabled() {
+			ops = append(ops, operation{plan.UnitEnabled, unit})
+		}
+	case "disabled":
+		if current.mayBeEnabled() {
+			ops = append(ops, operation{plan.UnitDisabled, unit})
+		}
+	}
+
+	if original.Active && !current.Active {
+		ops = append(ops, operation{plan.UnitStarted, unit})
+	} else if !original.Active && current.Active {
+		ops = append(ops, operation{plan.UnitStopped, unit})
+	}
+	return ops
+}
+
+// hasMask returns if unit is masked in the system unit directory.
+func (m *Manager) hasMask(unit string) (bool, error) {
+	path := filepath.Join(m.systemUnitDir, unit)
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if fi.Mode()&fs.ModeSymlink == 0 {
+		return false, nil
+	}
+
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false, err
+	}
+	return target == maskTarget, nil
+}
+
+// journalUnits records the masks and the original states of units in the journal of ctx, if any.
+// On rollback, once those files are restored, units are put back in the state they had before.
+func (m *Manager) journalUnits(ctx context.Context, units []string, states map[string]unitState) error {
+	// Rollback actions are run in reverse order: this one is called once the files are restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		if err := m.systemdCaller.DaemonReload(ctx); err != nil {
+			return err
+		}
+		var errs []error
+		for _, unit := range units {
+			errs = append(errs, m.restore(ctx, unit, states[unit]))
+		}
+		return errors.Join(errs...)
+	})
+
+	paths := []string{filepath.Dir(m.statePath)}
+	for _, unit := range units {
+		paths = append(paths, filepath.Join(m.systemUnitDir, unit))
+	}
+	return journal.Record(ctx, paths...)
+}
+
+// restore puts back unit in state s, without knowing its current state. Its mask is expected to be restored already.
+func (m *Manager) restore(ctx context.Context, unit string, s unitState) error {
+	switch s.UnitFileState {
+	case "enabled":
+		if err := m.systemdCaller.EnableUnit(ctx, unit); err != nil {
+			return err
+		}
+	case "disabled":
+		if err := m.systemdCaller.DisableUnit(ctx, unit); err != nil {
+			return err
+		}
+	}
+
+	if s.Active {
+		if err := m.systemdCaller.StartUnit(ctx, unit); err != nil {
+			log.Warning(ctx, gotext.Get("Failed to start unit %q: %v", unit, err))
+		}
+		return nil
+	}
+	if err := m.systemdCaller.StopUnit(ctx, unit); err != nil {
+		log.Warning(ctx, gotext.Get("Failed to stop unit %q: %v", unit, err))
+	}
+	return nil
+}
+
+// queryStates returns the current state of units, as reported by systemctl.
+func (m *Manager) queryStates(ctx context.Context, units []string) (states map[string]unitState, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to query units state"))
+
+	states = make(map[string]unitState)
+	for _, unit := range units {
+		// #nosec G204 - We are in control of the arguments and unit names are validated
+		cmd := exec.CommandContext(ctx, m.systemctlCmd[0],
+			append(slices.Clone(m.systemctlCmd[1:]), "show", "--property=UnitFileState,ActiveState", "--", unit)...)
+		var stderr strings.Builder
+		cmd.Stderr = &stderr
+		smbsafe.WaitExec()
+		out, err := cmd.Output()
+		smbsafe.DoneExec()
+		if msg := strings.TrimSpace(stderr.String()); err != nil && msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		} else if err != nil {
+			return nil, err
+		}
+
+		var s unitState
+		for _, line := range strings.Split(string(out), "\n") {
+			k, v, _ := strings.Cut(strings.TrimSpace(line), "=")
+			switch k {
+			case "UnitFileState":
+				s.UnitFileState = v
+			case "ActiveState":
+				s.Active = v == "active" || v == "activating" || v == "reloading"
+			}
+		}
+		states[unit] = s
+	}
+
+	return states, nil
+}
+
+// loadOriginalStates returns the original states of the units changed by adsys.
+func (m *Manager) loadOriginalStates() (originals map[string]unitState, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't load the original state of the units"))
+
+	originals = make(map[string]unitState)
+	d, err := os.ReadFile(m.statePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return originals, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(d, &originals); err != nil {
+		return nil, err
+	}
+	return originals, nil
+}
+
+// saveOriginalStates stores the original states of the units changed by adsys.
+// The state file is removed if there are none.
+func (m *Manager) saveOriginalStates(originals map[string]unitState) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't save the original state of the units"))
+
+	if len(originals) == 0 {
+		if err := os.RemoveAll(filepath.Dir(m.statePath)); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	d, err := json.MarshalIndent(originals, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(m.statePath), 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(m.statePath+".new", append(d, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(m.statePath+".new", m.statePath)
+}
+
+// unitNames returns the sorted names of all units in requested and originals.
+func unitNames(requested map[string]string, originals map[string]unitState) (units []string) {
+	for unit := range requested {
+		units = append(units, unit)
+	}
+	for unit := range originals {
+		if _, ok := requested[unit]; !ok {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+	return units
+}
+
+// parseEntries returns the requested action, which is one of the supported keys, for each unit listed in entries.
+// A unit listed in conflicting entries, like enable and disable, is an error.
+func parseEntries(ctx context.Context, entries []entry.Entry) (requested map[string]string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to parse services entries"))
+
+	requested = make(map[string]string)
+	// Follow the order of supported keys, so that a unit both enabled and started is only enabled.
+	for _, key := range supportedKeys {
+		for _, e := range entries {
+			if e.Key[strings.LastIndex(e.Key, "/")+1:] != key {
+				continue
+			}
+			if e.Disabled {
+				log.Debug(ctx, gotext.Get("The entry %q is disabled and will be skipped", e.Key))
+				continue
+			}
+			if e.Err != nil {
+				return nil, errors.New(gotext.Get("entry %q is errored: %v", e.Key, e.Err))
+			}
+
+			for _, unit := range strings.Split(e.Value, "\n") {
+				unit = strings.TrimSpace(unit)
+				if unit == "" {
+					continue
+				}
+				if !unitNameRe.MatchString(unit) {
+					return nil, errors.New(gotext.Get("invalid unit name %q in %q", unit, e.Key))
+				}
+
+				// Enabled units are started too, so they can be listed in both entries.
+				prev, ok := requested[unit]
+				if ok && prev != key && (prev != enableKey || key != startKey) {
+					return nil, errors.New(gotext.Get("unit %q can't be requested to %s and %s at the same time", unit, prev, key))
+				}
+				if ok {
+					log.Debug(ctx, gotext.Get("Unit %s is already requested to %s.", unit, prev))
+					continue
+				}
+				requested[unit] = key
+			}
+		}
+	}
+
+	for _, e := range entries {
+		if key := e.Key[strings.LastIndex(e.Key, "/")+1:]; !slices.Contains(supportedKeys, key) {
+			log.Warning(ctx, gotext.Get("Encountered unsupported key '%s' while parsing services entries, skipping it", key))
+		}
+	}
+
+	return requested, nil
+}
@@ -0,0 +1,388 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/termie/go-shutil"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/services"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries     []entry.Entry
+		existing    string
+		isUser      bool
+		noSystemctl bool
+		failOn      string
+
+		wantErr bool
+	}{
+		"Enable and start units": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer\napt-daily.timer"},
+		}},
+		"Disable and stop units": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service"},
+		}},
+		"Mask and stop units": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+		}},
+		"Start units": {entries: []entry.Entry{
+			{Key: "services/start", Value: "systemd-tmpfiles-clean.service"},
+		}},
+		"Multiple entries": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer"},
+			{Key: "services/disable", Value: "cups.service"},
+			{Key: "services/mask", Value: "bluetooth.service"},
+			{Key: "services/start", Value: "systemd-tmpfiles-clean.service"},
+		}},
+		"Units already in their requested state are left untouched": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "ssh.service"},
+			{Key: "services/disable", Value: "unattended-upgrades.service"},
+			{Key: "services/start", Value: "cups.service"},
+		}},
+		"Enabled units can also be listed in started units": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer"},
+			{Key: "services/start", Value: "fstrim.timer"},
+		}},
+		"Static units are started but not enabled": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "systemd-tmpfiles-clean.service"},
+		}},
+		"Duplicated units are handled once": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service\ncups.service"},
+		}},
+		"Empty lines and spaces are ignored": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "\n  cups.service  \n\n"},
+		}},
+		"Disabled entries are ignored": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service"},
+			{Key: "services/mask", Value: "bluetooth.service", Disabled: true},
+		}},
+		"Unsupported keys are ignored": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service"},
+			{Key: "services/restart", Value: "bluetooth.service"},
+		}},
+
+		// Previously applied policy
+		"Units not listed anymore are restored": {existing: "applied"},
+		"Units still listed keep their original state": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+			{Key: "services/disable", Value: "cups.service"},
+		}, existing: "applied"},
+		"Masked unit is unmasked when enabled": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "bluetooth.service"},
+		}, existing: "applied"},
+		"Mask set by the administrator is restored": {existing: "admin-mask-removed"},
+		"Mask set by the administrator is removed when enabled": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "bluetooth.service"},
+		}, existing: "admin-mask"},
+
+		"No entries without original states is a no-op":         {},
+		"No entries does not need systemctl without any change": {noSystemctl: true},
+		"Services policy is not applied for users": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+		}, isUser: true},
+		"Services policy for users does not need systemctl": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+		}, isUser: true, noSystemctl: true},
+		"Only emit a warning when starting units fails": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer"},
+		}, failOn: "start"},
+		"Only emit a warning when stopping units fails": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service"},
+		}, failOn: "stop"},
+
+		// Error cases
+		"Error on invalid unit name": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth"},
+		}, wantErr: true},
+		"Error on unit name with path": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "../bluetooth.service"},
+		}, wantErr: true},
+		"Error on unit requested to be enabled and disabled": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "cups.service"},
+			{Key: "services/disable", Value: "cups.service"},
+		}, wantErr: true},
+		"Error on unit requested to be masked and started": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "cups.service"},
+			{Key: "services/start", Value: "cups.service"},
+		}, wantErr: true},
+		"Error on errored entry": {entries: []entry.Entry{
+			{Key: "services/mask", Err: errors.New("some error")},
+		}, wantErr: true},
+		"Error when systemctl is not available": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+		}, noSystemctl: true, wantErr: true},
+		"Error when unit is defined in the system unit directory and can't be masked": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "custom.service"},
+		}, existing: "custom-unit", wantErr: true},
+		"Error when enabling unit fails": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer"},
+		}, failOn: "enable", wantErr: true},
+		"Error when disabling unit fails": {entries: []entry.Entry{
+			{Key: "services/disable", Value: "cups.service"},
+		}, failOn: "disable", wantErr: true},
+		"Error when daemon-reload fails": {entries: []entry.Entry{
+			{Key: "services/mask", Value: "bluetooth.service"},
+		}, failOn: "daemon-reload", wantErr: true},
+		"Error on invalid original states file": {existing: "invalid-state", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+
+			systemctlCmd := mockSystemctl(t, root)
+			if tc.noSystemctl {
+				systemctlCmd = []string{"doesnotexist-systemctl"}
+			}
+
+			m := services.New(filepath.Join(root, "state"), filepath.Join(root, "system"),
+				&mockSystemdCaller{root: root, failOn: tc.failOn}, services.WithSystemctlCmd(systemctlCmd))
+			err := m.ApplyPolicy(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "ApplyPolicy should have failed but didn't")
+			} else {
+				require.NoError(t, err, "ApplyPolicy should not have failed")
+			}
+
+			testutils.CompareTreesWithFiltering(t, root, testutils.GoldenPath(t), testutils.UpdateEnabled())
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing string
+		isUser   bool
+
+		wantErr bool
+	}{
+		"Units to change": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "fstrim.timer"},
+			{Key: "services/disable", Value: "cups.service"},
+			{Key: "services/mask", Value: "bluetooth.service"},
+			{Key: "services/start", Value: "systemd-tmpfiles-clean.service"},
+		}},
+		"Units already in their requested state": {entries: []entry.Entry{
+			{Key: "services/enable", Value: "ssh.service"},
+		}},
+		"Units to restore":                         {existing: "applied"},
+		"Unit to unmask":                           {entries: []entry.Entry{{Key: "services/enable", Value: "bluetooth.service"}}, existing: "applied"},
+		"No entries without original states":       {},
+		"Services policy is not planned for users": {entries: []entry.Entry{{Key: "services/mask", Value: "bluetooth.service"}}, isUser: true},
+
+		// Error cases
+		"Error on invalid unit name": {entries: []entry.Entry{{Key: "services/mask", Value: "not a unit"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+			systemUnitDir := filepath.Join(root, "system")
+
+			m := services.New(filepath.Join(root, "state"), systemUnitDir,
+				&mockSystemdCaller{root: root, failOn: "all"}, services.WithSystemctlCmd(mockSystemctl(t, root)))
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries)
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan should not have failed")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), systemUnitDir, "SYSTEM_UNIT_DIR"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
+// setupRoot returns a fake system root, with the units states, unit directory and adsys state
+// directory of the existing testdata directory. The default units states are used if existing is empty.
+func setupRoot(t *testing.T, existing string) string {
+	t.Helper()
+
+	if existing == "" {
+		existing = "default"
+	}
+	root := filepath.Join(t.TempDir(), "root")
+	require.NoError(t,
+		shutil.CopyTree(filepath.Join("testdata", existing), root,
+			&shutil.CopyTreeOptions{Symlinks: true, CopyFunction: shutil.Copy}),
+		"Setup: can't create existing units state")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "system"), 0750), "Setup: can't create system unit directory")
+
+	return root
+}
+
+// mockSystemdCaller records the calls made to systemd in root/calls, and updates the units states in root/units.
+type mockSystemdCaller struct {
+	root   string
+	failOn string
+
+	mu sync.Mutex
+}
+
+func (s *mockSystemdCaller) StartUnit(_ context.Context, unit string) error {
+	return s.call("start", unit)
+}
+
+func (s *mockSystemdCaller) StopUnit(_ context.Context, unit string) error {
+	return s.call("stop", unit)
+}
+
+func (s *mockSystemdCaller) EnableUnit(_ context.Context, unit string) error {
+	return s.call("enable", unit)
+}
+
+func (s *mockSystemdCaller) DisableUnit(_ context.Context, unit string) error {
+	return s.call("disable", unit)
+}
+
+func (s *mockSystemdCaller) DaemonReload(_ context.Context) error {
+	return s.call("daemon-reload", "")
+}
+
+func (s *mockSystemdCaller) call(action, unit string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failOn == action || s.failOn == "all" {
+		return fmt.Errorf("failed to %s %s", action, unit)
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.root, "calls"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, strings.TrimSpace(action+" "+unit)); err != nil {
+		return err
+	}
+	if unit == "" {
+		return nil
+	}
+
+	states, err := readUnitStates(s.root)
+	if err != nil {
+		return err
+	}
+	state := states[unit]
+	switch action {
+	case "start":
+		state[1] = "active"
+	case "stop":
+		state[1] = "inactive"
+	case "enable":
+		state[0] = "enabled"
+	case "disable":
+		state[0] = "disabled"
+	}
+	states[unit] = state
+
+	var content strings.Builder
+	for _, u := range sortedKeys(states) {
+		fmt.Fprintf(&content, "%s %s %s\n", u, states[u][0], states[u][1])
+	}
+	return os.WriteFile(filepath.Join(s.root, "units"), []byte(content.String()), 0600)
+}
+
+// readUnitStates returns the unit file state and active state of each unit listed in root/units.
+func readUnitStates(root string) (map[string][2]string, error) {
+	d, err := os.ReadFile(filepath.Join(root, "units"))
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string][2]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(d)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid unit state line %q", line)
+		}
+		states[fields[0]] = [2]string{fields[1], fields[2]}
+	}
+	return states, nil
+}
+
+func sortedKeys(m map[string][2]string) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// mockSystemctl returns a mocked systemctl command, reporting the units states from root.
+func mockSystemctl(t *testing.T, root string) []string {
+	t.Helper()
+
+	return []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockSystemctl", "--", root}
+}
+
+func TestMockSystemctl(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	root, args := args[0], args[1:]
+
+	if len(args) != 4 || strings.Join(args[:3], " ") != "show --property=UnitFileState,ActiveState --" {
+		fmt.Fprintf(os.Stderr, "Error: unexpected arguments %v\n", args)
+		os.Exit(1)
+	}
+	unit := args[3]
+
+	states, err := readUnitStates(root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	// Unknown units are reported without unit file state, like systemctl does.
+	state, ok := states[unit]
+	if !ok {
+		state = [2]string{"", "inactive"}
+	}
+	// Like systemd, a symlink to /dev/null in the unit directory masks the unit.
+	if target, err := os.Readlink(filepath.Join(root, "system", unit)); err == nil && target == "/dev/null" {
+		state[0] = "masked"
+	}
+
+	fmt.Printf("ActiveState=%s\nUnitFileState=%s\n", state[1], state[0])
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+	testutils.MergeCoverages()
+}
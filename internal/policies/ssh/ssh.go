@@ -0,0 +1,400 @@
+// Package ssh provides a manager to configure the OpenSSH server of the machine.
+//
+// The policy is rendered as an sshd_config drop-in, in /etc/ssh/sshd_config.d/50-adsys.conf, covering
+// password and GSSAPI authentications, the groups allowed to log in and the login banner. The banner is
+// shipped as a policy asset, relative to the SYSVOL/ubuntu/ssh/ directory, and written to
+// /etc/ssh/adsys-banner.
+//
+// The new configuration is validated with sshd -t before the ssh service is reloaded. If the validation
+// fails, the previous configuration is restored and the service is left untouched.
+//
+// Those policies are only supported on computers.
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/plan"
+	"github.com/ubuntu/adsys/internal/smbsafe"
+	"github.com/ubuntu/decorate"
+)
+
+const (
+	passwordAuthenticationKey = "password-authentication"
+	gssapiAuthenticationKey   = "gssapi-authentication"
+	allowGroupsKey            = "allow-groups"
+	bannerKey                 = "banner"
+)
+
+var supportedKeys = []string{passwordAuthenticationKey, gssapiAuthenticationKey, allowGroupsKey, bannerKey}
+
+const (
+	// dropInName is the path of the adsys sshd configuration drop-in, relative to the ssh directory.
+	dropInName = "sshd_config.d/50-adsys.conf"
+	// bannerName is the path of the login banner, relative to the ssh directory.
+	bannerName = "adsys-banner"
+	// sshService is the systemd unit of the OpenSSH server.
+	sshService = "ssh.service"
+)
+
+// header is the header of the sshd configuration drop-in written by adsys.
+const header = `# This file is managed by adsys.
+# Do not edit this file manually.
+# Any changes will be overwritten.
+
+`
+
+// AssetsReader is a function which returns policies assets as a read-only file system.
+type AssetsReader func(relSrc string) (fs.FS, error)
+
+// Manager prevents running multiple ssh updates in parallel.
+type Manager struct {
+	sshDir       string
+	sshdCmd      []string
+	systemctlCmd []string
+
+	mu sync.Mutex // Prevents validating and reloading the sshd configuration concurrently
+}
+
+type options struct {
+	sshdCmd      []string
+	systemctlCmd []string
+}
+
+// Option reprents an optional function to change the ssh manager.
+type Option func(*options)
+
+// WithSshdCmd overrides the default sshd command.
+func WithSshdCmd(cmd []string) Option {
+	return func(o *options) {
+		o.sshdCmd = cmd
+	}
+}
+
+// WithSystemctlCmd overrides the default systemctl command.
+func WithSystemctlCmd(cmd []string) Option {
+	return func(o *options) {
+		o.systemctlCmd = cmd
+	}
+}
+
+// New returns a new ssh policy manager, writing its configuration in sshDir.
+func New(sshDir string, opts ...Option) *Manager {
+	// defaults
+	args := options{
+		sshdCmd:      []string{"sshd"},
+		systemctlCmd: []string{"systemctl"},
+	}
+	// applied options
+	for _, o := range opts {
+		o(&args)
+	}
+
+	return &Manager{
+		sshDir:       sshDir,
+		sshdCmd:      args.sshdCmd,
+		systemctlCmd: args.systemctlCmd,
+	}
+}
+
+// ApplyPolicy writes the sshd configuration drop-in and login banner from entries, validates them and
+// reloads the ssh service. If the new configuration is invalid, the previous one is restored.
+func (m *Manager) ApplyPolicy(ctx context.Context, objectName string, isComputer bool, entries []entry.Entry, assetsReader AssetsReader) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't apply ssh policy"))
+
+	// SSH policies are only supported on computers
+	if !isComputer {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dropInPath, bannerPath := filepath.Join(m.sshDir, dropInName), filepath.Join(m.sshDir, bannerName)
+
+	dropIn, banner, err := m.contents(ctx, entries, assetsReader)
+	if err != nil {
+		return err
+	}
+
+	previousDropIn, err := readIfExists(dropInPath)
+	if err != nil {
+		return err
+	}
+	previousBanner, err := readIfExists(bannerPath)
+	if err != nil {
+		return err
+	}
+	if dropIn == string(previousDropIn) && banner == string(previousBanner) {
+		log.Debug(ctx, gotext.Get("SSH configuration is up to date"))
+		return nil
+	}
+
+	log.Debugf(ctx, "Applying ssh policy to %s", objectName)
+
+	// Rollback actions are run in reverse order: this one is called once the configuration is restored.
+	journal.OnRollback(ctx, func(ctx context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		return m.reload(ctx)
+	})
+	if err := journal.Record(ctx, dropInPath, bannerPath); err != nil {
+		return err
+	}
+
+	if err := writeOrRemove(bannerPath, banner); err != nil {
+		return err
+	}
+	if err := writeOrRemove(dropInPath, dropIn); err != nil {
+		return err
+	}
+
+	if err := m.run(ctx, m.sshdCmd, "-t"); err != nil {
+		m.restore(ctx, dropInPath, previousDropIn)
+		m.restore(ctx, bannerPath, previousBanner)
+		return errors.New(gotext.Get("invalid sshd configuration, previous one restored: %v", err))
+	}
+
+	return m.reload(ctx)
+}
+
+// Plan returns the changes ApplyPolicy would make to the sshd configuration, without applying them.
+func (m *Manager) Plan(ctx context.Context, _ string, isComputer bool, entries []entry.Entry, assetsReader AssetsReader) (changes []plan.Change, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't plan ssh policy"))
+
+	if !isComputer {
+		return nil, nil
+	}
+
+	// Don't read the configuration while it is being updated.
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dropIn, banner, err := m.contents(ctx, entries, assetsReader)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		path    string
+		content string
+	}{
+		{filepath.Join(m.sshDir, bannerName), banner},
+		{filepath.Join(m.sshDir, dropInName), dropIn},
+	} {
+		if f.content == "" {
+			changes = plan.AppendRemoval(changes, f.path)
+			continue
+		}
+		if changes, err = plan.AppendFile(changes, f.path, f.content); err != nil {
+			return nil, err
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return append(changes,
+		plan.Change{Action: plan.CommandRun, Target: "sshd -t"},
+		plan.Change{Action: plan.CommandRun, Target: "systemctl try-reload-or-restart " + sshService}), nil
+}
+
+// contents returns the sshd configuration drop-in and the login banner generated from entries.
+// They are empty if there are no enabled entries, or no banner.
+func (m *Manager) contents(ctx context.Context, entries []entry.Entry, assetsReader AssetsReader) (dropIn, banner string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to parse ssh entries"))
+
+	settings := make(map[string]string)
+	for _, e := range entries {
+		key := e.Key[strings.LastIndex(e.Key, "/")+1:]
+		if !slices.Contains(supportedKeys, key) {
+			log.Warning(ctx, gotext.Get("Encountered unsupported key '%s' while parsing ssh entries, skipping it", key))
+			continue
+		}
+		if e.Disabled {
+			log.Debug(ctx, gotext.Get("The entry %q is disabled and will be skipped", e.Key))
+			continue
+		}
+		if e.Err != nil {
+			return "", "", errors.New(gotext.Get("entry %q is errored: %v", e.Key, e.Err))
+		}
+		settings[key] = strings.TrimSpace(e.Value)
+	}
+
+	var content strings.Builder
+	for _, s := range []struct {
+		key       string
+		directive string
+	}{
+		{passwordAuthenticationKey, "PasswordAuthentication"},
+		{gssapiAuthenticationKey, "GSSAPIAuthentication"},
+	} {
+		v, ok := settings[s.key]
+		if !ok {
+			continue
+		}
+		if v != "yes" && v != "no" {
+			return "", "", errors.New(gotext.Get("invalid value %q for %s, expected yes or no", v, s.key))
+		}
+		fmt.Fprintf(&content, "%s %s\n", s.directive, v)
+	}
+
+	if v, ok := settings[allowGroupsKey]; ok {
+		var groups []string
+		for _, g := range splitAndNormalizeGroups(ctx, v) {
+			// Group names from the domain may contain spaces
+			if strings.ContainsAny(g, " \t") {
+				g = `"` + g + `"`
+			}
+			if slices.Contains(groups, g) {
+				continue
+			}
+			groups = append(groups, g)
+		}
+		if len(groups) > 0 {
+			fmt.Fprintf(&content, "AllowGroups %s\n", strings.Join(groups, " "))
+		}
+	}
+
+	if v, ok := settings[bannerKey]; ok && v != "" {
+		if banner, err = readBanner(v, assetsReader); err != nil {
+			return "", "", err
+		}
+		fmt.Fprintf(&content, "Banner %s\n", filepath.Join(m.sshDir, bannerName))
+	}
+
+	if content.Len() == 0 {
+		return "", "", nil
+	}
+	return header + content.String(), banner, nil
+}
+
+// readBanner returns the content of the banner asset relative to the ssh assets directory.
+func readBanner(name string, assetsReader AssetsReader) (banner string, err error) {
+	defer decorate.OnError(&err, gotext.Get("can't read banner %q", name))
+
+	if !fs.ValidPath(name) {
+		return "", errors.New(gotext.Get("banner path must be relative to the ssh assets directory"))
+	}
+	assets, err := assetsReader("ssh/")
+	if err != nil {
+		return "", err
+	}
+	d, err := fs.ReadFile(assets, name)
+	if err != nil {
+		return "", err
+	}
+	if len(d) == 0 {
+		return "", errors.New(gotext.Get("banner is empty"))
+	}
+
+	return string(d), nil
+}
+
+// splitAndNormalizeGroups splits v on lines and commas, and normalizes each group name like the privilege
+// manager does: invalid characters are removed and domain\group becomes group@domain.
+func splitAndNormalizeGroups(ctx context.Context, v string) []string {
+	var groups []string
+	for _, g := range strings.Split(strings.ReplaceAll(v, "\n", ","), ",") {
+		initialValue := g
+		// Invalid chars in Windows group names: '/[]:|<>+=;,?*%"
+		for _, c := range []string{"/", "[", "]", ":", "|", "<", ">", "=", ";", "?", "*", "%", `"`} {
+			g = strings.ReplaceAll(g, c, "")
+		}
+
+		// domain\group becomes group@domain
+		dg := strings.SplitN(g, `\`, 2)
+		if len(dg) == 2 {
+			g = fmt.Sprintf("%s@%s", dg[1], dg[0])
+			g = strings.ReplaceAll(g, `\`, "")
+		}
+
+		g = strings.TrimSpace(g)
+		if g == "" {
+			continue
+		}
+		if g != strings.TrimSpace(initialValue) {
+			log.Warningf(ctx, "Changed group %q to %q: Invalid characters or domain\\group format", initialValue, g)
+		}
+		groups = append(groups, g)
+	}
+
+	return groups
+}
+
+// restore puts back the previous content of path, or removes it if there was none.
+func (m *Manager) restore(ctx context.Context, path string, previous []byte) {
+	if err := writeOrRemove(path, string(previous)); err != nil {
+		log.Warning(ctx, gotext.Get("Couldn't restore previous ssh configuration: %v", err))
+	}
+}
+
+// reload reloads the ssh service if it is running, so that it uses the new configuration.
+func (m *Manager) reload(ctx context.Context) error {
+	if err := m.run(ctx, m.systemctlCmd, "try-reload-or-restart", sshService); err != nil {
+		return errors.New(gotext.Get("failed to reload %s: %v", sshService, err))
+	}
+	return nil
+}
+
+// run runs cmd with args and returns its combined output in the error, if any.
+func (m *Manager) run(ctx context.Context, cmd []string, args ...string) error {
+	// #nosec G204 - We are in control of the arguments
+	c := exec.CommandContext(ctx, cmd[0], append(slices.Clone(cmd[1:]), args...)...)
+	smbsafe.WaitExec()
+	out, err := c.CombinedOutput()
+	smbsafe.DoneExec()
+	if msg := strings.TrimSpace(string(out)); err != nil && msg != "" {
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return err
+}
+
+// readIfExists returns the content of path, or nil if it doesn't exist.
+func readIfExists(path string) ([]byte, error) {
+	d, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return d, err
+}
+
+// writeOrRemove writes content to path if it changed, or removes path if content is empty.
+func writeOrRemove(path, content string) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't update %s", path))
+
+	if content == "" {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if old, err := os.ReadFile(path); err == nil && string(old) == content {
+		return nil
+	}
+
+	// #nosec G301 - /etc/ssh/sshd_config.d permissions are 0755, so we should keep the same pattern.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// #nosec G306 - This file needs to be world-readable, like other sshd configuration files.
+	if err := os.WriteFile(path+".new", []byte(content), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".new", path)
+}
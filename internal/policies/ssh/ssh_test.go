@@ -0,0 +1,283 @@
+package ssh_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/adsys/internal/policies/journal"
+	"github.com/ubuntu/adsys/internal/policies/ssh"
+	"github.com/ubuntu/adsys/internal/testutils"
+)
+
+// fullConfig are entries setting all supported ssh settings.
+var fullConfig = []entry.Entry{
+	{Key: "ssh/password-authentication", Value: "no"},
+	{Key: "ssh/gssapi-authentication", Value: "yes"},
+	{Key: "ssh/allow-groups", Value: `EXAMPLE\Linux Admins`},
+	{Key: "ssh/banner", Value: "banner.txt"},
+}
+
+func TestApplyPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries     []entry.Entry
+		existing    bool
+		isUser      bool
+		noAssets    bool
+		sshdFails   bool
+		reloadFails bool
+		noSshd      bool
+		rollback    bool
+
+		wantErr bool
+	}{
+		"Disable password authentication": {entries: []entry.Entry{{Key: "ssh/password-authentication", Value: "no"}}},
+		"Enable GSSAPI authentication":    {entries: []entry.Entry{{Key: "ssh/gssapi-authentication", Value: "yes"}}},
+		"Allow groups are normalized": {entries: []entry.Entry{
+			{Key: "ssh/allow-groups", Value: "EXAMPLE\\Linux Admins\nops@example.com, %wheel\n\n  sysadmins  \nEXAMPLE\\Linux Admins\ninvalid*chars?"},
+		}},
+		"Banner from assets": {entries: []entry.Entry{{Key: "ssh/banner", Value: "banner.txt"}}},
+		"Banner from assets subdirectory": {entries: []entry.Entry{
+			{Key: "ssh/banner", Value: "banners/legal.txt"},
+		}},
+		"All settings":       {entries: fullConfig},
+		"Values are trimmed": {entries: []entry.Entry{{Key: "ssh/password-authentication", Value: "  no\n"}}},
+		"Disabled entries are ignored": {entries: []entry.Entry{
+			{Key: "ssh/password-authentication", Value: "no"},
+			{Key: "ssh/banner", Value: "banner.txt", Disabled: true},
+		}},
+		"Unsupported keys are ignored": {entries: []entry.Entry{
+			{Key: "ssh/password-authentication", Value: "no"},
+			{Key: "ssh/permit-root-login", Value: "yes"},
+		}},
+		"Empty allow groups are ignored": {entries: []entry.Entry{
+			{Key: "ssh/password-authentication", Value: "no"},
+			{Key: "ssh/allow-groups", Value: "\n , \n"},
+		}},
+		"Banner assets are not needed without banner": {entries: []entry.Entry{{Key: "ssh/password-authentication", Value: "no"}}, noAssets: true},
+		"Replace existing configuration": {entries: []entry.Entry{
+			{Key: "ssh/gssapi-authentication", Value: "no"},
+		}, existing: true},
+		"Unchanged configuration is not reloaded": {entries: fullConfig, existing: true},
+
+		"No entries without existing configuration is a no-op": {noSshd: true},
+		"No entries removes existing configuration":            {existing: true},
+		"All entries disabled removes existing configuration": {entries: []entry.Entry{
+			{Key: "ssh/password-authentication", Value: "no", Disabled: true},
+		}, existing: true},
+		"SSH policy is not applied for users": {entries: fullConfig, isUser: true, noSshd: true},
+		"Rollback restores configuration and reloads ssh": {entries: []entry.Entry{
+			{Key: "ssh/gssapi-authentication", Value: "no"},
+		}, existing: true, rollback: true},
+
+		// Error cases
+		"Error on invalid password authentication value":        {entries: []entry.Entry{{Key: "ssh/password-authentication", Value: "maybe"}}, wantErr: true},
+		"Error on invalid GSSAPI authentication value":          {entries: []entry.Entry{{Key: "ssh/gssapi-authentication", Value: "true"}}, wantErr: true},
+		"Error on errored entry":                                {entries: []entry.Entry{{Key: "ssh/allow-groups", Err: errors.New("some error")}}, wantErr: true},
+		"Error on missing banner asset":                         {entries: []entry.Entry{{Key: "ssh/banner", Value: "doesnotexist.txt"}}, wantErr: true},
+		"Error on empty banner asset":                           {entries: []entry.Entry{{Key: "ssh/banner", Value: "empty.txt"}}, wantErr: true},
+		"Error on absolute banner path":                         {entries: []entry.Entry{{Key: "ssh/banner", Value: "/etc/issue"}}, wantErr: true},
+		"Error on banner path outside of assets":                {entries: []entry.Entry{{Key: "ssh/banner", Value: "../banner.txt"}}, wantErr: true},
+		"Error on banner without assets":                        {entries: []entry.Entry{{Key: "ssh/banner", Value: "banner.txt"}}, noAssets: true, wantErr: true},
+		"Error on validation failure removes new configuration": {entries: fullConfig, sshdFails: true, wantErr: true},
+		"Error on validation failure restores previous configuration": {entries: []entry.Entry{
+			{Key: "ssh/gssapi-authentication", Value: "no"},
+		}, existing: true, sshdFails: true, wantErr: true},
+		"Error when sshd is not available": {entries: fullConfig, noSshd: true, wantErr: true},
+		"Error when reloading ssh fails":   {entries: fullConfig, reloadFails: true, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+
+			sshdCmd := mockCmd(t, "sshd", root, tc.sshdFails)
+			if tc.noSshd {
+				sshdCmd = []string{"doesnotexist-sshd"}
+			}
+			systemctlCmd := mockCmd(t, "systemctl", root, tc.reloadFails)
+
+			assetsReader := assetsFrom(filepath.Join("testdata", "assets"))
+			if tc.noAssets {
+				assetsReader = func(string) (fs.FS, error) { return nil, errors.New("no assets attached") }
+			}
+
+			ctx := context.Background()
+			var j *journal.Journal
+			if tc.rollback {
+				var err error
+				j, err = journal.New(filepath.Join(t.TempDir(), "journal"))
+				require.NoError(t, err, "Setup: can't create journal")
+				ctx = journal.WithJournal(ctx, j)
+			}
+
+			m := ssh.New(filepath.Join(root, "etc", "ssh"), ssh.WithSshdCmd(sshdCmd), ssh.WithSystemctlCmd(systemctlCmd))
+			err := m.ApplyPolicy(ctx, "ubuntu", !tc.isUser, tc.entries, assetsReader)
+			if tc.wantErr {
+				require.Error(t, err, "ApplyPolicy should have failed but didn't")
+			} else {
+				require.NoError(t, err, "ApplyPolicy should not have failed")
+			}
+
+			if tc.rollback {
+				require.NoError(t, j.Rollback(context.Background()), "Rollback should not have failed")
+			}
+
+			// The banner is referenced by its absolute path in the configuration
+			replaceInDropIn(t, root, root, "ROOT")
+			testutils.CompareTreesWithFiltering(t, root, testutils.GoldenPath(t), testutils.UpdateEnabled())
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		entries  []entry.Entry
+		existing bool
+		isUser   bool
+
+		wantErr bool
+	}{
+		"New configuration": {entries: fullConfig},
+		"Modified configuration": {entries: []entry.Entry{
+			{Key: "ssh/gssapi-authentication", Value: "no"},
+		}, existing: true},
+		"Unchanged configuration":              {entries: fullConfig, existing: true},
+		"No entries with a configuration":      {existing: true},
+		"No entries without any configuration": {},
+		"SSH policy is not planned for users":  {entries: fullConfig, isUser: true},
+
+		// Error cases
+		"Error on invalid value":        {entries: []entry.Entry{{Key: "ssh/password-authentication", Value: "maybe"}}, wantErr: true},
+		"Error on missing banner asset": {entries: []entry.Entry{{Key: "ssh/banner", Value: "doesnotexist.txt"}}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			root := setupRoot(t, tc.existing)
+
+			m := ssh.New(filepath.Join(root, "etc", "ssh"),
+				ssh.WithSshdCmd([]string{"this-should-not-be-called"}),
+				ssh.WithSystemctlCmd([]string{"this-should-not-be-called"}))
+			changes, err := m.Plan(context.Background(), "ubuntu", !tc.isUser, tc.entries, assetsFrom(filepath.Join("testdata", "assets")))
+			if tc.wantErr {
+				require.Error(t, err, "Plan should have failed but didn't")
+				return
+			}
+			require.NoError(t, err, "Plan should not have failed")
+
+			var got strings.Builder
+			for _, c := range changes {
+				fmt.Fprintln(&got, strings.ReplaceAll(c.String(), root, "ROOT"))
+			}
+			want := testutils.LoadWithUpdateFromGolden(t, got.String())
+			require.Equal(t, want, got.String(), "Plan returned unexpected changes")
+		})
+	}
+}
+
+// setupRoot returns a fake system root, with the ssh configuration of testdata/existing if existing is set.
+func setupRoot(t *testing.T, existing bool) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if !existing {
+		return root
+	}
+	testutils.Copy(t, filepath.Join("testdata", "existing", "etc"), filepath.Join(root, "etc"))
+	replaceInDropIn(t, root, "ROOT", root)
+
+	return root
+}
+
+// replaceInDropIn replaces from with to in the adsys drop-in of root, if it exists.
+func replaceInDropIn(t *testing.T, root, from, to string) {
+	t.Helper()
+
+	p := filepath.Join(root, "etc", "ssh", "sshd_config.d", "50-adsys.conf")
+	d, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	require.NoError(t, err, "Setup: can't read adsys drop-in")
+	require.NoError(t, os.WriteFile(p, []byte(strings.ReplaceAll(string(d), from, to)), 0600), "Setup: can't update adsys drop-in")
+}
+
+// assetsFrom returns an assets reader serving the policies assets stored in dir.
+func assetsFrom(dir string) ssh.AssetsReader {
+	return func(relSrc string) (fs.FS, error) {
+		relSrc = strings.TrimSuffix(relSrc, "/")
+		if _, err := os.Stat(filepath.Join(dir, relSrc)); err != nil {
+			return nil, err
+		}
+		return os.DirFS(filepath.Join(dir, relSrc)), nil
+	}
+}
+
+// mockCmd returns a mocked sshd or systemctl command, logging its calls to root/calls.
+// If fail is set, the command fails after logging its call.
+func mockCmd(t *testing.T, name, root string, fail bool) []string {
+	t.Helper()
+
+	return []string{"env", "GO_WANT_HELPER_PROCESS=1", os.Args[0], "-test.run=TestMockCmd", "--", name, root, fmt.Sprint(fail)}
+}
+
+func TestMockCmd(_ *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	defer os.Exit(0)
+
+	args := os.Args
+	for len(args) > 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		args = args[1:]
+	}
+	name, root, fail, args := args[0], args[1], args[2], args[3:]
+
+	f, err := os.OpenFile(filepath.Join(root, "calls"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "can't open calls file: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	// Log the configuration sshd validates, as it is restored on failure.
+	var config string
+	if name == "sshd" {
+		d, err := os.ReadFile(filepath.Join(root, "etc", "ssh", "sshd_config.d", "50-adsys.conf"))
+		if err != nil {
+			d = []byte("no adsys configuration\n")
+		}
+		config = fmt.Sprintf("\n%s", strings.ReplaceAll(string(d), root, "ROOT"))
+	}
+	fmt.Fprintf(f, "%s %s%s\n", name, strings.Join(args, " "), config)
+
+	if fail == "true" {
+		fmt.Fprintf(os.Stderr, "%s failed\n", name)
+		os.Exit(1)
+	}
+}
+
+func TestMain(m *testing.M) {
+	m.Run()
+	testutils.MergeCoverages()
+}
@@ -0,0 +1,169 @@
+package policies
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/leonelquinteros/gotext"
+	log "github.com/ubuntu/adsys/internal/grpc/logstreamer"
+	"github.com/ubuntu/adsys/internal/policies/entry"
+	"github.com/ubuntu/decorate"
+	"gopkg.in/yaml.v3"
+)
+
+// ManagerStatus is the outcome of the last application of the policies of a manager to an object.
+type ManagerStatus struct {
+	LastAttempt time.Time  `json:"last_attempt" yaml:"last_attempt"`
+	LastSuccess *time.Time `json:"last_success,omitempty" yaml:"last_success,omitempty"`
+	// Error is the reason of the last attempt failure. It is empty if the last attempt succeeded.
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Rules is the number of rules applied on last success.
+	Rules int `json:"rules" yaml:"rules"`
+	// Items is the outcome of the last attempt for each item handled by the manager, like packages.
+	// It is only recorded by managers reporting them.
+	Items map[string]string `json:"items,omitempty" yaml:"items,omitempty"`
+}
+
+// ObjectStatus is the status of each policy manager for an object, indexed by policy type.
+type ObjectStatus map[string]ManagerStatus
+
+// Status returns the status of each policy manager for objectName, as recorded on the last policies applications.
+// It is empty if no policy was ever applied to objectName.
+func (m *Manager) Status(objectName string) (status ObjectStatus, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to load policies status for %q", objectName))
+
+	status = make(ObjectStatus)
+	d, err := os.ReadFile(filepath.Join(m.statusDir, objectName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return status, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(d, &status); err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// PoliciesStatus displays the status of each policy manager for objectName, as recorded on the last policies
+// applications.
+func (m *Manager) PoliciesStatus(ctx context.Context, objectName string) (msg string, err error) {
+	defer decorate.OnError(&err, gotext.Get("failed to get policies status for %q", objectName))
+
+	log.Infof(ctx, "Getting policies status for %s", objectName)
+
+	status, err := m.Status(objectName)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	FormatStatus(&out, objectName, status)
+	return out.String(), nil
+}
+
+// FormatStatus writes to w the status of each policy manager for objectName, ordered by policy type.
+func FormatStatus(w io.Writer, objectName string, status ObjectStatus) {
+	if len(status) == 0 {
+		fmt.Fprintln(w, gotext.Get("No policies applied for %s", objectName))
+		return
+	}
+
+	fmt.Fprintln(w, gotext.Get("Policies status for %s:", objectName))
+	policyTypes := make([]string, 0, len(status))
+	for t := range status {
+		policyTypes = append(policyTypes, t)
+	}
+	slices.Sort(policyTypes)
+	for _, t := range policyTypes {
+		s := status[t]
+		result := gotext.Get("succeeded")
+		if s.Error != "" {
+			result = gotext.Get("failed")
+		}
+		fmt.Fprintf(w, "* %s: %s\n", t, result)
+		fmt.Fprintln(w, gotext.Get("** last attempt: %s", s.LastAttempt.UTC().Format(time.RFC3339)))
+		lastSuccess := gotext.Get("never")
+		if s.LastSuccess != nil {
+			lastSuccess = s.LastSuccess.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintln(w, gotext.Get("** last success: %s", lastSuccess))
+		fmt.Fprintln(w, gotext.Get("** rules applied: %d", s.Rules))
+		if s.Error != "" {
+			fmt.Fprintln(w, gotext.Get("** error: %s", s.Error))
+		}
+		items := make([]string, 0, len(s.Items))
+		for item := range s.Items {
+			items = append(items, item)
+		}
+		slices.Sort(items)
+		for _, item := range items {
+			fmt.Fprintf(w, "** %s: %s\n", item, s.Items[item])
+		}
+	}
+}
+
+// recordStatus updates the status of objectName with the outcome of each policy manager which attempted
+// to apply its rules.
+// results are the errors returned by each manager, and items the outcome of each item of the managers reporting them.
+// applyErr is the error of the whole application: if it failed, the changes of the managers which succeeded were
+// rolled back.
+// Failing to record the status is only logged, as it should not prevent policies to be applied.
+func (m *Manager) recordStatus(ctx context.Context, objectName string, rules map[string][]entry.Entry, results map[string]error, items map[string]map[string]string, applyErr error) {
+	if len(results) == 0 {
+		return
+	}
+
+	status, err := m.Status(objectName)
+	if err != nil {
+		log.Warning(ctx, gotext.Get("Resetting policies status: %v", err))
+		status = make(ObjectStatus)
+	}
+
+	now := time.Now()
+	for t, errManager := range results {
+		s := status[t]
+		s.LastAttempt = now
+		s.Items = items[t]
+		switch {
+		case errManager != nil:
+			s.Error = errManager.Error()
+		case applyErr != nil:
+			s.Error = gotext.Get("rolled back: %v", applyErr)
+		default:
+			s.Error = ""
+			s.LastSuccess = &now
+			s.Rules = len(rules[t])
+		}
+		status[t] = s
+	}
+
+	if err := m.saveStatus(objectName, status); err != nil {
+		log.Warning(ctx, gotext.Get("Failed to record policies status for %s: %v", objectName, err))
+	}
+}
+
+// saveStatus atomically writes the status of objectName.
+func (m *Manager) saveStatus(objectName string, status ObjectStatus) (err error) {
+	defer decorate.OnError(&err, gotext.Get("can't save policies status"))
+
+	d, err := yaml.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	p := filepath.Join(m.statusDir, objectName)
+	if err := os.WriteFile(p+".new", d, 0600); err != nil {
+		return err
+	}
+	return os.Rename(p+".new", p)
+}
@@ -45,6 +45,7 @@ func FormatBackendCalls(t *testing.T, backend backends.Backend) string {
 	got.WriteString(hostKrb5CCNameLine)
 
 	got.WriteString(fmt.Sprintf("* DefaultDomainSuffix(): %s\n", backend.DefaultDomainSuffix()))
+	got.WriteString(fmt.Sprintf("* Site(): %s\n", backend.Site()))
 	got.WriteString(fmt.Sprintf("* Config():\n%s\n", backend.Config()))
 
 	return got.String()
@@ -0,0 +1,56 @@
+package testutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// Krb5CC returns the content of a version 4 FILE credential cache for user@REALM, holding a ticket granting ticket
+// valid from start to end. The ticket is renewable if renewTill is not zero.
+func Krb5CC(principal string, start, end, renewTill time.Time) []byte {
+	user, realm, _ := strings.Cut(principal, "@")
+
+	var b bytes.Buffer
+	w := func(v any) {
+		// Writing to a bytes.Buffer never fails
+		_ = binary.Write(&b, binary.BigEndian, v)
+	}
+	data := func(d string) {
+		w(uint32(len(d)))
+		b.WriteString(d)
+	}
+	writePrincipal := func(components ...string) {
+		w(uint32(1))
+		w(uint32(len(components)))
+		data(realm)
+		for _, c := range components {
+			data(c)
+		}
+	}
+
+	// Version and empty header
+	w(uint16(0x0504))
+	w(uint16(0))
+	writePrincipal(user)
+
+	writePrincipal(user)
+	writePrincipal("krbtgt", realm)
+	w(uint16(18))
+	data("0123456789abcdef0123456789abcdef")
+	var flags, renew uint32
+	if !renewTill.IsZero() {
+		flags, renew = 0x00800000, uint32(renewTill.Unix())
+	}
+	w([]uint32{uint32(start.Unix()), uint32(start.Unix()), uint32(end.Unix()), renew})
+	w(uint8(0))
+	w(flags)
+	// No address nor authorization data
+	w(uint32(0))
+	w(uint32(0))
+	data("ticket")
+	data("")
+
+	return b.Bytes()
+}
@@ -60,6 +60,20 @@ func (m MockAssetsDumper) SaveAssetsTo(_ context.Context, relSrc, dest string, _
 	return shutil.CopyTree(fmt.Sprintf("testdata/sysvol-%s", m.Path), dest, nil)
 }
 
+// ReadAssets returns policy assets as a read-only file system, without uncompressing them.
+// It returns an error if the Err field is set to true.
+// It returns an error if Path is different than the relSrc exercised by the manager.
+func (m MockAssetsDumper) ReadAssets(relSrc string) (fs.FS, error) {
+	if m.Err {
+		return nil, errors.New("ReadAssets error")
+	}
+
+	if relSrc != m.Path {
+		return nil, fmt.Errorf("ReadAssets: unexpected relSrc: %q", relSrc)
+	}
+	return os.DirFS(fmt.Sprintf("testdata/sysvol-%s", m.Path)), nil
+}
+
 // MockSystemdCaller is a mock implementation of the systemd caller interface.
 // It is embedded in manager tests which implement subsets of the systemd caller interface according to their needs.
 type MockSystemdCaller struct{}
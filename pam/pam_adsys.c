@@ -63,19 +63,20 @@ static int update_policy(pam_handle_t *pamh, const char *username, const char *k
     }
 
     char **arggv;
-    arggv = calloc(6, sizeof(char *));
+    arggv = calloc(7, sizeof(char *));
     if (arggv == NULL) {
         return PAM_BUF_ERR;
     }
 
     arggv[0] = "/sbin/adsysctl";
     arggv[1] = "update";
-    arggv[2] = (char *)(username);
-    arggv[3] = (char *)(krb5ccname);
-    arggv[4] = NULL;
+    arggv[2] = "--login";
+    arggv[3] = (char *)(username);
+    arggv[4] = (char *)(krb5ccname);
+    arggv[5] = NULL;
     if (debug) {
-        arggv[4] = "-vv";
-        arggv[5] = NULL;
+        arggv[5] = "-vv";
+        arggv[6] = NULL;
     }
 
     pid_t pid = fork();